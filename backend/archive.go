@@ -36,6 +36,7 @@ const (
 )
 
 type FileMeta struct {
+	Name         string `json:"name,omitempty"`          // original filename
 	Provider     string `json:"provider,omitempty"`      // "s3"|"minio"|"local"
 	Bucket       string `json:"bucket,omitempty"`        // bucket name
 	Key          string `json:"key,omitempty"`           // object key
@@ -71,22 +72,325 @@ type DocumentTag struct {
 	TagID      int64 `db:"tag_id" json:"tag_id"`
 }
 
+// DocumentPermission — личный доступ к документу. CanShare разрешает выдавать доступ дальше;
+// ExpiresAt == nil — бессрочно, истёкший доступ не действует.
 type DocumentPermission struct {
-	DocumentID int64 `db:"document_id" json:"document_id"`
-	UserID     int64 `db:"user_id" json:"user_id"`
-	CanView    bool  `db:"can_view" json:"can_view"`
-	CanEdit    bool  `db:"can_edit" json:"can_edit"`
+	DocumentID int64      `db:"document_id" json:"document_id"`
+	UserID     int64      `db:"user_id" json:"user_id"`
+	CanView    bool       `db:"can_view" json:"can_view"`
+	CanEdit    bool       `db:"can_edit" json:"can_edit"`
+	CanShare   bool       `db:"can_share" json:"can_share"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+}
+
+// DocumentGroupPermission — права на документ для всех участников группы
+type DocumentGroupPermission struct {
+	DocumentID int64      `db:"document_id" json:"document_id"`
+	GroupID    int64      `db:"group_id" json:"group_id"`
+	CanView    bool       `db:"can_view" json:"can_view"`
+	CanEdit    bool       `db:"can_edit" json:"can_edit"`
+	CanShare   bool       `db:"can_share" json:"can_share"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+}
+
+// DocumentGrant — строка списка доступов к документу: пользователь (GranteeType = "user")
+// или группа ("group"); поля другого вида пустые
+type DocumentGrant struct {
+	GranteeType string     `db:"grantee_type" json:"grantee_type"`
+	UserID      *int64     `db:"user_id" json:"user_id,omitempty"`
+	Login       *string    `db:"login" json:"login,omitempty"`
+	FullName    *string    `db:"full_name" json:"full_name,omitempty"`
+	GroupID     *int64     `db:"group_id" json:"group_id,omitempty"`
+	GroupName   *string    `db:"group_name" json:"group_name,omitempty"`
+	CanView     bool       `db:"can_view" json:"can_view"`
+	CanEdit     bool       `db:"can_edit" json:"can_edit"`
+	CanShare    bool       `db:"can_share" json:"can_share"`
+	ExpiresAt   *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+}
+
+// SharedDocument — документ, доступный пользователю только по явному доступу.
+// Уровень сведён по личным и групповым доступам; ViaGroups — группы, через которые он получен.
+type SharedDocument struct {
+	ID             int64       `db:"id" json:"id"`
+	Title          string      `db:"title" json:"title"`
+	Privacy        PrivacyType `db:"privacy" json:"privacy"`
+	UpdatedAt      *time.Time  `db:"updated_at" json:"updated_at,omitempty"`
+	DocumentDate   *time.Time  `db:"document_date" json:"document_date,omitempty"`
+	TypeID         *int64      `db:"type_id" json:"type_id,omitempty"`
+	Author         *string     `db:"author" json:"author,omitempty"`
+	CreatedBy      *int64      `db:"created_by" json:"created_by,omitempty"`
+	CreatedByLogin *string     `db:"created_by_login" json:"created_by_login,omitempty"`
+	Access         string      `json:"access"` // view|edit
+	CanEdit        bool        `db:"can_edit" json:"can_edit"`
+	CanShare       bool        `db:"can_share" json:"can_share"`
+	ExpiresAt      *time.Time  `db:"expires_at" json:"expires_at,omitempty"`
+	ViaGroups      []string    `db:"via_groups" json:"via_groups"`
+}
+
+// TrashItem — документ в корзине; окончательно удаляется через retention после DeletedAt
+type TrashItem struct {
+	ID             int64       `db:"id" json:"id"`
+	Title          string      `db:"title" json:"title"`
+	Privacy        PrivacyType `db:"privacy" json:"privacy"`
+	DocumentDate   *time.Time  `db:"document_date" json:"document_date,omitempty"`
+	TypeID         *int64      `db:"type_id" json:"type_id,omitempty"`
+	Author         *string     `db:"author" json:"author,omitempty"`
+	CreatedBy      *int64      `db:"created_by" json:"created_by,omitempty"`
+	CreatedByLogin *string     `db:"created_by_login" json:"created_by_login,omitempty"`
+	DeletedAt      time.Time   `db:"deleted_at" json:"deleted_at"`
+	DeletedBy      *int64      `db:"deleted_by" json:"deleted_by,omitempty"`
+	DeletedByLogin *string     `db:"deleted_by_login" json:"deleted_by_login,omitempty"`
+}
+
+// AccessRequest — запрос доступа к документу. Level: view|edit;
+// Status: pending|approved|rejected|cancelled
+type AccessRequest struct {
+	ID              int64      `db:"id" json:"id"`
+	DocumentID      int64      `db:"document_id" json:"document_id"`
+	DocumentTitle   string     `db:"document_title" json:"document_title"`
+	UserID          int64      `db:"user_id" json:"user_id"`
+	UserLogin       string     `db:"user_login" json:"user_login"`
+	UserFullName    *string    `db:"user_full_name" json:"user_full_name,omitempty"`
+	Level           string     `db:"level" json:"level"`
+	Reason          *string    `db:"reason" json:"reason,omitempty"`
+	Status          string     `db:"status" json:"status"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	DecidedAt       *time.Time `db:"decided_at" json:"decided_at,omitempty"`
+	DecidedBy       *int64     `db:"decided_by" json:"decided_by,omitempty"`
+	DecidedByLogin  *string    `db:"decided_by_login" json:"decided_by_login,omitempty"`
+	DecisionComment *string    `db:"decision_comment" json:"decision_comment,omitempty"`
+	GrantExpiresAt  *time.Time `db:"grant_expires_at" json:"grant_expires_at,omitempty"`
+}
+
+// AccessDecision — решение по запросу доступа; ExpiresAt — срок выдаваемого доступа
+type AccessDecision struct {
+	Approve   bool       `json:"-"`
+	Comment   *string    `json:"comment"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// DocumentFile — вложение документа. Role: original|transcript|preview|attachment;
+// Position — порядок в списке с 1
+type DocumentFile struct {
+	ID          int64      `db:"id" json:"id"`
+	DocumentID  int64      `db:"-" json:"document_id"`
+	Position    int        `db:"position" json:"position"`
+	Role        string     `db:"role" json:"role"`
+	FileMeta    FileMeta   `db:"-" json:"file_meta"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	CreatedBy   *int64     `db:"created_by" json:"created_by,omitempty"`
+	UpdatedAt   *time.Time `db:"updated_at" json:"updated_at,omitempty"`
+	UpdatedBy   *int64     `db:"updated_by" json:"updated_by,omitempty"`
+	DownloadURL string     `db:"-" json:"download_url,omitempty"`
+}
+
+// SharedFile — файл документа (основной при FileID == nil или вложение) и другие документы,
+// где тот же объект хранилища — основной файл или вложение. RefCount — все ссылки
+// на объект, включая версии и документы, недоступные запрашивающему
+type SharedFile struct {
+	FileID    *int64          `json:"file_id,omitempty"`
+	Sha256    string          `json:"sha256,omitempty"`
+	RefCount  int             `json:"ref_count"`
+	Documents []SharedFileRef `json:"documents"`
+}
+
+// SharedFileRef — документ с тем же файлом; FileID — вложение, nil — основной файл
+type SharedFileRef struct {
+	DocumentID  int64  `json:"document_id"`
+	Title       string `json:"title"`
+	FileID      *int64 `json:"file_id,omitempty"`
+	DownloadURL string `json:"download_url"`
+}
+
+// DocumentVersion — снимок документа после изменения. ChangeKind: create|update|restore|files
+// (files — изменён список вложений);
+// RestoredFrom — номер версии, из которой восстановлено. Файл версии доступен по DownloadURL.
+// Files — вложения версии (заполняется только для одной версии)
+type DocumentVersion struct {
+	DocumentID     int64            `db:"-" json:"document_id"`
+	Version        int64            `db:"version" json:"version"`
+	Title          string           `db:"title" json:"title"`
+	Privacy        PrivacyType      `db:"privacy" json:"privacy"`
+	DocumentDate   *time.Time       `db:"document_date" json:"document_date,omitempty"`
+	Author         *string          `db:"author" json:"author,omitempty"`
+	TypeID         *int64           `db:"type_id" json:"type_id,omitempty"`
+	FileMeta       *FileMeta        `db:"-" json:"file_meta,omitempty"`
+	GeoJSON        *json.RawMessage `db:"geojson" json:"geojson,omitempty"`
+	Tags           []string         `db:"-" json:"tags"`
+	CreatedAt      time.Time        `db:"created_at" json:"created_at"`
+	CreatedBy      *int64           `db:"created_by" json:"created_by,omitempty"`
+	CreatedByLogin *string          `db:"created_by_login" json:"created_by_login,omitempty"`
+	ChangeKind     string           `db:"change_kind" json:"change_kind"`
+	RestoredFrom   *int64           `db:"restored_from" json:"restored_from,omitempty"`
+	IsCurrent      bool             `db:"is_current" json:"is_current"`
+	DownloadURL    string           `db:"-" json:"download_url,omitempty"`
+	Files          []VersionFile    `db:"-" json:"files,omitempty"`
+}
+
+// VersionFile — вложение в составе версии; FileID — id вложения на момент снимка
+type VersionFile struct {
+	FileID   int64    `db:"file_id" json:"file_id"`
+	Position int      `db:"position" json:"position"`
+	Role     string   `db:"role" json:"role"`
+	FileMeta FileMeta `db:"-" json:"file_meta"`
+}
+
+// Upload — загрузка файла в обход формы документа: возобновляемая (tus) или прямая
+// в хранилище по подписанной ссылке (direct). Offset — сколько байт уже принято;
+// Parts и HashState — внутреннее состояние сборки файла в хранилище (tus).
+// Завершённая загрузка (Status = completed) прикрепляется к документу по ID.
+type Upload struct {
+	ID              string            `db:"id" json:"id"`
+	UserID          int64             `db:"user_id" json:"user_id"`
+	Kind            string            `db:"kind" json:"kind"` // tus|direct
+	Length          int64             `db:"upload_length" json:"length"`
+	Offset          int64             `db:"upload_offset" json:"offset"`
+	Filename        *string           `db:"filename" json:"filename,omitempty"`
+	ContentType     *string           `db:"content_type" json:"content_type,omitempty"`
+	Metadata        map[string]string `db:"-" json:"metadata,omitempty"`
+	Sha256          *string           `db:"sha256" json:"sha256,omitempty"` // ожидаемая сумма (direct)
+	Bucket          string            `db:"bucket" json:"-"`
+	Key             string            `db:"key" json:"-"`
+	StorageUploadID string            `db:"storage_upload_id" json:"-"`
+	Parts           []UploadPart      `db:"-" json:"-"`
+	HashState       []byte            `db:"hash_state" json:"-"`
+	Status          string            `db:"status" json:"status"`
+	FileMeta        *FileMeta         `db:"-" json:"file_meta,omitempty"`
+	CreatedAt       time.Time         `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time         `db:"updated_at" json:"updated_at"`
+	ExpiresAt       time.Time         `db:"expires_at" json:"expires_at"`
+}
+
+// DirectUploadInput — запрос прямой загрузки: размер и тип обязательны, Sha256 (hex) проверяется при finalize
+type DirectUploadInput struct {
+	Filename    string  `json:"filename"`
+	ContentType string  `json:"content_type"`
+	Size        int64   `json:"size"`
+	Sha256      *string `json:"sha256,omitempty"`
+}
+
+// UploadPart — часть загрузки, уже переданная в хранилище
+type UploadPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// ExpiredUpload — просроченная загрузка, удалённая из БД; незавершённую нужно прервать
+// в хранилище (tus) или удалить её временный объект (direct)
+type ExpiredUpload struct {
+	ID              string `db:"id"`
+	Kind            string `db:"kind"`
+	Status          string `db:"status"`
+	Bucket          string `db:"bucket"`
+	Key             string `db:"key"`
+	StorageUploadID string `db:"storage_upload_id"`
+}
+
+// FieldChange — различие одного поля между двумя версиями
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type VersionDiff struct {
+	DocumentID int64         `json:"document_id"`
+	From       int64         `json:"from"`
+	To         int64         `json:"to"`
+	Changes    []FieldChange `json:"changes"`
 }
 
 // DocumentSearchFilter — фильтр для поиска документов (используется в handlers/services)
 type DocumentSearchFilter struct {
+	Query    string `json:"q"`         // полнотекстовый запрос (websearch-синтаксис)
 	Tag      string `json:"tag"`       // тег
 	Author   string `json:"author"`    // автор (имя)
 	Type     string `json:"type"`      // тип документа (имя) или type_id
 	DateFrom string `json:"date_from"` // диапазон дат — левые/правые границы (строки парсятся в сервисе/handler)
 	DateTo   string `json:"date_to"`
-	Limit    int    `json:"limit"`
-	Offset   int    `json:"offset"`
+
+	// пространственные фильтры (documents.geom, EPSG:4326)
+	BBox     []float64        `json:"bbox,omitempty"`     // [min_lon, min_lat, max_lon, max_lat]
+	Geometry *json.RawMessage `json:"geometry,omitempty"` // GeoJSON Polygon/MultiPolygon (или Feature с ним)
+	Relation string           `json:"relation,omitempty"` // intersects|within — отношение документа к Geometry
+	Near     []float64        `json:"near,omitempty"`     // [lon, lat] — точка для сортировки по расстоянию
+	RadiusM  *float64         `json:"radius_m,omitempty"` // радиус в метрах вокруг Near
+
+	Sort   string `json:"sort"`   // distance|relevance|created_at|updated_at|document_date|title
+	Order  string `json:"order"`  // asc|desc
+	Cursor string `json:"cursor"` // непрозрачный курсор next_cursor из предыдущего ответа; приоритетнее offset
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// DocumentSearchResult — страница результатов поиска
+type DocumentSearchResult struct {
+	Items      []DocumentSecure `json:"items"`
+	Total      int64            `json:"total"`
+	Limit      int              `json:"limit"`
+	Offset     int              `json:"offset"`
+	Sort       string           `json:"sort"`
+	Order      string           `json:"order"`
+	NextCursor string           `json:"next_cursor,omitempty"` // пусто на последней странице и за пределом offset 10000
+}
+
+// --- Проверка целостности файлов -----------------------------------------
+
+// Статусы проверки хранимого объекта
+const (
+	FixityOK       = "ok"
+	FixityMismatch = "mismatch" // содержимое или размер не совпали с FileMeta
+	FixityMissing  = "missing"  // объекта нет в хранилище
+	FixityError    = "error"    // объект не удалось прочитать; проверка повторится
+)
+
+// FixityTarget — объект хранилища и ожидаемые по FileMeta сумма и размер
+type FixityTarget struct {
+	Bucket string  `db:"bucket"`
+	Key    string  `db:"key"`
+	Sha256 *string `db:"sha256"`
+	Size   *int64  `db:"size"`
+}
+
+// FixityCheck — результат одной проверки объекта
+type FixityCheck struct {
+	Bucket         string    `json:"bucket"`
+	Key            string    `json:"key"`
+	Status         string    `json:"status"`
+	ExpectedSha256 *string   `json:"expected_sha256,omitempty"`
+	ActualSha256   *string   `json:"actual_sha256,omitempty"`
+	Size           *int64    `json:"size,omitempty"`
+	Error          *string   `json:"error,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// FixityRecord — строка отчёта: последний результат проверки файла документа
+// (основного, версии Version или вложения FileID)
+type FixityRecord struct {
+	DocumentID     int64      `db:"document_id" json:"document_id"`
+	Title          string     `db:"title" json:"title"`
+	Deleted        bool       `db:"deleted" json:"deleted"`
+	FileID         *int64     `db:"file_id" json:"file_id,omitempty"`
+	Version        *int64     `db:"version" json:"version,omitempty"`
+	Bucket         string     `db:"bucket" json:"bucket"`
+	Key            string     `db:"key" json:"key"`
+	Status         string     `db:"status" json:"status"`
+	ExpectedSha256 *string    `db:"expected_sha256" json:"expected_sha256,omitempty"`
+	ActualSha256   *string    `db:"actual_sha256" json:"actual_sha256,omitempty"`
+	Size           *int64     `db:"size" json:"size,omitempty"`
+	Error          *string    `db:"error" json:"error,omitempty"`
+	CheckedAt      time.Time  `db:"checked_at" json:"checked_at"`
+	FailedSince    *time.Time `db:"failed_since" json:"failed_since,omitempty"`
+	Checks         int        `db:"checks" json:"checks"`
+}
+
+// FixityReportFilter — параметры отчёта; по умолчанию только сбои
+type FixityReportFilter struct {
+	All        bool
+	DocumentID *int64
+	Limit      int
+	Offset     int
 }
 
 // --- Логи ----------------------------------------------------------------
@@ -106,28 +410,33 @@ type LogRecord struct {
 
 // DocumentSecure — результат security-функций (fn_get_document_by_id / fn_get_documents_for_user)
 type DocumentSecure struct {
-	DocID             int64       `db:"doc_id" json:"doc_id"`
-	Title             string      `db:"title" json:"title"`
-	Privacy           PrivacyType `db:"privacy" json:"privacy"`
-	CreatedAt         time.Time   `db:"created_at" json:"created_at"`
-	CreatedBy         *int64      `db:"created_by" json:"created_by,omitempty"`
-	CreatedByLogin    *string     `db:"created_by_login" json:"created_by_login,omitempty"`
-	CreatedByFullName *string     `db:"created_by_full_name" json:"created_by_full_name,omitempty"`
-	UpdatedAt         *time.Time  `db:"updated_at" json:"updated_at,omitempty"`
-	UpdatedBy         *int64      `db:"updated_by" json:"updated_by,omitempty"`
-	UpdatedByLogin    *string     `db:"updated_by_login" json:"updated_by_login,omitempty"`
-	UpdatedByFullName *string     `db:"updated_by_full_name" json:"updated_by_full_name,omitempty"`
-	DocumentDate      *time.Time  `db:"document_date" json:"document_date,omitempty"`
-	Author            *string     `db:"author" json:"author,omitempty"`
-	TypeID            *int64      `db:"type_id" json:"type_id,omitempty"`
-	TypeName          *string     `db:"type_name" json:"type_name,omitempty"`
-	Tags              []string    `db:"tags" json:"tags,omitempty"`
-	Viewers           []int64     `db:"viewers" json:"viewers,omitempty"`
-	Editors           []int64     `db:"editors" json:"editors,omitempty"`
-	CanRequesterEdit  bool        `db:"can_requester_edit" json:"can_requester_edit"`
-	Geom              *string     `db:"geom" json:"geom,omitempty"` // ST_AsGeoJSON(geom)
-	FileMeta          *FileMeta   `db:"file_meta" json:"file_meta,omitempty"`
-	DownloadURL       string      `json:"download_url,omitempty"`
+	DocID             int64          `db:"doc_id" json:"doc_id"`
+	Title             string         `db:"title" json:"title"`
+	Privacy           PrivacyType    `db:"privacy" json:"privacy"`
+	CreatedAt         time.Time      `db:"created_at" json:"created_at"`
+	CreatedBy         *int64         `db:"created_by" json:"created_by,omitempty"`
+	CreatedByLogin    *string        `db:"created_by_login" json:"created_by_login,omitempty"`
+	CreatedByFullName *string        `db:"created_by_full_name" json:"created_by_full_name,omitempty"`
+	UpdatedAt         *time.Time     `db:"updated_at" json:"updated_at,omitempty"`
+	UpdatedBy         *int64         `db:"updated_by" json:"updated_by,omitempty"`
+	UpdatedByLogin    *string        `db:"updated_by_login" json:"updated_by_login,omitempty"`
+	UpdatedByFullName *string        `db:"updated_by_full_name" json:"updated_by_full_name,omitempty"`
+	DocumentDate      *time.Time     `db:"document_date" json:"document_date,omitempty"`
+	Author            *string        `db:"author" json:"author,omitempty"`
+	TypeID            *int64         `db:"type_id" json:"type_id,omitempty"`
+	TypeName          *string        `db:"type_name" json:"type_name,omitempty"`
+	Tags              []string       `db:"tags" json:"tags,omitempty"`
+	Viewers           []int64        `db:"viewers" json:"viewers,omitempty"`
+	Editors           []int64        `db:"editors" json:"editors,omitempty"`
+	CanRequesterEdit  bool           `db:"can_requester_edit" json:"can_requester_edit"`
+	Geom              *string        `db:"geom" json:"geom,omitempty"` // ST_AsGeoJSON(geom)
+	FileMeta          *FileMeta      `db:"file_meta" json:"file_meta,omitempty"`
+	Version           int64          `db:"version" json:"version,omitempty"` // только в GET /:id, он же ETag
+	Files             []DocumentFile `db:"-" json:"files,omitempty"`         // вложения, только в GET /:id
+	DownloadURL       string         `json:"download_url,omitempty"`
+	Rank              *float32       `db:"rank" json:"rank,omitempty"`             // только при полнотекстовом поиске
+	Headline          *string        `db:"headline" json:"headline,omitempty"`     // фрагменты с <mark>…</mark>
+	DistanceM         *float64       `db:"distance_m" json:"distance_m,omitempty"` // только при поиске с near
 }
 
 // DocumentCreateInput — удобная структура для передачи данных из handler->service
@@ -140,6 +449,7 @@ type DocumentCreateInput struct {
 	FileMeta     *FileMeta
 	GeoJSON      *json.RawMessage
 	Tags         []string
+	FileText     *string // текст, извлечённый из файла, для полнотекстового поиска
 	CreatorID    int64
 }
 
@@ -154,5 +464,17 @@ type DocumentUpdateInput struct {
 	FileMeta     *FileMeta
 	GeoJSON      *json.RawMessage
 	Tags         *[]string
+	FileText     *string // учитывается только вместе с новым FileMeta; nil очищает текст старого файла
 	UpdaterID    int64
+	IfMatch      *int64 // ожидаемая версия документа (If-Match); nil — без проверки
+}
+
+// DocumentPatch — частичное изменение (PATCH): в Fields только присланные поля
+// с ключами fn_patch_document (title, privacy, document_date, author, type_id, geojson,
+// tags, file_meta); значение nil очищает поле
+type DocumentPatch struct {
+	Fields    map[string]interface{}
+	FileText  *string // текст нового файла, учитывается вместе с Fields["file_meta"]
+	UpdaterID int64
+	IfMatch   *int64
 }
@@ -3,11 +3,15 @@ package main
 import (
 	"archive"
 	"archive/pkg/handler"
+	"archive/pkg/jobs"
 	"archive/pkg/repository"
 	"archive/pkg/service"
+	"archive/storage"
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -53,9 +57,43 @@ func main() {
 		logrus.Fatalf("db ping failed: %v", err)
 	}
 
+	tokens, err := newTokenManager()
+	if err != nil {
+		logrus.Fatalf("failed to init jwt keys: %s", err.Error())
+	}
+
+	store, err := newStorage()
+	if err != nil {
+		logrus.Fatalf("failed to init storage: %s", err.Error())
+	}
+
+	if (viper.GetDuration("jobs.storage_gc") > 0 || viper.GetDuration("jobs.purge_trash") > 0) && viper.GetDuration("gc.grace_period") <= 0 {
+		logrus.Fatalf("gc.grace_period must be positive when jobs.storage_gc or jobs.purge_trash is enabled")
+	}
+
 	repos := repository.NewRepository(db)
-	services := service.NewService(repos)
-	handlers := handler.NewHandler(services)
+	services := service.NewService(repos, tokens, store, service.Options{
+		Uploads: service.UploadsConfig{
+			SpoolDir:   viper.GetString("uploads.spool_dir"),
+			PartSize:   viper.GetInt64("uploads.part_size"),
+			MaxSize:    viper.GetInt64("uploads.max_size"),
+			TTL:        viper.GetDuration("uploads.expiry"),
+			PresignTTL: viper.GetDuration("uploads.presign_expiry"),
+		},
+		StorageGC: service.StorageGCConfig{
+			Prefix: viper.GetString("gc.prefix"),
+			Grace:  viper.GetDuration("gc.grace_period"),
+			Batch:  viper.GetInt("gc.batch"),
+			DryRun: viper.GetBool("gc.dry_run"),
+		},
+		Fixity: service.FixityConfig{
+			Batch:        viper.GetInt("fixity.batch"),
+			MaxPerRun:    viper.GetInt("fixity.max_per_run"),
+			RecheckAfter: viper.GetDuration("fixity.recheck_after"),
+			RateLimit:    viper.GetInt64("fixity.rate_limit"),
+		},
+	})
+	handlers := handler.NewHandler(services, store)
 
 	srv := new(archive.Server)
 	go func() {
@@ -68,6 +106,10 @@ func main() {
 
 	stopCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
+
+	scheduler := newScheduler(services)
+	scheduler.Start(stopCtx)
+
 	<-stopCtx.Done()
 
 	logrus.Info("Server Shutting Down")
@@ -79,6 +121,8 @@ func main() {
 		logrus.Errorf("error occured on server shutting down: %s", err.Error())
 	}
 
+	scheduler.Wait()
+
 	if err := db.Close(); err != nil {
 		logrus.Errorf("error occured on db connection close: %s", err.Error())
 	}
@@ -87,5 +131,127 @@ func main() {
 func initConfig() error {
 	viper.AddConfigPath("configs")
 	viper.SetConfigName("config")
+	// скалярные ключи можно переопределить окружением: jwt.token_ttl -> JWT_TOKEN_TTL
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
 	return viper.ReadInConfig()
 }
+
+// newTokenManager собирает ключи JWT из секции jwt конфига
+func newTokenManager() (*service.TokenManager, error) {
+	var sources []service.TokenKeySource
+	if err := viper.UnmarshalKey("jwt.keys", &sources); err != nil {
+		return nil, err
+	}
+
+	keys := make([]service.TokenKey, 0, len(sources))
+	for _, src := range sources {
+		key, err := service.LoadTokenKey(src)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return service.NewTokenManager(service.TokenConfig{
+		Issuer:       viper.GetString("jwt.issuer"),
+		TTL:          viper.GetDuration("jwt.token_ttl"),
+		RefreshTTL:   viper.GetDuration("jwt.refresh_token_ttl"),
+		SigningKeyID: viper.GetString("jwt.signing_kid"),
+		Keys:         keys,
+	})
+}
+
+// newStorage — файловое хранилище из секции storage конфига (backend: minio|local);
+// секреты берутся из окружения
+func newStorage() (storage.Storage, error) {
+	switch backend := viper.GetString("storage.backend"); backend {
+	case "", "minio":
+	case "local":
+		return storage.NewLocalStorage(storage.LocalConfig{
+			Root:       viper.GetString("storage.local.root"),
+			Bucket:     viper.GetString("storage.local.bucket"),
+			Prefix:     viper.GetString("storage.local.prefix"),
+			BaseURL:    viper.GetString("storage.local.base_url"),
+			SigningKey: []byte(os.Getenv("LOCAL_STORAGE_SIGNING_KEY")),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+	return storage.NewMinioStorage(storage.MinioConfig{
+		Endpoint:        viper.GetString("storage.minio.endpoint"),
+		AccessKeyID:     viper.GetString("storage.minio.access_key_id"),
+		SecretAccessKey: os.Getenv("MINIO_SECRET_ACCESS_KEY"),
+		UseSSL:          viper.GetBool("storage.minio.use_ssl"),
+		Bucket:          viper.GetString("storage.minio.bucket"),
+		Region:          viper.GetString("storage.minio.region"),
+		Prefix:          viper.GetString("storage.minio.prefix"),
+	})
+}
+
+// newScheduler — фоновые задачи обслуживания; интервалы из секции jobs конфига (0 — отключить)
+func newScheduler(services *service.Service) *jobs.Scheduler {
+	return jobs.NewScheduler(
+		jobs.Job{
+			Name:     "purge_expired_permissions",
+			Interval: viper.GetDuration("jobs.purge_expired_permissions"),
+			Run: func(ctx context.Context) error {
+				n, err := services.Document.PurgeExpiredPermissions(ctx)
+				if err == nil && n > 0 {
+					logrus.Infof("purged %d expired document permissions", n)
+				}
+				return err
+			},
+		},
+		jobs.Job{
+			Name:     "purge_trash",
+			Interval: viper.GetDuration("jobs.purge_trash"),
+			Run: func(ctx context.Context) error {
+				// файлы без ссылок удаляются сразу, с той же перепроверкой, что и в storage_gc;
+				// пропущенные (недавно загруженные заново) остаются для storage_gc
+				files, err := services.Document.PurgeDeleted(ctx, viper.GetDuration("trash.retention"), viper.GetInt("trash.purge_batch"))
+				if err != nil || len(files) == 0 {
+					return err
+				}
+				n, err := services.StorageGC.RemovePurged(ctx, files)
+				logrus.Infof("purged trash: %d of %d unreferenced stored objects removed", n, len(files))
+				return err
+			},
+		},
+		jobs.Job{
+			Name:     "storage_gc",
+			Interval: viper.GetDuration("jobs.storage_gc"),
+			Run: func(ctx context.Context) error {
+				r, err := services.StorageGC.Run(ctx)
+				if err != nil {
+					return err
+				}
+				logrus.Infof("storage gc: %d objects scanned, %d orphans (%d bytes), %d removed, dry run: %t",
+					r.Scanned, r.Orphans, r.OrphanBytes, r.Removed, r.DryRun)
+				return nil
+			},
+		},
+		jobs.Job{
+			Name:     "fixity",
+			Interval: viper.GetDuration("jobs.fixity"),
+			Run: func(ctx context.Context) error {
+				r, err := services.Fixity.Run(ctx)
+				if r.Checked > 0 {
+					logrus.Infof("fixity: %d objects checked (%d bytes), %d failed, %d new alerts", r.Checked, r.Bytes, r.Failed, r.Alerts)
+				}
+				return err
+			},
+		},
+		jobs.Job{
+			Name:     "purge_uploads",
+			Interval: viper.GetDuration("jobs.purge_uploads"),
+			Run: func(ctx context.Context) error {
+				n, err := services.Uploads.PurgeExpired(ctx, viper.GetInt("uploads.purge_batch"))
+				if err == nil && n > 0 {
+					logrus.Infof("purged %d expired uploads", n)
+				}
+				return err
+			},
+		},
+	)
+}
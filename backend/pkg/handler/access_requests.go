@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"archive"
+	"archive/pkg/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessRequestError — неверный запрос -> 400, отказы БД — как у документов, прочее -> 500
+func accessRequestError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidAccessRequest) {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	documentError(c, err)
+}
+
+// accessRequestTarget — пользователь из токена и запрос из :id
+func accessRequestTarget(c *gin.Context) (userID int64, requestID int64, ok bool) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return 0, 0, false
+	}
+	requestID, err = strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || requestID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return 0, 0, false
+	}
+	return userID, requestID, true
+}
+
+type requestAccessInput struct {
+	Level  string  `json:"level"` // view (по умолчанию) | edit
+	Reason *string `json:"reason"`
+}
+
+// POST /api/documents/:id/access-requests  body: { "level": "view", "reason": "..." }
+func (h *Handler) requestDocumentAccess(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	var in requestAccessInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+
+	id, err := h.services.Access.Create(c.Request.Context(), userID, docID, in.Level, in.Reason)
+	if err != nil {
+		accessRequestError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// GET /api/access-requests/mine — отправленные запросы и их статус
+func (h *Handler) listMyAccessRequests(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	items, err := h.services.Access.ListMine(c.Request.Context(), userID)
+	if err != nil {
+		accessRequestError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// GET /api/access-requests/incoming?status=pending|approved|rejected|cancelled|all
+// Очередь для авторов документов, обладателей can_share и permissions.manage
+func (h *Handler) listIncomingAccessRequests(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	items, err := h.services.Access.ListIncoming(c.Request.Context(), userID, c.Query("status"))
+	if err != nil {
+		accessRequestError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/access-requests/:id/approve  body (optional): { "comment": "...", "expires_at": "..." }
+func (h *Handler) approveAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, true)
+}
+
+// POST /api/access-requests/:id/reject  body (optional): { "comment": "..." }
+func (h *Handler) rejectAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, false)
+}
+
+func (h *Handler) decideAccessRequest(c *gin.Context, approve bool) {
+	userID, requestID, ok := accessRequestTarget(c)
+	if !ok {
+		return
+	}
+
+	var in archive.AccessDecision
+	// тело необязательно
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+			return
+		}
+	}
+	in.Approve = approve
+
+	if err := h.services.Access.Decide(c.Request.Context(), userID, requestID, in); err != nil {
+		accessRequestError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// DELETE /api/access-requests/:id — отзыв своего ожидающего запроса
+func (h *Handler) cancelAccessRequest(c *gin.Context) {
+	userID, requestID, ok := accessRequestTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.services.Access.Cancel(c.Request.Context(), userID, requestID); err != nil {
+		accessRequestError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
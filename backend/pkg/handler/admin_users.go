@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"archive"
+	"archive/pkg/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminUserError — ошибки валидации -> 400, отказы БД — как у документов (403/404/409/400/500)
+func adminUserError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidUserInput) {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	documentError(c, err)
+}
+
+// adminTarget — requester из токена и целевой пользователь из :id
+func adminTarget(c *gin.Context) (adminID int64, targetID int64, ok bool) {
+	adminID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return 0, 0, false
+	}
+	targetID, err = strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || targetID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return 0, 0, false
+	}
+	return adminID, targetID, true
+}
+
+// GET /api/admin/users?q=&role_id=&disabled=&limit=&offset=
+func (h *Handler) adminListUsers(c *gin.Context) {
+	adminID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	filter := archive.UserListFilter{Query: c.Query("q")}
+	if v := c.Query("role_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid role_id")
+			return
+		}
+		filter.RoleID = &id
+	}
+	if v := c.Query("disabled"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid disabled")
+			return
+		}
+		filter.Disabled = &b
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid offset")
+			return
+		}
+		filter.Offset = n
+	}
+
+	res, err := h.services.Admin.ListUsers(c.Request.Context(), adminID, filter)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+type adminCreateUserInput struct {
+	Login    string  `json:"login" binding:"required"`
+	Password string  `json:"password" binding:"required"`
+	FullName *string `json:"full_name,omitempty"`
+	RoleID   int64   `json:"role_id" binding:"required"`
+}
+
+// POST /api/admin/users
+func (h *Handler) adminCreateUser(c *gin.Context) {
+	adminID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var in adminCreateUserInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+
+	id, err := h.services.Admin.CreateUser(c.Request.Context(), adminID, archive.AdminUserCreateInput{
+		Login:    in.Login,
+		Password: in.Password,
+		FullName: in.FullName,
+		RoleID:   in.RoleID,
+	})
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+type adminSetRoleInput struct {
+	RoleID int64 `json:"role_id" binding:"required"`
+}
+
+// PUT /api/admin/users/:id/role
+func (h *Handler) adminSetUserRole(c *gin.Context) {
+	adminID, targetID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var in adminSetRoleInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	if err := h.services.Admin.SetUserRole(c.Request.Context(), adminID, targetID, in.RoleID); err != nil {
+		adminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+type adminSetDisabledInput struct {
+	Disabled *bool `json:"disabled" binding:"required"`
+}
+
+// PUT /api/admin/users/:id/disabled — блокировка сразу завершает все сессии пользователя
+func (h *Handler) adminSetUserDisabled(c *gin.Context) {
+	adminID, targetID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var in adminSetDisabledInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	if err := h.services.Admin.SetUserDisabled(c.Request.Context(), adminID, targetID, *in.Disabled); err != nil {
+		adminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+type adminResetPasswordInput struct {
+	Password string `json:"password"`
+}
+
+// POST /api/admin/users/:id/password-reset
+// Временный пароль возвращается один раз; при входе пользователь обязан его сменить.
+func (h *Handler) adminResetPassword(c *gin.Context) {
+	adminID, targetID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var in adminResetPasswordInput
+	// тело необязательно
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid input")
+			return
+		}
+	}
+
+	password, err := h.services.Admin.ResetUserPassword(c.Request.Context(), adminID, targetID, in.Password)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"temporary_password": password})
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"archive"
+	"archive/pkg/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -57,39 +59,83 @@ func (h *Handler) signIn(c *gin.Context) {
 		return
 	}
 
-	token, err := h.services.Authorization.GenerateToken(c.Request.Context(), input.Login, input.Password)
+	tokens, err := h.services.Authorization.GenerateToken(c.Request.Context(), input.Login, input.Password)
 	if err != nil {
 		newErrorResponse(c, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{"token": token})
+	c.JSON(http.StatusOK, tokens)
 }
 
+// jwks — открытые ключи проверки access-токенов (RFC 7517)
+func (h *Handler) jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.services.Authorization.JWKS())
+}
+
+type refreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// POST /auth/refresh-token  body: { "refresh_token": "..." }
+// возвращает новую пару токенов; старый refresh-токен больше не действителен
 func (h *Handler) refreshToken(c *gin.Context) {
-	header := c.GetHeader("Authorization")
-	if header == "" {
-		newErrorResponse(c, http.StatusBadRequest, "empty auth header")
+	var input refreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
 		return
 	}
-	parts := strings.Split(header, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		newErrorResponse(c, http.StatusBadRequest, "invalid auth header")
+
+	tokens, err := h.services.Authorization.RefreshToken(c.Request.Context(), input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRefreshToken), errors.Is(err, service.ErrRefreshTokenExpired),
+			errors.Is(err, service.ErrRefreshTokenReused), errors.Is(err, service.ErrTokenRevoked):
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+		default:
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
-	oldToken := parts[1]
-	if oldToken == "" {
-		newErrorResponse(c, http.StatusBadRequest, "token is empty")
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// POST /auth/logout  body: { "refresh_token": "..." } — завершает текущую сессию
+func (h *Handler) logout(c *gin.Context) {
+	var input refreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
 		return
 	}
 
-	newToken, err := h.services.Authorization.RefreshToken(c.Request.Context(), oldToken)
-	if err != nil {
-		newErrorResponse(c, http.StatusUnauthorized, err.Error())
+	if err := h.services.Authorization.Logout(c.Request.Context(), input.RefreshToken); err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{"token": newToken})
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// POST /auth/logout-all — завершает все сессии текущего пользователя
+func (h *Handler) logoutAll(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil || userID == 0 {
+		newErrorResponse(c, http.StatusUnauthorized, "user not authorized")
+		return
+	}
+
+	if err := h.services.Authorization.LogoutAll(c.Request.Context(), userID); err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
 type updateFullNameInput struct {
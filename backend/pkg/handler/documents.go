@@ -2,7 +2,10 @@ package handler
 
 import (
 	"archive"
+	"archive/pkg/repository"
+	"archive/pkg/service"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,6 +13,22 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// documentError — отказы БД с явным SQLSTATE -> 403/404/409, остальное -> 500
+func documentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrForbidden):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, repository.ErrConflict):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, repository.ErrInvalidInput):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
 // createDocument — поддерживает multipart/form-data с GeoJSON
 func (h *Handler) createDocument(c *gin.Context) {
 	creatorID, err := getUserId(c)
@@ -61,32 +80,9 @@ func (h *Handler) createDocument(c *gin.Context) {
 		in.Tags = parts
 	}
 
-	if fileHdr, err := c.FormFile("file"); err == nil {
-		f, err := fileHdr.Open()
-		if err != nil {
-			newErrorResponse(c, http.StatusInternalServerError, "failed to open uploaded file")
-			return
-		}
-		defer f.Close()
-
-		contentType := fileHdr.Header.Get("Content-Type")
-		if contentType == "" {
-			contentType = "application/octet-stream"
-		}
-		// fileHdr.Size is int64
-		meta, err := h.storage.UploadStream(c.Request.Context(), fileHdr.Filename, f, fileHdr.Size, contentType)
-		if err != nil {
-			newErrorResponse(c, http.StatusInternalServerError, "failed to upload file")
-			return
-		}
-		in.FileMeta = &archive.FileMeta{
-			Provider: meta.Provider,
-			Bucket:   meta.Bucket,
-			Key:      meta.Key,
-			Mime:     meta.Mime,
-			Size:     meta.Size,
-			Sha256:   meta.Sha256,
-		}
+	var fileOK bool
+	if in.FileMeta, in.FileText, fileOK = h.formDocumentFile(c); !fileOK {
+		return
 	}
 
 	in.CreatorID = creatorID
@@ -99,32 +95,127 @@ func (h *Handler) createDocument(c *gin.Context) {
 	c.JSON(http.StatusCreated, map[string]interface{}{"id": id})
 }
 
-// searchDocumentsByTag — поиск с фильтрами
+// searchDocumentsByTag — поиск с фильтрами (AND), сортировкой и пагинацией
+// query: q, tag, author, type, date_from, date_to, bbox=min_lon,min_lat,max_lon,max_lat,
+// near=lon,lat, radius_m, sort, order, limit, offset | cursor (offset не больше 10000)
 func (h *Handler) searchDocumentsByTag(c *gin.Context) {
 	filter := archive.DocumentSearchFilter{
+		Query:    c.Query("q"),
 		Tag:      c.Query("tag"),
 		Author:   c.Query("author"),
 		Type:     c.Query("type"),
 		DateFrom: c.Query("date_from"),
 		DateTo:   c.Query("date_to"),
+		Sort:     c.Query("sort"),
+		Order:    c.Query("order"),
+		Cursor:   c.Query("cursor"),
 	}
 	if v := c.Query("limit"); v != "" {
-		if val, err := strconv.Atoi(v); err == nil {
-			filter.Limit = val
+		val, err := strconv.Atoi(v)
+		if err != nil || val < 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid limit")
+			return
 		}
+		filter.Limit = val
 	}
 	if v := c.Query("offset"); v != "" {
-		if val, err := strconv.Atoi(v); err == nil {
-			filter.Offset = val
+		val, err := strconv.Atoi(v)
+		if err != nil || val < 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid offset")
+			return
 		}
+		filter.Offset = val
 	}
+	if v := c.Query("bbox"); v != "" {
+		bbox, err := parseFloatList(v, 4)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid bbox")
+			return
+		}
+		filter.BBox = bbox
+	}
+	if v := c.Query("near"); v != "" {
+		near, err := parseFloatList(v, 2)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid near")
+			return
+		}
+		filter.Near = near
+	}
+	if v := c.Query("radius_m"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid radius_m")
+			return
+		}
+		filter.RadiusM = &r
+	}
+
+	h.runDocumentSearch(c, filter)
+}
+
+// searchDocumentsByArea — тот же поиск, но фильтр в JSON-теле; позволяет передать
+// GeoJSON-полигон: { "geometry": {...}, "relation": "intersects"|"within", ...остальные поля фильтра }
+func (h *Handler) searchDocumentsByArea(c *gin.Context) {
+	var filter archive.DocumentSearchFilter
+	if err := c.ShouldBindJSON(&filter); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+	if filter.Limit < 0 || filter.Offset < 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid limit/offset")
+		return
+	}
+
+	h.runDocumentSearch(c, filter)
+}
 
-	items, err := h.services.Document.SearchDocumentsByTag(c.Request.Context(), filter)
+func (h *Handler) runDocumentSearch(c *gin.Context, filter archive.DocumentSearchFilter) {
+	if filter.DateFrom != "" {
+		t, err := parseDateFlexible(filter.DateFrom)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid date_from")
+			return
+		}
+		filter.DateFrom = t.Format(dateLayout)
+	}
+	if filter.DateTo != "" {
+		t, err := parseDateFlexible(filter.DateTo)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid date_to")
+			return
+		}
+		filter.DateTo = t.Format(dateLayout)
+	}
+
+	res, err := h.services.Document.SearchDocumentsByTag(c.Request.Context(), filter)
 	if err != nil {
+		if isSearchInputError(err) {
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, items)
+	c.JSON(http.StatusOK, res)
+}
+
+func isSearchInputError(err error) bool {
+	for _, target := range []error{
+		service.ErrInvalidCursor,
+		service.ErrOffsetTooLarge,
+		service.ErrInvalidSort,
+		service.ErrInvalidOrder,
+		service.ErrSortNeedsQuery,
+		service.ErrSortNeedsPoint,
+		service.ErrInvalidSpatialFilter,
+		repository.ErrInvalidInput, // значение фильтра не приводится к типу столбца (type вне INT)
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
 }
 
 // updateDocument — поддерживает multipart/form-data с GeoJSON
@@ -141,9 +232,15 @@ func (h *Handler) updateDocument(c *gin.Context) {
 		return
 	}
 
+	ifMatch, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
 	var in archive.DocumentUpdateInput
 	in.DocumentID = id
 	in.UpdaterID = updaterID
+	in.IfMatch = ifMatch
 
 	if v := c.PostForm("title"); v != "" {
 		in.Title = &v
@@ -190,37 +287,25 @@ func (h *Handler) updateDocument(c *gin.Context) {
 		in.Tags = &parts
 	}
 
-	// file upload (optional) -> stream
-	if fileHdr, err := c.FormFile("file"); err == nil {
-		f, err := fileHdr.Open()
-		if err != nil {
-			newErrorResponse(c, http.StatusInternalServerError, "failed to open uploaded file")
+	// file upload (optional) -> stream; or a finished tus upload by upload_id.
+	// Nothing is written to storage until the caller is known to have edit rights.
+	if _, fileErr := c.FormFile("file"); fileErr == nil || strings.TrimSpace(c.PostForm("upload_id")) != "" {
+		if err := h.services.Document.RequireEdit(c.Request.Context(), id); err != nil {
+			documentError(c, err)
 			return
 		}
-		defer f.Close()
-
-		contentType := fileHdr.Header.Get("Content-Type")
-		if contentType == "" {
-			contentType = "application/octet-stream"
-		}
-
-		meta, err := h.storage.UploadStream(c.Request.Context(), fileHdr.Filename, f, fileHdr.Size, contentType)
-		if err != nil {
-			newErrorResponse(c, http.StatusInternalServerError, "failed to upload file")
-			return
-		}
-		in.FileMeta = &archive.FileMeta{
-			Provider: meta.Provider,
-			Bucket:   meta.Bucket,
-			Key:      meta.Key,
-			Mime:     meta.Mime,
-			Size:     meta.Size,
-			Sha256:   meta.Sha256,
-		}
+	}
+	var fileOK bool
+	if in.FileMeta, in.FileText, fileOK = h.formDocumentFile(c); !fileOK {
+		return
 	}
 
 	if err := h.services.Document.UpdateDocument(c.Request.Context(), in.DocumentID, in); err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		if errors.Is(err, repository.ErrPreconditionFailed) {
+			h.preconditionFailed(c, id, err)
+			return
+		}
+		documentError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -235,36 +320,101 @@ func (h *Handler) getDocumentByID(c *gin.Context) {
 	}
 
 	item, err := h.services.Document.GetDocumentByID(c.Request.Context(), id)
+	if err != nil {
+		// закрытый документ -> 403: доступ можно запросить через POST /:id/access-requests
+		documentError(c, err)
+		return
+	}
+
+	body, etag, err := documentRepresentation(item)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// deleteDocument
+func (h *Handler) deleteDocument(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
 
-	if item.FileMeta != nil && h.storage != nil {
-		// signed URL for short duration (например 300 сек)
-		if url, err := h.storage.SignedURL(c.Request.Context(), item.FileMeta.Bucket, item.FileMeta.Key, 300); err == nil {
-			item.DownloadURL = url
+	ifMatch, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	if err := h.services.Document.DeleteDocument(c.Request.Context(), id, ifMatch); err != nil {
+		if errors.Is(err, repository.ErrPreconditionFailed) {
+			h.preconditionFailed(c, id, err)
+			return
 		}
+		documentError(c, err)
+		return
 	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
 
-	c.JSON(http.StatusOK, item)
+// getTrash — удалённые документы, которые текущий пользователь может восстановить
+func (h *Handler) getTrash(c *gin.Context) {
+	items, err := h.services.Document.ListTrash(c.Request.Context())
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, items)
 }
 
-// deleteDocument
-func (h *Handler) deleteDocument(c *gin.Context) {
+// restoreDocument — возвращает документ из корзины
+func (h *Handler) restoreDocument(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil || id <= 0 {
 		newErrorResponse(c, http.StatusBadRequest, "invalid id")
 		return
 	}
 
-	if err := h.services.Document.DeleteDocument(c.Request.Context(), id); err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	if err := h.services.Document.RestoreDocument(c.Request.Context(), id); err != nil {
+		documentError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
 }
 
+// listDocumentPermissions — кто имеет доступ к документу (личный и через группы)
+func (h *Handler) listDocumentPermissions(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	grants, err := h.services.Document.ListDocumentPermissions(c.Request.Context(), docID)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, grants)
+}
+
+// getSharedWithMe — документы, доступные текущему пользователю только по явному доступу
+func (h *Handler) getSharedWithMe(c *gin.Context) {
+	docs, err := h.services.Document.GetSharedWithMe(c.Request.Context())
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, docs)
+}
+
 // setDocumentPermission
 func (h *Handler) setDocumentPermission(c *gin.Context) {
 	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -282,7 +432,7 @@ func (h *Handler) setDocumentPermission(c *gin.Context) {
 	input.DocumentID = docID
 
 	if err := h.services.Document.SetDocumentPermission(c.Request.Context(), docID, input); err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		documentError(c, err)
 		return
 	}
 
@@ -306,6 +456,85 @@ func (h *Handler) removeDocumentPermission(c *gin.Context) {
 	}
 
 	if err := h.services.Document.RemoveDocumentPermission(c.Request.Context(), docID, input.TargetUserID); err != nil {
+		documentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// setDocumentGroupPermission — доступ всем участникам группы
+// body: { "group_id": 1, "can_view": true, "can_edit": false, "can_share": false, "expires_at": "2026-01-01T00:00:00Z" }
+func (h *Handler) setDocumentGroupPermission(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	var input archive.DocumentGroupPermission
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+	input.DocumentID = docID
+
+	if err := h.services.Document.SetDocumentGroupPermission(c.Request.Context(), docID, input); err != nil {
+		documentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// removeDocumentGroupPermission — body: { "group_id": 1 }
+func (h *Handler) removeDocumentGroupPermission(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	var input struct {
+		GroupID int64 `json:"group_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	if err := h.services.Document.RemoveDocumentGroupPermission(c.Request.Context(), docID, input.GroupID); err != nil {
+		documentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// setDocumentFileText — текст, извлечённый из файла внешним OCR/конвертером.
+// body: { "text": "..." } ; "text": null очищает
+func (h *Handler) setDocumentFileText(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	var input struct {
+		Text *string `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	if err := h.services.Document.SetDocumentFileText(c.Request.Context(), docID, userID, input.Text); err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// patchDocument — PATCH /api/documents/:id: меняет только присланные поля.
+// JSON: имена полей как в GET (type_id), null очищает поле; "file": null удаляет файл.
+// multipart/form-data: имена как в PUT (document_type_id), пустое значение очищает поле,
+// часть file заменяет файл, пустое поле file удаляет его.
+// В обоих вариантах upload_id заменяет файл файлом завершённой загрузки tus.
+func (h *Handler) patchDocument(c *gin.Context) {
+	updaterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	ifMatch, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	patch := archive.DocumentPatch{UpdaterID: updaterID, IfMatch: ifMatch}
+	if strings.HasPrefix(c.ContentType(), "multipart/") || c.ContentType() == "application/x-www-form-urlencoded" {
+		patch.Fields, err = patchFieldsFromForm(c)
+	} else {
+		patch.Fields, err = patchFieldsFromJSON(c)
+	}
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// новый файл загружается только после разбора остальных полей и проверки права на правку
+	fileHdr, fileErr := c.FormFile("file")
+	if _, hasUpload := patch.Fields["upload_id"]; fileErr == nil || hasUpload {
+		if err := h.services.Document.RequireEdit(c.Request.Context(), id); err != nil {
+			documentError(c, err)
+			return
+		}
+	}
+	if fileErr == nil {
+		fm, text, err := h.uploadDocumentFile(c, fileHdr, true)
+		if err != nil {
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		patch.Fields["file_meta"] = fm
+		patch.FileText = text
+	} else if uploadID, ok := patch.Fields["upload_id"].(string); ok {
+		fm, ok := h.uploadedFile(c, uploadID)
+		if !ok {
+			return
+		}
+		patch.Fields["file_meta"] = fm
+		patch.FileText = h.uploadedFileText(c, fm)
+	}
+	delete(patch.Fields, "upload_id")
+
+	version, err := h.services.Document.PatchDocument(c.Request.Context(), id, patch)
+	if err != nil {
+		if errors.Is(err, repository.ErrPreconditionFailed) {
+			h.preconditionFailed(c, id, err)
+			return
+		}
+		documentError(c, err)
+		return
+	}
+	c.Header("ETag", documentETag(version))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "version": version})
+}
+
+func patchFieldsFromJSON(c *gin.Context) (map[string]interface{}, error) {
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		return nil, errors.New("invalid input")
+	}
+
+	fields := make(map[string]interface{}, len(body))
+	for key, raw := range body {
+		isNull := string(raw) == "null"
+		switch key {
+		case "title", "privacy", "author", "document_date":
+			if isNull {
+				fields[key] = nil
+				continue
+			}
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, fmt.Errorf("%s must be a string", key)
+			}
+			v, err := patchStringValue(key, s)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = v
+		case "type_id":
+			if isNull {
+				fields[key] = nil
+				continue
+			}
+			var id int64
+			if err := json.Unmarshal(raw, &id); err != nil {
+				return nil, errors.New("type_id must be an integer")
+			}
+			fields[key] = id
+		case "geojson":
+			if isNull {
+				fields[key] = nil
+				continue
+			}
+			fields[key] = raw
+		case "tags":
+			if isNull {
+				fields[key] = nil
+				continue
+			}
+			var tags []string
+			if err := json.Unmarshal(raw, &tags); err != nil {
+				return nil, errors.New("tags must be an array of strings")
+			}
+			fields[key] = tags
+		case "file":
+			if !isNull {
+				return nil, errors.New("file can only be removed (null) in JSON; upload a new file with multipart/form-data or upload_id")
+			}
+			fields["file_meta"] = nil
+		case "upload_id":
+			var id string
+			if err := json.Unmarshal(raw, &id); err != nil || id == "" {
+				return nil, errors.New("upload_id must be a string")
+			}
+			fields[key] = id
+		default:
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+	}
+	return fields, nil
+}
+
+func patchFieldsFromForm(c *gin.Context) (map[string]interface{}, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			return nil, errors.New("invalid multipart form")
+		}
+	} else if err := c.Request.ParseForm(); err != nil {
+		return nil, errors.New("invalid form")
+	}
+
+	fields := make(map[string]interface{})
+	for key, values := range c.Request.PostForm {
+		v := strings.TrimSpace(values[0])
+		switch key {
+		case "title", "privacy", "author", "document_date":
+			if v == "" {
+				fields[key] = nil
+				continue
+			}
+			s, err := patchStringValue(key, v)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = s
+		case "document_type_id":
+			if v == "" {
+				fields["type_id"] = nil
+				continue
+			}
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, errors.New("invalid document_type_id")
+			}
+			fields["type_id"] = id
+		case "geojson":
+			if v == "" {
+				fields[key] = nil
+				continue
+			}
+			if !json.Valid([]byte(v)) {
+				return nil, errors.New("invalid geojson")
+			}
+			fields[key] = json.RawMessage(v)
+		case "tags":
+			// как в PUT: через запятую; пустое значение снимает все теги
+			tags := []string{}
+			for _, t := range strings.Split(v, ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					tags = append(tags, t)
+				}
+			}
+			fields[key] = tags
+		case "file":
+			// текстовое поле file без содержимого — удалить файл; сам файл приходит частью формы
+			if v != "" {
+				return nil, errors.New("file must be sent as a file part")
+			}
+			fields["file_meta"] = nil
+		case "upload_id":
+			if v == "" {
+				return nil, errors.New("upload_id must not be empty")
+			}
+			fields[key] = v
+		default:
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+	}
+	return fields, nil
+}
+
+// patchStringValue нормализует строковые поля; дата приводится к YYYY-MM-DD
+func patchStringValue(key, v string) (string, error) {
+	if key != "document_date" {
+		return v, nil
+	}
+	t, err := parseDateFlexible(v)
+	if err != nil {
+		return "", errors.New("invalid document_date")
+	}
+	return t.Format("2006-01-02"), nil
+}
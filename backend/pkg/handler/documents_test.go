@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/pkg/service"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchRepo отвечает на поиск заданной ошибкой, как DocumentPostgres после pgError
+type searchRepo struct {
+	repository.Document
+	err error
+}
+
+func (r searchRepo) SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, int64, error) {
+	return nil, 0, r.err
+}
+
+func TestSearchDocumentsErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		query  string
+		err    error
+		status int
+	}{
+		{name: "type out of int range", query: "type=99999999999", err: fmt.Errorf("%w: value out of range", repository.ErrInvalidInput), status: http.StatusBadRequest},
+		{name: "invalid sort", query: "sort=author", status: http.StatusBadRequest},
+		{name: "database failure", query: "type=1", err: errors.New("connection refused"), status: http.StatusInternalServerError},
+		{name: "ok", query: "type=1", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&service.Service{Document: service.NewDocumentService(searchRepo{err: tt.err})}, nil)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/documents?"+tt.query, nil)
+
+			h.searchDocumentsByTag(c)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
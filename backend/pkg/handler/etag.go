@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"archive"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag документа — номер его версии (documents.version): меняется при каждой правке и восстановлении
+func documentETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// representationETag — ETag ответа GET /:id: версия и хэш тела. Ответ зависит и от того, что
+// version не меняет: прав запрашивающего, выданных доступов, вложений. If-Match читает только версию
+func representationETag(version int64, body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + strconv.FormatInt(version, 10) + "-" + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// documentRepresentation — тело ответа GET /:id и его ETag. Тем же телом и ETag отвечает 412,
+// поэтому current из 412 годится для If-None-Match на следующий GET
+func documentRepresentation(item archive.DocumentSecure) ([]byte, string, error) {
+	if item.FileMeta != nil {
+		// скачивание только через API: проверка доступа и запись в журнал
+		item.DownloadURL = documentFileURL(item.DocID)
+	}
+	withAttachmentURLs(item.Files)
+
+	body, err := json.Marshal(item)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, representationETag(item.Version, body), nil
+}
+
+// etagMatches — сравнение со списком из If-None-Match/If-Match ("*" совпадает с любым)
+func etagMatches(header, etag string) bool {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "*" || strings.TrimPrefix(part, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion читает обязательный If-Match для правок документа (PUT/PATCH/DELETE, восстановление версии).
+// "*" — без проверки версии (nil); без заголовка — 428, с нераспознанным значением — 400.
+func ifMatchVersion(c *gin.Context) (*int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		newErrorResponse(c, http.StatusPreconditionRequired, "If-Match header is required")
+		return nil, false
+	}
+	if header == "*" {
+		return nil, true
+	}
+	tag, _, _ := strings.Cut(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), "-")
+	v, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || v <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid If-Match header")
+		return nil, false
+	}
+	return &v, true
+}
+
+// preconditionFailed — 412 с текущим состоянием документа, чтобы клиент мог показать слияние
+func (h *Handler) preconditionFailed(c *gin.Context, docID int64, err error) {
+	current, getErr := h.services.Document.GetDocumentByID(c.Request.Context(), docID)
+	if getErr != nil {
+		documentError(c, getErr)
+		return
+	}
+	body, etag, mErr := documentRepresentation(current)
+	if mErr != nil {
+		newErrorResponse(c, http.StatusInternalServerError, mErr.Error())
+		return
+	}
+	c.Header("ETag", etag)
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, preconditionFailedResponse{
+		Message: err.Error(),
+		Current: body,
+	})
+}
+
+type preconditionFailedResponse struct {
+	Message string          `json:"message"`
+	Current json.RawMessage `json:"current"` // то же тело, что у GET /:id
+}
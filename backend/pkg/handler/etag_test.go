@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/pkg/service"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		want   bool
+	}{
+		{name: "exact", header: `"3"`, etag: `"3"`, want: true},
+		{name: "weak", header: `W/"3"`, etag: `"3"`, want: true},
+		{name: "wildcard", header: `*`, etag: `"3"`, want: true},
+		{name: "list", header: `"1", "2" ,"3"`, etag: `"3"`, want: true},
+		{name: "representation tag", header: `"3-0011223344556677"`, etag: `"3-0011223344556677"`, want: true},
+		{name: "other version", header: `"2"`, etag: `"3"`},
+		{name: "version without hash", header: `"3"`, etag: `"3-0011223344556677"`},
+		{name: "unquoted", header: `3`, etag: `"3"`},
+		{name: "empty", header: ``, etag: `"3"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, tt.etag); got != tt.want {
+				t.Fatalf("etagMatches(%q, %q) = %v, want %v", tt.header, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		header  string
+		version int64 // 0 — nil
+		ok      bool
+		status  int
+	}{
+		{name: "document etag", header: `"7"`, version: 7, ok: true},
+		{name: "weak etag", header: `W/"7"`, version: 7, ok: true},
+		{name: "representation etag", header: `"7-0011223344556677"`, version: 7, ok: true},
+		{name: "surrounding spaces", header: `  "7"  `, version: 7, ok: true},
+		{name: "wildcard", header: `*`, ok: true},
+		{name: "missing", header: ``, status: http.StatusPreconditionRequired},
+		{name: "not a number", header: `"abc"`, status: http.StatusBadRequest},
+		{name: "zero", header: `"0"`, status: http.StatusBadRequest},
+		{name: "negative", header: `"-1"`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/api/documents/1", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("If-Match", tt.header)
+			}
+
+			v, ok := ifMatchVersion(c)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				if w.Code != tt.status {
+					t.Fatalf("status = %d, want %d", w.Code, tt.status)
+				}
+				return
+			}
+			switch {
+			case tt.version == 0 && v != nil:
+				t.Fatalf("version = %d, want nil", *v)
+			case tt.version != 0 && (v == nil || *v != tt.version):
+				t.Fatalf("version = %v, want %d", v, tt.version)
+			}
+		})
+	}
+}
+
+func TestRepresentationETag(t *testing.T) {
+	a := representationETag(3, []byte(`{"id":1}`))
+	if a != representationETag(3, []byte(`{"id":1}`)) {
+		t.Fatal("representationETag must be deterministic")
+	}
+	if a == representationETag(3, []byte(`{"id":2}`)) {
+		t.Fatal("different bodies must give different tags")
+	}
+	if !etagMatches(a, a) {
+		t.Fatal("tag must match itself")
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/documents/1", nil)
+	c.Request.Header.Set("If-Match", a)
+	if v, ok := ifMatchVersion(c); !ok || v == nil || *v != 3 {
+		t.Fatalf("If-Match %s: version %v, ok %v", a, v, ok)
+	}
+}
+
+// documentRepo отдаёт один документ, как GetDocumentByID после правки другим пользователем
+type documentRepo struct {
+	repository.Document
+	doc archive.DocumentSecure
+}
+
+func (r documentRepo) GetDocumentByID(ctx context.Context, id int64) (archive.DocumentSecure, error) {
+	doc := r.doc
+	doc.Files = nil
+	return doc, nil
+}
+
+func (r documentRepo) ListFiles(ctx context.Context, docID int64) ([]archive.DocumentFile, error) {
+	return append([]archive.DocumentFile(nil), r.doc.Files...), nil
+}
+
+func TestPreconditionFailedETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		doc  archive.DocumentSecure
+	}{
+		{name: "without file", doc: archive.DocumentSecure{DocID: 1, Title: "Plan", Version: 3}},
+		{
+			name: "with file and attachments",
+			doc: archive.DocumentSecure{
+				DocID: 1, Title: "Plan", Version: 4,
+				FileMeta: &archive.FileMeta{Key: "a", Sha256: "aa"},
+				Files:    []archive.DocumentFile{{ID: 7, DocumentID: 1, Position: 1, Role: "preview"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&service.Service{Document: service.NewDocumentService(documentRepo{doc: tt.doc})}, nil)
+			get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest(http.MethodGet, "/api/documents/1", nil)
+				if ifNoneMatch != "" {
+					c.Request.Header.Set("If-None-Match", ifNoneMatch)
+				}
+				c.Params = gin.Params{{Key: "id", Value: "1"}}
+				h.getDocumentByID(c)
+				c.Writer.WriteHeaderNow() // c.Status без тела пишет код только при завершении запроса
+				return w
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/api/documents/1", nil)
+			h.preconditionFailed(c, 1, repository.ErrPreconditionFailed)
+			if w.Code != http.StatusPreconditionFailed {
+				t.Fatalf("status = %d, want 412", w.Code)
+			}
+			var resp struct {
+				Current json.RawMessage `json:"current"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			etag := w.Header().Get("ETag")
+			if etag != representationETag(tt.doc.Version, resp.Current) {
+				t.Fatalf("412 ETag %s does not describe the current body", etag)
+			}
+
+			got := get("")
+			if got.Header().Get("ETag") != etag {
+				t.Fatalf("GET ETag %s, 412 ETag %s", got.Header().Get("ETag"), etag)
+			}
+			if got.Body.String() != string(resp.Current) {
+				t.Fatalf("GET body %s, 412 current %s", got.Body.String(), resp.Current)
+			}
+			if got := get(etag); got.Code != http.StatusNotModified {
+				t.Fatalf("If-None-Match with the 412 ETag: status %d, want 304", got.Code)
+			}
+		})
+	}
+}
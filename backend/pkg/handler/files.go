@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"archive"
+	"archive/storage"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// documentFileURL — ссылка на скачивание файла документа через API
+func documentFileURL(docID int64) string {
+	return "/api/documents/" + strconv.FormatInt(docID, 10) + "/file"
+}
+
+// attachmentURL — ссылка на скачивание вложения через API
+func attachmentURL(docID, fileID int64) string {
+	return "/api/documents/" + strconv.FormatInt(docID, 10) + "/files/" + strconv.FormatInt(fileID, 10)
+}
+
+// uploadDocumentFile загружает файл из формы в хранилище; extractText — извлечь текст для поиска
+// (только для основного файла: текст вложений не индексируется)
+func (h *Handler) uploadDocumentFile(c *gin.Context, fileHdr *multipart.FileHeader, extractText bool) (*archive.FileMeta, *string, error) {
+	f, err := fileHdr.Open()
+	if err != nil {
+		return nil, nil, errors.New("failed to open uploaded file")
+	}
+	defer f.Close()
+
+	contentType := fileHdr.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	meta, err := h.storage.UploadStream(c.Request.Context(), fileHdr.Filename, f, fileHdr.Size, contentType)
+	if err != nil {
+		return nil, nil, errors.New("failed to upload file")
+	}
+	fm := &archive.FileMeta{
+		Name:     path.Base(fileHdr.Filename),
+		Provider: meta.Provider,
+		Bucket:   meta.Bucket,
+		Key:      meta.Key,
+		Mime:     meta.Mime,
+		Size:     meta.Size,
+		Sha256:   meta.Sha256,
+	}
+	if !extractText {
+		return fm, nil, nil
+	}
+	return fm, extractPlainText(f, contentType), nil
+}
+
+// GET /api/documents/:id/file?version=N — файл документа через API: право просмотра проверяется в БД,
+// скачивание пишется в журнал; Range/If-Range и условные запросы обрабатывает http.ServeContent
+func (h *Handler) downloadDocumentFile(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+	var version *int64
+	if v := c.Query("version"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid version")
+			return
+		}
+		version = &n
+	}
+
+	fm, err := h.services.Document.OpenDocumentFile(c.Request.Context(), docID, version)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+
+	h.serveStoredFile(c, docID, fm, func() error {
+		return h.services.Document.LogDocumentDownload(c.Request.Context(), docID, version, c.GetHeader("Range"))
+	})
+}
+
+// inlineTypes — что можно показать в браузере (?inline=true); остальное, в т.ч. HTML и SVG,
+// отдаётся только вложением как application/octet-stream
+var inlineTypes = map[string]bool{
+	"application/pdf": true,
+	"text/plain":      true,
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/avif":      true,
+	"image/bmp":       true,
+	"image/tiff":      true,
+}
+
+// servedContentType — Content-Type и Content-Disposition для отдачи файла:
+// тип из списка inlineTypes сохраняется, прочие заменяются на application/octet-stream
+func servedContentType(mimeType string, inline bool) (contentType, disposition string) {
+	mt, params, err := mime.ParseMediaType(mimeType)
+	if err != nil || !inlineTypes[mt] {
+		return "application/octet-stream", "attachment"
+	}
+	contentType = mt
+	if cs, ok := params["charset"]; ok && mt == "text/plain" {
+		contentType = mime.FormatMediaType(mt, map[string]string{"charset": cs})
+	}
+	if inline {
+		return contentType, "inline"
+	}
+	return contentType, "attachment"
+}
+
+// serveStoredFile отдаёт объект из хранилища: Content-Disposition с исходным именем,
+// ETag/Digest по sha256, Range/If-Range и условные запросы — через http.ServeContent.
+// logDownload пишет скачивание в журнал, когда объект уже открыт
+func (h *Handler) serveStoredFile(c *gin.Context, docID int64, fm archive.FileMeta, logDownload func() error) {
+	obj, info, err := h.storage.Open(c.Request.Context(), fm.Bucket, fm.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			logrus.Errorf("document %d: stored object %s/%s is missing", docID, fm.Bucket, fm.Key)
+			newErrorResponse(c, http.StatusNotFound, "file not found in storage")
+			return
+		}
+		newErrorResponse(c, http.StatusBadGateway, "failed to open file: "+err.Error())
+		return
+	}
+	defer obj.Close()
+
+	if err := logDownload(); err != nil {
+		documentError(c, err)
+		return
+	}
+
+	mimeType := fm.Mime
+	if mimeType == "" {
+		mimeType = info.ContentType
+	}
+	contentType, disposition := servedContentType(mimeType, c.Query("inline") == "true")
+	name := fileName(fm)
+
+	c.Header("Content-Type", contentType)
+	if cd := mime.FormatMediaType(disposition, map[string]string{"filename": name}); cd != "" {
+		c.Header("Content-Disposition", cd)
+	} else {
+		c.Header("Content-Disposition", disposition)
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	if sum, err := hex.DecodeString(fm.Sha256); err == nil && len(sum) == 32 {
+		b64 := base64.StdEncoding.EncodeToString(sum)
+		// ETag по содержимому нужен для If-Range; Digest (RFC 3230) и Repr-Digest (RFC 9530) — для проверки целостности
+		c.Header("ETag", `"`+fm.Sha256+`"`)
+		c.Header("Digest", "sha-256="+b64)
+		c.Header("Repr-Digest", "sha-256=:"+b64+":")
+	}
+
+	http.ServeContent(c.Writer, c.Request, name, info.LastModified, obj)
+}
+
+// ключи MinIO до адресации по содержимому имели вид <prefix>/<20060102-150405>-<имя>
+var keyTimestampPrefix = regexp.MustCompile(`^\d{8}-\d{6}-`)
+
+// fileName — исходное имя файла; для файлов, загруженных до появления FileMeta.Name, берётся из ключа
+func fileName(fm archive.FileMeta) string {
+	if fm.Name != "" {
+		return fm.Name
+	}
+	return keyTimestampPrefix.ReplaceAllString(path.Base(fm.Key), "")
+}
+
+func parseFileParams(c *gin.Context) (docID int64, fileID int64, ok bool) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return 0, 0, false
+	}
+	fileID, err = strconv.ParseInt(c.Param("file_id"), 10, 64)
+	if err != nil || fileID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid file id")
+		return 0, 0, false
+	}
+	return docID, fileID, true
+}
+
+func withAttachmentURLs(files []archive.DocumentFile) []archive.DocumentFile {
+	for i := range files {
+		files[i].DownloadURL = attachmentURL(files[i].DocumentID, files[i].ID)
+	}
+	return files
+}
+
+// GET /api/documents/:id/files — вложения по порядку
+func (h *Handler) listDocumentFiles(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	files, err := h.services.Document.ListFiles(c.Request.Context(), docID)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withAttachmentURLs(files))
+}
+
+// POST /api/documents/:id/files — multipart: file (или upload_id), role, position (по умолчанию в конец)
+func (h *Handler) addDocumentFile(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	var position *int
+	if v := c.PostForm("position"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid position")
+			return
+		}
+		position = &n
+	}
+	fm, ok := h.formAttachmentFile(c, docID)
+	if !ok {
+		return
+	}
+	if fm == nil {
+		newErrorResponse(c, http.StatusBadRequest, "file or upload_id is required")
+		return
+	}
+
+	id, err := h.services.Document.AddFile(c.Request.Context(), docID, c.PostForm("role"), *fm, position)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "download_url": attachmentURL(docID, id)})
+}
+
+// PUT /api/documents/:id/files/:file_id — multipart: file (или upload_id) и/или role
+func (h *Handler) replaceDocumentFile(c *gin.Context) {
+	docID, fileID, ok := parseFileParams(c)
+	if !ok {
+		return
+	}
+
+	var role *string
+	if v := c.PostForm("role"); v != "" {
+		role = &v
+	}
+	fm, ok := h.formAttachmentFile(c, docID)
+	if !ok {
+		return
+	}
+
+	if err := h.services.Document.ReplaceFile(c.Request.Context(), docID, fileID, role, fm); err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// DELETE /api/documents/:id/files/:file_id
+func (h *Handler) removeDocumentFile(c *gin.Context) {
+	docID, fileID, ok := parseFileParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.services.Document.RemoveFile(c.Request.Context(), docID, fileID); err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+type reorderFilesInput struct {
+	FileIDs []int64 `json:"file_ids" binding:"required"`
+}
+
+// PUT /api/documents/:id/files — body: file_ids (все вложения в новом порядке)
+func (h *Handler) reorderDocumentFiles(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	var input reorderFilesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+
+	if err := h.services.Document.ReorderFiles(c.Request.Context(), docID, input.FileIDs); err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// GET /api/documents/:id/files/:file_id — скачивание вложения, как GET /:id/file
+func (h *Handler) downloadDocumentAttachment(c *gin.Context) {
+	docID, fileID, ok := parseFileParams(c)
+	if !ok {
+		return
+	}
+
+	fm, err := h.services.Document.OpenAttachment(c.Request.Context(), docID, fileID)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	h.serveStoredFile(c, docID, fm, func() error {
+		return h.services.Document.LogAttachmentDownload(c.Request.Context(), docID, fileID, c.GetHeader("Range"))
+	})
+}
+
+// GET /api/documents/:id/duplicates — другие документы, где тот же файл (по SHA-256) —
+// основной файл или вложение; видны только доступные пользователю документы
+func (h *Handler) listSharedFiles(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	files, err := h.services.Document.SharedFiles(c.Request.Context(), docID)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	for i := range files {
+		for j := range files[i].Documents {
+			d := &files[i].Documents[j]
+			if d.FileID != nil {
+				d.DownloadURL = attachmentURL(d.DocumentID, *d.FileID)
+			} else {
+				d.DownloadURL = documentFileURL(d.DocumentID)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, files)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"archive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/admin/fixity?all=&document_id=&limit=&offset= — результаты проверки целостности
+// по файлам документов; по умолчанию только сбои (mismatch, missing, error)
+func (h *Handler) fixityReport(c *gin.Context) {
+	adminID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var filter archive.FixityReportFilter
+	if v := c.Query("all"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid all")
+			return
+		}
+		filter.All = b
+	}
+	if v := c.Query("document_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid document_id")
+			return
+		}
+		filter.DocumentID = &id
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid offset")
+			return
+		}
+		filter.Offset = n
+	}
+
+	records, err := h.services.Fixity.Report(c.Request.Context(), adminID, filter)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, records)
+}
+
+// POST /api/admin/fixity/documents/:id — внеочередная проверка файлов документа;
+// чтение идёт с тем же ограничением скорости, что и у фоновой задачи
+func (h *Handler) checkDocumentFixity(c *gin.Context) {
+	adminID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	extendDeadlines(c, 30*time.Minute)
+	checks, err := h.services.Fixity.CheckDocument(c.Request.Context(), adminID, docID)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, checks)
+}
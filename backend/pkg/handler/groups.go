@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"archive"
+	"archive/pkg/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupError — ошибки валидации -> 400, отказы БД -> 403/404/409/400/500
+func groupError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidGroupInput) {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	documentError(c, err)
+}
+
+// groupTarget — requester из токена и группа из :id
+func groupTarget(c *gin.Context) (requesterID int64, groupID int64, ok bool) {
+	requesterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return 0, 0, false
+	}
+	groupID, err = strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || groupID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return 0, 0, false
+	}
+	return requesterID, groupID, true
+}
+
+// GET /api/groups — все группы с числом участников и признаком членства
+func (h *Handler) listGroups(c *gin.Context) {
+	requesterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	groups, err := h.services.Groups.ListGroups(c.Request.Context(), requesterID)
+	if err != nil {
+		groupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// POST /api/groups  body: { "name": "Отдел картографии", "description": "..." }
+func (h *Handler) createGroup(c *gin.Context) {
+	requesterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var in archive.GroupInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+
+	id, err := h.services.Groups.CreateGroup(c.Request.Context(), requesterID, in)
+	if err != nil {
+		groupError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// PUT /api/groups/:id — отсутствующие поля не меняются
+func (h *Handler) updateGroup(c *gin.Context) {
+	requesterID, groupID, ok := groupTarget(c)
+	if !ok {
+		return
+	}
+
+	var in archive.GroupInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+
+	if err := h.services.Groups.UpdateGroup(c.Request.Context(), requesterID, groupID, in); err != nil {
+		groupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// DELETE /api/groups/:id — доступы группы к документам удаляются вместе с ней
+func (h *Handler) deleteGroup(c *gin.Context) {
+	requesterID, groupID, ok := groupTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.services.Groups.DeleteGroup(c.Request.Context(), requesterID, groupID); err != nil {
+		groupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// GET /api/groups/:id/members — участникам группы и groups.manage
+func (h *Handler) listGroupMembers(c *gin.Context) {
+	requesterID, groupID, ok := groupTarget(c)
+	if !ok {
+		return
+	}
+
+	members, err := h.services.Groups.ListMembers(c.Request.Context(), requesterID, groupID)
+	if err != nil {
+		groupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+type addGroupMembersInput struct {
+	UserIDs []int64 `json:"user_ids" binding:"required"`
+}
+
+// POST /api/groups/:id/members  body: { "user_ids": [1, 2, 3] } — уже состоящие пропускаются
+func (h *Handler) addGroupMembers(c *gin.Context) {
+	requesterID, groupID, ok := groupTarget(c)
+	if !ok {
+		return
+	}
+
+	var in addGroupMembersInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+
+	added, err := h.services.Groups.AddMembers(c.Request.Context(), requesterID, groupID, in.UserIDs)
+	if err != nil {
+		groupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"added": added})
+}
+
+// DELETE /api/groups/:id/members/:user_id
+func (h *Handler) removeGroupMember(c *gin.Context) {
+	requesterID, groupID, ok := groupTarget(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid user_id")
+		return
+	}
+
+	if err := h.services.Groups.RemoveMember(c.Request.Context(), requesterID, groupID, userID); err != nil {
+		groupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
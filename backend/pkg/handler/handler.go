@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"archive"
 	"archive/pkg/service"
 	"archive/storage"
 
@@ -25,7 +26,8 @@ func (h *Handler) InitRoutes() *gin.Engine {
 
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"*"}
-	config.AllowHeaders = []string{"Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With"}
+	config.AllowHeaders = append([]string{"Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, If-None-Match"}, tusRequestHeaders...)
+	config.ExposeHeaders = append([]string{"ETag"}, tusExposeHeaders...)
 	router.Use(cors.New(config))
 
 	auth := router.Group("/auth")
@@ -33,52 +35,174 @@ func (h *Handler) InitRoutes() *gin.Engine {
 		auth.POST("/sign-up", h.signUp)
 		auth.POST("/sign-in", h.signIn)
 		auth.POST("/refresh-token", h.refreshToken)
+		auth.POST("/logout", h.logout)
+		auth.POST("/logout-all", h.userIdentityMiddleware, h.logoutAll)
+	}
+
+	router.GET("/.well-known/jwks.json", h.jwks)
+
+	// local storage: files by signed URL (access is checked when the URL is issued)
+	if local, ok := h.storage.(*storage.LocalStorage); ok {
+		router.GET(storage.LocalURLPrefix+"/*path", gin.WrapH(local))
+		router.HEAD(storage.LocalURLPrefix+"/*path", gin.WrapH(local))
+		router.PUT(storage.LocalURLPrefix+"/*path", gin.WrapH(local)) // presigned uploads
 	}
 
 	ref := router.Group("/api")
 	{
 
-		ref.GET("/users", h.getUsers)
-		ref.PUT("/users/full_name", h.updateUserFullName)
-		ref.PUT("/users/password", h.changeUserPassword)
+		ref.GET("/users", h.userIdentityMiddleware, h.getUsers)
+		ref.PUT("/users/full_name", h.userIdentityMiddleware, h.updateUserFullName)
+		ref.PUT("/users/password", h.passwordChangeIdentityMiddleware, h.changeUserPassword)
+
+		// dictionaries: read is public, write requires dictionaries.write
+		dictWrite := []gin.HandlerFunc{h.userIdentityMiddleware, h.requirePermission(archive.PermDictionariesWrite)}
 
 		// document types
-		ref.POST("/document_types", h.createDocumentType)
+		ref.POST("/document_types", append(dictWrite, h.createDocumentType)...)
 		ref.GET("/document_types", h.getAllDocumentTypes)
 		ref.GET("/document_types/:id", h.getDocumentTypeByID)
-		ref.PUT("/document_types/:id", h.updateDocumentType)
-		ref.DELETE("/document_types/:id", h.deleteDocumentType)
+		ref.PUT("/document_types/:id", append(dictWrite, h.updateDocumentType)...)
+		ref.DELETE("/document_types/:id", append(dictWrite, h.deleteDocumentType)...)
 
 		// tags
-		ref.POST("/tags", h.createTag)
+		ref.POST("/tags", append(dictWrite, h.createTag)...)
 		ref.GET("/tags", h.getAllTags)
 		ref.GET("/tags/:id", h.getTagByID)
-		ref.PUT("/tags/:id", h.updateTag)
-		ref.DELETE("/tags/:id", h.deleteTag)
+		ref.PUT("/tags/:id", append(dictWrite, h.updateTag)...)
+		ref.DELETE("/tags/:id", append(dictWrite, h.deleteTag)...)
 	}
 
 	// document endpoints (protected)
 	docs := router.Group("/api/documents")
 	docs.Use(h.userIdentityMiddleware)
 	{
-		docs.POST("", h.createDocument)
-		docs.GET("", h.searchDocumentsByTag) // query params: tag=..., limit, offset, author, type, date_from, date_to
-		docs.GET("/:id", h.getDocumentByID)
-		docs.PUT("/:id", h.updateDocument)
-		docs.DELETE("/:id", h.deleteDocument)
-
-		// permission management (admin)
-		docs.POST("/:id/permissions", h.setDocumentPermission)      // body: target_user_id, can_view, can_edit
-		docs.DELETE("/:id/permissions", h.removeDocumentPermission) // body: target_user_id
+		docs.POST("", h.createDocument)               // multipart: поля документа, file или upload_id
+		docs.GET("", h.searchDocumentsByTag)          // query params: q, tag, author, type, date_from, date_to, bbox, near, radius_m, sort, order, limit, offset|cursor
+		docs.POST("/search", h.searchDocumentsByArea) // body: те же поля + geometry (GeoJSON Polygon) и relation
+		docs.GET("/shared-with-me", h.getSharedWithMe)
+		docs.GET("/:id", h.getDocumentByID)   // ETag; If-None-Match -> 304
+		docs.PUT("/:id", h.updateDocument)    // If-Match обязателен, устаревшая версия -> 412
+		docs.PATCH("/:id", h.patchDocument)   // только присланные поля (JSON или multipart), null очищает; If-Match обязателен
+		docs.DELETE("/:id", h.deleteDocument) // в корзину; If-Match обязателен
+		docs.POST("/:id/restore", h.restoreDocument)
+		docs.GET("/:id/file", h.downloadDocumentFile) // query: version; Range/If-Range, Digest; пишется в журнал
+		docs.PUT("/:id/text", h.setDocumentFileText)  // body: text (извлечённый текст файла для поиска)
+
+		// attachments: read requires view access, changes require edit access
+		docs.GET("/:id/files", h.listDocumentFiles)
+		docs.POST("/:id/files", h.addDocumentFile)                    // multipart: file or upload_id, role, position
+		docs.PUT("/:id/files", h.reorderDocumentFiles)                // body: file_ids
+		docs.GET("/:id/files/:file_id", h.downloadDocumentAttachment) // Range/If-Range, Digest; пишется в журнал
+		docs.PUT("/:id/files/:file_id", h.replaceDocumentFile)        // multipart: file? or upload_id?, role?
+		docs.DELETE("/:id/files/:file_id", h.removeDocumentFile)
+		docs.GET("/:id/duplicates", h.listSharedFiles) // other documents with the same stored file
+
+		// version history: read requires view access, restore requires edit access
+		docs.GET("/:id/versions", h.listDocumentVersions)
+		docs.GET("/:id/versions/diff", h.diffDocumentVersions) // query: from, to (default: current)
+		docs.GET("/:id/versions/:version", h.getDocumentVersion)
+		docs.POST("/:id/versions/:version/restore", h.restoreDocumentVersion)
+
+		// sharing: document author, can_share holders or permissions.manage (checked in DB)
+		docs.GET("/:id/permissions", h.listDocumentPermissions)
+		docs.POST("/:id/access-requests", h.requestDocumentAccess)             // body: level (view|edit), reason
+		docs.POST("/:id/permissions", h.setDocumentPermission)                 // body: user_id, can_view, can_edit, can_share, expires_at
+		docs.DELETE("/:id/permissions", h.removeDocumentPermission)            // body: target_user_id
+		docs.POST("/:id/group-permissions", h.setDocumentGroupPermission)      // body: group_id, can_view, can_edit, can_share, expires_at
+		docs.DELETE("/:id/group-permissions", h.removeDocumentGroupPermission) // body: group_id
+	}
+
+	// uploads: resumable (tus 1.0) or direct to storage by presigned URL;
+	// the finished upload is attached to a document by upload_id
+	uploads := router.Group("/api/uploads")
+	uploads.Use(h.tusResumable)
+	{
+		uploads.OPTIONS("", h.tusOptions) // discovery: Tus-Version, Tus-Extension, Tus-Max-Size
+		uploads.OPTIONS("/:id", h.tusOptions)
+		uploads.POST("", h.userIdentityMiddleware, h.createUpload)                // tus: Upload-Length, Upload-Metadata (filename, filetype); otherwise JSON body for a presigned PUT
+		uploads.POST("/:id/finalize", h.userIdentityMiddleware, h.finalizeUpload) // presigned uploads: verify and move to the permanent key
+		uploads.HEAD("/:id", h.userIdentityMiddleware, h.headUpload)
+		uploads.GET("/:id", h.userIdentityMiddleware, h.getUpload)
+		uploads.PATCH("/:id", h.userIdentityMiddleware, h.patchUpload) // headers: Upload-Offset; body: application/offset+octet-stream
+		uploads.DELETE("/:id", h.userIdentityMiddleware, h.deleteUpload)
+	}
+
+	// trash: documents the user may restore (author, editors, deleter or documents.delete_any)
+	trash := router.Group("/api/trash")
+	trash.Use(h.userIdentityMiddleware)
+	{
+		trash.GET("", h.getTrash)
+	}
+
+	// user groups: any user can list groups, membership changes require groups.manage
+	groups := router.Group("/api/groups")
+	groups.Use(h.userIdentityMiddleware)
+	{
+		groups.GET("", h.listGroups)
+		groups.POST("", h.requirePermission(archive.PermGroupsManage), h.createGroup)    // body: name, description
+		groups.PUT("/:id", h.requirePermission(archive.PermGroupsManage), h.updateGroup) // body: name?, description?
+		groups.DELETE("/:id", h.requirePermission(archive.PermGroupsManage), h.deleteGroup)
+		groups.GET("/:id/members", h.listGroupMembers)                                                // members of the group and groups.manage (checked in DB)
+		groups.POST("/:id/members", h.requirePermission(archive.PermGroupsManage), h.addGroupMembers) // body: user_ids
+		groups.DELETE("/:id/members/:user_id", h.requirePermission(archive.PermGroupsManage), h.removeGroupMember)
+	}
+
+	// access requests: requester sees own requests, document sharers see the incoming queue
+	access := router.Group("/api/access-requests")
+	access.Use(h.userIdentityMiddleware)
+	{
+		access.GET("/mine", h.listMyAccessRequests)
+		access.GET("/incoming", h.listIncomingAccessRequests) // query: status (default pending, all)
+		access.POST("/:id/approve", h.approveAccessRequest)   // body: comment?, expires_at?
+		access.POST("/:id/reject", h.rejectAccessRequest)     // body: comment?
+		access.DELETE("/:id", h.cancelAccessRequest)
+	}
+
+	// vector tiles for the map (protected: content depends on document visibility)
+	tiles := router.Group("/api/tiles")
+	tiles.Use(h.userIdentityMiddleware)
+	{
+		tiles.GET("/:z/:x/:y", h.getDocumentsTile) // :y = "{y}.mvt"; query: cluster=true
+	}
+
+	// user management (users.manage; every action is written to logs)
+	adminUsers := router.Group("/api/admin/users")
+	adminUsers.Use(h.userIdentityMiddleware, h.requirePermission(archive.PermUsersManage))
+	{
+		adminUsers.GET("", h.adminListUsers)                         // query: q, role_id, disabled, limit, offset
+		adminUsers.POST("", h.adminCreateUser)                       // body: login, password, full_name, role_id
+		adminUsers.PUT("/:id/role", h.adminSetUserRole)              // body: role_id
+		adminUsers.PUT("/:id/disabled", h.adminSetUserDisabled)      // body: disabled
+		adminUsers.POST("/:id/password-reset", h.adminResetPassword) // body: password (optional, generated if empty)
+	}
+
+	// roles: list is also available to users.manage (checked in DB) to assign roles
+	adminRoles := router.Group("/api/admin")
+	adminRoles.Use(h.userIdentityMiddleware)
+	{
+		adminRoles.GET("/permissions", h.listPermissions)
+		adminRoles.GET("/roles", h.listRoles)
+		adminRoles.POST("/roles", h.requirePermission(archive.PermRolesManage), h.createRole)    // body: name, description, permissions
+		adminRoles.PUT("/roles/:id", h.requirePermission(archive.PermRolesManage), h.updateRole) // body: name?, description?, permissions?
+		adminRoles.DELETE("/roles/:id", h.requirePermission(archive.PermRolesManage), h.deleteRole)
+	}
+
+	// stored file integrity (storage.audit); failures are also written to logs as table file_fixity
+	fixity := router.Group("/api/admin/fixity")
+	fixity.Use(h.userIdentityMiddleware, h.requirePermission(archive.PermStorageAudit))
+	{
+		fixity.GET("", h.fixityReport)                       // query: all, document_id, limit, offset
+		fixity.POST("/documents/:id", h.checkDocumentFixity) // re-read all files of the document now
 	}
 
-	// logs endpoints for admin
+	// logs endpoints (logs.read)
 	logs := router.Group("/api/logs")
-	logs.Use(h.userIdentityMiddleware)
+	logs.Use(h.userIdentityMiddleware, h.requirePermission(archive.PermLogsRead))
 	{
-		logs.GET("/by_user", h.getLogsByUser)   // admin only
-		logs.GET("/by_table", h.getLogsByTable) // admin only
-		logs.GET("/by_date", h.getLogsByDate)   // admin only
+		logs.GET("/by_user", h.getLogsByUser)
+		logs.GET("/by_table", h.getLogsByTable)
+		logs.GET("/by_date", h.getLogsByDate)
 	}
 
 	return router
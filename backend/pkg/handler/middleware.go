@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"archive/pkg/repository"
+	"archive/pkg/service"
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -13,6 +17,16 @@ const (
 )
 
 func (h *Handler) userIdentityMiddleware(c *gin.Context) {
+	h.identifyUser(c, false)
+}
+
+// passwordChangeIdentityMiddleware — как userIdentityMiddleware, но пропускает пользователя,
+// которому администратор сбросил пароль: смена пароля — единственное, что ему доступно.
+func (h *Handler) passwordChangeIdentityMiddleware(c *gin.Context) {
+	h.identifyUser(c, true)
+}
+
+func (h *Handler) identifyUser(c *gin.Context, allowPendingPasswordChange bool) {
 	header := c.GetHeader(authorizationHeader)
 	if header == "" {
 		newErrorResponse(c, http.StatusUnauthorized, "empty auth header")
@@ -33,17 +47,47 @@ func (h *Handler) userIdentityMiddleware(c *gin.Context) {
 		return
 	}
 
-	userId, err := h.services.Authorization.ParseToken(c, headerParts[1])
-	if err != nil {
+	userId, err := h.services.Authorization.ParseToken(c.Request.Context(), headerParts[1])
+	switch {
+	case errors.Is(err, service.ErrPasswordChangeRequired) && allowPendingPasswordChange:
+	case errors.Is(err, service.ErrPasswordChangeRequired), errors.Is(err, service.ErrUserDisabled):
+		newErrorResponse(c, http.StatusForbidden, err.Error())
+		c.Abort()
+		return
+	case err != nil:
 		newErrorResponse(c, http.StatusUnauthorized, err.Error())
 		c.Abort()
 		return
 	}
 
 	c.Set(userCtx, userId)
+	// репозиторий берёт requester id из context.Context запроса
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), repository.CtxUserIDKey{}, userId))
 	c.Next()
 }
 
+// requirePermission пропускает запрос, только если у роли пользователя есть право permission.
+// Ставится после userIdentityMiddleware; проверка — та же has_permission, что и в SQL-функциях.
+func (h *Handler) requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserId(c)
+		if err != nil {
+			newErrorResponse(c, http.StatusUnauthorized, "user not authorized")
+			return
+		}
+		ok, err := h.services.Authorization.HasPermission(c.Request.Context(), userID, permission)
+		if err != nil {
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok {
+			newErrorResponse(c, http.StatusForbidden, "permission "+permission+" required")
+			return
+		}
+		c.Next()
+	}
+}
+
 func getUserId(c *gin.Context) (int64, error) {
 	id, ok := c.Get(userCtx)
 	if !ok {
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"archive"
+	"archive/pkg/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func roleError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidRoleInput) {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	newErrorResponse(c, http.StatusForbidden, err.Error())
+}
+
+// GET /api/admin/permissions — справочник прав
+func (h *Handler) listPermissions(c *gin.Context) {
+	perms, err := h.services.Roles.ListPermissions(c.Request.Context())
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, perms)
+}
+
+// GET /api/admin/roles — роли с набором прав и числом пользователей
+func (h *Handler) listRoles(c *gin.Context) {
+	requesterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	roles, err := h.services.Roles.ListRoles(c.Request.Context(), requesterID)
+	if err != nil {
+		roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// POST /api/admin/roles  body: { "name": "archivist", "description": "...", "permissions": ["documents.read_all"] }
+func (h *Handler) createRole(c *gin.Context) {
+	requesterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	var in archive.RoleInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+
+	id, err := h.services.Roles.CreateRole(c.Request.Context(), requesterID, in)
+	if err != nil {
+		roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// PUT /api/admin/roles/:id — отсутствующие поля не меняются; permissions заменяет набор прав
+func (h *Handler) updateRole(c *gin.Context) {
+	requesterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var in archive.RoleInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input body")
+		return
+	}
+
+	if err := h.services.Roles.UpdateRole(c.Request.Context(), requesterID, id, in); err != nil {
+		roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// DELETE /api/admin/roles/:id — системные и назначенные пользователям роли не удаляются
+func (h *Handler) deleteRole(c *gin.Context) {
+	requesterID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	if err := h.services.Roles.DeleteRole(c.Request.Context(), requesterID, id); err != nil {
+		roleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, statusResponse{Status: "ok"})
+}
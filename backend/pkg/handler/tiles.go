@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"archive/pkg/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mvtContentType = "application/vnd.mapbox-vector-tile"
+
+// getDocumentsTile GET /api/tiles/:z/:x/:y.mvt?cluster=true
+func (h *Handler) getDocumentsTile(c *gin.Context) {
+	z, errZ := strconv.Atoi(c.Param("z"))
+	x, errX := strconv.Atoi(c.Param("x"))
+	yStr, ok := strings.CutSuffix(c.Param("y"), ".mvt")
+	if !ok {
+		newErrorResponse(c, http.StatusNotFound, "unsupported tile format")
+		return
+	}
+	y, errY := strconv.Atoi(yStr)
+	if errZ != nil || errX != nil || errY != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid tile coordinates")
+		return
+	}
+	cluster, _ := strconv.ParseBool(c.Query("cluster"))
+
+	tile, err := h.services.Tiles.GetDocumentsTile(c.Request.Context(), z, x, y, cluster)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTile) {
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// содержимое зависит от прав пользователя — общим кэшам его хранить нельзя
+	c.Header("Cache-Control", "private, max-age=60")
+	if len(tile) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Data(http.StatusOK, mvtContentType, tile)
+}
@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/pkg/service"
+	"archive/storage"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Возобновляемые загрузки по протоколу tus 1.0 (https://tus.io/protocols/resumable-upload):
+// POST создаёт загрузку, HEAD сообщает принятое смещение, PATCH дописывает байты с этого
+// смещения, DELETE отменяет. POST без Tus-Resumable выдаёт подписанную ссылку для загрузки
+// прямо в хранилище, после неё вызывается finalize. Завершённая загрузка любого вида
+// прикрепляется к документу полем upload_id.
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	// PATCH может нести сотни мегабайт: общие таймауты сервера для него снимаются
+	tusPatchTimeout = 30 * time.Minute
+)
+
+// заголовки tus,, которые браузерный клиент tus должен отправлять и читать (CORS)
+var (
+	tusRequestHeaders  = []string{"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}
+	tusExposeHeaders   = []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires"}
+	errTusVersion      = errors.New("unsupported tus version")
+	errTusContentType  = errors.New("content type must be application/offset+octet-stream")
+	errTusUploadLength = errors.New("invalid Upload-Length")
+)
+
+// directUploadResponse — прямая загрузка: файл отправляется запросом presigned.method на
+// presigned.url с presigned.headers, затем вызывается finalize_url
+type directUploadResponse struct {
+	archive.Upload
+	Presigned   storage.PresignedUpload `json:"presigned"`
+	FinalizeURL string                  `json:"finalize_url"`
+}
+
+type finalizeUploadInput struct {
+	Sha256 *string `json:"sha256"`
+}
+
+// tusResumable проверяет версию протокола. HEAD и PATCH бывают только у tus; POST и DELETE
+// без заголовка относятся к прямой загрузке, OPTIONS (discovery) и GET его не требуют.
+func (h *Handler) tusResumable(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	v := c.GetHeader("Tus-Resumable")
+	tusOnly := c.Request.Method == http.MethodHead || c.Request.Method == http.MethodPatch
+	if (v != "" && v != tusVersion) || (v == "" && tusOnly) {
+		c.Header("Tus-Version", tusVersion)
+		newErrorResponse(c, http.StatusPreconditionFailed, errTusVersion.Error())
+		return
+	}
+	c.Next()
+}
+
+// uploadError — ошибки сервиса загрузок в статусы tus
+func uploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUploadOffsetMismatch):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrUploadBusy):
+		newErrorResponse(c, http.StatusLocked, err.Error())
+	case errors.Is(err, service.ErrUploadTooLarge):
+		newErrorResponse(c, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, service.ErrUploadNotCompleted), errors.Is(err, service.ErrUploadKind):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrUploadVerification):
+		newErrorResponse(c, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, repository.ErrNotFound):
+		newErrorResponse(c, http.StatusNotFound, "upload not found")
+	default:
+		documentError(c, err)
+	}
+}
+
+func uploadLocation(id string) string {
+	return "/api/uploads/" + id
+}
+
+func setUploadHeaders(c *gin.Context, u archive.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if u.Status == "active" {
+		c.Header("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Header("Cache-Control", "no-store")
+}
+
+// OPTIONS /api/uploads — возможности сервера
+func (h *Handler) tusOptions(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if limit := h.services.Uploads.MaxSize(); limit > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(limit, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/uploads — tus: Upload-Length, Upload-Metadata (filename, filetype в base64);
+// без Tus-Resumable — прямая загрузка в хранилище (createDirectUpload)
+func (h *Handler) createUpload(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if c.GetHeader("Tus-Resumable") == "" {
+		h.createDirectUpload(c, userID)
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, errTusUploadLength.Error())
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	u, err := h.services.Uploads.Create(c.Request.Context(), userID, length, metadata)
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.Header("Location", uploadLocation(u.ID))
+	setUploadHeaders(c, u)
+	c.JSON(http.StatusCreated, u)
+}
+
+// createDirectUpload — body: filename, content_type, size, sha256?; ответ: подписанная ссылка
+// во временный ключ хранилища
+func (h *Handler) createDirectUpload(c *gin.Context, userID int64) {
+	var in archive.DirectUploadInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+	u, presigned, err := h.services.Uploads.CreateDirect(c.Request.Context(), userID, in)
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.Header("Location", uploadLocation(u.ID))
+	c.JSON(http.StatusCreated, directUploadResponse{
+		Upload:      u,
+		Presigned:   presigned,
+		FinalizeURL: uploadLocation(u.ID) + "/finalize",
+	})
+}
+
+// POST /api/uploads/:id/finalize — body: sha256? (если не указан при создании);
+// проверка размера, типа и SHA-256, перенос в постоянный ключ. Ответ — загрузка с file_meta
+func (h *Handler) finalizeUpload(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	var in finalizeUploadInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid input")
+			return
+		}
+	}
+
+	// SHA-256 считается по всему объекту: на больших файлах дольше общего WriteTimeout
+	extendDeadlines(c, tusPatchTimeout)
+	u, err := h.services.Uploads.Finalize(c.Request.Context(), userID, c.Param("id"), in.Sha256)
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// extendDeadlines снимает таймауты сервера для долгого запроса
+func extendDeadlines(c *gin.Context, d time.Duration) {
+	rc := http.NewResponseController(c.Writer)
+	deadline := time.Now().Add(d)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		logrus.Warnf("extend read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		logrus.Warnf("extend write deadline: %v", err)
+	}
+}
+
+// HEAD /api/uploads/:id — сколько байт уже принято
+func (h *Handler) headUpload(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	u, err := h.services.Uploads.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		// у HEAD нет тела: только статус
+		if errors.Is(err, repository.ErrNotFound) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	setUploadHeaders(c, u)
+	c.Status(http.StatusOK)
+}
+
+// GET /api/uploads/:id — состояние загрузки (для прикрепления: status, file_meta)
+func (h *Handler) getUpload(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	u, err := h.services.Uploads.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+	setUploadHeaders(c, u)
+	c.JSON(http.StatusOK, u)
+}
+
+// PATCH /api/uploads/:id — тело application/offset+octet-stream с позиции Upload-Offset
+func (h *Handler) patchUpload(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		newErrorResponse(c, http.StatusUnsupportedMediaType, errTusContentType.Error())
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid Upload-Offset")
+		return
+	}
+
+	extendDeadlines(c, tusPatchTimeout)
+
+	u, err := h.services.Uploads.Write(c.Request.Context(), userID, c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		if errors.Is(err, service.ErrUploadOffsetMismatch) {
+			c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		}
+		uploadError(c, err)
+		return
+	}
+	setUploadHeaders(c, u)
+	c.Status(http.StatusNoContent)
+}
+
+// DELETE /api/uploads/:id — отмена загрузки (tus termination или прямой загрузки)
+func (h *Handler) deleteUpload(c *gin.Context) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if err := h.services.Uploads.Terminate(c.Request.Context(), userID, c.Param("id")); err != nil {
+		uploadError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// parseUploadMetadata — "key base64value,key2 base64value2"; значение может отсутствовать
+func parseUploadMetadata(header string) (map[string]string, error) {
+	out := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata")
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata value for " + key)
+		}
+		out[key] = string(b)
+	}
+	return out, nil
+}
+
+// formDocumentFile — файл документа из формы: часть file загружается в хранилище,
+// поле upload_id берёт файл завершённой загрузки tus. fm == nil — файла в форме нет;
+// ok == false — ответ с ошибкой уже отправлен.
+func (h *Handler) formDocumentFile(c *gin.Context) (fm *archive.FileMeta, text *string, ok bool) {
+	if fileHdr, err := c.FormFile("file"); err == nil {
+		fm, text, err = h.uploadDocumentFile(c, fileHdr, true)
+		if err != nil {
+			newErrorResponse(c, http.StatusInternalServerError, err.Error())
+			return nil, nil, false
+		}
+		return fm, text, true
+	}
+
+	uploadID := strings.TrimSpace(c.PostForm("upload_id"))
+	if uploadID == "" {
+		return nil, nil, true
+	}
+	fm, ok = h.uploadedFile(c, uploadID)
+	if !ok {
+		return nil, nil, false
+	}
+	return fm, h.uploadedFileText(c, fm), true
+}
+
+// uploadedFileText извлекает текст файла завершённой загрузки, как uploadDocumentFile
+// для части file: объект читается из хранилища. Ошибка чтения не мешает прикрепить файл
+func (h *Handler) uploadedFileText(c *gin.Context, fm *archive.FileMeta) *string {
+	if !isPlainText(fm.Mime) {
+		return nil
+	}
+	obj, _, err := h.storage.Open(c.Request.Context(), fm.Bucket, fm.Key)
+	if err != nil {
+		logrus.Warnf("extract text of %s/%s: %v", fm.Bucket, fm.Key, err)
+		return nil
+	}
+	defer obj.Close()
+	return extractPlainText(obj, fm.Mime)
+}
+
+// formAttachmentFile — файл вложения из формы, как formDocumentFile, но без извлечения текста.
+// Право на правку документа проверяется до загрузки в хранилище
+func (h *Handler) formAttachmentFile(c *gin.Context, docID int64) (*archive.FileMeta, bool) {
+	fileHdr, fileErr := c.FormFile("file")
+	uploadID := strings.TrimSpace(c.PostForm("upload_id"))
+	if fileErr != nil && uploadID == "" {
+		return nil, true
+	}
+	if err := h.services.Document.RequireEdit(c.Request.Context(), docID); err != nil {
+		documentError(c, err)
+		return nil, false
+	}
+	if fileErr != nil {
+		return h.uploadedFile(c, uploadID)
+	}
+	fm, _, err := h.uploadDocumentFile(c, fileHdr, false)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return fm, true
+}
+
+// uploadedFile — файл завершённой загрузки текущего пользователя
+func (h *Handler) uploadedFile(c *gin.Context, uploadID string) (*archive.FileMeta, bool) {
+	userID, err := getUserId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusUnauthorized, "user not found")
+		return nil, false
+	}
+	fm, err := h.services.Uploads.FileMeta(c.Request.Context(), userID, uploadID)
+	if err != nil {
+		uploadError(c, err)
+		return nil, false
+	}
+	return &fm, true
+}
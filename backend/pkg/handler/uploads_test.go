@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", header: "", want: map[string]string{}},
+		{name: "blank", header: "   ", want: map[string]string{}},
+		{name: "single pair", header: "filename cGxhbi5wZGY=", want: map[string]string{"filename": "plan.pdf"}},
+		{
+			name:   "several pairs with spaces",
+			header: " filename cGxhbi5wZGY= , filetype YXBwbGljYXRpb24vcGRm",
+			want:   map[string]string{"filename": "plan.pdf", "filetype": "application/pdf"},
+		},
+		{name: "key without value", header: "is_confidential", want: map[string]string{"is_confidential": ""}},
+		{name: "utf-8 value", header: "filename 0L/Qu9Cw0L0ucGRm", want: map[string]string{"filename": "план.pdf"}},
+		{name: "empty pair", header: "filename cGxhbi5wZGY=,", wantErr: true},
+		{name: "only separator", header: ",", wantErr: true},
+		{name: "bad base64", header: "filename plan.pdf", wantErr: true},
+		{name: "url-safe base64", header: "filename _-8=", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,13 +3,19 @@ package handler
 import (
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 var ErrUserNotFound = fmt.Errorf("user id not found in context")
 
+// dateLayout — формат DATE-колонок (document_date и т.п.)
+const dateLayout = "2006-01-02"
+
 // parseDateFlexible пытается распарсить строку в time.Time.
 // Поддерживаемые форматы (попытки в порядке):
 // - RFC3339 / time.RFC3339
@@ -27,6 +33,12 @@ func parseDateFlexible(s string) (time.Time, error) {
 		return t, nil
 	}
 
+	for _, layout := range []string{"2006-01-02 15:04:05", dateLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
 	// Попробуем разобрать как unix timestamp (секунды или миллисекунды)
 	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
 		// 13+ цифр — миллисекунды
@@ -39,3 +51,59 @@ func parseDateFlexible(s string) (time.Time, error) {
 
 	return time.Time{}, errors.New("unsupported date format")
 }
+
+// maxExtractedText — сколько байт текстового файла попадает в полнотекстовый индекс
+const maxExtractedText = 1 << 20
+
+// extractPlainText читает начало уже загруженного текстового файла для поиска.
+// Для остальных типов возвращает nil: их текст присылает внешний экстрактор (PUT /:id/text).
+func extractPlainText(r io.ReadSeeker, contentType string) *string {
+	if !isPlainText(contentType) {
+		return nil
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxExtractedText))
+	if err != nil {
+		return nil
+	}
+	text := string(b)
+	if !utf8.ValidString(text) {
+		// файл мог обрезаться посреди многобайтного символа, либо это не UTF-8
+		text = strings.ToValidUTF8(text, "")
+	}
+	// PostgreSQL не принимает NUL в TEXT
+	text = strings.ReplaceAll(text, "\x00", "")
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	return &text
+}
+
+// isPlainText — текст файла такого типа извлекается сразу при загрузке
+func isPlainText(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mt, "text/") || mt == "application/json" || mt == "application/xml"
+}
+
+// parseFloatList разбирает "a,b,c" ровно из n чисел (bbox, near и т.п.)
+func parseFloatList(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d comma-separated numbers", n)
+	}
+	out := make([]float64, 0, n)
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
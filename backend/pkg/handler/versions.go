@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"archive"
+	"archive/pkg/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseVersionParams — :id документа и :version
+func parseVersionParams(c *gin.Context) (docID int64, version int64, ok bool) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return 0, 0, false
+	}
+	version, err = strconv.ParseInt(c.Param("version"), 10, 64)
+	if err != nil || version <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid version")
+		return 0, 0, false
+	}
+	return docID, version, true
+}
+
+// versionFileURL — ссылка на файл версии через API (старые файлы хранятся, пока на них ссылается версия)
+func versionFileURL(v *archive.DocumentVersion) {
+	if v.FileMeta == nil {
+		return
+	}
+	v.DownloadURL = documentFileURL(v.DocumentID) + "?version=" + strconv.FormatInt(v.Version, 10)
+}
+
+// GET /api/documents/:id/versions — история, новые версии сверху
+func (h *Handler) listDocumentVersions(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	versions, err := h.services.Document.ListVersions(c.Request.Context(), docID)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// GET /api/documents/:id/versions/:version — полный снимок и ссылка на файл версии
+func (h *Handler) getDocumentVersion(c *gin.Context) {
+	docID, version, ok := parseVersionParams(c)
+	if !ok {
+		return
+	}
+
+	v, err := h.services.Document.GetVersion(c.Request.Context(), docID, version)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	versionFileURL(&v)
+	c.JSON(http.StatusOK, v)
+}
+
+// GET /api/documents/:id/versions/diff?from=1&to=3 — по умолчанию to — текущая версия
+func (h *Handler) diffDocumentVersions(c *gin.Context) {
+	docID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || docID <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid document id")
+		return
+	}
+
+	from, err := strconv.ParseInt(c.Query("from"), 10, 64)
+	if err != nil || from <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid from")
+		return
+	}
+
+	var to int64 // 0 — текущая версия
+	if v := c.Query("to"); v != "" {
+		to, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || to <= 0 {
+			newErrorResponse(c, http.StatusBadRequest, "invalid to")
+			return
+		}
+	}
+
+	diff, err := h.services.Document.DiffVersions(c.Request.Context(), docID, from, to)
+	if err != nil {
+		documentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// POST /api/documents/:id/versions/:version/restore — содержимое версии становится новой версией.
+// Как и PUT, требует If-Match с текущим ETag документа.
+func (h *Handler) restoreDocumentVersion(c *gin.Context) {
+	docID, version, ok := parseVersionParams(c)
+	if !ok {
+		return
+	}
+	ifMatch, ok := ifMatchVersion(c)
+	if !ok {
+		return
+	}
+
+	newVersion, err := h.services.Document.RestoreVersion(c.Request.Context(), docID, version, ifMatch)
+	if err != nil {
+		if errors.Is(err, repository.ErrPreconditionFailed) {
+			h.preconditionFailed(c, docID, err)
+			return
+		}
+		documentError(c, err)
+		return
+	}
+	c.Header("ETag", documentETag(newVersion))
+	c.JSON(http.StatusOK, gin.H{"version": newVersion})
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Job — периодическая фоновая задача
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler запускает задачи по интервалу до отмены контекста.
+// Задача с Interval <= 0 считается отключённой.
+type Scheduler struct {
+	jobs []Job
+	wg   sync.WaitGroup
+}
+
+func NewScheduler(jobs ...Job) *Scheduler {
+	return &Scheduler{jobs: jobs}
+}
+
+// Start не блокирует; каждая задача выполняется сразу и затем раз в Interval
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		if job.Interval <= 0 {
+			logrus.Infof("job %s disabled", job.Name)
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Wait дожидается завершения текущих запусков после отмены контекста
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx, job)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.Errorf("job %s panicked: %v", job.Name, r)
+		}
+	}()
+
+	started := time.Now()
+	if err := job.Run(ctx); err != nil {
+		if ctx.Err() == nil {
+			logrus.Errorf("job %s failed: %s", job.Name, err.Error())
+		}
+		return
+	}
+	logrus.Debugf("job %s finished in %s", job.Name, time.Since(started))
+}
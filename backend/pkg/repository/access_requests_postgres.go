@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"archive"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AccessRequestsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAccessRequestsPostgres(db *sqlx.DB) *AccessRequestsPostgres {
+	return &AccessRequestsPostgres{db: db}
+}
+
+const accessRequestColumns = `id, document_id, document_title, user_id, user_login, user_full_name, level, reason, status,
+       created_at, decided_at, decided_by, decided_by_login, decision_comment, grant_expires_at`
+
+// Create -> SELECT fn_request_document_access(p_user_id, p_document_id, p_level, p_reason)
+func (r *AccessRequestsPostgres) Create(ctx context.Context, userID int64, docID int64, level string, reason *string) (int64, error) {
+	var id int64
+	query := `SELECT ` + fnRequestDocumentAccess + `($1,$2,$3,$4)`
+	if err := r.db.QueryRowxContext(ctx, query, userID, docID, level, reason).Scan(&id); err != nil {
+		return 0, pgError(err)
+	}
+	return id, nil
+}
+
+// ListMine -> SELECT * FROM fn_list_my_access_requests(p_user_id)
+func (r *AccessRequestsPostgres) ListMine(ctx context.Context, userID int64) ([]archive.AccessRequest, error) {
+	query := `SELECT ` + accessRequestColumns + ` FROM ` + fnListMyAccessRequests + `($1)`
+	items := make([]archive.AccessRequest, 0)
+	if err := r.db.SelectContext(ctx, &items, query, userID); err != nil {
+		return nil, pgError(err)
+	}
+	return items, nil
+}
+
+// ListIncoming -> SELECT * FROM fn_list_incoming_access_requests(p_user_id, p_status); nil status — все
+func (r *AccessRequestsPostgres) ListIncoming(ctx context.Context, userID int64, status *string) ([]archive.AccessRequest, error) {
+	query := `SELECT ` + accessRequestColumns + ` FROM ` + fnListIncomingAccessRequests + `($1,$2)`
+	items := make([]archive.AccessRequest, 0)
+	if err := r.db.SelectContext(ctx, &items, query, userID, status); err != nil {
+		return nil, pgError(err)
+	}
+	return items, nil
+}
+
+// Decide -> SELECT fn_decide_access_request(p_user_id, p_request_id, p_approve, p_comment, p_expires_at)
+func (r *AccessRequestsPostgres) Decide(ctx context.Context, userID int64, requestID int64, d archive.AccessDecision) error {
+	query := `SELECT ` + fnDecideAccessRequest + `($1,$2,$3,$4,$5)`
+	_, err := r.db.ExecContext(ctx, query, userID, requestID, d.Approve, d.Comment, d.ExpiresAt)
+	return pgError(err)
+}
+
+// Cancel -> SELECT fn_cancel_access_request(p_user_id, p_request_id)
+func (r *AccessRequestsPostgres) Cancel(ctx context.Context, userID int64, requestID int64) error {
+	query := `SELECT ` + fnCancelAccessRequest + `($1,$2)`
+	_, err := r.db.ExecContext(ctx, query, userID, requestID)
+	return pgError(err)
+}
@@ -62,3 +62,73 @@ func (r *AdminPostgres) GetLogsByDate(ctx context.Context, adminID int64, start
 	}
 	return logs, nil
 }
+
+// ListUsers -> SELECT * FROM fn_admin_list_users(p_admin_id, p_query, p_role_id, p_disabled, p_limit, p_offset)
+func (r *AdminPostgres) ListUsers(ctx context.Context, adminID int64, filter archive.UserListFilter) ([]archive.User, int64, error) {
+	query := `SELECT id, login, full_name, role_id, role_name, created_at, disabled, must_change_password, total_count
+		FROM ` + fnAdminListUsers + `($1,$2,$3,$4,$5,$6)`
+
+	var q interface{}
+	if filter.Query != "" {
+		q = filter.Query
+	}
+	var role interface{}
+	if filter.RoleID != nil {
+		role = *filter.RoleID
+	}
+	var disabled interface{}
+	if filter.Disabled != nil {
+		disabled = *filter.Disabled
+	}
+
+	rows, err := r.db.QueryxContext(ctx, query, adminID, q, role, disabled, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, pgError(err)
+	}
+	defer rows.Close()
+
+	users := make([]archive.User, 0)
+	var total int64
+	for rows.Next() {
+		var u archive.User
+		if err := rows.Scan(&u.ID, &u.Login, &u.FullName, &u.RoleID, &u.RoleName, &u.CreatedAt, &u.Disabled, &u.MustChangePassword, &total); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, pgError(err)
+	}
+	return users, total, nil
+}
+
+// CreateUser -> SELECT fn_admin_create_user(p_admin_id, p_login, p_password_hash, p_full_name, p_role_id)
+func (r *AdminPostgres) CreateUser(ctx context.Context, adminID int64, in archive.AdminUserCreateInput, passwordHash string) (int64, error) {
+	var id int64
+	query := `SELECT ` + fnAdminCreateUser + `($1,$2,$3,$4,$5)`
+	if err := r.db.QueryRowxContext(ctx, query, adminID, in.Login, passwordHash, in.FullName, in.RoleID).Scan(&id); err != nil {
+		return 0, pgError(err)
+	}
+	return id, nil
+}
+
+// SetUserRole -> SELECT fn_admin_set_user_role(p_admin_id, p_target_user_id, p_role_id)
+func (r *AdminPostgres) SetUserRole(ctx context.Context, adminID int64, targetUserID int64, roleID int64) error {
+	query := `SELECT ` + fnAdminSetUserRole + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, adminID, targetUserID, roleID)
+	return pgError(err)
+}
+
+// SetUserDisabled -> SELECT fn_admin_set_user_disabled(p_admin_id, p_target_user_id, p_disabled)
+func (r *AdminPostgres) SetUserDisabled(ctx context.Context, adminID int64, targetUserID int64, disabled bool) error {
+	query := `SELECT ` + fnAdminSetUserDisabled + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, adminID, targetUserID, disabled)
+	return pgError(err)
+}
+
+// ResetUserPassword -> SELECT fn_admin_reset_user_password(p_admin_id, p_target_user_id, p_new_password_hash)
+func (r *AdminPostgres) ResetUserPassword(ctx context.Context, adminID int64, targetUserID int64, newPasswordHash string) error {
+	query := `SELECT ` + fnAdminResetUserPassword + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, adminID, targetUserID, newPasswordHash)
+	return pgError(err)
+}
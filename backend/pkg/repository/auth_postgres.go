@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"archive"
 
@@ -30,31 +31,40 @@ func (r *AuthPostgres) CreateUser(ctx context.Context, user archive.User) (int64
 	return id, nil
 }
 
-// GetUser -> вызывает fn_authorize_user(login, password)
-// Примечание: fn_authorize_user в вашем SQL сравнивает значения password напрямую,
-// поэтому caller должен договариваться каким форматом пароля пользоваться (plain vs hash).
-func (r *AuthPostgres) GetUser(ctx context.Context, login, passwordHash string) (archive.User, error) {
-	var u archive.User
-	// fn_authorize_user возвращает (id, login, full_name, role_name)
-	query := `SELECT id, login, full_name FROM ` + fnAuthorizeUser + `($1, $2)`
-	// используем GetContext, чтобы завести результат в struct
-	// но fn_authorize_user - это setof record, поэтому лучше использовать QueryRowxContext + Scan
-	row := r.db.QueryRowxContext(ctx, query, login, passwordHash)
+// GetUser -> вызывает fn_authorize_user(login): пользователь вместе с password_hash.
+// Пароль проверяет сервис; для неизвестного логина возвращается sql.ErrNoRows.
+func (r *AuthPostgres) GetUser(ctx context.Context, login string) (archive.User, error) {
+	query := `SELECT id, login, full_name, role_name, password_hash, disabled, must_change_password FROM ` + fnAuthorizeUser + `($1)`
+	row := r.db.QueryRowxContext(ctx, query, login)
 
-	var id int64
-	var lg string
-	var fullName *string
-	if err := row.Scan(&id, &lg, &fullName); err != nil {
+	var u archive.User
+	if err := row.Scan(&u.ID, &u.Login, &u.FullName, &u.RoleName, &u.PasswordHash, &u.Disabled, &u.MustChangePassword); err != nil {
 		return archive.User{}, err
 	}
-	u.ID = id
-	u.Login = lg
-	if fullName != nil {
-		u.FullName = fullName
-	}
 	return u, nil
 }
 
+// GetPasswordHash -> SELECT fn_get_user_password_hash(p_user_id)
+func (r *AuthPostgres) GetPasswordHash(ctx context.Context, userID int64) (string, error) {
+	var hash string
+	query := `SELECT ` + fnGetUserPasswordHash + `($1)`
+	if err := r.db.QueryRowxContext(ctx, query, userID).Scan(&hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// RehashPassword -> SELECT fn_rehash_user_password(p_user_id, p_old_hash, p_new_hash);
+// false — хеш уже сменился (например, параллельной сменой пароля)
+func (r *AuthPostgres) RehashPassword(ctx context.Context, userID int64, oldHash, newHash string) (bool, error) {
+	var updated bool
+	query := `SELECT ` + fnRehashUserPassword + `($1,$2,$3)`
+	if err := r.db.QueryRowxContext(ctx, query, userID, oldHash, newHash).Scan(&updated); err != nil {
+		return false, err
+	}
+	return updated, nil
+}
+
 func (r *AuthPostgres) GetUsersByIDs(ctx context.Context, ids []int64) ([]archive.User, error) {
 	const q = `SELECT id, full_name FROM ` + "fn_get_users_by_ids" + `($1)`
 	rows, err := r.db.QueryxContext(ctx, q, pq.Array(ids))
@@ -91,9 +101,66 @@ func (r *AuthPostgres) UpdateUserFullName(ctx context.Context, requesterID int64
 	return err
 }
 
-// ChangeUserPassword -> SELECT fn_change_user_password(p_requester_id, p_target_user_id, p_old_password, p_new_password)
-func (r *AuthPostgres) ChangeUserPassword(ctx context.Context, requesterID int64, targetUserID int64, oldPasswordHash, newPasswordHash string) error {
-	const q = `SELECT ` + "fn_change_user_password" + `($1,$2,$3,$4)`
-	_, err := r.db.ExecContext(ctx, q, requesterID, targetUserID, oldPasswordHash, newPasswordHash)
+// ChangeUserPassword -> SELECT fn_change_user_password(p_requester_id, p_target_user_id, p_new_password_hash)
+// старый пароль проверяется в сервисе
+func (r *AuthPostgres) ChangeUserPassword(ctx context.Context, requesterID int64, targetUserID int64, newPasswordHash string) error {
+	const q = `SELECT ` + "fn_change_user_password" + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, q, requesterID, targetUserID, newPasswordHash)
+	return err
+}
+
+// CreateRefreshToken -> SELECT fn_create_refresh_token(p_user_id, p_family_id, p_token_hash, p_expires_at)
+func (r *AuthPostgres) CreateRefreshToken(ctx context.Context, userID int64, familyID, tokenHash string, expiresAt time.Time) error {
+	query := `SELECT ` + fnCreateRefreshToken + `($1,$2,$3,$4)`
+	_, err := r.db.ExecContext(ctx, query, userID, familyID, tokenHash, expiresAt)
+	return err
+}
+
+// RotateRefreshToken -> fn_rotate_refresh_token(p_token_hash, p_new_token_hash, p_expires_at).
+// status: ok | invalid | expired | revoked | reused (см. миграцию 000007)
+func (r *AuthPostgres) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (int64, string, error) {
+	query := `SELECT user_id, status FROM ` + fnRotateRefreshToken + `($1,$2,$3)`
+	var userID sql.NullInt64
+	var status string
+	if err := r.db.QueryRowxContext(ctx, query, tokenHash, newTokenHash, expiresAt).Scan(&userID, &status); err != nil {
+		return 0, "", err
+	}
+	return userID.Int64, status, nil
+}
+
+// RevokeRefreshToken -> SELECT fn_revoke_refresh_token(p_token_hash); false — токен не найден
+func (r *AuthPostgres) RevokeRefreshToken(ctx context.Context, tokenHash string) (bool, error) {
+	var found bool
+	query := `SELECT ` + fnRevokeRefreshToken + `($1)`
+	if err := r.db.QueryRowxContext(ctx, query, tokenHash).Scan(&found); err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// RevokeUserTokens -> SELECT fn_revoke_user_tokens(p_user_id)
+func (r *AuthPostgres) RevokeUserTokens(ctx context.Context, userID int64) error {
+	query := `SELECT ` + fnRevokeUserTokens + `($1)`
+	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
 }
+
+// GetAuthState -> SELECT * FROM fn_get_user_auth_state(p_user_id)
+func (r *AuthPostgres) GetAuthState(ctx context.Context, userID int64) (archive.UserAuthState, error) {
+	var st archive.UserAuthState
+	query := `SELECT tokens_revoked_at, disabled, must_change_password FROM ` + fnGetUserAuthState + `($1)`
+	if err := r.db.GetContext(ctx, &st, query, userID); err != nil {
+		return archive.UserAuthState{}, err
+	}
+	return st, nil
+}
+
+// HasPermission -> SELECT has_permission(p_user_id, p_permission)
+func (r *AuthPostgres) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	var ok bool
+	query := `SELECT ` + fnHasPermission + `($1,$2)`
+	if err := r.db.QueryRowxContext(ctx, query, userID, permission).Scan(&ok); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"archive"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+type fileRow struct {
+	archive.DocumentFile
+	FileMeta json.RawMessage `db:"file_meta"`
+}
+
+// ListFiles -> fn_list_document_files: вложения по порядку
+func (r *DocumentPostgres) ListFiles(ctx context.Context, docID int64) ([]archive.DocumentFile, error) {
+	var requester interface{}
+	if uid, ok := userIDFromCtx(ctx); ok {
+		requester = uid
+	}
+	query := `SELECT id, position, role, file_meta, created_at, created_by, updated_at, updated_by
+FROM ` + fnListDocumentFiles + `($1,$2)`
+
+	var rows []fileRow
+	if err := r.db.SelectContext(ctx, &rows, query, docID, requester); err != nil {
+		return nil, pgError(err)
+	}
+	out := make([]archive.DocumentFile, 0, len(rows))
+	for _, row := range rows {
+		f := row.DocumentFile
+		f.DocumentID = docID
+		if err := json.Unmarshal(row.FileMeta, &f.FileMeta); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// AddFile -> fn_add_document_file: position nil — в конец списка
+func (r *DocumentPostgres) AddFile(ctx context.Context, docID int64, role string, fm archive.FileMeta, position *int) (int64, error) {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return 0, fmt.Errorf("user id missing in context")
+	}
+	meta, err := marshalFileMeta(&fm)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	query := `SELECT ` + fnAddDocumentFile + `($1,$2,$3,$4,$5)`
+	if err := r.db.QueryRowxContext(ctx, query, docID, uid, role, meta, position).Scan(&id); err != nil {
+		return 0, pgError(err)
+	}
+	return id, nil
+}
+
+// ReplaceFile -> fn_replace_document_file: nil — оставить роль/файл как есть
+func (r *DocumentPostgres) ReplaceFile(ctx context.Context, docID int64, fileID int64, role *string, fm *archive.FileMeta) error {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	meta, err := marshalFileMeta(fm)
+	if err != nil {
+		return err
+	}
+	query := `SELECT ` + fnReplaceDocumentFile + `($1,$2,$3,$4,$5)`
+	_, err = r.db.ExecContext(ctx, query, docID, uid, fileID, role, meta)
+	return pgError(err)
+}
+
+// RemoveFile -> fn_remove_document_file
+func (r *DocumentPostgres) RemoveFile(ctx context.Context, docID int64, fileID int64) error {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnRemoveDocumentFile + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, docID, uid, fileID)
+	return pgError(err)
+}
+
+// ReorderFiles -> fn_reorder_document_files: fileIDs — все вложения в новом порядке
+func (r *DocumentPostgres) ReorderFiles(ctx context.Context, docID int64, fileIDs []int64) error {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnReorderDocumentFiles + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, docID, uid, pq.Array(fileIDs))
+	return pgError(err)
+}
+
+// OpenAttachment -> fn_open_document_attachment: проверка доступа, file_meta вложения
+func (r *DocumentPostgres) OpenAttachment(ctx context.Context, docID int64, fileID int64) (archive.FileMeta, error) {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return archive.FileMeta{}, fmt.Errorf("user id missing in context")
+	}
+	var raw []byte
+	query := `SELECT ` + fnOpenDocumentAttachment + `($1,$2,$3)`
+	if err := r.db.QueryRowxContext(ctx, query, docID, uid, fileID).Scan(&raw); err != nil {
+		return archive.FileMeta{}, pgError(err)
+	}
+	var fm archive.FileMeta
+	if err := json.Unmarshal(raw, &fm); err != nil {
+		return archive.FileMeta{}, err
+	}
+	return fm, nil
+}
+
+// LogAttachmentDownload -> fn_log_attachment_download: запись скачивания вложения в журнал
+func (r *DocumentPostgres) LogAttachmentDownload(ctx context.Context, docID int64, fileID int64, rangeHeader string) error {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnLogAttachmentDownload + `($1,$2,$3,$4)`
+	_, err := r.db.ExecContext(ctx, query, docID, uid, fileID, sql.NullString{String: rangeHeader, Valid: rangeHeader != ""})
+	return pgError(err)
+}
+
+// SharedFiles -> fn_document_shared_files: для основного файла и каждого вложения — другие
+// видимые запрашивающему документы с тем же объектом хранилища
+func (r *DocumentPostgres) SharedFiles(ctx context.Context, docID int64) ([]archive.SharedFile, error) {
+	var requester interface{}
+	if uid, ok := userIDFromCtx(ctx); ok {
+		requester = uid
+	}
+	query := `SELECT source_file_id, bucket, key, sha256, ref_count, document_id, title, file_id
+FROM ` + fnDocumentSharedFiles + `($1,$2)`
+
+	var rows []struct {
+		SourceFileID *int64  `db:"source_file_id"`
+		Bucket       string  `db:"bucket"`
+		Key          string  `db:"key"`
+		Sha256       *string `db:"sha256"`
+		RefCount     int     `db:"ref_count"`
+		DocumentID   *int64  `db:"document_id"`
+		Title        *string `db:"title"`
+		FileID       *int64  `db:"file_id"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, query, docID, requester); err != nil {
+		return nil, pgError(err)
+	}
+
+	// строки идут по файлам документа подряд
+	out := []archive.SharedFile{}
+	for i, row := range rows {
+		if i == 0 || row.Bucket != rows[i-1].Bucket || row.Key != rows[i-1].Key || !sameID(row.SourceFileID, rows[i-1].SourceFileID) {
+			f := archive.SharedFile{FileID: row.SourceFileID, RefCount: row.RefCount, Documents: []archive.SharedFileRef{}}
+			if row.Sha256 != nil {
+				f.Sha256 = *row.Sha256
+			}
+			out = append(out, f)
+		}
+		if row.DocumentID == nil {
+			continue
+		}
+		ref := archive.SharedFileRef{DocumentID: *row.DocumentID, FileID: row.FileID}
+		if row.Title != nil {
+			ref.Title = *row.Title
+		}
+		last := &out[len(out)-1]
+		last.Documents = append(last.Documents, ref)
+	}
+	return out, nil
+}
+
+func sameID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type DocumentPostgres struct {
@@ -96,8 +97,14 @@ func (r *DocumentPostgres) CreateDocument(ctx context.Context, in archive.Docume
 	authorVal := trimStringParam(in.Author)
 	privacyVal := privacyParam(in.Privacy)
 
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	query := `SELECT ` + fnAddDocument + `($1,$2,$3,$4,$5,$6,$7,$8,$9)`
-	err = r.db.QueryRowxContext(ctx, query,
+	err = tx.QueryRowxContext(ctx, query,
 		in.CreatorID,
 		in.Title,
 		in.DocumentDate,
@@ -111,25 +118,49 @@ func (r *DocumentPostgres) CreateDocument(ctx context.Context, in archive.Docume
 	if err != nil {
 		return 0, err
 	}
+	if in.FileText != nil {
+		if err := setFileText(ctx, tx, id, in.CreatorID, in.FileText); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
 	return id, nil
 }
 
-// SearchDocumentsByTag (unchanged structure — file_meta not required here)
-func (r *DocumentPostgres) SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, error) {
+// setFileText -> fn_set_document_file_text в транзакции изменения документа: текст файла
+// попадает в индекс вместе с документом или не попадает вовсе
+func setFileText(ctx context.Context, tx *sqlx.Tx, docID int64, userID int64, text *string) error {
+	query := `SELECT ` + fnSetDocumentFileText + `($1,$2,$3)`
+	_, err := tx.ExecContext(ctx, query, docID, userID, text)
+	return pgError(err)
+}
+
+// SearchDocumentsByTag -> fn_search_documents: фильтры, сортировка и limit/offset выполняются в БД.
+// filter должен быть уже нормализован сервисом (Sort/Order/Limit заданы).
+func (r *DocumentPostgres) SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, int64, error) {
 	const q = `
 SELECT
   id,
   title,
   privacy,
+  created_at,
+  created_by,
   updated_at,
+  updated_by,
   document_date,
-  type_id,
   author,
+  type_id,
+  type_name,
+  tags,
   geojson,
   can_edit,
-  is_author
-FROM ` + fnGetDocumentsForUser + `($1)
-ORDER BY COALESCE(updated_at, now()) DESC
+  rank,
+  headline,
+  distance_m,
+  total_count
+FROM ` + fnSearchDocuments + `($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)
 `
 
 	var requester interface{}
@@ -141,18 +172,74 @@ ORDER BY COALESCE(updated_at, now()) DESC
 		ID           int64               `db:"id"`
 		Title        string              `db:"title"`
 		Privacy      archive.PrivacyType `db:"privacy"`
+		CreatedAt    time.Time           `db:"created_at"`
+		CreatedBy    *int64              `db:"created_by"`
 		UpdatedAt    sql.NullTime        `db:"updated_at"`
+		UpdatedBy    *int64              `db:"updated_by"`
 		DocumentDate *time.Time          `db:"document_date"`
-		TypeID       *int64              `db:"type_id"`
 		Author       sql.NullString      `db:"author"`
+		TypeID       *int64              `db:"type_id"`
+		TypeName     *string             `db:"type_name"`
+		Tags         pq.StringArray      `db:"tags"`
 		GeoJSON      *json.RawMessage    `db:"geojson"`
 		CanEdit      bool                `db:"can_edit"`
-		IsAuthor     bool                `db:"is_author"`
+		Rank         *float32            `db:"rank"`
+		Headline     *string             `db:"headline"`
+		DistanceM    *float64            `db:"distance_m"`
+		TotalCount   int64               `db:"total_count"`
+	}
+
+	var bboxParam, areaParam, relationParam, nearLon, nearLat interface{}
+	if filter.BBox != nil {
+		bboxParam = pq.Float64Array(filter.BBox)
+	}
+	if filter.Geometry != nil {
+		areaParam = string(*filter.Geometry)
+		relationParam = filter.Relation
+	}
+	if len(filter.Near) == 2 {
+		nearLon, nearLat = filter.Near[0], filter.Near[1]
+	}
+
+	args := []interface{}{
+		requester,
+		trimStringParam(&filter.Query),
+		trimStringParam(&filter.Tag),
+		trimStringParam(&filter.Author),
+		trimStringParam(&filter.Type),
+		trimStringParam(&filter.DateFrom),
+		trimStringParam(&filter.DateTo),
+		bboxParam,
+		areaParam,
+		relationParam,
+		nearLon,
+		nearLat,
+		filter.RadiusM,
+		filter.Sort,
+		filter.Order != "asc",
+		filter.Limit,
+		filter.Offset,
 	}
 
 	var rows []listRow
-	if err := r.db.SelectContext(ctx, &rows, q, requester); err != nil {
-		return nil, err
+	if err := r.db.SelectContext(ctx, &rows, q, args...); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if len(rows) > 0 {
+		total = rows[0].TotalCount
+	} else if filter.Offset > 0 {
+		// страница за пределами выборки: window-функция ничего не вернула, считаем отдельно
+		args[len(args)-1] = 0 // offset
+		args[len(args)-2] = 1 // limit
+		var probe []listRow
+		if err := r.db.SelectContext(ctx, &probe, q, args...); err != nil {
+			return nil, 0, err
+		}
+		if len(probe) > 0 {
+			total = probe[0].TotalCount
+		}
 	}
 
 	out := make([]archive.DocumentSecure, 0, len(rows))
@@ -171,11 +258,19 @@ ORDER BY COALESCE(updated_at, now()) DESC
 			DocID:            rr.ID,
 			Title:            rr.Title,
 			Privacy:          rr.Privacy,
+			CreatedAt:        rr.CreatedAt,
+			CreatedBy:        rr.CreatedBy,
 			UpdatedAt:        updatedAtPtr,
+			UpdatedBy:        rr.UpdatedBy,
 			DocumentDate:     rr.DocumentDate,
 			Author:           authorPtr,
 			TypeID:           rr.TypeID,
+			TypeName:         rr.TypeName,
+			Tags:             []string(rr.Tags),
 			CanRequesterEdit: rr.CanEdit,
+			Rank:             rr.Rank,
+			Headline:         rr.Headline,
+			DistanceM:        rr.DistanceM,
 		}
 		if rr.GeoJSON != nil && len(*rr.GeoJSON) > 0 {
 			s := string(*rr.GeoJSON)
@@ -184,19 +279,7 @@ ORDER BY COALESCE(updated_at, now()) DESC
 		out = append(out, ds)
 	}
 
-	// apply offset/limit in app layer
-	start := filter.Offset
-	if start < 0 {
-		start = 0
-	}
-	if start >= len(out) {
-		return []archive.DocumentSecure{}, nil
-	}
-	end := len(out)
-	if filter.Limit > 0 && start+filter.Limit < end {
-		end = start + filter.Limit
-	}
-	return out[start:end], nil
+	return out, total, nil
 }
 
 // GetDocumentByID -> returns file_meta JSONB (and other fields)
@@ -216,7 +299,10 @@ SELECT
   file_meta,
   geojson,
   ST_AsGeoJSON(geom) as geom,
-  can_edit
+  can_edit,
+  viewers,
+  editors,
+  version
 FROM ` + fnGetDocumentByID + `($1,$2)
 LIMIT 1
 `
@@ -241,6 +327,9 @@ LIMIT 1
 		GeoJSON      *json.RawMessage    `db:"geojson"`
 		Geom         *string             `db:"geom"`
 		CanEdit      bool                `db:"can_edit"`
+		Viewers      pq.Int64Array       `db:"viewers"`
+		Editors      pq.Int64Array       `db:"editors"`
+		Version      int64               `db:"version"`
 	}
 
 	var row docRow
@@ -248,7 +337,7 @@ LIMIT 1
 		if err == sql.ErrNoRows {
 			return archive.DocumentSecure{}, nil
 		}
-		return archive.DocumentSecure{}, err
+		return archive.DocumentSecure{}, pgError(err)
 	}
 
 	var updatedAtPtr *time.Time
@@ -284,6 +373,9 @@ LIMIT 1
 		FileMeta:         fileMeta,
 		Geom:             row.Geom,
 		CanRequesterEdit: row.CanEdit,
+		Viewers:          []int64(row.Viewers),
+		Editors:          []int64(row.Editors),
+		Version:          row.Version,
 	}
 
 	_ = row.GeoJSON
@@ -331,8 +423,14 @@ func (r *DocumentPostgres) UpdateDocument(ctx context.Context, id int64, in arch
 
 	authorVal := trimStringParam(in.Author)
 
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	query := `SELECT ` + fnUpdateDocument + `($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`
-	_, err = r.db.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		in.DocumentID,
 		in.UpdaterID,
 		titleParam,
@@ -343,18 +441,194 @@ func (r *DocumentPostgres) UpdateDocument(ctx context.Context, id int64, in arch
 		geojsonVal,
 		tagsParam,
 		privacyVal,
+		in.IfMatch,
 	)
-	return err
+	if err != nil {
+		return pgError(err)
+	}
+	// новый файл: текст старого в индексе больше не актуален
+	if in.FileMeta != nil {
+		if err := setFileText(ctx, tx, in.DocumentID, in.UpdaterID, in.FileText); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PatchDocument -> fn_patch_document: меняет только поля из p.Fields, возвращает новую версию
+func (r *DocumentPostgres) PatchDocument(ctx context.Context, id int64, p archive.DocumentPatch) (int64, error) {
+	if p.UpdaterID == 0 {
+		uid, ok := userIDFromCtx(ctx)
+		if !ok {
+			return 0, fmt.Errorf("updater id required")
+		}
+		p.UpdaterID = uid
+	}
+	patch, err := json.Marshal(p.Fields)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var version int64
+	query := `SELECT ` + fnPatchDocument + `($1,$2,$3,$4)`
+	if err := tx.QueryRowxContext(ctx, query, id, p.UpdaterID, string(patch), p.IfMatch).Scan(&version); err != nil {
+		return 0, pgError(err)
+	}
+	// новый файл: fn_patch_document уже сбросил текст старого
+	if fm, ok := p.Fields["file_meta"]; ok && fm != nil && p.FileText != nil {
+		if err := setFileText(ctx, tx, id, p.UpdaterID, p.FileText); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return version, nil
 }
 
-func (r *DocumentPostgres) DeleteDocument(ctx context.Context, id int64) error {
+// RequireEdit -> fn_require_document_edit: ErrNotFound/ErrForbidden, если текущий пользователь не может править документ
+func (r *DocumentPostgres) RequireEdit(ctx context.Context, id int64) error {
 	uid, ok := userIDFromCtx(ctx)
 	if !ok {
 		return fmt.Errorf("user id missing in context")
 	}
-	query := `SELECT ` + fnDeleteDocument + `($1,$2)`
+	query := `SELECT ` + fnRequireDocumentEdit + `($1,$2)`
 	_, err := r.db.ExecContext(ctx, query, id, uid)
-	return err
+	return pgError(err)
+}
+
+// DeleteDocument -> fn_delete_document: в корзину; ifMatch — ожидаемая версия (nil — без проверки)
+func (r *DocumentPostgres) DeleteDocument(ctx context.Context, id int64, ifMatch *int64) error {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnDeleteDocument + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, id, uid, ifMatch)
+	return pgError(err)
+}
+
+// ListTrash -> fn_list_trash: удалённые документы, которые пользователь может восстановить
+func (r *DocumentPostgres) ListTrash(ctx context.Context) ([]archive.TrashItem, error) {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return nil, fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT id, title, privacy, document_date, type_id, author, created_by, created_by_login,
+       deleted_at, deleted_by, deleted_by_login
+FROM ` + fnListTrash + `($1)`
+
+	items := []archive.TrashItem{}
+	if err := r.db.SelectContext(ctx, &items, query, uid); err != nil {
+		return nil, pgError(err)
+	}
+	return items, nil
+}
+
+// RestoreDocument -> fn_restore_document
+func (r *DocumentPostgres) RestoreDocument(ctx context.Context, id int64) error {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnRestoreDocument + `($1,$2)`
+	_, err := r.db.ExecContext(ctx, query, id, uid)
+	return pgError(err)
+}
+
+// PurgeDeleted -> fn_purge_deleted_documents: окончательно удаляет документы из корзины старше olderThan;
+// возвращает файлы, на которые больше никто не ссылается
+func (r *DocumentPostgres) PurgeDeleted(ctx context.Context, olderThan time.Duration, limit int) ([]archive.FileMeta, error) {
+	query := `SELECT provider, bucket, key FROM ` + fnPurgeDeletedDocuments + `(make_interval(secs => $1), $2)`
+
+	var rows []struct {
+		Provider *string `db:"provider"`
+		Bucket   *string `db:"bucket"`
+		Key      string  `db:"key"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, query, olderThan.Seconds(), limit); err != nil {
+		return nil, pgError(err)
+	}
+	files := make([]archive.FileMeta, 0, len(rows))
+	for _, row := range rows {
+		fm := archive.FileMeta{Key: row.Key}
+		if row.Provider != nil {
+			fm.Provider = *row.Provider
+		}
+		if row.Bucket != nil {
+			fm.Bucket = *row.Bucket
+		}
+		files = append(files, fm)
+	}
+	return files, nil
+}
+
+// UnreferencedObjects -> fn_unreferenced_objects: ключи из keys, на которые не ссылается ни один
+// документ (включая корзину), версия, вложение или загрузка
+func (r *DocumentPostgres) UnreferencedObjects(ctx context.Context, bucket string, keys []string) ([]string, error) {
+	query := `SELECT key FROM ` + fnUnreferencedObjects + `($1,$2)`
+	out := make([]string, 0)
+	if err := r.db.SelectContext(ctx, &out, query, bucket, pq.Array(keys)); err != nil {
+		return nil, pgError(err)
+	}
+	return out, nil
+}
+
+// ListDocumentPermissions -> fn_get_document_permissions: действующие доступы (автору, can_share и permissions.manage)
+func (r *DocumentPostgres) ListDocumentPermissions(ctx context.Context, docID int64) ([]archive.DocumentGrant, error) {
+	requesterID, ok := userIDFromCtx(ctx)
+	if !ok {
+		return nil, fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT grantee_type, user_id, login, full_name, group_id, group_name, can_view, can_edit, can_share, expires_at
+FROM ` + fnGetDocumentPermissions + `($1,$2)`
+	grants := make([]archive.DocumentGrant, 0)
+	if err := r.db.SelectContext(ctx, &grants, query, docID, requesterID); err != nil {
+		return nil, pgError(err)
+	}
+	return grants, nil
+}
+
+// GetSharedWithMe -> fn_get_documents_shared_with_me
+func (r *DocumentPostgres) GetSharedWithMe(ctx context.Context) ([]archive.SharedDocument, error) {
+	requesterID, ok := userIDFromCtx(ctx)
+	if !ok {
+		return nil, fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT id, title, privacy, updated_at, document_date, type_id, author, created_by, created_by_login,
+       can_edit, can_share, expires_at, via_groups
+FROM ` + fnGetSharedWithMe + `($1)`
+	rows, err := r.db.QueryxContext(ctx, query, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := make([]archive.SharedDocument, 0)
+	for rows.Next() {
+		var d archive.SharedDocument
+		var groups pq.StringArray
+		if err := rows.Scan(&d.ID, &d.Title, &d.Privacy, &d.UpdatedAt, &d.DocumentDate, &d.TypeID, &d.Author,
+			&d.CreatedBy, &d.CreatedByLogin, &d.CanEdit, &d.CanShare, &d.ExpiresAt, &groups); err != nil {
+			return nil, err
+		}
+		d.ViaGroups = []string(groups)
+		d.Access = "view"
+		if d.CanEdit {
+			d.Access = "edit"
+		}
+		docs = append(docs, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return docs, nil
 }
 
 func (r *DocumentPostgres) SetDocumentPermission(ctx context.Context, docID int64, p archive.DocumentPermission) error {
@@ -362,9 +636,9 @@ func (r *DocumentPostgres) SetDocumentPermission(ctx context.Context, docID int6
 	if !ok {
 		return fmt.Errorf("user id missing in context")
 	}
-	query := `SELECT ` + fnSetDocumentPermission + `($1,$2,$3,$4,$5)`
-	_, err := r.db.ExecContext(ctx, query, docID, adminID, p.UserID, p.CanView, p.CanEdit)
-	return err
+	query := `SELECT ` + fnSetDocumentPermission + `($1,$2,$3,$4,$5,$6,$7)`
+	_, err := r.db.ExecContext(ctx, query, docID, adminID, p.UserID, p.CanView, p.CanEdit, p.CanShare, p.ExpiresAt)
+	return pgError(err)
 }
 
 func (r *DocumentPostgres) RemoveDocumentPermission(ctx context.Context, docID int64, targetUserID int64) error {
@@ -374,5 +648,164 @@ func (r *DocumentPostgres) RemoveDocumentPermission(ctx context.Context, docID i
 	}
 	query := `SELECT ` + fnRemoveDocumentPermission + `($1,$2,$3)`
 	_, err := r.db.ExecContext(ctx, query, docID, adminID, targetUserID)
+	return pgError(err)
+}
+
+func (r *DocumentPostgres) SetDocumentGroupPermission(ctx context.Context, docID int64, p archive.DocumentGroupPermission) error {
+	adminID, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnSetDocumentGroupPerm + `($1,$2,$3,$4,$5,$6,$7)`
+	_, err := r.db.ExecContext(ctx, query, docID, adminID, p.GroupID, p.CanView, p.CanEdit, p.CanShare, p.ExpiresAt)
+	return pgError(err)
+}
+
+func (r *DocumentPostgres) RemoveDocumentGroupPermission(ctx context.Context, docID int64, groupID int64) error {
+	adminID, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnRemoveDocumentGroupPerm + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, docID, adminID, groupID)
+	return pgError(err)
+}
+
+// PurgeExpiredPermissions -> fn_purge_expired_document_permissions: удаляет истёкшие личные и групповые доступы
+func (r *DocumentPostgres) PurgeExpiredPermissions(ctx context.Context) (int64, error) {
+	var n int64
+	query := `SELECT ` + fnPurgeExpiredPermissions + `()`
+	if err := r.db.QueryRowxContext(ctx, query).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// OpenDocumentFile -> fn_open_document_file: проверка доступа, file_meta файла документа или версии
+func (r *DocumentPostgres) OpenDocumentFile(ctx context.Context, docID int64, version *int64) (archive.FileMeta, error) {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return archive.FileMeta{}, fmt.Errorf("user id missing in context")
+	}
+	var raw []byte
+	query := `SELECT ` + fnOpenDocumentFile + `($1,$2,$3)`
+	if err := r.db.QueryRowxContext(ctx, query, docID, uid, version).Scan(&raw); err != nil {
+		return archive.FileMeta{}, pgError(err)
+	}
+	var fm archive.FileMeta
+	if err := json.Unmarshal(raw, &fm); err != nil {
+		return archive.FileMeta{}, err
+	}
+	return fm, nil
+}
+
+// LogDocumentDownload -> fn_log_document_download: запись скачивания в журнал, когда объект уже открыт
+func (r *DocumentPostgres) LogDocumentDownload(ctx context.Context, docID int64, version *int64, rangeHeader string) error {
+	uid, ok := userIDFromCtx(ctx)
+	if !ok {
+		return fmt.Errorf("user id missing in context")
+	}
+	query := `SELECT ` + fnLogDocumentDownload + `($1,$2,$3,$4)`
+	_, err := r.db.ExecContext(ctx, query, docID, uid, version, sql.NullString{String: rangeHeader, Valid: rangeHeader != ""})
+	return pgError(err)
+}
+
+// SetDocumentFileText -> fn_set_document_file_text: текст файла для полнотекстового индекса (nil очищает)
+func (r *DocumentPostgres) SetDocumentFileText(ctx context.Context, docID int64, userID int64, text *string) error {
+	query := `SELECT ` + fnSetDocumentFileText + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, docID, userID, text)
 	return err
 }
+
+// versionRow — строка fn_list_document_versions / fn_get_document_version
+type versionRow struct {
+	archive.DocumentVersion
+	FileMeta *json.RawMessage `db:"file_meta"`
+	Tags     pq.StringArray   `db:"tags"`
+}
+
+func (v versionRow) toVersion(docID int64) archive.DocumentVersion {
+	out := v.DocumentVersion
+	out.DocumentID = docID
+	if v.FileMeta != nil && len(*v.FileMeta) > 0 {
+		var fm archive.FileMeta
+		if err := json.Unmarshal(*v.FileMeta, &fm); err == nil {
+			out.FileMeta = &fm
+		}
+	}
+	out.Tags = []string(v.Tags)
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	return out
+}
+
+// ListVersions -> fn_list_document_versions: новые версии сверху, без geojson
+func (r *DocumentPostgres) ListVersions(ctx context.Context, docID int64) ([]archive.DocumentVersion, error) {
+	var requester interface{}
+	if uid, ok := userIDFromCtx(ctx); ok {
+		requester = uid
+	}
+	query := `SELECT version, title, privacy, document_date, author, type_id, file_meta, tags,
+       created_at, created_by, created_by_login, change_kind, restored_from, is_current
+FROM ` + fnListDocumentVersions + `($1,$2)`
+
+	var rows []versionRow
+	if err := r.db.SelectContext(ctx, &rows, query, docID, requester); err != nil {
+		return nil, pgError(err)
+	}
+	out := make([]archive.DocumentVersion, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, row.toVersion(docID))
+	}
+	return out, nil
+}
+
+// GetVersion -> fn_get_document_version
+func (r *DocumentPostgres) GetVersion(ctx context.Context, docID int64, version int64) (archive.DocumentVersion, error) {
+	var requester interface{}
+	if uid, ok := userIDFromCtx(ctx); ok {
+		requester = uid
+	}
+	query := `SELECT version, title, privacy, document_date, author, type_id, file_meta, geojson, tags,
+       created_at, created_by, created_by_login, change_kind, restored_from, is_current
+FROM ` + fnGetDocumentVersion + `($1,$2,$3)`
+
+	var row versionRow
+	if err := r.db.GetContext(ctx, &row, query, docID, requester, version); err != nil {
+		return archive.DocumentVersion{}, pgError(err)
+	}
+	v := row.toVersion(docID)
+
+	var files []struct {
+		archive.VersionFile
+		FileMeta json.RawMessage `db:"file_meta"`
+	}
+	filesQuery := `SELECT file_id, position, role, file_meta FROM ` + fnListVersionFiles + `($1,$2,$3)`
+	if err := r.db.SelectContext(ctx, &files, filesQuery, docID, requester, version); err != nil {
+		return archive.DocumentVersion{}, pgError(err)
+	}
+	v.Files = make([]archive.VersionFile, 0, len(files))
+	for _, f := range files {
+		vf := f.VersionFile
+		if err := json.Unmarshal(f.FileMeta, &vf.FileMeta); err != nil {
+			return archive.DocumentVersion{}, err
+		}
+		v.Files = append(v.Files, vf)
+	}
+	return v, nil
+}
+
+// RestoreVersion -> fn_restore_document_version: возвращает номер новой версии; ifMatch — ожидаемая версия документа
+func (r *DocumentPostgres) RestoreVersion(ctx context.Context, docID int64, version int64, ifMatch *int64) (int64, error) {
+	userID, ok := userIDFromCtx(ctx)
+	if !ok {
+		return 0, fmt.Errorf("user id missing in context")
+	}
+	var newVersion int64
+	query := `SELECT ` + fnRestoreDocumentVersion + `($1,$2,$3,$4)`
+	if err := r.db.QueryRowxContext(ctx, query, docID, userID, version, ifMatch).Scan(&newVersion); err != nil {
+		return 0, pgError(err)
+	}
+	return newVersion, nil
+}
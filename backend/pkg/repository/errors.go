@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Ошибки, которые функции БД поднимают с явным SQLSTATE (RAISE ... USING ERRCODE);
+// остальные ошибки возвращаются как есть.
+var (
+	ErrForbidden = errors.New("forbidden")
+	ErrNotFound  = errors.New("not found")
+	ErrConflict  = errors.New("conflict")
+
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrPreconditionFailed — документ изменён после версии из If-Match
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// pgError переводит SQLSTATE в ошибки пакета, сохраняя текст из БД
+func pgError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code {
+	case "42501": // insufficient_privilege
+		return fmt.Errorf("%w: %s", ErrForbidden, pqErr.Message)
+	case "P0002": // no_data_found
+		return fmt.Errorf("%w: %s", ErrNotFound, pqErr.Message)
+	case "23505", "55000": // unique_violation, object_not_in_prerequisite_state
+		return fmt.Errorf("%w: %s", ErrConflict, pqErr.Message)
+	case "22023", "22007", "22008", "22P02", "22003": // invalid_parameter_value, ошибки приведения даты/числа, numeric_value_out_of_range
+		return fmt.Errorf("%w: %s", ErrInvalidInput, pqErr.Message)
+	case "AR412": // свой код _check_document_version
+		return fmt.Errorf("%w: %s", ErrPreconditionFailed, pqErr.Message)
+	}
+	return err
+}
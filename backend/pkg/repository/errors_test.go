@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestPgError(t *testing.T) {
+	plain := errors.New("connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want error // nil — ошибка возвращается как есть
+	}{
+		{name: "insufficient privilege", err: &pq.Error{Code: "42501"}, want: ErrForbidden},
+		{name: "no data found", err: &pq.Error{Code: "P0002"}, want: ErrNotFound},
+		{name: "unique violation", err: &pq.Error{Code: "23505"}, want: ErrConflict},
+		{name: "wrong state", err: &pq.Error{Code: "55000"}, want: ErrConflict},
+		{name: "invalid parameter", err: &pq.Error{Code: "22023"}, want: ErrInvalidInput},
+		{name: "invalid text representation", err: &pq.Error{Code: "22P02"}, want: ErrInvalidInput},
+		{name: "numeric value out of range", err: &pq.Error{Code: "22003"}, want: ErrInvalidInput},
+		{name: "document version", err: &pq.Error{Code: "AR412"}, want: ErrPreconditionFailed},
+		{name: "other sqlstate", err: &pq.Error{Code: "40001"}},
+		{name: "not a pq error", err: plain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pgError(tt.err)
+			if tt.want == nil {
+				if got != tt.err {
+					t.Fatalf("pgError(%v) = %v, want the error unchanged", tt.err, got)
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) {
+				t.Fatalf("pgError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
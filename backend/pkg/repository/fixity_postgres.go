@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"archive"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type FixityPostgres struct {
+	db *sqlx.DB
+}
+
+func NewFixityPostgres(db *sqlx.DB) *FixityPostgres {
+	return &FixityPostgres{db: db}
+}
+
+// NextBatch -> fn_fixity_next_batch: объекты, ещё не проверявшиеся или проверенные раньше recheckAfter
+func (r *FixityPostgres) NextBatch(ctx context.Context, limit int, recheckAfter time.Duration) ([]archive.FixityTarget, error) {
+	query := `SELECT bucket, key, sha256, size FROM ` + fnFixityNextBatch + `($1, make_interval(secs => $2))`
+	var targets []archive.FixityTarget
+	if err := r.db.SelectContext(ctx, &targets, query, limit, recheckAfter.Seconds()); err != nil {
+		return nil, pgError(err)
+	}
+	return targets, nil
+}
+
+// DocumentFiles -> fn_fixity_document_files: все объекты документа (файл, версии, вложения); право storage.audit
+func (r *FixityPostgres) DocumentFiles(ctx context.Context, adminID int64, docID int64) ([]archive.FixityTarget, error) {
+	query := `SELECT bucket, key, sha256, size FROM ` + fnFixityDocumentFiles + `($1,$2)`
+	var targets []archive.FixityTarget
+	if err := r.db.SelectContext(ctx, &targets, query, adminID, docID); err != nil {
+		return nil, pgError(err)
+	}
+	return targets, nil
+}
+
+// Record -> fn_record_fixity_result; alert — объект только что перешёл в mismatch/missing
+// (записано в logs и отправлено pg_notify('fixity_alert'))
+func (r *FixityPostgres) Record(ctx context.Context, c archive.FixityCheck) (bool, error) {
+	query := `SELECT ` + fnRecordFixityResult + `($1,$2,$3,$4,$5,$6,$7)`
+	var alert bool
+	err := r.db.GetContext(ctx, &alert, query, c.Bucket, c.Key, c.ExpectedSha256, c.ActualSha256, c.Size, c.Status, c.Error)
+	return alert, pgError(err)
+}
+
+// Report -> fn_fixity_report: результаты проверки по документам; право storage.audit
+func (r *FixityPostgres) Report(ctx context.Context, adminID int64, filter archive.FixityReportFilter) ([]archive.FixityRecord, error) {
+	query := `SELECT document_id, title, deleted, file_id, version, bucket, key, status, expected_sha256, actual_sha256,
+       size, error, checked_at, failed_since, checks
+FROM ` + fnFixityReport + `($1,$2,$3,$4,$5)`
+	records := []archive.FixityRecord{}
+	if err := r.db.SelectContext(ctx, &records, query, adminID, !filter.All, filter.DocumentID, filter.Limit, filter.Offset); err != nil {
+		return nil, pgError(err)
+	}
+	return records, nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+
+	"archive"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type GroupsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewGroupsPostgres(db *sqlx.DB) *GroupsPostgres {
+	return &GroupsPostgres{db: db}
+}
+
+// ListGroups -> SELECT * FROM fn_list_groups(p_requester_id)
+func (r *GroupsPostgres) ListGroups(ctx context.Context, requesterID int64) ([]archive.Group, error) {
+	query := `SELECT id, name, description, created_at, member_count, is_member FROM ` + fnListGroups + `($1)`
+	groups := make([]archive.Group, 0)
+	if err := r.db.SelectContext(ctx, &groups, query, requesterID); err != nil {
+		return nil, pgError(err)
+	}
+	return groups, nil
+}
+
+// CreateGroup -> SELECT fn_create_group(p_requester_id, p_name, p_description)
+func (r *GroupsPostgres) CreateGroup(ctx context.Context, requesterID int64, in archive.GroupInput) (int64, error) {
+	var id int64
+	query := `SELECT ` + fnCreateGroup + `($1,$2,$3)`
+	if err := r.db.QueryRowxContext(ctx, query, requesterID, in.Name, in.Description).Scan(&id); err != nil {
+		return 0, pgError(err)
+	}
+	return id, nil
+}
+
+// UpdateGroup -> SELECT fn_update_group(p_requester_id, p_group_id, p_name, p_description)
+func (r *GroupsPostgres) UpdateGroup(ctx context.Context, requesterID int64, groupID int64, in archive.GroupInput) error {
+	query := `SELECT ` + fnUpdateGroup + `($1,$2,$3,$4)`
+	_, err := r.db.ExecContext(ctx, query, requesterID, groupID, in.Name, in.Description)
+	return pgError(err)
+}
+
+// DeleteGroup -> SELECT fn_delete_group(p_requester_id, p_group_id)
+func (r *GroupsPostgres) DeleteGroup(ctx context.Context, requesterID int64, groupID int64) error {
+	query := `SELECT ` + fnDeleteGroup + `($1,$2)`
+	_, err := r.db.ExecContext(ctx, query, requesterID, groupID)
+	return pgError(err)
+}
+
+// ListMembers -> SELECT * FROM fn_list_group_members(p_requester_id, p_group_id)
+func (r *GroupsPostgres) ListMembers(ctx context.Context, requesterID int64, groupID int64) ([]archive.GroupMember, error) {
+	query := `SELECT user_id, login, full_name, added_at FROM ` + fnListGroupMembers + `($1,$2)`
+	members := make([]archive.GroupMember, 0)
+	if err := r.db.SelectContext(ctx, &members, query, requesterID, groupID); err != nil {
+		return nil, pgError(err)
+	}
+	return members, nil
+}
+
+// AddMembers -> SELECT fn_add_group_members(p_requester_id, p_group_id, p_user_ids); возвращает число добавленных
+func (r *GroupsPostgres) AddMembers(ctx context.Context, requesterID int64, groupID int64, userIDs []int64) (int, error) {
+	var added int
+	query := `SELECT ` + fnAddGroupMembers + `($1,$2,$3)`
+	if err := r.db.QueryRowxContext(ctx, query, requesterID, groupID, pq.Array(userIDs)).Scan(&added); err != nil {
+		return 0, pgError(err)
+	}
+	return added, nil
+}
+
+// RemoveMember -> SELECT fn_remove_group_member(p_requester_id, p_group_id, p_user_id)
+func (r *GroupsPostgres) RemoveMember(ctx context.Context, requesterID int64, groupID int64, userID int64) error {
+	query := `SELECT ` + fnRemoveGroupMember + `($1,$2,$3)`
+	_, err := r.db.ExecContext(ctx, query, requesterID, groupID, userID)
+	return pgError(err)
+}
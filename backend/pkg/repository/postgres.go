@@ -12,14 +12,108 @@ const (
 	fnRegisterUser  = "fn_register_user"
 	fnAuthorizeUser = "fn_authorize_user"
 
+	// passwords (verification happens in service)
+	fnGetUserPasswordHash = "fn_get_user_password_hash"
+	fnRehashUserPassword  = "fn_rehash_user_password"
+
+	// refresh tokens / revocation
+	fnCreateRefreshToken = "fn_create_refresh_token"
+	fnRotateRefreshToken = "fn_rotate_refresh_token"
+	fnRevokeRefreshToken = "fn_revoke_refresh_token"
+	fnRevokeUserTokens   = "fn_revoke_user_tokens"
+	fnGetUserAuthState   = "fn_get_user_auth_state"
+
+	// user management (admin)
+	fnAdminListUsers         = "fn_admin_list_users"
+	fnAdminCreateUser        = "fn_admin_create_user"
+	fnAdminSetUserRole       = "fn_admin_set_user_role"
+	fnAdminSetUserDisabled   = "fn_admin_set_user_disabled"
+	fnAdminResetUserPassword = "fn_admin_reset_user_password"
+
+	// roles / permissions (RBAC)
+	fnHasPermission   = "has_permission"
+	fnListPermissions = "fn_list_permissions"
+	fnListRoles       = "fn_list_roles"
+	fnCreateRole      = "fn_create_role"
+	fnUpdateRole      = "fn_update_role"
+	fnDeleteRole      = "fn_delete_role"
+
+	// groups
+	fnListGroups        = "fn_list_groups"
+	fnCreateGroup       = "fn_create_group"
+	fnUpdateGroup       = "fn_update_group"
+	fnDeleteGroup       = "fn_delete_group"
+	fnListGroupMembers  = "fn_list_group_members"
+	fnAddGroupMembers   = "fn_add_group_members"
+	fnRemoveGroupMember = "fn_remove_group_member"
+
 	// document CRUD / permissions
 	fnAddDocument              = "fn_add_document"
 	fnUpdateDocument           = "fn_update_document"
+	fnPatchDocument            = "fn_patch_document"
+	fnRequireDocumentEdit      = "fn_require_document_edit"
 	fnDeleteDocument           = "fn_delete_document"
 	fnSetDocumentPermission    = "fn_set_document_permission"
 	fnRemoveDocumentPermission = "fn_remove_document_permission"
+	fnSetDocumentGroupPerm     = "fn_set_document_group_permission"
+	fnRemoveDocumentGroupPerm  = "fn_remove_document_group_permission"
+	fnPurgeExpiredPermissions  = "fn_purge_expired_document_permissions"
+	fnGetDocumentPermissions   = "fn_get_document_permissions"
+	fnGetSharedWithMe          = "fn_get_documents_shared_with_me"
 	fnGetDocumentsForUser      = "fn_get_documents_for_user"
 	fnGetDocumentByID          = "fn_get_document_by_id"
+	fnSearchDocuments          = "fn_search_documents"
+	fnSetDocumentFileText      = "fn_set_document_file_text"
+	fnOpenDocumentFile         = "fn_open_document_file"
+	fnLogDocumentDownload      = "fn_log_document_download"
+
+	// trash
+	fnListTrash             = "fn_list_trash"
+	fnRestoreDocument       = "fn_restore_document"
+	fnPurgeDeletedDocuments = "fn_purge_deleted_documents"
+
+	// storage garbage collection
+	fnUnreferencedObjects = "fn_unreferenced_objects"
+
+	// attachments
+	fnListDocumentFiles      = "fn_list_document_files"
+	fnAddDocumentFile        = "fn_add_document_file"
+	fnReplaceDocumentFile    = "fn_replace_document_file"
+	fnRemoveDocumentFile     = "fn_remove_document_file"
+	fnReorderDocumentFiles   = "fn_reorder_document_files"
+	fnOpenDocumentAttachment = "fn_open_document_attachment"
+	fnLogAttachmentDownload  = "fn_log_attachment_download"
+	fnDocumentSharedFiles    = "fn_document_shared_files"
+
+	// resumable uploads (tus)
+	fnCreateUpload        = "fn_create_upload"
+	fnGetUpload           = "fn_get_upload"
+	fnSaveUploadProgress  = "fn_save_upload_progress"
+	fnCompleteUpload      = "fn_complete_upload"
+	fnDeleteUpload        = "fn_delete_upload"
+	fnPurgeExpiredUploads = "fn_purge_expired_uploads"
+
+	// fixity
+	fnFixityNextBatch     = "fn_fixity_next_batch"
+	fnRecordFixityResult  = "fn_record_fixity_result"
+	fnFixityDocumentFiles = "fn_fixity_document_files"
+	fnFixityReport        = "fn_fixity_report"
+
+	// versions
+	fnListDocumentVersions   = "fn_list_document_versions"
+	fnGetDocumentVersion     = "fn_get_document_version"
+	fnListVersionFiles       = "fn_list_document_version_files"
+	fnRestoreDocumentVersion = "fn_restore_document_version"
+
+	// access requests
+	fnRequestDocumentAccess      = "fn_request_document_access"
+	fnListMyAccessRequests       = "fn_list_my_access_requests"
+	fnListIncomingAccessRequests = "fn_list_incoming_access_requests"
+	fnDecideAccessRequest        = "fn_decide_access_request"
+	fnCancelAccessRequest        = "fn_cancel_access_request"
+
+	// map tiles
+	fnGetDocumentsTile = "fn_get_documents_tile"
 
 	// logs
 	fnGetLogsByUser  = "fn_get_logs_by_user"
@@ -12,10 +12,27 @@ type CtxUserIDKey struct{}
 
 type Authorization interface {
 	CreateUser(ctx context.Context, user archive.User) (int64, error)
-	GetUser(ctx context.Context, login, passwordHash string) (archive.User, error)
+	GetUser(ctx context.Context, login string) (archive.User, error)
+	GetPasswordHash(ctx context.Context, userID int64) (string, error)
+	RehashPassword(ctx context.Context, userID int64, oldHash, newHash string) (bool, error)
 	GetUsersByIDs(ctx context.Context, ids []int64) ([]archive.User, error)
 	UpdateUserFullName(ctx context.Context, requesterID int64, targetUserID int64, fullName string) error
-	ChangeUserPassword(ctx context.Context, requesterID int64, targetUserID int64, oldPasswordHash, newPasswordHash string) error
+	ChangeUserPassword(ctx context.Context, requesterID int64, targetUserID int64, newPasswordHash string) error
+
+	CreateRefreshToken(ctx context.Context, userID int64, familyID, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (userID int64, status string, err error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) (bool, error)
+	RevokeUserTokens(ctx context.Context, userID int64) error
+	GetAuthState(ctx context.Context, userID int64) (archive.UserAuthState, error)
+	HasPermission(ctx context.Context, userID int64, permission string) (bool, error)
+}
+
+type Roles interface {
+	ListPermissions(ctx context.Context) ([]archive.Permission, error)
+	ListRoles(ctx context.Context, requesterID int64) ([]archive.Role, error)
+	CreateRole(ctx context.Context, requesterID int64, in archive.RoleInput) (int64, error)
+	UpdateRole(ctx context.Context, requesterID int64, roleID int64, in archive.RoleInput) error
+	DeleteRole(ctx context.Context, requesterID int64, roleID int64) error
 }
 
 type DocumentTypes interface {
@@ -36,19 +53,92 @@ type Tags interface {
 
 type Document interface {
 	CreateDocument(ctx context.Context, in archive.DocumentCreateInput) (int64, error)
-	SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, error)
+	SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, int64, error)
 	GetDocumentByID(ctx context.Context, id int64) (archive.DocumentSecure, error)
 	UpdateDocument(ctx context.Context, id int64, in archive.DocumentUpdateInput) error
-	DeleteDocument(ctx context.Context, id int64) error
+	PatchDocument(ctx context.Context, id int64, p archive.DocumentPatch) (int64, error)
+	RequireEdit(ctx context.Context, id int64) error
+	DeleteDocument(ctx context.Context, id int64, ifMatch *int64) error
 
+	ListTrash(ctx context.Context) ([]archive.TrashItem, error)
+	RestoreDocument(ctx context.Context, id int64) error
+	PurgeDeleted(ctx context.Context, olderThan time.Duration, limit int) ([]archive.FileMeta, error)
+	UnreferencedObjects(ctx context.Context, bucket string, keys []string) ([]string, error)
+
+	ListDocumentPermissions(ctx context.Context, docID int64) ([]archive.DocumentGrant, error)
+	GetSharedWithMe(ctx context.Context) ([]archive.SharedDocument, error)
 	SetDocumentPermission(ctx context.Context, docID int64, p archive.DocumentPermission) error
 	RemoveDocumentPermission(ctx context.Context, docID int64, targetUserID int64) error
+	SetDocumentGroupPermission(ctx context.Context, docID int64, p archive.DocumentGroupPermission) error
+	RemoveDocumentGroupPermission(ctx context.Context, docID int64, groupID int64) error
+	PurgeExpiredPermissions(ctx context.Context) (int64, error)
+
+	SetDocumentFileText(ctx context.Context, docID int64, userID int64, text *string) error
+	OpenDocumentFile(ctx context.Context, docID int64, version *int64) (archive.FileMeta, error)
+	LogDocumentDownload(ctx context.Context, docID int64, version *int64, rangeHeader string) error
+
+	ListFiles(ctx context.Context, docID int64) ([]archive.DocumentFile, error)
+	AddFile(ctx context.Context, docID int64, role string, fm archive.FileMeta, position *int) (int64, error)
+	ReplaceFile(ctx context.Context, docID int64, fileID int64, role *string, fm *archive.FileMeta) error
+	RemoveFile(ctx context.Context, docID int64, fileID int64) error
+	ReorderFiles(ctx context.Context, docID int64, fileIDs []int64) error
+	OpenAttachment(ctx context.Context, docID int64, fileID int64) (archive.FileMeta, error)
+	LogAttachmentDownload(ctx context.Context, docID int64, fileID int64, rangeHeader string) error
+	SharedFiles(ctx context.Context, docID int64) ([]archive.SharedFile, error)
+
+	ListVersions(ctx context.Context, docID int64) ([]archive.DocumentVersion, error)
+	GetVersion(ctx context.Context, docID int64, version int64) (archive.DocumentVersion, error)
+	RestoreVersion(ctx context.Context, docID int64, version int64, ifMatch *int64) (int64, error)
+}
+
+type Tiles interface {
+	GetDocumentsTile(ctx context.Context, z, x, y int, cluster bool) ([]byte, error)
 }
 
 type Admin interface {
 	GetLogsByUser(ctx context.Context, adminID int64, targetUserID int64, start *time.Time, end *time.Time) ([]archive.LogRecord, error)
 	GetLogsByTable(ctx context.Context, adminID int64, tableName string, start *time.Time, end *time.Time) ([]archive.LogRecord, error)
 	GetLogsByDate(ctx context.Context, adminID int64, start time.Time, end time.Time) ([]archive.LogRecord, error)
+
+	ListUsers(ctx context.Context, adminID int64, filter archive.UserListFilter) ([]archive.User, int64, error)
+	CreateUser(ctx context.Context, adminID int64, in archive.AdminUserCreateInput, passwordHash string) (int64, error)
+	SetUserRole(ctx context.Context, adminID int64, targetUserID int64, roleID int64) error
+	SetUserDisabled(ctx context.Context, adminID int64, targetUserID int64, disabled bool) error
+	ResetUserPassword(ctx context.Context, adminID int64, targetUserID int64, newPasswordHash string) error
+}
+
+type Groups interface {
+	ListGroups(ctx context.Context, requesterID int64) ([]archive.Group, error)
+	CreateGroup(ctx context.Context, requesterID int64, in archive.GroupInput) (int64, error)
+	UpdateGroup(ctx context.Context, requesterID int64, groupID int64, in archive.GroupInput) error
+	DeleteGroup(ctx context.Context, requesterID int64, groupID int64) error
+	ListMembers(ctx context.Context, requesterID int64, groupID int64) ([]archive.GroupMember, error)
+	AddMembers(ctx context.Context, requesterID int64, groupID int64, userIDs []int64) (int, error)
+	RemoveMember(ctx context.Context, requesterID int64, groupID int64, userID int64) error
+}
+
+type AccessRequests interface {
+	Create(ctx context.Context, userID int64, docID int64, level string, reason *string) (int64, error)
+	ListMine(ctx context.Context, userID int64) ([]archive.AccessRequest, error)
+	ListIncoming(ctx context.Context, userID int64, status *string) ([]archive.AccessRequest, error)
+	Decide(ctx context.Context, userID int64, requestID int64, d archive.AccessDecision) error
+	Cancel(ctx context.Context, userID int64, requestID int64) error
+}
+
+type Uploads interface {
+	Create(ctx context.Context, u archive.Upload) error
+	Get(ctx context.Context, userID int64, id string) (archive.Upload, error)
+	SaveProgress(ctx context.Context, userID int64, id string, oldOffset, newOffset int64, parts []archive.UploadPart, hashState []byte) error
+	Complete(ctx context.Context, userID int64, id string, fm archive.FileMeta) error
+	Delete(ctx context.Context, userID int64, id string) error
+	PurgeExpired(ctx context.Context, limit int) ([]archive.ExpiredUpload, error)
+}
+
+type Fixity interface {
+	NextBatch(ctx context.Context, limit int, recheckAfter time.Duration) ([]archive.FixityTarget, error)
+	DocumentFiles(ctx context.Context, adminID int64, docID int64) ([]archive.FixityTarget, error)
+	Record(ctx context.Context, c archive.FixityCheck) (alert bool, err error)
+	Report(ctx context.Context, adminID int64, filter archive.FixityReportFilter) ([]archive.FixityRecord, error)
 }
 
 // Repository aggregates sub-repos
@@ -57,7 +147,13 @@ type Repository struct {
 	DocumentTypes DocumentTypes
 	Tags          Tags
 	Document      Document
+	Tiles         Tiles
 	Admin         Admin
+	Roles         Roles
+	Groups        Groups
+	Access        AccessRequests
+	Uploads       Uploads
+	Fixity        Fixity
 
 	DB *sqlx.DB
 }
@@ -68,7 +164,13 @@ func NewRepository(db *sqlx.DB) *Repository {
 		DocumentTypes: NewDocumentTypesPostgres(db),
 		Tags:          NewTagsPostgres(db),
 		Document:      NewDocumentPostgres(db),
+		Tiles:         NewTilesPostgres(db),
 		Admin:         NewAdminPostgres(db),
+		Roles:         NewRolesPostgres(db),
+		Groups:        NewGroupsPostgres(db),
+		Access:        NewAccessRequestsPostgres(db),
+		Uploads:       NewUploadsPostgres(db),
+		Fixity:        NewFixityPostgres(db),
 		DB:            db,
 	}
 }
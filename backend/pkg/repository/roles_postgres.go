@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+
+	"archive"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type RolesPostgres struct {
+	db *sqlx.DB
+}
+
+func NewRolesPostgres(db *sqlx.DB) *RolesPostgres {
+	return &RolesPostgres{db: db}
+}
+
+// ListPermissions -> SELECT * FROM fn_list_permissions()
+func (r *RolesPostgres) ListPermissions(ctx context.Context) ([]archive.Permission, error) {
+	query := `SELECT code, description FROM ` + fnListPermissions + `()`
+	perms := make([]archive.Permission, 0)
+	if err := r.db.SelectContext(ctx, &perms, query); err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+// ListRoles -> SELECT * FROM fn_list_roles(p_requester_id)
+func (r *RolesPostgres) ListRoles(ctx context.Context, requesterID int64) ([]archive.Role, error) {
+	query := `SELECT id, name, description, is_system, permissions, user_count FROM ` + fnListRoles + `($1)`
+	rows, err := r.db.QueryxContext(ctx, query, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]archive.Role, 0)
+	for rows.Next() {
+		var role archive.Role
+		var perms pq.StringArray
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.IsSystem, &perms, &role.UserCount); err != nil {
+			return nil, err
+		}
+		role.Permissions = []string(perms)
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// rolePermissionsArg — nil-срез передаётся как NULL («не менять»), пустой — как '{}'
+func rolePermissionsArg(perms []string) interface{} {
+	if perms == nil {
+		return nil
+	}
+	return pq.Array(perms)
+}
+
+// CreateRole -> SELECT fn_create_role(p_requester_id, p_name, p_description, p_permissions)
+func (r *RolesPostgres) CreateRole(ctx context.Context, requesterID int64, in archive.RoleInput) (int64, error) {
+	var id int64
+	query := `SELECT ` + fnCreateRole + `($1,$2,$3,$4)`
+	if err := r.db.QueryRowxContext(ctx, query, requesterID, in.Name, in.Description, rolePermissionsArg(in.Permissions)).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateRole -> SELECT fn_update_role(p_requester_id, p_role_id, p_name, p_description, p_permissions)
+func (r *RolesPostgres) UpdateRole(ctx context.Context, requesterID int64, roleID int64, in archive.RoleInput) error {
+	query := `SELECT ` + fnUpdateRole + `($1,$2,$3,$4,$5)`
+	_, err := r.db.ExecContext(ctx, query, requesterID, roleID, in.Name, in.Description, rolePermissionsArg(in.Permissions))
+	return err
+}
+
+// DeleteRole -> SELECT fn_delete_role(p_requester_id, p_role_id)
+func (r *RolesPostgres) DeleteRole(ctx context.Context, requesterID int64, roleID int64) error {
+	query := `SELECT ` + fnDeleteRole + `($1,$2)`
+	_, err := r.db.ExecContext(ctx, query, requesterID, roleID)
+	return err
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TilesPostgres struct {
+	db *sqlx.DB
+}
+
+func NewTilesPostgres(db *sqlx.DB) *TilesPostgres {
+	return &TilesPostgres{db: db}
+}
+
+// GetDocumentsTile -> fn_get_documents_tile(requester, z, x, y, cluster); пустой тайл — nil
+func (r *TilesPostgres) GetDocumentsTile(ctx context.Context, z, x, y int, cluster bool) ([]byte, error) {
+	var requester interface{}
+	if uid, ok := userIDFromCtx(ctx); ok {
+		requester = uid
+	}
+
+	var tile []byte
+	query := `SELECT ` + fnGetDocumentsTile + `($1,$2,$3,$4,$5)`
+	if err := r.db.QueryRowxContext(ctx, query, requester, z, x, y, cluster).Scan(&tile); err != nil {
+		return nil, err
+	}
+	return tile, nil
+}
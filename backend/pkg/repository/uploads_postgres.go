@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	"archive"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type UploadsPostgres struct {
+	db *sqlx.DB
+}
+
+func NewUploadsPostgres(db *sqlx.DB) *UploadsPostgres {
+	return &UploadsPostgres{db: db}
+}
+
+type uploadRow struct {
+	archive.Upload
+	MetadataJSON json.RawMessage  `db:"metadata"`
+	PartsJSON    json.RawMessage  `db:"parts"`
+	FileMetaJSON *json.RawMessage `db:"file_meta"`
+}
+
+// Create -> SELECT fn_create_upload(p_id, p_user_id, p_length, p_filename, p_content_type, p_metadata,
+// p_bucket, p_key, p_storage_upload_id, p_expires_at, p_kind, p_sha256)
+func (r *UploadsPostgres) Create(ctx context.Context, u archive.Upload) error {
+	meta, err := json.Marshal(u.Metadata)
+	if err != nil {
+		return err
+	}
+	var storageUploadID *string
+	if u.StorageUploadID != "" {
+		storageUploadID = &u.StorageUploadID
+	}
+	query := `SELECT ` + fnCreateUpload + `($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`
+	_, err = r.db.ExecContext(ctx, query, u.ID, u.UserID, u.Length, u.Filename, u.ContentType, string(meta),
+		u.Bucket, u.Key, storageUploadID, u.ExpiresAt, u.Kind, u.Sha256)
+	return pgError(err)
+}
+
+// Get -> SELECT * FROM fn_get_upload(p_id, p_user_id)
+func (r *UploadsPostgres) Get(ctx context.Context, userID int64, id string) (archive.Upload, error) {
+	query := `SELECT id, user_id, kind, upload_length, upload_offset, filename, content_type, metadata, sha256, bucket, key,
+       coalesce(storage_upload_id, '') AS storage_upload_id, parts, hash_state, status, file_meta, created_at, updated_at, expires_at
+FROM ` + fnGetUpload + `($1,$2)`
+
+	var row uploadRow
+	if err := r.db.GetContext(ctx, &row, query, id, userID); err != nil {
+		return archive.Upload{}, pgError(err)
+	}
+	u := row.Upload
+	if err := json.Unmarshal(row.MetadataJSON, &u.Metadata); err != nil {
+		return archive.Upload{}, err
+	}
+	if err := json.Unmarshal(row.PartsJSON, &u.Parts); err != nil {
+		return archive.Upload{}, err
+	}
+	if row.FileMetaJSON != nil {
+		u.FileMeta = &archive.FileMeta{}
+		if err := json.Unmarshal(*row.FileMetaJSON, u.FileMeta); err != nil {
+			return archive.Upload{}, err
+		}
+	}
+	return u, nil
+}
+
+// SaveProgress -> SELECT fn_save_upload_progress(p_id, p_user_id, p_old_offset, p_new_offset, p_parts, p_hash_state);
+// oldOffset не совпал с сохранённым — ErrConflict
+func (r *UploadsPostgres) SaveProgress(ctx context.Context, userID int64, id string, oldOffset, newOffset int64, parts []archive.UploadPart, hashState []byte) error {
+	if parts == nil {
+		parts = []archive.UploadPart{}
+	}
+	b, err := json.Marshal(parts)
+	if err != nil {
+		return err
+	}
+	query := `SELECT ` + fnSaveUploadProgress + `($1,$2,$3,$4,$5,$6)`
+	_, err = r.db.ExecContext(ctx, query, id, userID, oldOffset, newOffset, string(b), hashState)
+	return pgError(err)
+}
+
+// Complete -> SELECT fn_complete_upload(p_id, p_user_id, p_file_meta)
+func (r *UploadsPostgres) Complete(ctx context.Context, userID int64, id string, fm archive.FileMeta) error {
+	b, err := json.Marshal(fm)
+	if err != nil {
+		return err
+	}
+	query := `SELECT ` + fnCompleteUpload + `($1,$2,$3)`
+	_, err = r.db.ExecContext(ctx, query, id, userID, string(b))
+	return pgError(err)
+}
+
+// Delete -> SELECT fn_delete_upload(p_id, p_user_id)
+func (r *UploadsPostgres) Delete(ctx context.Context, userID int64, id string) error {
+	query := `SELECT ` + fnDeleteUpload + `($1,$2)`
+	_, err := r.db.ExecContext(ctx, query, id, userID)
+	return pgError(err)
+}
+
+// PurgeExpired -> SELECT * FROM fn_purge_expired_uploads(p_limit): строки уже удалены
+func (r *UploadsPostgres) PurgeExpired(ctx context.Context, limit int) ([]archive.ExpiredUpload, error) {
+	query := `SELECT id, kind, status, bucket, key, coalesce(storage_upload_id, '') AS storage_upload_id
+FROM ` + fnPurgeExpiredUploads + `($1)`
+	items := make([]archive.ExpiredUpload, 0)
+	if err := r.db.SelectContext(ctx, &items, query, limit); err != nil {
+		return nil, pgError(err)
+	}
+	return items, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidAccessRequest = errors.New("invalid access request")
+
+// статусы запросов, по которым можно фильтровать очередь
+var accessRequestStatuses = map[string]bool{
+	"pending":   true,
+	"approved":  true,
+	"rejected":  true,
+	"cancelled": true,
+}
+
+type AccessRequestsService struct {
+	repo repository.AccessRequests
+}
+
+func NewAccessRequestsService(repo repository.AccessRequests) *AccessRequestsService {
+	return &AccessRequestsService{repo: repo}
+}
+
+func (s *AccessRequestsService) Create(ctx context.Context, userID int64, docID int64, level string, reason *string) (int64, error) {
+	if docID <= 0 {
+		return 0, ErrInvalidAccessRequest
+	}
+	if level == "" {
+		level = "view"
+	}
+	if level != "view" && level != "edit" {
+		return 0, ErrInvalidAccessRequest
+	}
+	return s.repo.Create(ctx, userID, docID, level, reason)
+}
+
+func (s *AccessRequestsService) ListMine(ctx context.Context, userID int64) ([]archive.AccessRequest, error) {
+	return s.repo.ListMine(ctx, userID)
+}
+
+// ListIncoming: пустой status — только ожидающие, "all" — все
+func (s *AccessRequestsService) ListIncoming(ctx context.Context, userID int64, status string) ([]archive.AccessRequest, error) {
+	switch {
+	case status == "":
+		status = "pending"
+	case status == "all":
+		return s.repo.ListIncoming(ctx, userID, nil)
+	case !accessRequestStatuses[status]:
+		return nil, ErrInvalidAccessRequest
+	}
+	return s.repo.ListIncoming(ctx, userID, &status)
+}
+
+func (s *AccessRequestsService) Decide(ctx context.Context, userID int64, requestID int64, d archive.AccessDecision) error {
+	if requestID <= 0 {
+		return ErrInvalidAccessRequest
+	}
+	if d.ExpiresAt != nil && (!d.Approve || !d.ExpiresAt.After(time.Now())) {
+		return ErrInvalidAccessRequest
+	}
+	return s.repo.Decide(ctx, userID, requestID, d)
+}
+
+func (s *AccessRequestsService) Cancel(ctx context.Context, userID int64, requestID int64) error {
+	if requestID <= 0 {
+		return ErrInvalidAccessRequest
+	}
+	return s.repo.Cancel(ctx, userID, requestID)
+}
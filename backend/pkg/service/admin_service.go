@@ -4,9 +4,21 @@ import (
 	"archive"
 	"archive/pkg/repository"
 	"context"
+	"errors"
+	"strings"
 	"time"
 )
 
+const (
+	defaultUserListLimit = 50
+	maxUserListLimit     = 500
+
+	// длина временного пароля при сбросе (байт до base64url)
+	tempPasswordBytes = 12
+)
+
+var ErrInvalidUserInput = errors.New("invalid user input")
+
 type AdminService struct {
 	repo repository.Admin
 }
@@ -26,3 +38,72 @@ func (s *AdminService) GetLogsByTable(ctx context.Context, adminID int64, tableN
 func (s *AdminService) GetLogsByDate(ctx context.Context, adminID int64, start time.Time, end time.Time) ([]archive.LogRecord, error) {
 	return s.repo.GetLogsByDate(ctx, adminID, start, end)
 }
+
+func (s *AdminService) ListUsers(ctx context.Context, adminID int64, filter archive.UserListFilter) (archive.UserListResult, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUserListLimit
+	}
+	if filter.Limit > maxUserListLimit {
+		filter.Limit = maxUserListLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	users, total, err := s.repo.ListUsers(ctx, adminID, filter)
+	if err != nil {
+		return archive.UserListResult{}, err
+	}
+	return archive.UserListResult{Items: users, Total: total, Limit: filter.Limit, Offset: filter.Offset}, nil
+}
+
+// CreateUser создаёт пользователя с заданной ролью. Пароль — временный:
+// пользователь должен сменить его при первом входе.
+func (s *AdminService) CreateUser(ctx context.Context, adminID int64, in archive.AdminUserCreateInput) (int64, error) {
+	if strings.TrimSpace(in.Login) == "" || in.Password == "" || in.RoleID <= 0 {
+		return 0, ErrInvalidUserInput
+	}
+	hash, err := hashPassword(in.Password)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.CreateUser(ctx, adminID, in, hash)
+}
+
+func (s *AdminService) SetUserRole(ctx context.Context, adminID int64, targetUserID int64, roleID int64) error {
+	if targetUserID <= 0 || roleID <= 0 {
+		return ErrInvalidUserInput
+	}
+	return s.repo.SetUserRole(ctx, adminID, targetUserID, roleID)
+}
+
+func (s *AdminService) SetUserDisabled(ctx context.Context, adminID int64, targetUserID int64, disabled bool) error {
+	if targetUserID <= 0 {
+		return ErrInvalidUserInput
+	}
+	return s.repo.SetUserDisabled(ctx, adminID, targetUserID, disabled)
+}
+
+// ResetUserPassword задаёт временный пароль и отзывает сессии пользователя.
+// Пустой password — сгенерировать; временный пароль возвращается, чтобы передать его пользователю.
+func (s *AdminService) ResetUserPassword(ctx context.Context, adminID int64, targetUserID int64, password string) (string, error) {
+	if targetUserID <= 0 {
+		return "", ErrInvalidUserInput
+	}
+	if password == "" {
+		generated, err := randomToken(tempPasswordBytes)
+		if err != nil {
+			return "", err
+		}
+		password = generated
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.ResetUserPassword(ctx, adminID, targetUserID, hash); err != nil {
+		return "", err
+	}
+	return password, nil
+}
@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,95 +16,273 @@ import (
 	"archive/pkg/repository"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
 )
 
+var (
+	ErrInvalidCredentials  = errors.New("invalid login or password")
+	ErrOldPasswordMismatch = errors.New("old password does not match")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+	ErrTokenRevoked        = errors.New("token revoked")
+	ErrUserDisabled        = errors.New("user account is disabled")
+	// ErrPasswordChangeRequired — токен действителен, но до смены пароля доступна только она
+	ErrPasswordChangeRequired = errors.New("password change required")
+)
+
+// статусы fn_rotate_refresh_token
 const (
-	// желательно вынести в конфиг приложения
-	salt       = "hjqrhjqw124617ajfhajs"
-	signingKey = "archive#test#just#some###24214texTTTT#S"
-	tokenTTL   = 12 * time.Hour
+	refreshStatusOK      = "ok"
+	refreshStatusExpired = "expired"
+	refreshStatusRevoked = "revoked"
+	refreshStatusReused  = "reused"
 )
 
+// TokenPair — ответ на вход и обмен refresh-токена.
+// Поле token оставлено под прежним именем для совместимости с клиентами.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // срок жизни access-токена, секунды
+
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+}
+
 type tokenClaims struct {
 	jwt.StandardClaims
 	UserId int64 `json:"user_id"`
+	// IssuedAtMicro — время выпуска в микросекундах: iat хранит секунды, а отзыв
+	// («выйти везде») и новый вход часто приходятся на одну секунду
+	IssuedAtMicro int64 `json:"iat_us,omitempty"`
+}
+
+// issuedBefore — токен выпущен не позже t; для токенов без iat_us сравниваются секунды
+func (c tokenClaims) issuedBefore(t time.Time) bool {
+	if c.IssuedAtMicro > 0 {
+		return c.IssuedAtMicro <= t.UnixMicro()
+	}
+	return c.IssuedAt <= t.Unix()
 }
 
 type AuthService struct {
-	repo repository.Authorization
+	repo   repository.Authorization
+	tokens *TokenManager
 }
 
-func NewAuthService(repo repository.Authorization) *AuthService {
-	return &AuthService{repo: repo}
+func NewAuthService(repo repository.Authorization, tokens *TokenManager) *AuthService {
+	return &AuthService{repo: repo, tokens: tokens}
 }
 
 func (s *AuthService) CreateUser(ctx context.Context, user archive.User) (int64, error) {
 	if user.Login == "" || user.PasswordHash == "" {
 		return 0, errors.New("login and password required")
 	}
-	user.PasswordHash = s.generatePasswordHash(user.PasswordHash)
+	hash, err := hashPassword(user.PasswordHash)
+	if err != nil {
+		return 0, err
+	}
+	user.PasswordHash = hash
 	return s.repo.CreateUser(ctx, user)
 }
 
-func (s *AuthService) GenerateToken(ctx context.Context, username, password string) (string, error) {
+// GenerateToken проверяет пароль и начинает новую сессию: access-токен и
+// refresh-токен нового семейства.
+func (s *AuthService) GenerateToken(ctx context.Context, username, password string) (TokenPair, error) {
 	if username == "" || password == "" {
-		return "", errors.New("username/password required")
+		return TokenPair{}, errors.New("username/password required")
 	}
-	hashed := s.generatePasswordHash(password)
 
-	u, err := s.repo.GetUser(ctx, username, hashed)
+	u, err := s.repo.GetUser(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		// выравниваем время ответа с веткой существующего пользователя
+		_, _, _ = verifyPassword(password, dummyPasswordHash)
+		return TokenPair{}, ErrInvalidCredentials
+	}
 	if err != nil {
-		return "", err
+		return TokenPair{}, err
+	}
+
+	ok, needsRehash, err := verifyPassword(password, u.PasswordHash)
+	if err != nil {
+		logrus.Errorf("user %d: %s", u.ID, err.Error())
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if !ok {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if u.Disabled {
+		return TokenPair{}, ErrUserDisabled
+	}
+	if needsRehash {
+		s.rehashPassword(ctx, u.ID, u.PasswordHash, password)
 	}
 
-	return s.generateTokenForUserID(u.ID)
+	familyID, err := randomToken(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	expiresAt := time.Now().Add(s.tokens.RefreshTTL())
+	if err := s.repo.CreateRefreshToken(ctx, u.ID, familyID, hashRefreshToken(refresh), expiresAt); err != nil {
+		return TokenPair{}, err
+	}
+
+	pair, err := s.tokenPair(u.ID, refresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	pair.PasswordChangeRequired = u.MustChangePassword
+	return pair, nil
 }
 
-func (s *AuthService) ParseToken(ctx context.Context, accessToken string) (int64, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// проверка метода подписи
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(signingKey), nil
-	})
+// rehashPassword переводит пароль на текущую схему хеширования. Ошибка не мешает входу:
+// пароль уже проверен, а перехешировать можно и при следующем входе.
+func (s *AuthService) rehashPassword(ctx context.Context, userID int64, oldHash, password string) {
+	newHash, err := hashPassword(password)
 	if err != nil {
+		logrus.Errorf("rehash password for user %d: %s", userID, err.Error())
+		return
+	}
+	if _, err := s.repo.RehashPassword(ctx, userID, oldHash, newHash); err != nil {
+		logrus.Errorf("rehash password for user %d: %s", userID, err.Error())
+	}
+}
+
+// ParseToken проверяет access-токен, то, что он выпущен после последнего «выйти везде»,
+// и что пользователь не заблокирован. Если пользователь обязан сменить пароль,
+// возвращается его id вместе с ErrPasswordChangeRequired.
+func (s *AuthService) ParseToken(ctx context.Context, accessToken string) (int64, error) {
+	var claims tokenClaims
+	if err := s.tokens.Parse(accessToken, &claims); err != nil {
 		return 0, err
 	}
 
-	claims, ok := token.Claims.(*tokenClaims)
-	if !ok || !token.Valid {
-		return 0, errors.New("invalid token claims")
+	state, err := s.repo.GetAuthState(ctx, claims.UserId)
+	if err != nil {
+		return 0, err
+	}
+	if state.TokensRevokedAt != nil && claims.issuedBefore(*state.TokensRevokedAt) {
+		return 0, ErrTokenRevoked
+	}
+	if state.Disabled {
+		return 0, ErrUserDisabled
+	}
+	if state.MustChangePassword {
+		return claims.UserId, ErrPasswordChangeRequired
 	}
 	return claims.UserId, nil
 }
 
-// RefreshToken — если переданный токен валиден (подпись и срок жизни),
-// создаёт и возвращает новый токен для того же user_id.
-func (s *AuthService) RefreshToken(ctx context.Context, accessToken string) (string, error) {
-	userId, err := s.ParseToken(ctx, accessToken)
+// HasPermission — проверка права роли пользователя (has_permission в БД)
+func (s *AuthService) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	return s.repo.HasPermission(ctx, userID, permission)
+}
+
+// JWKS — открытые ключи проверки токенов для других сервисов
+func (s *AuthService) JWKS() JWKSet {
+	return s.tokens.JWKS()
+}
+
+// RefreshToken обменивает refresh-токен на новую пару. Refresh-токен одноразовый:
+// повторное предъявление уже обменянного токена отзывает всю сессию (семейство).
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (TokenPair, error) {
+	if refreshToken == "" {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	next, err := randomToken(32)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	expiresAt := time.Now().Add(s.tokens.RefreshTTL())
+
+	userID, status, err := s.repo.RotateRefreshToken(ctx, hashRefreshToken(refreshToken), hashRefreshToken(next), expiresAt)
 	if err != nil {
+		return TokenPair{}, err
+	}
+	switch status {
+	case refreshStatusOK:
+		return s.tokenPair(userID, next)
+	case refreshStatusExpired:
+		return TokenPair{}, ErrRefreshTokenExpired
+	case refreshStatusRevoked:
+		return TokenPair{}, ErrTokenRevoked
+	case refreshStatusReused:
+		logrus.Warnf("refresh token reuse for user %d, session family revoked", userID)
+		return TokenPair{}, ErrRefreshTokenReused
+	default:
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+}
+
+// Logout завершает сессию, к которой относится refresh-токен.
+// Уже выданный access-токен остаётся действительным до истечения своего (короткого) срока.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	if refreshToken == "" {
+		return ErrInvalidRefreshToken
+	}
+	found, err := s.repo.RevokeRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// LogoutAll отзывает все сессии пользователя, включая уже выданные access-токены.
+func (s *AuthService) LogoutAll(ctx context.Context, userID int64) error {
+	if userID == 0 {
+		return errors.New("invalid user id")
+	}
+	return s.repo.RevokeUserTokens(ctx, userID)
+}
+
+func (s *AuthService) tokenPair(userID int64, refreshToken string) (TokenPair, error) {
+	access, err := s.generateTokenForUserID(userID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.tokens.TTL() / time.Second),
+	}, nil
+}
+
+// randomToken — n случайных байт в base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return s.generateTokenForUserID(userId)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken — в БД хранится только sha256 от refresh-токена.
+// Токен случайный и длинный, поэтому медленный хеш не нужен.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *AuthService) generateTokenForUserID(userID int64) (string, error) {
+	now := time.Now()
 	claims := tokenClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
-			IssuedAt:  time.Now().Unix(),
+			Issuer:    s.tokens.Issuer(),
+			Subject:   strconv.FormatInt(userID, 10),
+			ExpiresAt: now.Add(s.tokens.TTL()).Unix(),
+			IssuedAt:  now.Unix(),
 		},
-		UserId: userID,
+		UserId:        userID,
+		IssuedAtMicro: now.UnixMicro(),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-	return token.SignedString([]byte(signingKey))
-}
-
-func (s *AuthService) generatePasswordHash(password string) string {
-	h := sha256.New()
-	h.Write([]byte(password))
-	return fmt.Sprintf("%x", h.Sum([]byte(salt)))
+	return s.tokens.Sign(&claims)
 }
 
 func (s *AuthService) GetUsersByIDs(ctx context.Context, ids []int64) ([]archive.User, error) {
@@ -125,11 +307,26 @@ func (s *AuthService) ChangeUserPassword(ctx context.Context, requesterID int64,
 	if strings.TrimSpace(newPassword) == "" {
 		return errors.New("new password required")
 	}
-	oldHash := ""
-	if strings.TrimSpace(oldPassword) != "" {
-		oldHash = s.generatePasswordHash(oldPassword)
+
+	// свой пароль (в том числе администратор) меняется только со старым паролем;
+	// чужой — только администратором, это проверяет fn_change_user_password
+	if requesterID == targetUserID {
+		current, err := s.repo.GetPasswordHash(ctx, targetUserID)
+		if err != nil {
+			return err
+		}
+		ok, _, err := verifyPassword(oldPassword, current)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrOldPasswordMismatch
+		}
 	}
-	newHash := s.generatePasswordHash(newPassword)
 
-	return s.repo.ChangeUserPassword(ctx, requesterID, targetUserID, oldHash, newHash)
+	newHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	return s.repo.ChangeUserPassword(ctx, requesterID, targetUserID, newHash)
 }
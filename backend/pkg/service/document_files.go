@@ -0,0 +1,95 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// fileRoles — допустимые роли вложений (как CHECK в document_files)
+var fileRoles = map[string]bool{"original": true, "transcript": true, "preview": true, "attachment": true}
+
+func validFileRole(role string) error {
+	if !fileRoles[role] {
+		return fmt.Errorf("%w: role must be one of original/transcript/preview/attachment", repository.ErrInvalidInput)
+	}
+	return nil
+}
+
+func (s *DocumentService) ListFiles(ctx context.Context, docID int64) ([]archive.DocumentFile, error) {
+	if docID <= 0 {
+		return nil, errors.New("invalid id")
+	}
+	return s.repo.ListFiles(ctx, docID)
+}
+
+func (s *DocumentService) AddFile(ctx context.Context, docID int64, role string, fm archive.FileMeta, position *int) (int64, error) {
+	if docID <= 0 {
+		return 0, errors.New("invalid id")
+	}
+	if role == "" {
+		role = "attachment"
+	}
+	if err := validFileRole(role); err != nil {
+		return 0, err
+	}
+	if position != nil && *position <= 0 {
+		return 0, fmt.Errorf("%w: position must be positive", repository.ErrInvalidInput)
+	}
+	return s.repo.AddFile(ctx, docID, role, fm, position)
+}
+
+func (s *DocumentService) ReplaceFile(ctx context.Context, docID int64, fileID int64, role *string, fm *archive.FileMeta) error {
+	if docID <= 0 || fileID <= 0 {
+		return errors.New("invalid id")
+	}
+	if role == nil && fm == nil {
+		return fmt.Errorf("%w: nothing to update", repository.ErrInvalidInput)
+	}
+	if role != nil {
+		if err := validFileRole(*role); err != nil {
+			return err
+		}
+	}
+	return s.repo.ReplaceFile(ctx, docID, fileID, role, fm)
+}
+
+func (s *DocumentService) RemoveFile(ctx context.Context, docID int64, fileID int64) error {
+	if docID <= 0 || fileID <= 0 {
+		return errors.New("invalid id")
+	}
+	return s.repo.RemoveFile(ctx, docID, fileID)
+}
+
+func (s *DocumentService) ReorderFiles(ctx context.Context, docID int64, fileIDs []int64) error {
+	if docID <= 0 {
+		return errors.New("invalid id")
+	}
+	if len(fileIDs) == 0 {
+		return fmt.Errorf("%w: file_ids is required", repository.ErrInvalidInput)
+	}
+	return s.repo.ReorderFiles(ctx, docID, fileIDs)
+}
+
+func (s *DocumentService) OpenAttachment(ctx context.Context, docID int64, fileID int64) (archive.FileMeta, error) {
+	if docID <= 0 || fileID <= 0 {
+		return archive.FileMeta{}, errors.New("invalid id")
+	}
+	return s.repo.OpenAttachment(ctx, docID, fileID)
+}
+
+func (s *DocumentService) LogAttachmentDownload(ctx context.Context, docID int64, fileID int64, rangeHeader string) error {
+	if docID <= 0 || fileID <= 0 {
+		return errors.New("invalid id")
+	}
+	return s.repo.LogAttachmentDownload(ctx, docID, fileID, rangeHeader)
+}
+
+func (s *DocumentService) SharedFiles(ctx context.Context, docID int64) ([]archive.SharedFile, error) {
+	if docID <= 0 {
+		return nil, errors.New("invalid id")
+	}
+	return s.repo.SharedFiles(ctx, docID)
+}
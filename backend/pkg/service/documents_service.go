@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"archive"
 	"archive/pkg/repository"
@@ -24,18 +26,47 @@ func (s *DocumentService) CreateDocument(ctx context.Context, in archive.Documen
 	if in.Privacy == "" {
 		in.Privacy = archive.PrivacyPublic
 	}
+	// текст файла сохраняется в той же транзакции
 	return s.repo.CreateDocument(ctx, in)
 }
 
-func (s *DocumentService) SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, error) {
-	return s.repo.SearchDocumentsByTag(ctx, filter)
+func (s *DocumentService) SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) (archive.DocumentSearchResult, error) {
+	if err := normalizeSearchFilter(&filter); err != nil {
+		return archive.DocumentSearchResult{}, err
+	}
+
+	items, total, err := s.repo.SearchDocumentsByTag(ctx, filter)
+	if err != nil {
+		return archive.DocumentSearchResult{}, err
+	}
+
+	res := archive.DocumentSearchResult{
+		Items:  items,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+		Sort:   filter.Sort,
+		Order:  filter.Order,
+	}
+	// дальше maxSearchOffset курсор не выдаётся: total показывает, что результаты есть ещё
+	if next := filter.Offset + len(items); int64(next) < total && next <= maxSearchOffset {
+		res.NextCursor = encodeSearchCursor(next)
+	}
+	return res, nil
 }
 
 func (s *DocumentService) GetDocumentByID(ctx context.Context, id int64) (archive.DocumentSecure, error) {
 	if id <= 0 {
 		return archive.DocumentSecure{}, errors.New("invalid id")
 	}
-	return s.repo.GetDocumentByID(ctx, id)
+	doc, err := s.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return doc, err
+	}
+	if doc.Files, err = s.repo.ListFiles(ctx, id); err != nil {
+		return archive.DocumentSecure{}, err
+	}
+	return doc, nil
 }
 
 func (s *DocumentService) UpdateDocument(ctx context.Context, id int64, in archive.DocumentUpdateInput) error {
@@ -45,15 +76,102 @@ func (s *DocumentService) UpdateDocument(ctx context.Context, id int64, in archi
 	return s.repo.UpdateDocument(ctx, id, in)
 }
 
-func (s *DocumentService) DeleteDocument(ctx context.Context, id int64) error {
+// patchFields — ключи, которые принимает fn_patch_document
+var patchFields = map[string]bool{
+	"title": true, "privacy": true, "document_date": true, "author": true,
+	"type_id": true, "geojson": true, "tags": true, "file_meta": true,
+}
+
+func (s *DocumentService) PatchDocument(ctx context.Context, id int64, p archive.DocumentPatch) (int64, error) {
+	if id <= 0 {
+		return 0, errors.New("invalid id")
+	}
+	if len(p.Fields) == 0 {
+		return 0, fmt.Errorf("%w: nothing to update", repository.ErrInvalidInput)
+	}
+	for k, v := range p.Fields {
+		if !patchFields[k] {
+			return 0, fmt.Errorf("%w: unknown field %q", repository.ErrInvalidInput, k)
+		}
+		if v == nil && (k == "title" || k == "privacy") {
+			return 0, fmt.Errorf("%w: %s cannot be cleared", repository.ErrInvalidInput, k)
+		}
+	}
+
+	return s.repo.PatchDocument(ctx, id, p)
+}
+
+// RequireEdit — проверка права на правку до загрузки файла в хранилище
+func (s *DocumentService) RequireEdit(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return fmt.Errorf("%w: invalid id", repository.ErrInvalidInput)
+	}
+	return s.repo.RequireEdit(ctx, id)
+}
+
+func (s *DocumentService) OpenDocumentFile(ctx context.Context, docID int64, version *int64) (archive.FileMeta, error) {
+	if docID <= 0 || (version != nil && *version <= 0) {
+		return archive.FileMeta{}, errors.New("invalid id")
+	}
+	return s.repo.OpenDocumentFile(ctx, docID, version)
+}
+
+func (s *DocumentService) LogDocumentDownload(ctx context.Context, docID int64, version *int64, rangeHeader string) error {
+	if docID <= 0 || (version != nil && *version <= 0) {
+		return errors.New("invalid id")
+	}
+	return s.repo.LogDocumentDownload(ctx, docID, version, rangeHeader)
+}
+
+func (s *DocumentService) SetDocumentFileText(ctx context.Context, docID int64, userID int64, text *string) error {
+	if docID <= 0 || userID <= 0 {
+		return errors.New("invalid input")
+	}
+	return s.repo.SetDocumentFileText(ctx, docID, userID, text)
+}
+
+func (s *DocumentService) DeleteDocument(ctx context.Context, id int64, ifMatch *int64) error {
 	if id <= 0 {
 		return errors.New("invalid id")
 	}
-	return s.repo.DeleteDocument(ctx, id)
+	return s.repo.DeleteDocument(ctx, id, ifMatch)
+}
+
+func (s *DocumentService) ListTrash(ctx context.Context) ([]archive.TrashItem, error) {
+	return s.repo.ListTrash(ctx)
+}
+
+func (s *DocumentService) RestoreDocument(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return fmt.Errorf("%w: invalid id", repository.ErrInvalidInput)
+	}
+	return s.repo.RestoreDocument(ctx, id)
+}
+
+// PurgeDeleted вызывается планировщиком; возвращённые файлы удаляет StorageGC.RemovePurged
+func (s *DocumentService) PurgeDeleted(ctx context.Context, olderThan time.Duration, limit int) ([]archive.FileMeta, error) {
+	if olderThan < 0 {
+		return nil, errors.New("retention must not be negative")
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.repo.PurgeDeleted(ctx, olderThan, limit)
+}
+
+func (s *DocumentService) ListDocumentPermissions(ctx context.Context, docID int64) ([]archive.DocumentGrant, error) {
+	if docID <= 0 {
+		return nil, errors.New("invalid id")
+	}
+	return s.repo.ListDocumentPermissions(ctx, docID)
+}
+
+func (s *DocumentService) GetSharedWithMe(ctx context.Context) ([]archive.SharedDocument, error) {
+	return s.repo.GetSharedWithMe(ctx)
 }
 
 func (s *DocumentService) SetDocumentPermission(ctx context.Context, docID int64, p archive.DocumentPermission) error {
-	if docID <= 0 || p.UserID <= 0 {
+	if docID <= 0 || p.UserID <= 0 || (p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now())) {
 		return errors.New("invalid input")
 	}
 	p.DocumentID = docID
@@ -66,3 +184,78 @@ func (s *DocumentService) RemoveDocumentPermission(ctx context.Context, docID in
 	}
 	return s.repo.RemoveDocumentPermission(ctx, docID, targetUserID)
 }
+
+func (s *DocumentService) SetDocumentGroupPermission(ctx context.Context, docID int64, p archive.DocumentGroupPermission) error {
+	if docID <= 0 || p.GroupID <= 0 || (p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now())) {
+		return errors.New("invalid input")
+	}
+	p.DocumentID = docID
+	return s.repo.SetDocumentGroupPermission(ctx, docID, p)
+}
+
+func (s *DocumentService) RemoveDocumentGroupPermission(ctx context.Context, docID int64, groupID int64) error {
+	if docID <= 0 || groupID <= 0 {
+		return errors.New("invalid input")
+	}
+	return s.repo.RemoveDocumentGroupPermission(ctx, docID, groupID)
+}
+
+// PurgeExpiredPermissions вызывается планировщиком; проверки доступа истёкшие права и так не учитывают
+func (s *DocumentService) PurgeExpiredPermissions(ctx context.Context) (int64, error) {
+	return s.repo.PurgeExpiredPermissions(ctx)
+}
+
+func (s *DocumentService) ListVersions(ctx context.Context, docID int64) ([]archive.DocumentVersion, error) {
+	if docID <= 0 {
+		return nil, fmt.Errorf("%w: invalid id", repository.ErrInvalidInput)
+	}
+	return s.repo.ListVersions(ctx, docID)
+}
+
+func (s *DocumentService) GetVersion(ctx context.Context, docID int64, version int64) (archive.DocumentVersion, error) {
+	if docID <= 0 || version <= 0 {
+		return archive.DocumentVersion{}, fmt.Errorf("%w: invalid id", repository.ErrInvalidInput)
+	}
+	return s.repo.GetVersion(ctx, docID, version)
+}
+
+// DiffVersions — поля, различающиеся между версиями from и to (в порядке from -> to);
+// to <= 0 — текущая версия
+func (s *DocumentService) DiffVersions(ctx context.Context, docID int64, from, to int64) (archive.VersionDiff, error) {
+	if to <= 0 {
+		versions, err := s.ListVersions(ctx, docID)
+		if err != nil {
+			return archive.VersionDiff{}, err
+		}
+		for _, v := range versions {
+			if v.IsCurrent {
+				to = v.Version
+				break
+			}
+		}
+		if to <= 0 {
+			return archive.VersionDiff{}, fmt.Errorf("%w: document %d has no current version", repository.ErrNotFound, docID)
+		}
+	}
+	a, err := s.GetVersion(ctx, docID, from)
+	if err != nil {
+		return archive.VersionDiff{}, err
+	}
+	b, err := s.GetVersion(ctx, docID, to)
+	if err != nil {
+		return archive.VersionDiff{}, err
+	}
+	return archive.VersionDiff{
+		DocumentID: docID,
+		From:       from,
+		To:         to,
+		Changes:    diffVersions(a, b),
+	}, nil
+}
+
+func (s *DocumentService) RestoreVersion(ctx context.Context, docID int64, version int64, ifMatch *int64) (int64, error) {
+	if docID <= 0 || version <= 0 {
+		return 0, fmt.Errorf("%w: invalid id", repository.ErrInvalidInput)
+	}
+	return s.repo.RestoreVersion(ctx, docID, version, ifMatch)
+}
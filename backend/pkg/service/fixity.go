@@ -0,0 +1,239 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FixityConfig — настройки проверки целостности (секция fixity конфига)
+type FixityConfig struct {
+	Batch        int           // объектов на один запрос к БД
+	MaxPerRun    int           // предел объектов за один запуск задачи; 0 — пока есть что проверять
+	RecheckAfter time.Duration // повторная проверка объекта не раньше чем через
+	RateLimit    int64         // байт/с чтения из хранилища на все проверки; 0 — без ограничения
+}
+
+// FixityReport — итог одного запуска
+type FixityReport struct {
+	Checked int   // объектов проверено
+	Bytes   int64 // байт прочитано
+	Failed  int   // mismatch, missing или error
+	Alerts  int   // новых сбоев (mismatch/missing), по которым поднята тревога
+}
+
+// FixityService перечитывает объекты хранилища, пересчитывает SHA-256 и сверяет
+// с FileMeta. Результат пишется в БД по объекту; прогресс — это время последней
+// проверки, поэтому прерванный проход продолжается со следующего непроверенного объекта
+type FixityService struct {
+	repo    repository.Fixity
+	store   storage.Storage
+	cfg     FixityConfig
+	limiter *rateLimiter
+}
+
+func NewFixityService(repo repository.Fixity, store storage.Storage, cfg FixityConfig) *FixityService {
+	if cfg.Batch <= 0 {
+		cfg.Batch = 50
+	}
+	if cfg.RecheckAfter <= 0 {
+		cfg.RecheckAfter = 30 * 24 * time.Hour
+	}
+	return &FixityService{repo: repo, store: store, cfg: cfg, limiter: newRateLimiter(cfg.RateLimit)}
+}
+
+// Run — один проход фоновой задачи
+func (s *FixityService) Run(ctx context.Context) (FixityReport, error) {
+	var report FixityReport
+	for s.cfg.MaxPerRun <= 0 || report.Checked < s.cfg.MaxPerRun {
+		limit := s.cfg.Batch
+		if s.cfg.MaxPerRun > 0 && s.cfg.MaxPerRun-report.Checked < limit {
+			limit = s.cfg.MaxPerRun - report.Checked
+		}
+		targets, err := s.repo.NextBatch(ctx, limit, s.cfg.RecheckAfter)
+		if err != nil {
+			return report, err
+		}
+		if len(targets) == 0 {
+			break
+		}
+		for _, t := range targets {
+			if _, err := s.verify(ctx, t, &report); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// CheckDocument — внеочередная проверка всех файлов документа (основной, версии, вложения)
+func (s *FixityService) CheckDocument(ctx context.Context, adminID int64, docID int64) ([]archive.FixityCheck, error) {
+	targets, err := s.repo.DocumentFiles(ctx, adminID, docID)
+	if err != nil {
+		return nil, err
+	}
+	var report FixityReport
+	checks := make([]archive.FixityCheck, 0, len(targets))
+	for _, t := range targets {
+		c, err := s.verify(ctx, t, &report)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, nil
+}
+
+func (s *FixityService) Report(ctx context.Context, adminID int64, filter archive.FixityReportFilter) ([]archive.FixityRecord, error) {
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 100
+	}
+	return s.repo.Report(ctx, adminID, filter)
+}
+
+// verify проверяет объект и сохраняет результат; ошибка — только отмена контекста или сбой БД
+func (s *FixityService) verify(ctx context.Context, t archive.FixityTarget, report *FixityReport) (archive.FixityCheck, error) {
+	c, err := s.check(ctx, t)
+	if err != nil {
+		return c, err
+	}
+	report.Checked++
+	if c.Size != nil {
+		report.Bytes += *c.Size
+	}
+	// результат сохраняется и при отмене запроса: объект уже прочитан
+	alert, err := s.repo.Record(context.WithoutCancel(ctx), c)
+	if err != nil {
+		return c, err
+	}
+	if c.Status != archive.FixityOK {
+		report.Failed++
+	}
+	if alert {
+		report.Alerts++
+		logrus.Errorf("fixity alert: %s/%s is %s (expected sha256 %s, actual %s)",
+			t.Bucket, t.Key, c.Status, deref(c.ExpectedSha256), deref(c.ActualSha256))
+	} else if c.Status == archive.FixityError {
+		logrus.Warnf("fixity: %s/%s: %s", t.Bucket, t.Key, deref(c.Error))
+	}
+	return c, nil
+}
+
+// check читает объект целиком; без ожидаемой суммы (старые записи) объект считается
+// исправным, а фактическая сумма сохраняется для отчёта
+func (s *FixityService) check(ctx context.Context, t archive.FixityTarget) (archive.FixityCheck, error) {
+	c := archive.FixityCheck{Bucket: t.Bucket, Key: t.Key, ExpectedSha256: t.Sha256}
+	fail := func(status string, err error) (archive.FixityCheck, error) {
+		c.Status = status
+		c.CheckedAt = time.Now()
+		if err != nil {
+			msg := err.Error()
+			c.Error = &msg
+		}
+		return c, nil
+	}
+
+	obj, _, err := s.store.Open(ctx, t.Bucket, t.Key)
+	if err != nil {
+		if ctx.Err() != nil {
+			return c, ctx.Err()
+		}
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return fail(archive.FixityMissing, nil)
+		}
+		return fail(archive.FixityError, err)
+	}
+	defer obj.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, &throttledReader{r: obj, ctx: ctx, limiter: s.limiter})
+	if err != nil {
+		if ctx.Err() != nil {
+			return c, ctx.Err()
+		}
+		return fail(archive.FixityError, err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	c.ActualSha256 = &sum
+	c.Size = &n
+
+	switch {
+	case t.Sha256 != nil && !strings.EqualFold(*t.Sha256, sum):
+		return fail(archive.FixityMismatch, nil)
+	case t.Size != nil && *t.Size > 0 && *t.Size != n:
+		return fail(archive.FixityMismatch, fmt.Errorf("size %d, expected %d", n, *t.Size))
+	}
+	c.Status = archive.FixityOK
+	c.CheckedAt = time.Now()
+	return c, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// rateLimiter делит полосу чтения между всеми проверками: каждый прочитанный
+// кусок занимает своё окно времени, и читатель ждёт его конца
+type rateLimiter struct {
+	bytesPerSec int64
+	mu          sync.Mutex
+	next        time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSec: bytesPerSec}
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.bytesPerSec) * float64(time.Second)))
+	until := l.next
+	l.mu.Unlock()
+
+	t := time.NewTimer(time.Until(until))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type throttledReader struct {
+	r       io.Reader
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if werr := t.limiter.wait(t.ctx, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"archive"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"archive/storage"
+)
+
+// fixityRepo — repository.Fixity в памяти. NextBatch и Record повторяют
+// fn_fixity_next_batch и fn_record_fixity_result: непроверенные объекты идут первыми,
+// тревога поднимается, когда объект впервые получает статус mismatch или missing
+type fixityRepo struct {
+	mu       sync.Mutex
+	targets  []archive.FixityTarget
+	results  map[string]fixityResult
+	recorded []archive.FixityCheck
+	alerts   []string // ключи, по которым ушёл бы pg_notify('fixity_alert')
+}
+
+type fixityResult struct {
+	status    string
+	checkedAt time.Time
+}
+
+func newFixityRepo(targets ...archive.FixityTarget) *fixityRepo {
+	return &fixityRepo{targets: targets, results: make(map[string]fixityResult)}
+}
+
+func (r *fixityRepo) NextBatch(ctx context.Context, limit int, recheckAfter time.Duration) ([]archive.FixityTarget, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	due := make([]archive.FixityTarget, 0)
+	for _, t := range r.targets {
+		res, ok := r.results[t.Key]
+		if !ok || !res.checkedAt.After(time.Now().Add(-recheckAfter)) {
+			due = append(due, t)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := r.results[due[i].Key].checkedAt, r.results[due[j].Key].checkedAt
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return due[i].Key < due[j].Key
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (r *fixityRepo) DocumentFiles(ctx context.Context, adminID int64, docID int64) ([]archive.FixityTarget, error) {
+	return r.targets, nil
+}
+
+func (r *fixityRepo) Record(ctx context.Context, c archive.FixityCheck) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, ok := r.results[c.Key]
+	r.results[c.Key] = fixityResult{status: c.Status, checkedAt: c.CheckedAt}
+	r.recorded = append(r.recorded, c)
+	alert := (c.Status == archive.FixityMismatch || c.Status == archive.FixityMissing) && (!ok || prev.status != c.Status)
+	if alert {
+		r.alerts = append(r.alerts, c.Key)
+	}
+	return alert, nil
+}
+
+func (r *fixityRepo) Report(ctx context.Context, adminID int64, filter archive.FixityReportFilter) ([]archive.FixityRecord, error) {
+	return nil, nil
+}
+
+func (r *fixityRepo) recordedKeys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.recorded))
+	for _, c := range r.recorded {
+		keys = append(keys, c.Key)
+	}
+	return keys
+}
+
+// fixityTarget — цель проверки с суммой и размером содержимого content
+func fixityTarget(key, content string) archive.FixityTarget {
+	sum := sha256.Sum256([]byte(content))
+	hexSum := hex.EncodeToString(sum[:])
+	size := int64(len(content))
+	return archive.FixityTarget{Bucket: "archive", Key: key, Sha256: &hexSum, Size: &size}
+}
+
+// openHookStorage вызывает onOpen перед каждым Open и, как настоящее хранилище,
+// не отдаёт объект по отменённому контексту
+type openHookStorage struct {
+	*memStorage
+	onOpen func(key string)
+}
+
+func (s openHookStorage) Open(ctx context.Context, bucket, key string) (io.ReadSeekCloser, storage.ObjectInfo, error) {
+	s.onOpen(key)
+	if err := ctx.Err(); err != nil {
+		return nil, storage.ObjectInfo{}, err
+	}
+	return s.memStorage.Open(ctx, bucket, key)
+}
+
+func TestFixityRun(t *testing.T) {
+	noSum := fixityTarget("c", "ccc")
+	noSum.Sha256 = nil
+	wrongSize := fixityTarget("c", "ccc")
+	wrongSize.Sha256 = nil
+	*wrongSize.Size = 4
+
+	tests := []struct {
+		name     string
+		targets  []archive.FixityTarget
+		stored   map[string]string
+		previous map[string]string // статус прошлой проверки
+		status   map[string]string
+		report   FixityReport
+		alerts   []string
+	}{
+		{
+			name:    "all objects intact",
+			targets: []archive.FixityTarget{fixityTarget("a", "aaa"), fixityTarget("b", "bbb")},
+			stored:  map[string]string{"a": "aaa", "b": "bbb"},
+			status:  map[string]string{"a": archive.FixityOK, "b": archive.FixityOK},
+			report:  FixityReport{Checked: 2, Bytes: 6},
+		},
+		{
+			name:    "altered bytes raise an alert",
+			targets: []archive.FixityTarget{fixityTarget("a", "aaa"), fixityTarget("b", "bbb")},
+			stored:  map[string]string{"a": "aaa", "b": "bXb"},
+			status:  map[string]string{"a": archive.FixityOK, "b": archive.FixityMismatch},
+			report:  FixityReport{Checked: 2, Bytes: 6, Failed: 1, Alerts: 1},
+			alerts:  []string{"b"},
+		},
+		{
+			name:    "missing object raises an alert",
+			targets: []archive.FixityTarget{fixityTarget("a", "aaa")},
+			stored:  map[string]string{},
+			status:  map[string]string{"a": archive.FixityMissing},
+			report:  FixityReport{Checked: 1, Failed: 1, Alerts: 1},
+			alerts:  []string{"a"},
+		},
+		{
+			name:     "known mismatch is not alerted again",
+			targets:  []archive.FixityTarget{fixityTarget("a", "aaa")},
+			stored:   map[string]string{"a": "aXa"},
+			previous: map[string]string{"a": archive.FixityMismatch},
+			status:   map[string]string{"a": archive.FixityMismatch},
+			report:   FixityReport{Checked: 1, Bytes: 3, Failed: 1},
+		},
+		{
+			name:    "size checked when there is no expected sum",
+			targets: []archive.FixityTarget{wrongSize},
+			stored:  map[string]string{"c": "ccc"},
+			status:  map[string]string{"c": archive.FixityMismatch},
+			report:  FixityReport{Checked: 1, Bytes: 3, Failed: 1, Alerts: 1},
+			alerts:  []string{"c"},
+		},
+		{
+			name:    "legacy record without sum is ok",
+			targets: []archive.FixityTarget{noSum},
+			stored:  map[string]string{"c": "ccc"},
+			status:  map[string]string{"c": archive.FixityOK},
+			report:  FixityReport{Checked: 1, Bytes: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+
+			store := newMemStorage()
+			for k, v := range tt.stored {
+				store.put(k, []byte(v), time.Now())
+			}
+			repo := newFixityRepo(tt.targets...)
+			for k, st := range tt.previous {
+				// давно проверенный объект снова в очереди
+				repo.results[k] = fixityResult{status: st, checkedAt: time.Now().Add(-60 * 24 * time.Hour)}
+			}
+			s := NewFixityService(repo, store, FixityConfig{Batch: 10})
+
+			report, err := s.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if report != tt.report {
+				t.Fatalf("report = %+v, want %+v", report, tt.report)
+			}
+			got := make(map[string]string)
+			for _, c := range repo.recorded {
+				got[c.Key] = c.Status
+				if c.Status == archive.FixityMismatch && c.ExpectedSha256 != nil && (c.ActualSha256 == nil || *c.ActualSha256 == *c.ExpectedSha256) {
+					t.Fatalf("%s: mismatch recorded without the actual sum", c.Key)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.status) {
+				t.Fatalf("recorded %v, want %v", got, tt.status)
+			}
+			if !reflect.DeepEqual(repo.alerts, tt.alerts) && (len(repo.alerts) != 0 || len(tt.alerts) != 0) {
+				t.Fatalf("alerts %v, want %v", repo.alerts, tt.alerts)
+			}
+
+			// каждая новая тревога попадает в журнал сервиса уровнем error
+			logged := 0
+			for _, e := range hook.AllEntries() {
+				if e.Level == logrus.ErrorLevel && strings.HasPrefix(e.Message, "fixity alert:") {
+					logged++
+				}
+			}
+			if logged != len(tt.alerts) {
+				t.Fatalf("logged %d alerts, want %d", logged, len(tt.alerts))
+			}
+		})
+	}
+}
+
+func TestFixityRunResumes(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+	targets := make([]archive.FixityTarget, 0, len(keys))
+	store := newMemStorage()
+	for _, k := range keys {
+		targets = append(targets, fixityTarget(k, k))
+		store.put(k, []byte(k), time.Now())
+	}
+
+	t.Run("max per run", func(t *testing.T) {
+		repo := newFixityRepo(targets...)
+		s := NewFixityService(repo, store, FixityConfig{Batch: 1, MaxPerRun: 2})
+		for i, want := range []int{2, 2, 1, 0} {
+			report, err := s.Run(context.Background())
+			if err != nil {
+				t.Fatalf("run %d: %v", i, err)
+			}
+			if report.Checked != want {
+				t.Fatalf("run %d: checked %d, want %d", i, report.Checked, want)
+			}
+		}
+		if got := repo.recordedKeys(); !reflect.DeepEqual(got, keys) {
+			t.Fatalf("checked %v, want each object once in order %v", got, keys)
+		}
+	})
+
+	t.Run("interrupted run", func(t *testing.T) {
+		repo := newFixityRepo(targets...)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		hooked := openHookStorage{memStorage: store, onOpen: func(key string) {
+			if key == "c" {
+				cancel()
+			}
+		}}
+		s := NewFixityService(repo, hooked, FixityConfig{Batch: 2})
+
+		report, err := s.Run(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+		if report.Checked != 2 {
+			t.Fatalf("checked %d before the interruption, want 2", report.Checked)
+		}
+
+		hooked.onOpen = func(string) {}
+		s = NewFixityService(repo, hooked, FixityConfig{Batch: 2})
+		if _, err := s.Run(context.Background()); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if got := repo.recordedKeys(); !reflect.DeepEqual(got, keys) {
+			t.Fatalf("checked %v, want %v: the second run must continue from c", got, keys)
+		}
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	const rate = 10000 // байт/с: 1000 байт — 100 мс
+
+	tests := []struct {
+		name    string
+		readers int
+		chunks  int
+		min     time.Duration
+	}{
+		{name: "one reader", readers: 1, chunks: 3, min: 300 * time.Millisecond},
+		{name: "bandwidth is shared", readers: 2, chunks: 2, min: 400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(rate)
+			start := time.Now()
+			var wg sync.WaitGroup
+			for r := 0; r < tt.readers; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < tt.chunks; i++ {
+						if err := l.wait(context.Background(), 1000); err != nil {
+							t.Error(err)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			elapsed := time.Since(start)
+			if elapsed < tt.min-10*time.Millisecond {
+				t.Fatalf("elapsed %v, want at least %v", elapsed, tt.min)
+			}
+			if elapsed > tt.min+time.Second {
+				t.Fatalf("elapsed %v, want about %v", elapsed, tt.min)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		l := newRateLimiter(0)
+		if l != nil {
+			t.Fatal("rate 0 must disable the limiter")
+		}
+		start := time.Now()
+		if err := l.wait(context.Background(), 1<<30); err != nil || time.Since(start) > 50*time.Millisecond {
+			t.Fatalf("nil limiter must not wait: %v", err)
+		}
+	})
+
+	t.Run("cancelled wait", func(t *testing.T) {
+		l := newRateLimiter(1)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := l.wait(ctx, 1000); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("wait must return on context cancellation")
+		}
+	})
+
+	t.Run("fixity reads are paced", func(t *testing.T) {
+		store := newMemStorage()
+		store.put("a", []byte(strings.Repeat("a", 2000)), time.Now())
+		repo := newFixityRepo(fixityTarget("a", strings.Repeat("a", 2000)))
+		s := NewFixityService(repo, store, FixityConfig{RateLimit: rate})
+		start := time.Now()
+		if _, err := s.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+			t.Fatalf("2000 bytes at %d B/s read in %v", rate, elapsed)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidGroupInput = errors.New("invalid group input")
+
+type GroupsService struct {
+	repo repository.Groups
+}
+
+func NewGroupsService(repo repository.Groups) *GroupsService {
+	return &GroupsService{repo: repo}
+}
+
+func (s *GroupsService) ListGroups(ctx context.Context, requesterID int64) ([]archive.Group, error) {
+	return s.repo.ListGroups(ctx, requesterID)
+}
+
+func (s *GroupsService) CreateGroup(ctx context.Context, requesterID int64, in archive.GroupInput) (int64, error) {
+	if in.Name == nil || strings.TrimSpace(*in.Name) == "" {
+		return 0, ErrInvalidGroupInput
+	}
+	return s.repo.CreateGroup(ctx, requesterID, in)
+}
+
+func (s *GroupsService) UpdateGroup(ctx context.Context, requesterID int64, groupID int64, in archive.GroupInput) error {
+	if groupID <= 0 || (in.Name != nil && strings.TrimSpace(*in.Name) == "") {
+		return ErrInvalidGroupInput
+	}
+	return s.repo.UpdateGroup(ctx, requesterID, groupID, in)
+}
+
+func (s *GroupsService) DeleteGroup(ctx context.Context, requesterID int64, groupID int64) error {
+	if groupID <= 0 {
+		return ErrInvalidGroupInput
+	}
+	return s.repo.DeleteGroup(ctx, requesterID, groupID)
+}
+
+func (s *GroupsService) ListMembers(ctx context.Context, requesterID int64, groupID int64) ([]archive.GroupMember, error) {
+	if groupID <= 0 {
+		return nil, ErrInvalidGroupInput
+	}
+	return s.repo.ListMembers(ctx, requesterID, groupID)
+}
+
+func (s *GroupsService) AddMembers(ctx context.Context, requesterID int64, groupID int64, userIDs []int64) (int, error) {
+	if groupID <= 0 || len(userIDs) == 0 {
+		return 0, ErrInvalidGroupInput
+	}
+	for _, id := range userIDs {
+		if id <= 0 {
+			return 0, ErrInvalidGroupInput
+		}
+	}
+	return s.repo.AddMembers(ctx, requesterID, groupID, userIDs)
+}
+
+func (s *GroupsService) RemoveMember(ctx context.Context, requesterID int64, groupID int64, userID int64) error {
+	if groupID <= 0 || userID <= 0 {
+		return ErrInvalidGroupInput
+	}
+	return s.repo.RemoveMember(ctx, requesterID, groupID, userID)
+}
@@ -2,19 +2,25 @@ package service
 
 import (
 	"archive"
+	"archive/storage"
 	"context"
+	"io"
 	"time"
 )
 
 // Authorization сервис (аутентификация)
 type Authorization interface {
 	CreateUser(ctx context.Context, user archive.User) (int64, error)
-	GenerateToken(ctx context.Context, username, password string) (string, error)
-	RefreshToken(ctx context.Context, accessToken string) (string, error)
+	GenerateToken(ctx context.Context, username, password string) (TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string) (TokenPair, error)
+	Logout(ctx context.Context, refreshToken string) error
+	LogoutAll(ctx context.Context, userID int64) error
 	ParseToken(ctx context.Context, token string) (int64, error)
+	HasPermission(ctx context.Context, userID int64, permission string) (bool, error)
+	JWKS() JWKSet
 	GetUsersByIDs(ctx context.Context, ids []int64) ([]archive.User, error)
 	UpdateUserFullName(ctx context.Context, requesterID int64, targetUserID int64, fullName string) error
-	ChangeUserPassword(ctx context.Context, requesterID int64, targetUserID int64, oldPasswordHash, newPasswordHash string) error
+	ChangeUserPassword(ctx context.Context, requesterID int64, targetUserID int64, oldPassword, newPassword string) error
 }
 
 // DocumentTypes сервис (справочник document_types)
@@ -38,17 +44,112 @@ type Tags interface {
 // Document и Admin оставляем как прежде (с контекстом)
 type Document interface {
 	CreateDocument(ctx context.Context, in archive.DocumentCreateInput) (int64, error)
-	SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, error)
+	SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) (archive.DocumentSearchResult, error)
 	GetDocumentByID(ctx context.Context, id int64) (archive.DocumentSecure, error)
 	UpdateDocument(ctx context.Context, id int64, in archive.DocumentUpdateInput) error
-	DeleteDocument(ctx context.Context, id int64) error
+	PatchDocument(ctx context.Context, id int64, p archive.DocumentPatch) (int64, error)
+	RequireEdit(ctx context.Context, id int64) error
+	DeleteDocument(ctx context.Context, id int64, ifMatch *int64) error
 
+	ListTrash(ctx context.Context) ([]archive.TrashItem, error)
+	RestoreDocument(ctx context.Context, id int64) error
+	PurgeDeleted(ctx context.Context, olderThan time.Duration, limit int) ([]archive.FileMeta, error)
+
+	ListDocumentPermissions(ctx context.Context, docID int64) ([]archive.DocumentGrant, error)
+	GetSharedWithMe(ctx context.Context) ([]archive.SharedDocument, error)
 	SetDocumentPermission(ctx context.Context, docID int64, p archive.DocumentPermission) error
 	RemoveDocumentPermission(ctx context.Context, docID int64, targetUserID int64) error
+	SetDocumentGroupPermission(ctx context.Context, docID int64, p archive.DocumentGroupPermission) error
+	RemoveDocumentGroupPermission(ctx context.Context, docID int64, groupID int64) error
+	PurgeExpiredPermissions(ctx context.Context) (int64, error)
+
+	SetDocumentFileText(ctx context.Context, docID int64, userID int64, text *string) error
+	OpenDocumentFile(ctx context.Context, docID int64, version *int64) (archive.FileMeta, error)
+	LogDocumentDownload(ctx context.Context, docID int64, version *int64, rangeHeader string) error
+
+	ListFiles(ctx context.Context, docID int64) ([]archive.DocumentFile, error)
+	AddFile(ctx context.Context, docID int64, role string, fm archive.FileMeta, position *int) (int64, error)
+	ReplaceFile(ctx context.Context, docID int64, fileID int64, role *string, fm *archive.FileMeta) error
+	RemoveFile(ctx context.Context, docID int64, fileID int64) error
+	ReorderFiles(ctx context.Context, docID int64, fileIDs []int64) error
+	OpenAttachment(ctx context.Context, docID int64, fileID int64) (archive.FileMeta, error)
+	LogAttachmentDownload(ctx context.Context, docID int64, fileID int64, rangeHeader string) error
+	SharedFiles(ctx context.Context, docID int64) ([]archive.SharedFile, error)
+
+	ListVersions(ctx context.Context, docID int64) ([]archive.DocumentVersion, error)
+	GetVersion(ctx context.Context, docID int64, version int64) (archive.DocumentVersion, error)
+	DiffVersions(ctx context.Context, docID int64, from, to int64) (archive.VersionDiff, error)
+	RestoreVersion(ctx context.Context, docID int64, version int64, ifMatch *int64) (int64, error)
+}
+
+// Tiles сервис (векторные тайлы для карты)
+type Tiles interface {
+	GetDocumentsTile(ctx context.Context, z, x, y int, cluster bool) ([]byte, error)
 }
 
 type Admin interface {
 	GetLogsByUser(ctx context.Context, adminID int64, targetUserID int64, start *time.Time, end *time.Time) ([]archive.LogRecord, error)
 	GetLogsByTable(ctx context.Context, adminID int64, tableName string, start *time.Time, end *time.Time) ([]archive.LogRecord, error)
 	GetLogsByDate(ctx context.Context, adminID int64, start time.Time, end time.Time) ([]archive.LogRecord, error)
+
+	ListUsers(ctx context.Context, adminID int64, filter archive.UserListFilter) (archive.UserListResult, error)
+	CreateUser(ctx context.Context, adminID int64, in archive.AdminUserCreateInput) (int64, error)
+	SetUserRole(ctx context.Context, adminID int64, targetUserID int64, roleID int64) error
+	SetUserDisabled(ctx context.Context, adminID int64, targetUserID int64, disabled bool) error
+	ResetUserPassword(ctx context.Context, adminID int64, targetUserID int64, password string) (string, error)
+}
+
+// Roles сервис (роли и права)
+type Roles interface {
+	ListPermissions(ctx context.Context) ([]archive.Permission, error)
+	ListRoles(ctx context.Context, requesterID int64) ([]archive.Role, error)
+	CreateRole(ctx context.Context, requesterID int64, in archive.RoleInput) (int64, error)
+	UpdateRole(ctx context.Context, requesterID int64, roleID int64, in archive.RoleInput) error
+	DeleteRole(ctx context.Context, requesterID int64, roleID int64) error
+}
+
+// Groups сервис (группы пользователей)
+type Groups interface {
+	ListGroups(ctx context.Context, requesterID int64) ([]archive.Group, error)
+	CreateGroup(ctx context.Context, requesterID int64, in archive.GroupInput) (int64, error)
+	UpdateGroup(ctx context.Context, requesterID int64, groupID int64, in archive.GroupInput) error
+	DeleteGroup(ctx context.Context, requesterID int64, groupID int64) error
+	ListMembers(ctx context.Context, requesterID int64, groupID int64) ([]archive.GroupMember, error)
+	AddMembers(ctx context.Context, requesterID int64, groupID int64, userIDs []int64) (int, error)
+	RemoveMember(ctx context.Context, requesterID int64, groupID int64, userID int64) error
+}
+
+// AccessRequests сервис (запросы доступа к документам)
+type AccessRequests interface {
+	Create(ctx context.Context, userID int64, docID int64, level string, reason *string) (int64, error)
+	ListMine(ctx context.Context, userID int64) ([]archive.AccessRequest, error)
+	ListIncoming(ctx context.Context, userID int64, status string) ([]archive.AccessRequest, error)
+	Decide(ctx context.Context, userID int64, requestID int64, d archive.AccessDecision) error
+	Cancel(ctx context.Context, userID int64, requestID int64) error
+}
+
+// Uploads сервис (возобновляемые загрузки tus и прямые загрузки в хранилище)
+type Uploads interface {
+	Create(ctx context.Context, userID int64, length int64, metadata map[string]string) (archive.Upload, error)
+	CreateDirect(ctx context.Context, userID int64, in archive.DirectUploadInput) (archive.Upload, storage.PresignedUpload, error)
+	Finalize(ctx context.Context, userID int64, id string, sha256 *string) (archive.Upload, error)
+	Get(ctx context.Context, userID int64, id string) (archive.Upload, error)
+	Write(ctx context.Context, userID int64, id string, offset int64, r io.Reader) (archive.Upload, error)
+	Terminate(ctx context.Context, userID int64, id string) error
+	FileMeta(ctx context.Context, userID int64, id string) (archive.FileMeta, error)
+	PurgeExpired(ctx context.Context, limit int) (int, error)
+	MaxSize() int64
+}
+
+// StorageGC сервис (объекты хранилища без ссылок из БД)
+type StorageGC interface {
+	Run(ctx context.Context) (StorageGCReport, error)
+	RemovePurged(ctx context.Context, files []archive.FileMeta) (int, error)
+}
+
+// Fixity сервис (проверка целостности хранимых файлов)
+type Fixity interface {
+	Run(ctx context.Context) (FixityReport, error)
+	CheckDocument(ctx context.Context, adminID int64, docID int64) ([]archive.FixityCheck, error)
+	Report(ctx context.Context, adminID int64, filter archive.FixityReportFilter) ([]archive.FixityRecord, error)
 }
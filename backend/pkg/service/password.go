@@ -0,0 +1,101 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры Argon2id (RFC 9106, второй рекомендованный профиль).
+// При их изменении старые хеши перехешируются при следующем входе.
+const (
+	argon2Memory  uint32 = 64 * 1024 // KiB
+	argon2Time    uint32 = 3
+	argon2Threads uint8  = 2
+	argon2KeyLen  uint32 = 32
+	argon2SaltLen        = 16
+
+	// legacySalt — общий «соль» старой схемы sha256; нужен только для проверки
+	// ещё не перехешированных паролей.
+	legacySalt = "hjqrhjqw124617ajfhajs"
+)
+
+var errMalformedHash = errors.New("malformed password hash")
+
+// hashPassword возвращает Argon2id-хеш в PHC-формате:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash> (base64 без паддинга)
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// verifyPassword сравнивает пароль с сохранённым хешем любого поддерживаемого формата.
+// needsRehash = true, если хеш устаревшего формата или с устаревшими параметрами.
+func verifyPassword(password, encoded string) (ok bool, needsRehash bool, err error) {
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		return verifyArgon2id(password, encoded)
+	}
+	// старая схема: hex(salt) + hex(sha256(password)), см. историю generatePasswordHash
+	ok = subtle.ConstantTimeCompare([]byte(legacyPasswordHash(password)), []byte(encoded)) == 1
+	return ok, ok, nil
+}
+
+func verifyArgon2id(password, encoded string) (bool, bool, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, errMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, errMalformedHash
+	}
+	if version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, errMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errMalformedHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false, false, errMalformedHash
+	}
+
+	got := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, false, nil
+	}
+	needsRehash := memory != argon2Memory || time != argon2Time || threads != argon2Threads ||
+		uint32(len(want)) != argon2KeyLen || len(salt) != argon2SaltLen
+	return true, needsRehash, nil
+}
+
+func legacyPasswordHash(password string) string {
+	h := sha256.New()
+	h.Write([]byte(password))
+	return fmt.Sprintf("%x", h.Sum([]byte(legacySalt)))
+}
+
+// dummyPasswordHash используется при входе с несуществующим логином, чтобы время
+// ответа не выдавало, есть ли такой пользователь.
+var dummyPasswordHash, _ = hashPassword("dummy-password-for-timing")
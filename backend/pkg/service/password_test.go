@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// weakArgon2Hash — хеш с параметрами слабее текущих: должен проходить проверку и требовать перехеширования
+func weakArgon2Hash(password string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 1024, 1, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=1024,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestVerifyPassword(t *testing.T) {
+	current, err := hashPassword("secret")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		encoded     string
+		ok          bool
+		needsRehash bool
+		wantErr     bool
+	}{
+		{name: "argon2id current params", password: "secret", encoded: current, ok: true},
+		{name: "argon2id wrong password", password: "wrong", encoded: current},
+		{name: "argon2id weaker params", password: "secret", encoded: weakArgon2Hash("secret"), ok: true, needsRehash: true},
+		{name: "legacy sha256", password: "secret", encoded: legacyPasswordHash("secret"), ok: true, needsRehash: true},
+		{name: "legacy wrong password", password: "wrong", encoded: legacyPasswordHash("secret")},
+		{name: "empty hash", password: "secret", encoded: ""},
+		{name: "missing segments", password: "secret", encoded: "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA", wantErr: true},
+		{name: "bad version", password: "secret", encoded: "$argon2id$v=16$m=65536,t=3,p=2$c2FsdA$aGFzaA", wantErr: true},
+		{name: "bad params", password: "secret", encoded: "$argon2id$v=19$m=x,t=3,p=2$c2FsdA$aGFzaA", wantErr: true},
+		{name: "bad salt", password: "secret", encoded: "$argon2id$v=19$m=65536,t=3,p=2$!!$aGFzaA", wantErr: true},
+		{name: "empty key", password: "secret", encoded: "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := verifyPassword(tt.password, tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.ok || needsRehash != tt.needsRehash {
+				t.Fatalf("got ok=%v needsRehash=%v, want ok=%v needsRehash=%v", ok, needsRehash, tt.ok, tt.needsRehash)
+			}
+		})
+	}
+}
+
+func TestHashPasswordUniqueSalt(t *testing.T) {
+	a, err := hashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := hashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Fatal("two hashes of the same password must differ by salt")
+	}
+}
+
+func TestVerifyPasswordMalformedError(t *testing.T) {
+	_, _, err := verifyPassword("secret", "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA")
+	if !errors.Is(err, errMalformedHash) {
+		t.Fatalf("err = %v, want errMalformedHash", err)
+	}
+}
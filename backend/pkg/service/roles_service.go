@@ -0,0 +1,51 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"context"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidRoleInput = errors.New("invalid role input")
+
+type RolesService struct {
+	repo repository.Roles
+}
+
+func NewRolesService(repo repository.Roles) *RolesService {
+	return &RolesService{repo: repo}
+}
+
+func (s *RolesService) ListPermissions(ctx context.Context) ([]archive.Permission, error) {
+	return s.repo.ListPermissions(ctx)
+}
+
+func (s *RolesService) ListRoles(ctx context.Context, requesterID int64) ([]archive.Role, error) {
+	return s.repo.ListRoles(ctx, requesterID)
+}
+
+func (s *RolesService) CreateRole(ctx context.Context, requesterID int64, in archive.RoleInput) (int64, error) {
+	if in.Name == nil || strings.TrimSpace(*in.Name) == "" {
+		return 0, ErrInvalidRoleInput
+	}
+	if in.Permissions == nil {
+		in.Permissions = []string{}
+	}
+	return s.repo.CreateRole(ctx, requesterID, in)
+}
+
+func (s *RolesService) UpdateRole(ctx context.Context, requesterID int64, roleID int64, in archive.RoleInput) error {
+	if roleID <= 0 || (in.Name != nil && strings.TrimSpace(*in.Name) == "") {
+		return ErrInvalidRoleInput
+	}
+	return s.repo.UpdateRole(ctx, requesterID, roleID, in)
+}
+
+func (s *RolesService) DeleteRole(ctx context.Context, requesterID int64, roleID int64) error {
+	if roleID <= 0 {
+		return ErrInvalidRoleInput
+	}
+	return s.repo.DeleteRole(ctx, requesterID, roleID)
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"archive"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+	// maxSearchOffset — глубже курсор не ведёт: OFFSET в SQL стоит O(offset), а листать
+	// десятки тысяч документов незачем — нужно сузить фильтр. Курсор хранит смещение,
+	// поэтому вставки и удаления между запросами сдвигают страницы (записи могут
+	// повториться или пропасть); для просмотра результатов этого достаточно
+	maxSearchOffset   = 10000
+	defaultSearchSort = "created_at"
+	relevanceSort     = "relevance"
+	distanceSort      = "distance"
+)
+
+var (
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrOffsetTooLarge = fmt.Errorf("offset must not exceed %d: narrow the search filter", maxSearchOffset)
+	ErrInvalidSort    = errors.New("invalid sort: expected distance, relevance, created_at, updated_at, document_date or title")
+	ErrInvalidOrder   = errors.New("invalid order: expected asc or desc")
+	ErrSortNeedsQuery = errors.New("sort=relevance requires q")
+	ErrSortNeedsPoint = errors.New("sort=distance requires near")
+
+	// ErrInvalidSpatialFilter оборачивает все ошибки bbox/near/radius_m/geometry
+	ErrInvalidSpatialFilter = errors.New("invalid spatial filter")
+)
+
+var searchSortFields = map[string]bool{
+	"created_at":    true,
+	"updated_at":    true,
+	"document_date": true,
+	"title":         true,
+	relevanceSort:   true,
+	distanceSort:    true,
+}
+
+// searchCursor — содержимое next_cursor. Клиент получает его в base64 и не разбирает.
+type searchCursor struct {
+	Offset int `json:"o"`
+}
+
+func encodeSearchCursor(offset int) string {
+	b, _ := json.Marshal(searchCursor{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSearchCursor(s string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	var c searchCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return c.Offset, nil
+}
+
+// normalizeSearchFilter проверяет сортировку, подставляет значения по умолчанию
+// (near — по расстоянию, q — по релевантности) и переводит курсор в offset.
+func normalizeSearchFilter(f *archive.DocumentSearchFilter) error {
+	if err := normalizeSpatialFilter(f); err != nil {
+		return err
+	}
+
+	f.Query = strings.TrimSpace(f.Query)
+	f.Sort = strings.ToLower(strings.TrimSpace(f.Sort))
+	if f.Sort == "" {
+		switch {
+		case f.Near != nil:
+			f.Sort = distanceSort
+		case f.Query != "":
+			f.Sort = relevanceSort
+		default:
+			f.Sort = defaultSearchSort
+		}
+	}
+	if !searchSortFields[f.Sort] {
+		return ErrInvalidSort
+	}
+	if f.Sort == relevanceSort && f.Query == "" {
+		return ErrSortNeedsQuery
+	}
+	if f.Sort == distanceSort && f.Near == nil {
+		return ErrSortNeedsPoint
+	}
+
+	f.Order = strings.ToLower(strings.TrimSpace(f.Order))
+	switch f.Order {
+	case "":
+		f.Order = "desc"
+	case "asc", "desc":
+	default:
+		return ErrInvalidOrder
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = defaultSearchLimit
+	}
+	if f.Limit > maxSearchLimit {
+		f.Limit = maxSearchLimit
+	}
+
+	if f.Cursor != "" {
+		offset, err := decodeSearchCursor(f.Cursor)
+		if err != nil {
+			return err
+		}
+		f.Offset = offset
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	if f.Offset > maxSearchOffset {
+		return ErrOffsetTooLarge
+	}
+	return nil
+}
+
+func validLonLat(lon, lat float64) bool {
+	return lon >= -180 && lon <= 180 && lat >= -90 && lat <= 90
+}
+
+// normalizeSpatialFilter проверяет bbox/near/radius_m/geometry и снимает обёртку Feature с geometry.
+func normalizeSpatialFilter(f *archive.DocumentSearchFilter) error {
+	if f.BBox != nil {
+		if len(f.BBox) != 4 {
+			return fmt.Errorf("%w: bbox must be min_lon,min_lat,max_lon,max_lat", ErrInvalidSpatialFilter)
+		}
+		if !validLonLat(f.BBox[0], f.BBox[1]) || !validLonLat(f.BBox[2], f.BBox[3]) ||
+			f.BBox[0] > f.BBox[2] || f.BBox[1] > f.BBox[3] {
+			return fmt.Errorf("%w: bbox out of range", ErrInvalidSpatialFilter)
+		}
+	}
+
+	if f.Near != nil {
+		if len(f.Near) != 2 || !validLonLat(f.Near[0], f.Near[1]) {
+			return fmt.Errorf("%w: near must be lon,lat", ErrInvalidSpatialFilter)
+		}
+	}
+	if f.RadiusM != nil {
+		if f.Near == nil {
+			return fmt.Errorf("%w: radius_m requires near", ErrInvalidSpatialFilter)
+		}
+		if *f.RadiusM <= 0 {
+			return fmt.Errorf("%w: radius_m must be positive", ErrInvalidSpatialFilter)
+		}
+	}
+
+	f.Relation = strings.ToLower(strings.TrimSpace(f.Relation))
+	if f.Geometry == nil {
+		if f.Relation != "" {
+			return fmt.Errorf("%w: relation requires geometry", ErrInvalidSpatialFilter)
+		}
+		return nil
+	}
+	switch f.Relation {
+	case "":
+		f.Relation = "intersects"
+	case "intersects", "within":
+	default:
+		return fmt.Errorf("%w: relation must be intersects or within", ErrInvalidSpatialFilter)
+	}
+
+	var head struct {
+		Type     string          `json:"type"`
+		Geometry json.RawMessage `json:"geometry"`
+	}
+	if err := json.Unmarshal(*f.Geometry, &head); err != nil {
+		return fmt.Errorf("%w: geometry is not a GeoJSON object", ErrInvalidSpatialFilter)
+	}
+	if head.Type == "Feature" {
+		g := head.Geometry
+		f.Geometry = &g
+		if err := json.Unmarshal(g, &head); err != nil {
+			return fmt.Errorf("%w: feature has no geometry", ErrInvalidSpatialFilter)
+		}
+	}
+	if head.Type != "Polygon" && head.Type != "MultiPolygon" {
+		return fmt.Errorf("%w: geometry must be Polygon or MultiPolygon", ErrInvalidSpatialFilter)
+	}
+	return nil
+}
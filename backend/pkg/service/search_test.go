@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"archive"
+	"archive/pkg/repository"
+)
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 50, 1 << 20} {
+		got, err := decodeSearchCursor(encodeSearchCursor(offset))
+		if err != nil {
+			t.Fatalf("offset %d: %v", offset, err)
+		}
+		if got != offset {
+			t.Fatalf("offset %d decoded as %d", offset, got)
+		}
+	}
+}
+
+func TestDecodeSearchCursorInvalid(t *testing.T) {
+	enc := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "%%%"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"o":1}`))},
+		{name: "not json", cursor: enc("offset=1")},
+		{name: "wrong type", cursor: enc(`{"o":"1"}`)},
+		{name: "negative offset", cursor: enc(`{"o":-1}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeSearchCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("err = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestNormalizeSearchFilter(t *testing.T) {
+	radius := func(v float64) *float64 { return &v }
+	geometry := func(s string) *json.RawMessage { r := json.RawMessage(s); return &r }
+	polygon := `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`
+
+	tests := []struct {
+		name    string
+		in      archive.DocumentSearchFilter
+		wantErr error
+		check   func(t *testing.T, f archive.DocumentSearchFilter)
+	}{
+		{
+			name: "defaults",
+			in:   archive.DocumentSearchFilter{},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if f.Sort != defaultSearchSort || f.Order != "desc" || f.Limit != defaultSearchLimit || f.Offset != 0 {
+					t.Fatalf("got sort=%q order=%q limit=%d offset=%d", f.Sort, f.Order, f.Limit, f.Offset)
+				}
+			},
+		},
+		{
+			name: "query sorts by relevance",
+			in:   archive.DocumentSearchFilter{Query: "  map  "},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if f.Query != "map" || f.Sort != relevanceSort {
+					t.Fatalf("got q=%q sort=%q", f.Query, f.Sort)
+				}
+			},
+		},
+		{
+			name: "near sorts by distance",
+			in:   archive.DocumentSearchFilter{Query: "map", Near: []float64{37.6, 55.7}},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if f.Sort != distanceSort {
+					t.Fatalf("sort = %q", f.Sort)
+				}
+			},
+		},
+		{
+			name: "sort and order are case-insensitive",
+			in:   archive.DocumentSearchFilter{Sort: " Title ", Order: "ASC"},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if f.Sort != "title" || f.Order != "asc" {
+					t.Fatalf("got sort=%q order=%q", f.Sort, f.Order)
+				}
+			},
+		},
+		{
+			name: "limit is capped",
+			in:   archive.DocumentSearchFilter{Limit: maxSearchLimit + 1},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if f.Limit != maxSearchLimit {
+					t.Fatalf("limit = %d", f.Limit)
+				}
+			},
+		},
+		{
+			name: "cursor wins over offset",
+			in:   archive.DocumentSearchFilter{Cursor: encodeSearchCursor(100), Offset: 5},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if f.Offset != 100 {
+					t.Fatalf("offset = %d", f.Offset)
+				}
+			},
+		},
+		{
+			name: "negative offset is reset",
+			in:   archive.DocumentSearchFilter{Offset: -10},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if f.Offset != 0 {
+					t.Fatalf("offset = %d", f.Offset)
+				}
+			},
+		},
+		{
+			name: "feature geometry is unwrapped",
+			in:   archive.DocumentSearchFilter{Geometry: geometry(`{"type":"Feature","geometry":` + polygon + `}`)},
+			check: func(t *testing.T, f archive.DocumentSearchFilter) {
+				if string(*f.Geometry) != polygon || f.Relation != "intersects" {
+					t.Fatalf("got geometry=%s relation=%q", *f.Geometry, f.Relation)
+				}
+			},
+		},
+		{name: "unknown sort", in: archive.DocumentSearchFilter{Sort: "author"}, wantErr: ErrInvalidSort},
+		{name: "unknown order", in: archive.DocumentSearchFilter{Order: "up"}, wantErr: ErrInvalidOrder},
+		{name: "relevance without query", in: archive.DocumentSearchFilter{Sort: relevanceSort}, wantErr: ErrSortNeedsQuery},
+		{name: "distance without near", in: archive.DocumentSearchFilter{Sort: distanceSort}, wantErr: ErrSortNeedsPoint},
+		{name: "invalid cursor", in: archive.DocumentSearchFilter{Cursor: "%%%"}, wantErr: ErrInvalidCursor},
+		{name: "offset over limit", in: archive.DocumentSearchFilter{Offset: maxSearchOffset + 1}, wantErr: ErrOffsetTooLarge},
+		{name: "cursor over limit", in: archive.DocumentSearchFilter{Cursor: encodeSearchCursor(maxSearchOffset + 1)}, wantErr: ErrOffsetTooLarge},
+		{name: "bbox wrong length", in: archive.DocumentSearchFilter{BBox: []float64{0, 0, 1}}, wantErr: ErrInvalidSpatialFilter},
+		{name: "bbox inverted", in: archive.DocumentSearchFilter{BBox: []float64{10, 0, 1, 1}}, wantErr: ErrInvalidSpatialFilter},
+		{name: "bbox out of range", in: archive.DocumentSearchFilter{BBox: []float64{0, 0, 181, 1}}, wantErr: ErrInvalidSpatialFilter},
+		{name: "near out of range", in: archive.DocumentSearchFilter{Near: []float64{0, 91}}, wantErr: ErrInvalidSpatialFilter},
+		{name: "radius without near", in: archive.DocumentSearchFilter{RadiusM: radius(100)}, wantErr: ErrInvalidSpatialFilter},
+		{name: "non-positive radius", in: archive.DocumentSearchFilter{Near: []float64{0, 0}, RadiusM: radius(0)}, wantErr: ErrInvalidSpatialFilter},
+		{name: "relation without geometry", in: archive.DocumentSearchFilter{Relation: "within"}, wantErr: ErrInvalidSpatialFilter},
+		{name: "unknown relation", in: archive.DocumentSearchFilter{Geometry: geometry(polygon), Relation: "touches"}, wantErr: ErrInvalidSpatialFilter},
+		{name: "point geometry", in: archive.DocumentSearchFilter{Geometry: geometry(`{"type":"Point","coordinates":[0,0]}`)}, wantErr: ErrInvalidSpatialFilter},
+		{name: "geometry not an object", in: archive.DocumentSearchFilter{Geometry: geometry(`[1,2]`)}, wantErr: ErrInvalidSpatialFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.in
+			err := normalizeSearchFilter(&f)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, f)
+		})
+	}
+}
+
+// searchRepo отдаёт limit документов из total или заданную ошибку, как DocumentPostgres после pgError
+type searchRepo struct {
+	repository.Document
+	total int64
+	err   error
+}
+
+func (r searchRepo) SearchDocumentsByTag(ctx context.Context, filter archive.DocumentSearchFilter) ([]archive.DocumentSecure, int64, error) {
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	n := min(int64(filter.Limit), max(r.total-int64(filter.Offset), 0))
+	return make([]archive.DocumentSecure, n), r.total, nil
+}
+
+func TestSearchDocumentsNextCursor(t *testing.T) {
+	tests := []struct {
+		name       string
+		total      int64
+		offset     int
+		limit      int
+		wantOffset int // -1 — курсора нет
+	}{
+		{name: "first page", total: 120, limit: 50, wantOffset: 50},
+		{name: "last page", total: 120, offset: 100, limit: 50, wantOffset: -1},
+		{name: "exact end", total: 100, offset: 50, limit: 50, wantOffset: -1},
+		{name: "up to the offset limit", total: 50000, offset: maxSearchOffset - 500, limit: 500, wantOffset: maxSearchOffset},
+		{name: "past the offset limit", total: 50000, offset: maxSearchOffset, limit: 500, wantOffset: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewDocumentService(searchRepo{total: tt.total})
+			res, err := s.SearchDocumentsByTag(context.Background(), archive.DocumentSearchFilter{Offset: tt.offset, Limit: tt.limit})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantOffset < 0 {
+				if res.NextCursor != "" {
+					t.Fatalf("next_cursor = %q, want none", res.NextCursor)
+				}
+				return
+			}
+			got, err := decodeSearchCursor(res.NextCursor)
+			if err != nil || got != tt.wantOffset {
+				t.Fatalf("next_cursor offset = %d (%v), want %d", got, err, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestSearchDocumentsRepositoryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		// type=99999999999: SQLSTATE 22003 при приведении к INT
+		{name: "type out of int range", err: fmt.Errorf("%w: value \"99999999999\" is out of range for type integer", repository.ErrInvalidInput), wantErr: repository.ErrInvalidInput},
+		{name: "other error", err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewDocumentService(searchRepo{err: tt.err})
+			_, err := s.SearchDocumentsByTag(context.Background(), archive.DocumentSearchFilter{Type: "99999999999"})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
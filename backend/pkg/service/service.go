@@ -2,6 +2,7 @@ package service
 
 import (
 	"archive/pkg/repository"
+	"archive/storage"
 )
 
 // Service агрегирует все сервисы
@@ -10,15 +11,36 @@ type Service struct {
 	DocumentTypes DocumentTypes
 	Tags          Tags
 	Document      Document
+	Tiles         Tiles
 	Admin         Admin
+	Roles         Roles
+	Groups        Groups
+	Access        AccessRequests
+	Uploads       Uploads
+	StorageGC     StorageGC
+	Fixity        Fixity
 }
 
-func NewService(repos *repository.Repository) *Service {
+// Options — настройки сервисов, работающих с хранилищем
+type Options struct {
+	Uploads   UploadsConfig
+	StorageGC StorageGCConfig
+	Fixity    FixityConfig
+}
+
+func NewService(repos *repository.Repository, tokens *TokenManager, store storage.Storage, opts Options) *Service {
 	return &Service{
-		Authorization: NewAuthService(repos.Authorization),
+		Authorization: NewAuthService(repos.Authorization, tokens),
 		DocumentTypes: NewDocumentTypesService(repos.DocumentTypes),
 		Tags:          NewTagsService(repos.Tags),
 		Document:      NewDocumentService(repos.Document),
+		Tiles:         NewTilesService(repos.Tiles),
 		Admin:         NewAdminService(repos.Admin),
+		Roles:         NewRolesService(repos.Roles),
+		Groups:        NewGroupsService(repos.Groups),
+		Access:        NewAccessRequestsService(repos.Access),
+		Uploads:       NewUploadsService(repos.Uploads, store, opts.Uploads),
+		StorageGC:     NewStorageGCService(repos.Document, store, opts.StorageGC),
+		Fixity:        NewFixityService(repos.Fixity, store, opts.Fixity),
 	}
 }
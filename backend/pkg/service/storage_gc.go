@@ -0,0 +1,164 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/storage"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StorageGCConfig — настройки сборки мусора в хранилище (секция gc конфига)
+type StorageGCConfig struct {
+	Prefix string        // где искать объекты; "" — весь бакет
+	Grace  time.Duration // объекты моложе не трогаются: файл уже загружен, а строка в БД ещё не записана; обязателен
+	Batch  int           // ключей на один запрос к БД
+	DryRun bool          // только отчёт, без удаления
+}
+
+// StorageGCReport — итог одного прохода
+type StorageGCReport struct {
+	Scanned     int   // объектов просмотрено
+	Orphans     int   // объектов без ссылок старше Grace
+	OrphanBytes int64 // их общий размер
+	Removed     int   // удалено (0 при DryRun)
+	DryRun      bool
+}
+
+// StorageGCService находит объекты хранилища, на которые не ссылается ни один
+// документ, версия, вложение или загрузка: файл заменили, документ удалён из корзины
+// раньше, чем появилась очистка, или запись документа не удалась после загрузки файла
+type StorageGCService struct {
+	repo  repository.Document
+	store storage.Storage
+	cfg   StorageGCConfig
+}
+
+func NewStorageGCService(repo repository.Document, store storage.Storage, cfg StorageGCConfig) *StorageGCService {
+	if cfg.Batch <= 0 {
+		cfg.Batch = 1000
+	}
+	return &StorageGCService{repo: repo, store: store, cfg: cfg}
+}
+
+// Run — один проход по хранилищу; каждый найденный объект пишется в лог
+func (s *StorageGCService) Run(ctx context.Context) (StorageGCReport, error) {
+	report := StorageGCReport{DryRun: s.cfg.DryRun}
+	if s.cfg.Grace <= 0 {
+		return report, errors.New("storage gc: grace period must be positive")
+	}
+	cutoff := time.Now().Add(-s.cfg.Grace)
+	batch := make([]storage.ObjectEntry, 0, s.cfg.Batch)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		// ключи одного прохода List лежат в одном бакете
+		keys := make([]string, 0, len(batch))
+		byKey := make(map[string]storage.ObjectEntry, len(batch))
+		for _, e := range batch {
+			keys = append(keys, e.Key)
+			byKey[e.Key] = e
+		}
+		orphans, err := s.repo.UnreferencedObjects(ctx, batch[0].Bucket, keys)
+		if err != nil {
+			return err
+		}
+		for _, key := range orphans {
+			e := byKey[key]
+			if !s.cfg.DryRun {
+				orphan, err := s.stillOrphan(ctx, e)
+				if err != nil {
+					return err
+				}
+				if !orphan {
+					continue
+				}
+			}
+			report.Orphans++
+			report.OrphanBytes += e.Size
+			if s.cfg.DryRun {
+				logrus.Infof("storage gc: orphan %s/%s (%d bytes, modified %s), dry run", e.Bucket, e.Key, e.Size, e.LastModified.Format(time.RFC3339))
+				continue
+			}
+			if err := s.store.Delete(ctx, e.Bucket, e.Key); err != nil {
+				logrus.Errorf("storage gc: delete %s/%s: %v", e.Bucket, e.Key, err)
+				continue
+			}
+			logrus.Infof("storage gc: removed orphan %s/%s (%d bytes)", e.Bucket, e.Key, e.Size)
+			report.Removed++
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := s.store.List(ctx, s.cfg.Prefix, func(e storage.ObjectEntry) error {
+		report.Scanned++
+		if e.LastModified.After(cutoff) {
+			return nil
+		}
+		batch = append(batch, e)
+		if len(batch) < s.cfg.Batch {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return report, err
+	}
+	return report, flush()
+}
+
+// RemovePurged удаляет из хранилища файлы документов, окончательно удалённых из корзины.
+// Каждый объект перед удалением проверяется так же, как в Run: недавно изменённый или снова
+// получивший ссылку остаётся. DryRun здесь не действует — это удаление по сроку хранения
+// корзины, а не поиск мусора. Не удалённые объекты позже найдёт Run
+func (s *StorageGCService) RemovePurged(ctx context.Context, files []archive.FileMeta) (int, error) {
+	if s.cfg.Grace <= 0 {
+		return 0, errors.New("storage gc: grace period must be positive")
+	}
+	removed := 0
+	for _, fm := range files {
+		e := storage.ObjectEntry{Bucket: fm.Bucket, Key: fm.Key}
+		orphan, err := s.stillOrphan(ctx, e)
+		if err != nil {
+			return removed, err
+		}
+		if !orphan {
+			continue
+		}
+		if err := s.store.Delete(ctx, e.Bucket, e.Key); err != nil {
+			logrus.Errorf("purge trash: delete %s/%s: %v", e.Bucket, e.Key, err)
+			continue
+		}
+		logrus.Infof("purge trash: removed %s/%s", e.Bucket, e.Key)
+		removed++
+	}
+	return removed, nil
+}
+
+// stillOrphan перепроверяет объект перед удалением: с момента List его могли снова
+// загрузить (Promote того же содержимого обновляет время изменения), а ссылка на него
+// могла появиться в БД
+func (s *StorageGCService) stillOrphan(ctx context.Context, e storage.ObjectEntry) (bool, error) {
+	info, err := s.store.Stat(ctx, e.Bucket, e.Key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrObjectNotFound) {
+			logrus.Errorf("storage gc: stat %s/%s: %v", e.Bucket, e.Key, err)
+		}
+		return false, nil
+	}
+	if info.LastModified.After(time.Now().Add(-s.cfg.Grace)) {
+		logrus.Infof("storage gc: %s/%s modified %s, skipped", e.Bucket, e.Key, info.LastModified.Format(time.RFC3339))
+		return false, nil
+	}
+	orphans, err := s.repo.UnreferencedObjects(ctx, e.Bucket, []string{e.Key})
+	if err != nil {
+		return false, err
+	}
+	return len(orphans) > 0, nil
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/storage"
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStorage — storage.Storage в памяти с объектами одного бакета; методы, которые
+// тестам не нужны, не реализованы (вызов паникует на nil-интерфейсе)
+type memStorage struct {
+	storage.Storage
+
+	mu      sync.Mutex
+	objects map[string]memObject
+	deleted []string
+}
+
+type memObject struct {
+	data     []byte
+	modified time.Time
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{objects: make(map[string]memObject)}
+}
+
+func (m *memStorage) put(key string, data []byte, modified time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memObject{data: data, modified: modified}
+}
+
+func (m *memStorage) List(ctx context.Context, prefix string, fn func(storage.ObjectEntry) error) error {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.objects))
+	for k := range m.objects {
+		keys = append(keys, k)
+	}
+	m.mu.Unlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		m.mu.Lock()
+		o, ok := m.objects[k]
+		m.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if err := fn(storage.ObjectEntry{Bucket: "archive", Key: k, Size: int64(len(o.data)), LastModified: o.modified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) Stat(ctx context.Context, bucket, key string) (storage.ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return storage.ObjectInfo{}, storage.ErrObjectNotFound
+	}
+	return storage.ObjectInfo{Size: int64(len(o.data)), LastModified: o.modified}, nil
+}
+
+func (m *memStorage) Open(ctx context.Context, bucket, key string) (io.ReadSeekCloser, storage.ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.objects[key]
+	if !ok {
+		return nil, storage.ObjectInfo{}, storage.ErrObjectNotFound
+	}
+	return nopSeekCloser{bytes.NewReader(o.data)}, storage.ObjectInfo{Size: int64(len(o.data)), LastModified: o.modified}, nil
+}
+
+func (m *memStorage) Delete(ctx context.Context, bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	m.deleted = append(m.deleted, key)
+	return nil
+}
+
+type nopSeekCloser struct{ io.ReadSeeker }
+
+func (nopSeekCloser) Close() error { return nil }
+
+// gcRepo отвечает на UnreferencedObjects по набору ссылок; afterFirst вызывается после
+// первого запроса — так моделируется то, что произошло между List и удалением
+type gcRepo struct {
+	repository.Document
+
+	refs       map[string]bool
+	afterFirst func()
+	calls      int
+}
+
+func (r *gcRepo) UnreferencedObjects(ctx context.Context, bucket string, keys []string) ([]string, error) {
+	out := make([]string, 0)
+	for _, k := range keys {
+		if !r.refs[k] {
+			out = append(out, k)
+		}
+	}
+	r.calls++
+	if r.calls == 1 && r.afterFirst != nil {
+		r.afterFirst()
+	}
+	return out, nil
+}
+
+func TestStorageGCRemovePurged(t *testing.T) {
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		grace   time.Duration
+		dryRun  bool
+		files   []string
+		objects map[string]time.Time
+		refs    map[string]bool
+		removed []string
+		wantErr bool
+	}{
+		{
+			name:    "unreferenced objects are removed",
+			grace:   72 * time.Hour,
+			files:   []string{"a", "b"},
+			objects: map[string]time.Time{"a": old, "b": old, "c": old},
+			removed: []string{"a", "b"},
+		},
+		{
+			name:    "dry run does not stop the purge",
+			grace:   72 * time.Hour,
+			dryRun:  true,
+			files:   []string{"a"},
+			objects: map[string]time.Time{"a": old},
+			removed: []string{"a"},
+		},
+		{
+			name:    "object referenced again is kept",
+			grace:   72 * time.Hour,
+			files:   []string{"a", "b"},
+			objects: map[string]time.Time{"a": old, "b": old},
+			refs:    map[string]bool{"b": true},
+			removed: []string{"a"},
+		},
+		{
+			name:    "recently uploaded again is kept",
+			grace:   72 * time.Hour,
+			files:   []string{"a", "b"},
+			objects: map[string]time.Time{"a": old, "b": recent},
+			removed: []string{"a"},
+		},
+		{
+			name:    "missing object is skipped",
+			grace:   72 * time.Hour,
+			files:   []string{"a", "gone"},
+			objects: map[string]time.Time{"a": old},
+			removed: []string{"a"},
+		},
+		{
+			name:    "grace period is required",
+			files:   []string{"a"},
+			objects: map[string]time.Time{"a": old},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemStorage()
+			for k, mod := range tt.objects {
+				store.put(k, []byte(k), mod)
+			}
+			repo := &gcRepo{refs: tt.refs}
+			s := NewStorageGCService(repo, store, StorageGCConfig{Grace: tt.grace, DryRun: tt.dryRun})
+
+			files := make([]archive.FileMeta, 0, len(tt.files))
+			for _, k := range tt.files {
+				files = append(files, archive.FileMeta{Bucket: "archive", Key: k})
+			}
+			n, err := s.RemovePurged(context.Background(), files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n != len(tt.removed) {
+				t.Fatalf("removed = %d, want %d", n, len(tt.removed))
+			}
+			if len(tt.removed) == 0 && len(store.deleted) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(store.deleted, tt.removed) {
+				t.Fatalf("deleted %v, want %v", store.deleted, tt.removed)
+			}
+		})
+	}
+}
+
+func TestStorageGCRun(t *testing.T) {
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	type object struct {
+		modified time.Time
+		ref      bool
+	}
+	tests := []struct {
+		name    string
+		grace   time.Duration
+		dryRun  bool
+		batch   int
+		objects map[string]object
+		// между первым запросом ссылок и удалением
+		between    func(store *memStorage, repo *gcRepo)
+		wantErr    bool
+		wantReport StorageGCReport
+		removed    []string
+	}{
+		{
+			name:  "old orphans are removed",
+			grace: 72 * time.Hour,
+			objects: map[string]object{
+				"a": {modified: old},
+				"b": {modified: old, ref: true},
+				"c": {modified: old},
+			},
+			wantReport: StorageGCReport{Scanned: 3, Orphans: 2, OrphanBytes: 2, Removed: 2},
+			removed:    []string{"a", "c"},
+		},
+		{
+			name:  "recent orphan is kept",
+			grace: 72 * time.Hour,
+			objects: map[string]object{
+				"a": {modified: old},
+				"b": {modified: recent},
+			},
+			wantReport: StorageGCReport{Scanned: 2, Orphans: 1, OrphanBytes: 1, Removed: 1},
+			removed:    []string{"a"},
+		},
+		{
+			name:   "dry run removes nothing",
+			grace:  72 * time.Hour,
+			dryRun: true,
+			objects: map[string]object{
+				"a": {modified: old},
+				"b": {modified: old},
+			},
+			wantReport: StorageGCReport{Scanned: 2, Orphans: 2, OrphanBytes: 2, DryRun: true},
+		},
+		{
+			name:  "object referenced between listing and deletion survives",
+			grace: 72 * time.Hour,
+			objects: map[string]object{
+				"a": {modified: old},
+				"b": {modified: old},
+			},
+			between:    func(store *memStorage, repo *gcRepo) { repo.refs["b"] = true },
+			wantReport: StorageGCReport{Scanned: 2, Orphans: 1, OrphanBytes: 1, Removed: 1},
+			removed:    []string{"a"},
+		},
+		{
+			name:  "object uploaded again between listing and deletion survives",
+			grace: 72 * time.Hour,
+			objects: map[string]object{
+				"a": {modified: old},
+				"b": {modified: old},
+			},
+			between:    func(store *memStorage, repo *gcRepo) { store.put("b", []byte("b"), time.Now()) },
+			wantReport: StorageGCReport{Scanned: 2, Orphans: 1, OrphanBytes: 1, Removed: 1},
+			removed:    []string{"a"},
+		},
+		{
+			name:  "object deleted between listing and deletion is skipped",
+			grace: 72 * time.Hour,
+			objects: map[string]object{
+				"a": {modified: old},
+				"b": {modified: old},
+			},
+			between: func(store *memStorage, repo *gcRepo) {
+				store.mu.Lock()
+				delete(store.objects, "b")
+				store.mu.Unlock()
+			},
+			wantReport: StorageGCReport{Scanned: 2, Orphans: 1, OrphanBytes: 1, Removed: 1},
+			removed:    []string{"a"},
+		},
+		{
+			name:  "several batches",
+			grace: 72 * time.Hour,
+			batch: 2,
+			objects: map[string]object{
+				"a": {modified: old},
+				"b": {modified: old, ref: true},
+				"c": {modified: old},
+				"d": {modified: recent},
+				"e": {modified: old},
+			},
+			wantReport: StorageGCReport{Scanned: 5, Orphans: 3, OrphanBytes: 3, Removed: 3},
+			removed:    []string{"a", "c", "e"},
+		},
+		{
+			name:    "grace period is required",
+			objects: map[string]object{"a": {modified: old}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemStorage()
+			repo := &gcRepo{refs: make(map[string]bool)}
+			for k, o := range tt.objects {
+				store.put(k, []byte(k), o.modified)
+				if o.ref {
+					repo.refs[k] = true
+				}
+			}
+			if tt.between != nil {
+				repo.afterFirst = func() { tt.between(store, repo) }
+			}
+			s := NewStorageGCService(repo, store, StorageGCConfig{Grace: tt.grace, DryRun: tt.dryRun, Batch: tt.batch})
+
+			report, err := s.Run(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if report != tt.wantReport {
+				t.Fatalf("report = %+v, want %+v", report, tt.wantReport)
+			}
+			if len(tt.removed) == 0 && len(store.deleted) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(store.deleted, tt.removed) {
+				t.Fatalf("deleted %v, want %v", store.deleted, tt.removed)
+			}
+		})
+	}
+}
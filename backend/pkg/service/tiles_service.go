@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"archive/pkg/repository"
+)
+
+const (
+	maxTileZoom = 24
+	// на зумах до clusterMaxZoom включительно документы группируются, если клиент просит кластеризацию
+	clusterMaxZoom = 10
+)
+
+var ErrInvalidTile = errors.New("invalid tile coordinates")
+
+type TilesService struct {
+	repo repository.Tiles
+}
+
+func NewTilesService(repo repository.Tiles) *TilesService {
+	return &TilesService{repo: repo}
+}
+
+func (s *TilesService) GetDocumentsTile(ctx context.Context, z, x, y int, cluster bool) ([]byte, error) {
+	if z < 0 || z > maxTileZoom {
+		return nil, ErrInvalidTile
+	}
+	n := 1 << z
+	if x < 0 || y < 0 || x >= n || y >= n {
+		return nil, ErrInvalidTile
+	}
+	return s.repo.GetDocumentsTile(ctx, z, x, y, cluster && z <= clusterMaxZoom)
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	// minHMACSecretLen — RFC 7518 §3.2: ключ HS256 не короче размера хеша
+	minHMACSecretLen = 32
+)
+
+var (
+	ErrUnknownTokenKey = errors.New("unknown token key id")
+	ErrTokenAlgorithm  = errors.New("unexpected token signing algorithm")
+)
+
+// TokenKey — один ключ подписи/проверки JWT.
+// Для HS256 задаётся Secret; для RS256/EdDSA — Public и, если ключом подписывают, Private.
+type TokenKey struct {
+	ID        string
+	Algorithm string
+	Secret    []byte
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+// TokenConfig — настройки выпуска и проверки токенов.
+// Проверяются токены, подписанные любым ключом из Keys, — это позволяет ротировать
+// ключи без разлогинивания: новый ключ становится SigningKeyID, старый остаётся в Keys
+// (можно только с публичной частью), пока не истекут выданные им токены.
+type TokenConfig struct {
+	Issuer       string
+	TTL          time.Duration
+	RefreshTTL   time.Duration
+	SigningKeyID string
+	Keys         []TokenKey
+}
+
+// TokenKeySource — описание ключа в конфиге (jwt.keys).
+type TokenKeySource struct {
+	ID             string `mapstructure:"kid"`
+	Algorithm      string `mapstructure:"alg"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+	SecretEnv      string `mapstructure:"secret_env"` // имя переменной окружения с секретом HS256
+}
+
+type TokenManager struct {
+	issuer     string
+	ttl        time.Duration
+	refreshTTL time.Duration
+	signing    TokenKey
+	keys       map[string]TokenKey
+}
+
+func NewTokenManager(cfg TokenConfig) (*TokenManager, error) {
+	if cfg.TTL <= 0 {
+		return nil, errors.New("jwt: token ttl must be positive")
+	}
+	if cfg.RefreshTTL <= 0 {
+		return nil, errors.New("jwt: refresh token ttl must be positive")
+	}
+	m := &TokenManager{
+		issuer:     cfg.Issuer,
+		ttl:        cfg.TTL,
+		refreshTTL: cfg.RefreshTTL,
+		keys:       make(map[string]TokenKey, len(cfg.Keys)),
+	}
+	for _, k := range cfg.Keys {
+		if k.ID == "" {
+			return nil, errors.New("jwt: key without kid")
+		}
+		if _, dup := m.keys[k.ID]; dup {
+			return nil, fmt.Errorf("jwt: duplicate kid %q", k.ID)
+		}
+		if err := validateTokenKey(k); err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", k.ID, err)
+		}
+		m.keys[k.ID] = k
+	}
+
+	signing, ok := m.keys[cfg.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt: signing key %q is not configured", cfg.SigningKeyID)
+	}
+	if signing.Algorithm != AlgHS256 && signing.Private == nil {
+		return nil, fmt.Errorf("jwt: signing key %q has no private key", cfg.SigningKeyID)
+	}
+	m.signing = signing
+	return m, nil
+}
+
+func validateTokenKey(k TokenKey) error {
+	switch k.Algorithm {
+	case AlgHS256:
+		if len(k.Secret) < minHMACSecretLen {
+			return fmt.Errorf("HS256 secret must be at least %d bytes", minHMACSecretLen)
+		}
+	case AlgRS256:
+		if _, ok := k.Public.(*rsa.PublicKey); !ok {
+			return errors.New("RS256 requires an RSA public key")
+		}
+	case AlgEdDSA:
+		if _, ok := k.Public.(ed25519.PublicKey); !ok {
+			return errors.New("EdDSA requires an Ed25519 public key")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", k.Algorithm)
+	}
+	return nil
+}
+
+func signingMethod(alg string) jwt.SigningMethod {
+	switch alg {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return signingMethodEd25519
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// Sign подписывает claims текущим ключом и проставляет kid в заголовок.
+func (m *TokenManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(signingMethod(m.signing.Algorithm), claims)
+	token.Header["kid"] = m.signing.ID
+	if m.signing.Algorithm == AlgHS256 {
+		return token.SignedString(m.signing.Secret)
+	}
+	return token.SignedString(m.signing.Private)
+}
+
+// Parse проверяет подпись ключом из заголовка kid и стандартные claims (exp/iat/nbf, iss).
+// Токены без kid выпущены до появления kid и iss: у них iss проверяется, только если он есть.
+func (m *TokenManager) Parse(tokenString string, claims jwt.Claims) error {
+	legacy := false
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			// токены, выпущенные до появления kid
+			legacy = true
+			kid = m.signing.ID
+		}
+		key, ok := m.keys[kid]
+		if !ok {
+			return nil, ErrUnknownTokenKey
+		}
+		// алгоритм задаётся ключом, а не заголовком токена
+		if token.Method.Alg() != key.Algorithm {
+			return nil, ErrTokenAlgorithm
+		}
+		if key.Algorithm == AlgHS256 {
+			return key.Secret, nil
+		}
+		return key.Public, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	if m.issuer != "" {
+		if std, ok := claims.(interface{ VerifyIssuer(string, bool) bool }); ok && !std.VerifyIssuer(m.issuer, !legacy) {
+			return errors.New("invalid token issuer")
+		}
+	}
+	return nil
+}
+
+func (m *TokenManager) TTL() time.Duration { return m.ttl }
+
+func (m *TokenManager) RefreshTTL() time.Duration { return m.refreshTTL }
+
+func (m *TokenManager) Issuer() string { return m.issuer }
+
+// --- JWKS ------------------------------------------------------------------
+
+// JWK — открытый ключ в формате RFC 7517 (только RSA и OKP/Ed25519).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS — открытые ключи всех асимметричных ключей проверки. Секреты HS256 не публикуются.
+func (m *TokenManager) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(m.keys))}
+	for _, k := range m.keys {
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     k.ID,
+				Algorithm: k.Algorithm,
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     k.ID,
+				Algorithm: k.Algorithm,
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+// --- загрузка ключей ---------------------------------------------------------
+
+// LoadTokenKey читает ключ, описанный в конфиге: PEM-файлы для RS256/EdDSA
+// (достаточно public_key_file для ключа, которым только проверяют) или секрет из окружения для HS256.
+func LoadTokenKey(src TokenKeySource) (TokenKey, error) {
+	k := TokenKey{ID: src.ID, Algorithm: src.Algorithm}
+	if k.Algorithm == "" {
+		k.Algorithm = AlgHS256
+	}
+
+	if k.Algorithm == AlgHS256 {
+		if src.SecretEnv == "" {
+			return TokenKey{}, fmt.Errorf("jwt key %q: secret_env required for HS256", src.ID)
+		}
+		secret := os.Getenv(src.SecretEnv)
+		if secret == "" {
+			return TokenKey{}, fmt.Errorf("jwt key %q: env %s is empty", src.ID, src.SecretEnv)
+		}
+		k.Secret = []byte(secret)
+		return k, nil
+	}
+
+	if src.PrivateKeyFile != "" {
+		priv, err := readPrivateKey(src.PrivateKeyFile)
+		if err != nil {
+			return TokenKey{}, fmt.Errorf("jwt key %q: %w", src.ID, err)
+		}
+		k.Private = priv
+		k.Public = priv.Public()
+	}
+	if src.PublicKeyFile != "" {
+		pub, err := readPublicKey(src.PublicKeyFile)
+		if err != nil {
+			return TokenKey{}, fmt.Errorf("jwt key %q: %w", src.ID, err)
+		}
+		k.Public = pub
+	}
+	if k.Public == nil {
+		return TokenKey{}, fmt.Errorf("jwt key %q: private_key_file or public_key_file required", src.ID)
+	}
+	return k, nil
+}
+
+func readPEMBlock(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEMBlock(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(block.Type, "RSA") {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported private key type %T", path, key)
+	}
+	return signer, nil
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEMBlock(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(block.Type, "RSA") {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// --- EdDSA для jwt-go (в v3 его нет) --------------------------------------------
+
+type signingMethodEdDSA struct{}
+
+var signingMethodEd25519 = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(AlgEdDSA, func() jwt.SigningMethod { return signingMethodEd25519 })
+}
+
+func (*signingMethodEdDSA) Alg() string { return AlgEdDSA }
+
+func (*signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
+
+func (*signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var testSecret = []byte(strings.Repeat("s", minHMACSecretLen))
+
+func newTestTokenManager(t *testing.T, signingKID string, keys ...TokenKey) *TokenManager {
+	t.Helper()
+	m, err := NewTokenManager(TokenConfig{
+		Issuer:       "archive",
+		TTL:          time.Minute,
+		RefreshTTL:   time.Hour,
+		SigningKeyID: signingKID,
+		Keys:         keys,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager: %v", err)
+	}
+	return m
+}
+
+func TestNewTokenManagerValidation(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := TokenKey{ID: "hs", Algorithm: AlgHS256, Secret: testSecret}
+
+	tests := []struct {
+		name string
+		cfg  TokenConfig
+	}{
+		{name: "zero ttl", cfg: TokenConfig{RefreshTTL: time.Hour, SigningKeyID: "hs", Keys: []TokenKey{hs}}},
+		{name: "zero refresh ttl", cfg: TokenConfig{TTL: time.Minute, SigningKeyID: "hs", Keys: []TokenKey{hs}}},
+		{name: "key without kid", cfg: TokenConfig{TTL: time.Minute, RefreshTTL: time.Hour, SigningKeyID: "hs",
+			Keys: []TokenKey{{Algorithm: AlgHS256, Secret: testSecret}}}},
+		{name: "duplicate kid", cfg: TokenConfig{TTL: time.Minute, RefreshTTL: time.Hour, SigningKeyID: "hs", Keys: []TokenKey{hs, hs}}},
+		{name: "short secret", cfg: TokenConfig{TTL: time.Minute, RefreshTTL: time.Hour, SigningKeyID: "hs",
+			Keys: []TokenKey{{ID: "hs", Algorithm: AlgHS256, Secret: []byte("short")}}}},
+		{name: "unknown signing kid", cfg: TokenConfig{TTL: time.Minute, RefreshTTL: time.Hour, SigningKeyID: "other", Keys: []TokenKey{hs}}},
+		{name: "signing key without private part", cfg: TokenConfig{TTL: time.Minute, RefreshTTL: time.Hour, SigningKeyID: "ed",
+			Keys: []TokenKey{{ID: "ed", Algorithm: AlgEdDSA, Public: pub}}}},
+		{name: "unsupported algorithm", cfg: TokenConfig{TTL: time.Minute, RefreshTTL: time.Hour, SigningKeyID: "x",
+			Keys: []TokenKey{{ID: "x", Algorithm: "none"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTokenManager(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestTokenManagerParse(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := TokenKey{ID: "hs", Algorithm: AlgHS256, Secret: testSecret}
+	ed := TokenKey{ID: "ed", Algorithm: AlgEdDSA, Private: priv, Public: pub}
+	otherHS := TokenKey{ID: "hs", Algorithm: AlgHS256, Secret: []byte(strings.Repeat("o", minHMACSecretLen))}
+
+	current := newTestTokenManager(t, "ed", hs, ed)
+	previous := newTestTokenManager(t, "hs", hs)
+	unknown := newTestTokenManager(t, "other", TokenKey{ID: "other", Algorithm: AlgHS256, Secret: testSecret})
+	forged := newTestTokenManager(t, "hs", otherHS)
+
+	now := time.Now()
+	valid := jwt.StandardClaims{Issuer: "archive", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+
+	sign := func(m *TokenManager, claims jwt.StandardClaims) string {
+		s, err := m.Sign(claims)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return s
+	}
+	// токен без kid, как до появления ротации ключей
+	legacy := func(claims jwt.StandardClaims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	// HS256-токен с kid асимметричного ключа: подпись нельзя принимать открытым ключом как секретом
+	algConfusion := func() string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, valid)
+		token.Header["kid"] = "ed"
+		s, err := token.SignedString([]byte(pub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		manager *TokenManager
+		token   string
+		wantErr error
+		ok      bool
+	}{
+		{name: "current key", manager: current, token: sign(current, valid), ok: true},
+		{name: "rotated out key still verifies", manager: current, token: sign(previous, valid), ok: true},
+		{name: "unknown kid", manager: current, token: sign(unknown, valid), wantErr: ErrUnknownTokenKey},
+		{name: "wrong secret", manager: current, token: sign(forged, valid)},
+		{name: "algorithm confusion", manager: current, token: algConfusion(), wantErr: ErrTokenAlgorithm},
+		{name: "expired", manager: current, token: sign(current, jwt.StandardClaims{Issuer: "archive", ExpiresAt: now.Add(-time.Minute).Unix()})},
+		{name: "wrong issuer", manager: current, token: sign(current, jwt.StandardClaims{Issuer: "other", ExpiresAt: valid.ExpiresAt})},
+		{name: "missing issuer", manager: current, token: sign(current, jwt.StandardClaims{ExpiresAt: valid.ExpiresAt})},
+		{name: "legacy token without kid and iss", manager: previous, token: legacy(jwt.StandardClaims{ExpiresAt: valid.ExpiresAt}), ok: true},
+		{name: "legacy token with wrong iss", manager: previous, token: legacy(jwt.StandardClaims{Issuer: "other", ExpiresAt: valid.ExpiresAt})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.manager.Parse(tt.token, &jwt.StandardClaims{})
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				// jwt-go оборачивает ошибку keyfunc в ValidationError.Inner
+				var ve *jwt.ValidationError
+				if !errors.As(err, &ve) || !errors.Is(ve.Inner, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestSignSetsKid(t *testing.T) {
+	m := newTestTokenManager(t, "hs", TokenKey{ID: "hs", Algorithm: AlgHS256, Secret: testSecret})
+	s, err := m.Sign(jwt.StandardClaims{Issuer: "archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := new(jwt.Parser).ParseUnverified(s, &jwt.StandardClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid, _ := token.Header["kid"].(string); kid != "hs" {
+		t.Fatalf("kid = %q, want hs", kid)
+	}
+}
@@ -0,0 +1,620 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/storage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadTooLarge       = errors.New("upload exceeds maximum size")
+	ErrUploadBusy           = errors.New("upload is being written by another request")
+	ErrUploadNotCompleted   = errors.New("upload is not completed")
+	ErrUploadKind           = errors.New("operation is not supported for this kind of upload")
+	ErrUploadVerification   = errors.New("uploaded file failed verification")
+)
+
+const (
+	// maxUploadParts — предел числа частей multipart-загрузки в S3
+	maxUploadParts = 10000
+	// maxDirectUploadSize — предел одного PUT в S3; файлы больше загружаются через tus
+	maxDirectUploadSize = 5 << 30
+)
+
+// UploadsConfig — настройки возобновляемых загрузок (секция uploads конфига)
+type UploadsConfig struct {
+	SpoolDir   string        // каталог для хвоста загрузки, ещё не переданного в хранилище частью
+	PartSize   int64         // размер части; не меньше минимума хранилища
+	MaxSize    int64         // максимальный размер файла (Tus-Max-Size)
+	TTL        time.Duration // сколько живёт незавершённая или неприкреплённая загрузка
+	PresignTTL time.Duration // срок подписанной ссылки прямой загрузки; не больше TTL
+}
+
+// UploadsService собирает файл из PATCH-запросов tus в multipart-загрузку хранилища.
+// Принятые байты сначала дописываются в spool-файл, полный spool уходит в хранилище
+// очередной частью. В БД хранится смещение, список частей и состояние SHA-256 на
+// границе последней части, поэтому загрузку можно продолжить после обрыва соединения
+// или перезапуска. Spool лежит на локальном диске: все PATCH одной загрузки должны
+// попадать на один экземпляр API.
+type UploadsService struct {
+	repo  repository.Uploads
+	store storage.Storage
+	cfg   UploadsConfig
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+func NewUploadsService(repo repository.Uploads, store storage.Storage, cfg UploadsConfig) *UploadsService {
+	if cfg.SpoolDir == "" {
+		cfg.SpoolDir = filepath.Join(os.TempDir(), "archive-uploads")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.PresignTTL <= 0 || cfg.PresignTTL > cfg.TTL {
+		cfg.PresignTTL = min(time.Hour, cfg.TTL)
+	}
+	if store != nil && cfg.PartSize < store.MinPartSize() {
+		cfg.PartSize = store.MinPartSize()
+	}
+	if cfg.MaxSize > 0 && cfg.PartSize*maxUploadParts < cfg.MaxSize {
+		cfg.PartSize = (cfg.MaxSize + maxUploadParts - 1) / maxUploadParts
+	}
+	return &UploadsService{repo: repo, store: store, cfg: cfg, active: make(map[string]bool)}
+}
+
+func (s *UploadsService) MaxSize() int64 {
+	return s.cfg.MaxSize
+}
+
+// Create начинает загрузку; имя и тип файла берутся из метаданных tus (filename, filetype)
+func (s *UploadsService) Create(ctx context.Context, userID int64, length int64, metadata map[string]string) (archive.Upload, error) {
+	if length <= 0 {
+		return archive.Upload{}, fmt.Errorf("%w: upload length must be positive", repository.ErrInvalidInput)
+	}
+	if s.cfg.MaxSize > 0 && length > s.cfg.MaxSize {
+		return archive.Upload{}, ErrUploadTooLarge
+	}
+
+	filename := filepath.Base(metadata["filename"])
+	if filename == "." || filename == string(filepath.Separator) {
+		filename = "upload"
+	}
+	contentType := metadata["filetype"]
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return archive.Upload{}, err
+	}
+	mu, err := s.store.NewMultipartUpload(ctx, filename, contentType)
+	if err != nil {
+		return archive.Upload{}, err
+	}
+
+	now := time.Now()
+	u := archive.Upload{
+		ID:              id,
+		UserID:          userID,
+		Kind:            "tus",
+		Length:          length,
+		Filename:        &filename,
+		ContentType:     &contentType,
+		Metadata:        metadata,
+		Bucket:          mu.Bucket,
+		Key:             mu.Key,
+		StorageUploadID: mu.UploadID,
+		Status:          "active",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		ExpiresAt:       now.Add(s.cfg.TTL),
+	}
+	if err := s.repo.Create(ctx, u); err != nil {
+		_ = s.store.AbortMultipartUpload(context.WithoutCancel(ctx), mu)
+		return archive.Upload{}, err
+	}
+	return u, nil
+}
+
+// CreateDirect выдаёт подписанную ссылку для загрузки файла прямо в хранилище
+// (во временный ключ); после загрузки клиент вызывает Finalize
+func (s *UploadsService) CreateDirect(ctx context.Context, userID int64, in archive.DirectUploadInput) (archive.Upload, storage.PresignedUpload, error) {
+	if in.Size <= 0 {
+		return archive.Upload{}, storage.PresignedUpload{}, fmt.Errorf("%w: size must be positive", repository.ErrInvalidInput)
+	}
+	if in.Size > maxDirectUploadSize || (s.cfg.MaxSize > 0 && in.Size > s.cfg.MaxSize) {
+		return archive.Upload{}, storage.PresignedUpload{}, ErrUploadTooLarge
+	}
+	if in.Sha256 != nil {
+		sum := strings.ToLower(strings.TrimSpace(*in.Sha256))
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+			return archive.Upload{}, storage.PresignedUpload{}, fmt.Errorf("%w: sha256 must be 64 hex characters", repository.ErrInvalidInput)
+		}
+		in.Sha256 = &sum
+	}
+	filename := filepath.Base(in.Filename)
+	if filename == "." || filename == string(filepath.Separator) {
+		filename = "upload"
+	}
+	contentType := strings.TrimSpace(in.ContentType)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return archive.Upload{}, storage.PresignedUpload{}, fmt.Errorf("%w: invalid content_type", repository.ErrInvalidInput)
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return archive.Upload{}, storage.PresignedUpload{}, err
+	}
+	presigned, err := s.store.PresignUpload(ctx, filename, contentType, in.Size, s.cfg.PresignTTL)
+	if err != nil {
+		return archive.Upload{}, storage.PresignedUpload{}, err
+	}
+
+	now := time.Now()
+	u := archive.Upload{
+		ID:          id,
+		UserID:      userID,
+		Kind:        "direct",
+		Length:      in.Size,
+		Filename:    &filename,
+		ContentType: &contentType,
+		Metadata:    map[string]string{},
+		Sha256:      in.Sha256,
+		Bucket:      presigned.Bucket,
+		Key:         presigned.Key,
+		Status:      "active",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ExpiresAt:   now.Add(s.cfg.TTL),
+	}
+	if err := s.repo.Create(ctx, u); err != nil {
+		return archive.Upload{}, storage.PresignedUpload{}, err
+	}
+	return u, presigned, nil
+}
+
+// Finalize проверяет объект прямой загрузки (размер, тип, SHA-256), переносит его
+// в постоянный ключ и завершает загрузку. Не прошедший проверку объект удаляется:
+// ссылка действует до истечения, файл можно загрузить заново.
+func (s *UploadsService) Finalize(ctx context.Context, userID int64, id string, sha *string) (archive.Upload, error) {
+	if !s.lock(id) {
+		return archive.Upload{}, ErrUploadBusy
+	}
+	defer s.unlock(id)
+
+	u, err := s.repo.Get(ctx, userID, id)
+	if err != nil {
+		return archive.Upload{}, err
+	}
+	if u.Kind != "direct" {
+		return u, ErrUploadKind
+	}
+	if u.Status != "active" {
+		return u, nil
+	}
+	expected := u.Sha256
+	if sha != nil {
+		sum := strings.ToLower(strings.TrimSpace(*sha))
+		if expected != nil && *expected != sum {
+			return u, fmt.Errorf("%w: sha256 differs from the one given when the upload was created", repository.ErrInvalidInput)
+		}
+		expected = &sum
+	}
+
+	info, err := s.store.Stat(ctx, u.Bucket, u.Key)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return u, fmt.Errorf("%w: file has not been uploaded", ErrUploadNotCompleted)
+	}
+	if err != nil {
+		return u, err
+	}
+	contentType := "application/octet-stream"
+	if u.ContentType != nil {
+		contentType = *u.ContentType
+	}
+
+	sum, err := s.verifyDirect(ctx, u, info, contentType, expected)
+	if err != nil {
+		if errors.Is(err, ErrUploadVerification) {
+			_ = s.store.Delete(context.WithoutCancel(ctx), u.Bucket, u.Key)
+		}
+		return u, err
+	}
+
+	res, err := s.store.Promote(ctx, u.Bucket, u.Key, sum, contentType)
+	if err != nil {
+		return u, err
+	}
+	fm := archive.FileMeta{
+		Name:     *u.Filename,
+		Provider: res.Provider,
+		Bucket:   res.Bucket,
+		Key:      res.Key,
+		Mime:     contentType,
+		Size:     u.Length,
+		Sha256:   sum,
+	}
+	if err := s.repo.Complete(ctx, userID, u.ID, fm); err != nil {
+		return u, err
+	}
+	if res.Key != u.Key {
+		_ = s.store.Delete(context.WithoutCancel(ctx), u.Bucket, u.Key)
+	}
+
+	u.Status = "completed"
+	u.Offset = u.Length
+	u.FileMeta = &fm
+	return u, nil
+}
+
+// verifyDirect сверяет объект с заявленными размером и типом и считает его SHA-256
+func (s *UploadsService) verifyDirect(ctx context.Context, u archive.Upload, info storage.ObjectInfo, contentType string, expected *string) (string, error) {
+	if info.Size != u.Length {
+		return "", fmt.Errorf("%w: size %d, expected %d", ErrUploadVerification, info.Size, u.Length)
+	}
+	if info.ContentType != "" && !sameMediaType(info.ContentType, contentType) {
+		return "", fmt.Errorf("%w: content type %q, expected %q", ErrUploadVerification, info.ContentType, contentType)
+	}
+
+	r, _, err := s.store.Open(ctx, u.Bucket, u.Key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	if n != u.Length {
+		return "", fmt.Errorf("%w: size %d, expected %d", ErrUploadVerification, n, u.Length)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if expected != nil && *expected != sum {
+		return "", fmt.Errorf("%w: sha256 mismatch", ErrUploadVerification)
+	}
+	return sum, nil
+}
+
+func sameMediaType(a, b string) bool {
+	ma, _, errA := mime.ParseMediaType(a)
+	mb, _, errB := mime.ParseMediaType(b)
+	return errA == nil && errB == nil && ma == mb
+}
+
+func (s *UploadsService) Get(ctx context.Context, userID int64, id string) (archive.Upload, error) {
+	return s.repo.Get(ctx, userID, id)
+}
+
+// Write дописывает тело PATCH начиная с offset. Если клиент оборвал передачу, принятые
+// байты сохраняются и возвращается новое смещение без ошибки — как требует tus.
+// Когда приняты все байты, загрузка завершается в хранилище.
+func (s *UploadsService) Write(ctx context.Context, userID int64, id string, offset int64, r io.Reader) (archive.Upload, error) {
+	if !s.lock(id) {
+		return archive.Upload{}, ErrUploadBusy
+	}
+	defer s.unlock(id)
+
+	u, err := s.repo.Get(ctx, userID, id)
+	if err != nil {
+		return archive.Upload{}, err
+	}
+	if u.Kind != "tus" {
+		return u, ErrUploadKind
+	}
+	if offset != u.Offset {
+		return u, ErrUploadOffsetMismatch
+	}
+	if u.Status != "active" {
+		return u, nil
+	}
+
+	// запись не прерывается вместе с запросом: принятое нужно успеть сохранить
+	saveCtx := context.WithoutCancel(ctx)
+
+	h, err := restoreHash(u.HashState)
+	if err != nil {
+		return u, err
+	}
+	var committed int64
+	for _, p := range u.Parts {
+		committed += p.Size
+	}
+
+	if err := os.MkdirAll(s.cfg.SpoolDir, 0o750); err != nil {
+		return u, err
+	}
+	f, err := os.OpenFile(s.spoolPath(id), os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return u, err
+	}
+	defer f.Close()
+
+	// хвост после последней части: его байты входят в offset, но не в hash_state
+	tail := u.Offset - committed
+	st, err := f.Stat()
+	if err != nil {
+		return u, err
+	}
+	if st.Size() < tail {
+		// spool потерян (перезапуск на другом диске, очистка tmp): откатываемся к границе части
+		if err := s.repo.SaveProgress(saveCtx, userID, id, u.Offset, committed, u.Parts, u.HashState); err != nil {
+			return u, err
+		}
+		u.Offset = committed
+		return u, ErrUploadOffsetMismatch
+	}
+	// байты сверх offset остались от записи, прогресс которой не успели сохранить
+	if err := f.Truncate(tail); err != nil {
+		return u, err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, tail)); err != nil {
+		return u, err
+	}
+	if _, err := f.Seek(tail, io.SeekStart); err != nil {
+		return u, err
+	}
+
+	w := uploadWriter{s: s, ctx: saveCtx, u: &u, f: f, h: h, spooled: tail, saved: u.Offset}
+	if err := w.copy(io.LimitReader(r, u.Length-u.Offset)); err != nil {
+		return u, err
+	}
+	if u.Offset < u.Length {
+		return u, nil
+	}
+	if err := w.finish(); err != nil {
+		return u, err
+	}
+	f.Close()
+	_ = os.Remove(s.spoolPath(id))
+	return u, nil
+}
+
+// Terminate удаляет загрузку; незавершённая прерывается в хранилище
+func (s *UploadsService) Terminate(ctx context.Context, userID int64, id string) error {
+	if !s.lock(id) {
+		return ErrUploadBusy
+	}
+	defer s.unlock(id)
+
+	u, err := s.repo.Get(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, userID, id); err != nil {
+		return err
+	}
+	s.discard(ctx, archive.ExpiredUpload{ID: u.ID, Kind: u.Kind, Status: u.Status, Bucket: u.Bucket, Key: u.Key, StorageUploadID: u.StorageUploadID})
+	return nil
+}
+
+// FileMeta — файл завершённой загрузки пользователя для прикрепления к документу
+func (s *UploadsService) FileMeta(ctx context.Context, userID int64, id string) (archive.FileMeta, error) {
+	u, err := s.repo.Get(ctx, userID, id)
+	if err != nil {
+		return archive.FileMeta{}, err
+	}
+	if u.Status != "completed" || u.FileMeta == nil {
+		return archive.FileMeta{}, ErrUploadNotCompleted
+	}
+	return *u.FileMeta, nil
+}
+
+// PurgeExpired удаляет просроченные загрузки (не больше limit) и прерывает незавершённые
+func (s *UploadsService) PurgeExpired(ctx context.Context, limit int) (int, error) {
+	items, err := s.repo.PurgeExpired(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, it := range items {
+		s.discard(ctx, it)
+	}
+	return len(items), nil
+}
+
+// discard — прерывает multipart-загрузку и удаляет spool или временный объект прямой загрузки;
+// строка в БД уже удалена, поэтому ошибки не возвращаются (незавершённые части со временем
+// удалит само хранилище)
+func (s *UploadsService) discard(ctx context.Context, u archive.ExpiredUpload) {
+	if u.Status != "active" {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	if u.Kind == "direct" {
+		_ = s.store.Delete(ctx, u.Bucket, u.Key)
+		return
+	}
+	_ = s.store.AbortMultipartUpload(ctx, storage.MultipartUpload{Bucket: u.Bucket, Key: u.Key, UploadID: u.StorageUploadID})
+	_ = os.Remove(s.spoolPath(u.ID))
+}
+
+func (s *UploadsService) spoolPath(id string) string {
+	return filepath.Join(s.cfg.SpoolDir, id+".part")
+}
+
+func (s *UploadsService) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[id] {
+		return false
+	}
+	s.active[id] = true
+	return true
+}
+
+func (s *UploadsService) unlock(id string) {
+	s.mu.Lock()
+	delete(s.active, id)
+	s.mu.Unlock()
+}
+
+// uploadWriter — состояние одного PATCH: spool-файл, хеш и сохранённое в БД смещение
+type uploadWriter struct {
+	s   *UploadsService
+	ctx context.Context
+	u   *archive.Upload
+	f   *os.File
+	h   hash.Hash
+
+	spooled int64 // байт в spool
+	saved   int64 // offset, записанный в БД
+}
+
+func (w *uploadWriter) copy(r io.Reader) error {
+	buf := make([]byte, 256<<10)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if _, err := w.f.Write(buf[:n]); err != nil {
+				return err
+			}
+			w.h.Write(buf[:n])
+			w.spooled += int64(n)
+			w.u.Offset += int64(n)
+			// последнюю часть отправляет finish
+			if w.spooled >= w.s.cfg.PartSize && w.u.Offset < w.u.Length {
+				if err := w.flushPart(); err != nil {
+					return err
+				}
+			}
+		}
+		if rerr != nil {
+			// io.EOF или обрыв соединения: сохраняем то, что успели принять
+			if err := w.f.Sync(); err != nil {
+				return err
+			}
+			if w.u.Offset == w.saved {
+				return nil
+			}
+			return w.save(w.u.HashState)
+		}
+	}
+}
+
+// flushPart отправляет spool очередной частью и сохраняет прогресс на границе части
+func (w *uploadWriter) flushPart() error {
+	if err := w.f.Sync(); err != nil {
+		return err
+	}
+	mu := storage.MultipartUpload{Bucket: w.u.Bucket, Key: w.u.Key, UploadID: w.u.StorageUploadID}
+	part, err := w.s.store.PutPart(w.ctx, mu, len(w.u.Parts)+1, io.NewSectionReader(w.f, 0, w.spooled), w.spooled)
+	if err != nil {
+		return err
+	}
+	w.u.Parts = append(w.u.Parts, archive.UploadPart{Number: part.Number, ETag: part.ETag, Size: part.Size})
+
+	state, err := w.h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := w.save(state); err != nil {
+		return err
+	}
+	w.u.HashState = state
+
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = w.f.Seek(0, io.SeekStart)
+	w.spooled = 0
+	return err
+}
+
+func (w *uploadWriter) save(hashState []byte) error {
+	if err := w.s.repo.SaveProgress(w.ctx, w.u.UserID, w.u.ID, w.saved, w.u.Offset, w.u.Parts, hashState); err != nil {
+		return err
+	}
+	w.saved = w.u.Offset
+	return nil
+}
+
+// finish отправляет остаток spool последней частью и собирает файл в хранилище
+func (w *uploadWriter) finish() error {
+	if w.spooled > 0 || len(w.u.Parts) == 0 {
+		if err := w.flushPart(); err != nil {
+			return err
+		}
+	}
+
+	contentType := "application/octet-stream"
+	if w.u.ContentType != nil {
+		contentType = *w.u.ContentType
+	}
+	parts := make([]storage.UploadedPart, 0, len(w.u.Parts))
+	for _, p := range w.u.Parts {
+		parts = append(parts, storage.UploadedPart{Number: p.Number, ETag: p.ETag, Size: p.Size})
+	}
+	mu := storage.MultipartUpload{Bucket: w.u.Bucket, Key: w.u.Key, UploadID: w.u.StorageUploadID}
+	assembled, err := w.s.store.CompleteMultipartUpload(w.ctx, mu, parts, contentType)
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(w.h.Sum(nil))
+	res, err := w.s.store.Promote(w.ctx, assembled.Bucket, assembled.Key, sum, contentType)
+	if err != nil {
+		return err
+	}
+
+	fm := archive.FileMeta{
+		Provider: res.Provider,
+		Bucket:   res.Bucket,
+		Key:      res.Key,
+		Mime:     contentType,
+		Size:     w.u.Length,
+		Sha256:   sum,
+	}
+	if w.u.Filename != nil {
+		fm.Name = *w.u.Filename
+	}
+	if err := w.s.repo.Complete(w.ctx, w.u.UserID, w.u.ID, fm); err != nil {
+		return err
+	}
+	if res.Key != assembled.Key {
+		_ = w.s.store.Delete(w.ctx, assembled.Bucket, assembled.Key)
+	}
+	w.u.Status = "completed"
+	w.u.FileMeta = &fm
+	w.u.HashState = nil
+	return nil
+}
+
+func restoreHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if len(state) == 0 {
+		return h, nil
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("restore upload hash: %w", err)
+	}
+	return h, nil
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
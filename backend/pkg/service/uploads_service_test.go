@@ -0,0 +1,301 @@
+package service
+
+import (
+	"archive"
+	"archive/pkg/repository"
+	"archive/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memUploads — repository.Uploads в памяти; SaveProgress, как и fn_save_upload_progress,
+// отклоняет запись, если смещение в БД уже не равно oldOffset
+type memUploads struct {
+	mu      sync.Mutex
+	uploads map[string]archive.Upload
+}
+
+func newMemUploads() *memUploads {
+	return &memUploads{uploads: make(map[string]archive.Upload)}
+}
+
+func (m *memUploads) Create(ctx context.Context, u archive.Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads[u.ID] = u
+	return nil
+}
+
+func (m *memUploads) Get(ctx context.Context, userID int64, id string) (archive.Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[id]
+	if !ok || u.UserID != userID {
+		return archive.Upload{}, repository.ErrNotFound
+	}
+	u.Parts = append([]archive.UploadPart(nil), u.Parts...)
+	return u, nil
+}
+
+func (m *memUploads) SaveProgress(ctx context.Context, userID int64, id string, oldOffset, newOffset int64, parts []archive.UploadPart, hashState []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[id]
+	if !ok || u.UserID != userID {
+		return repository.ErrNotFound
+	}
+	if u.Status != "active" || u.Offset != oldOffset {
+		return repository.ErrConflict
+	}
+	u.Offset = newOffset
+	u.Parts = append([]archive.UploadPart(nil), parts...)
+	u.HashState = hashState
+	m.uploads[id] = u
+	return nil
+}
+
+func (m *memUploads) Complete(ctx context.Context, userID int64, id string, fm archive.FileMeta) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[id]
+	if !ok || u.UserID != userID {
+		return repository.ErrNotFound
+	}
+	u.Status = "completed"
+	u.Offset = u.Length
+	u.FileMeta = &fm
+	u.HashState = nil
+	m.uploads[id] = u
+	return nil
+}
+
+func (m *memUploads) Delete(ctx context.Context, userID int64, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, id)
+	return nil
+}
+
+func (m *memUploads) PurgeExpired(ctx context.Context, limit int) ([]archive.ExpiredUpload, error) {
+	return nil, nil
+}
+
+// brokenReader отдаёт данные, а затем ошибку — как оборванное соединение
+type brokenReader struct{ r io.Reader }
+
+func (b brokenReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func newTestUploadsService(t *testing.T, partSize int64) (*UploadsService, *memUploads, storage.Storage) {
+	t.Helper()
+	store, err := storage.NewLocalStorage(storage.LocalConfig{
+		Root:       t.TempDir(),
+		Prefix:     "documents/",
+		SigningKey: []byte(strings.Repeat("k", 32)),
+	})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	repo := newMemUploads()
+	s := NewUploadsService(repo, store, UploadsConfig{SpoolDir: t.TempDir(), PartSize: partSize})
+	return s, repo, store
+}
+
+func TestUploadsWrite(t *testing.T) {
+	const content = "0123456789"
+
+	type step struct {
+		before     func(t *testing.T, s *UploadsService, id string)
+		offset     int64
+		body       string
+		broken     bool // соединение обрывается после body
+		wantErr    error
+		wantOffset int64
+	}
+	appendSpool := func(extra string) func(t *testing.T, s *UploadsService, id string) {
+		return func(t *testing.T, s *UploadsService, id string) {
+			f, err := os.OpenFile(s.spoolPath(id), os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.WriteString(extra); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	removeSpool := func(t *testing.T, s *UploadsService, id string) {
+		if err := os.Remove(s.spoolPath(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "single request",
+			steps: []step{{offset: 0, body: content, wantOffset: 10}},
+		},
+		{
+			name: "resume across part boundary",
+			steps: []step{
+				{offset: 0, body: "012345", wantOffset: 6},
+				{offset: 6, body: "6789", wantOffset: 10},
+			},
+		},
+		{
+			name: "resume after broken connection",
+			steps: []step{
+				{offset: 0, body: "0123456", broken: true, wantOffset: 7},
+				{offset: 7, body: "789", wantOffset: 10},
+			},
+		},
+		{
+			name: "body longer than upload is cut",
+			steps: []step{
+				{offset: 0, body: "01234"},
+				{offset: 5, body: "56789extra", wantOffset: 10},
+			},
+		},
+		{
+			name: "offset mismatch",
+			steps: []step{
+				{offset: 0, body: "012345", wantOffset: 6},
+				{offset: 4, body: "456789", wantErr: ErrUploadOffsetMismatch, wantOffset: 6},
+				{offset: 6, body: "6789", wantOffset: 10},
+			},
+		},
+		{
+			name: "unsaved spool bytes are truncated",
+			steps: []step{
+				{offset: 0, body: "012345", wantOffset: 6},
+				{before: appendSpool("XY"), offset: 6, body: "6789", wantOffset: 10},
+			},
+		},
+		{
+			name: "lost spool rolls back to part boundary",
+			steps: []step{
+				{offset: 0, body: "0123"},
+				{offset: 4, body: "45"},
+				{before: removeSpool, offset: 6, body: "6789", wantErr: ErrUploadOffsetMismatch, wantOffset: 4},
+				{offset: 4, body: "456789", wantOffset: 10},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, repo, store := newTestUploadsService(t, 4)
+			u, err := s.Create(ctx, 1, int64(len(content)), map[string]string{"filename": "plan.txt", "filetype": "text/plain"})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			for i, st := range tt.steps {
+				if st.wantOffset == 0 {
+					st.wantOffset = st.offset + int64(len(st.body))
+				}
+				if st.before != nil {
+					st.before(t, s, u.ID)
+				}
+				var r io.Reader = strings.NewReader(st.body)
+				if st.broken {
+					r = brokenReader{r}
+				}
+				got, err := s.Write(ctx, 1, u.ID, st.offset, r)
+				if !errors.Is(err, st.wantErr) {
+					t.Fatalf("step %d: err = %v, want %v", i, err, st.wantErr)
+				}
+				if got.Offset != st.wantOffset {
+					t.Fatalf("step %d: offset = %d, want %d", i, got.Offset, st.wantOffset)
+				}
+				saved, _ := repo.Get(ctx, 1, u.ID)
+				if saved.Offset != st.wantOffset {
+					t.Fatalf("step %d: saved offset = %d, want %d", i, saved.Offset, st.wantOffset)
+				}
+			}
+
+			done, _ := repo.Get(ctx, 1, u.ID)
+			if done.Status != "completed" || done.FileMeta == nil {
+				t.Fatalf("upload is not completed: status %q", done.Status)
+			}
+			sum := sha256.Sum256([]byte(content))
+			if done.FileMeta.Sha256 != hex.EncodeToString(sum[:]) || done.FileMeta.Size != int64(len(content)) {
+				t.Fatalf("file meta = %+v", *done.FileMeta)
+			}
+			f, _, err := store.Open(ctx, done.FileMeta.Bucket, done.FileMeta.Key)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer f.Close()
+			b, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != content {
+				t.Fatalf("stored %q, want %q", b, content)
+			}
+			if _, err := os.Stat(s.spoolPath(u.ID)); !os.IsNotExist(err) {
+				t.Fatalf("spool is left after completion: %v", err)
+			}
+		})
+	}
+}
+
+func TestUploadsWriteRejects(t *testing.T) {
+	ctx := context.Background()
+	s, repo, _ := newTestUploadsService(t, 4)
+
+	direct := archive.Upload{ID: "direct", UserID: 1, Kind: "direct", Length: 10, Status: "active"}
+	completed := archive.Upload{ID: "completed", UserID: 1, Kind: "tus", Length: 10, Offset: 10, Status: "completed"}
+	for _, u := range []archive.Upload{direct, completed} {
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		userID  int64
+		id      string
+		offset  int64
+		wantErr error
+	}{
+		{name: "direct upload", userID: 1, id: "direct", wantErr: ErrUploadKind},
+		{name: "other user", userID: 2, id: "completed", offset: 10, wantErr: repository.ErrNotFound},
+		{name: "completed upload is not written", userID: 1, id: "completed", offset: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Write(ctx, tt.userID, tt.id, tt.offset, strings.NewReader("data"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.Offset != tt.offset {
+				t.Fatalf("offset = %d, want %d", got.Offset, tt.offset)
+			}
+		})
+	}
+
+	if !s.lock("busy") {
+		t.Fatal("lock")
+	}
+	defer s.unlock("busy")
+	if _, err := s.Write(ctx, 1, "busy", 0, strings.NewReader("data")); !errors.Is(err, ErrUploadBusy) {
+		t.Fatalf("err = %v, want ErrUploadBusy", err)
+	}
+}
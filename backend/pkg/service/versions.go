@@ -0,0 +1,91 @@
+package service
+
+import (
+	"archive"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// diffVersions сравнивает содержимое версий; служебные поля (автор правки, время) не сравниваются
+func diffVersions(a, b archive.DocumentVersion) []archive.FieldChange {
+	changes := make([]archive.FieldChange, 0)
+	add := func(field string, from, to interface{}) {
+		changes = append(changes, archive.FieldChange{Field: field, From: from, To: to})
+	}
+
+	if a.Title != b.Title {
+		add("title", a.Title, b.Title)
+	}
+	if a.Privacy != b.Privacy {
+		add("privacy", a.Privacy, b.Privacy)
+	}
+	if fa, fb := formatDate(a.DocumentDate), formatDate(b.DocumentDate); fa != fb {
+		add("document_date", fa, fb)
+	}
+	if !reflect.DeepEqual(a.Author, b.Author) {
+		add("author", a.Author, b.Author)
+	}
+	if !reflect.DeepEqual(a.TypeID, b.TypeID) {
+		add("type_id", a.TypeID, b.TypeID)
+	}
+	if !reflect.DeepEqual(a.FileMeta, b.FileMeta) {
+		add("file_meta", a.FileMeta, b.FileMeta)
+	}
+	if !equalJSON(a.GeoJSON, b.GeoJSON) {
+		add("geojson", a.GeoJSON, b.GeoJSON)
+	}
+	if !equalTags(a.Tags, b.Tags) {
+		add("tags", a.Tags, b.Tags)
+	}
+	if !equalFiles(a.Files, b.Files) {
+		add("files", a.Files, b.Files)
+	}
+	return changes
+}
+
+// equalFiles — вложения сравниваются по порядку, роли и файлу; id вложения не важен
+func equalFiles(a, b []archive.VersionFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Role != b[i].Role || a[i].FileMeta != b[i].FileMeta {
+			return false
+		}
+	}
+	return true
+}
+
+func formatDate(d *time.Time) interface{} {
+	if d == nil {
+		return nil
+	}
+	return d.Format("2006-01-02")
+}
+
+// equalJSON — сравнение без учёта форматирования (jsonb в БД уже нормализован)
+func equalJSON(a, b *json.RawMessage) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, *a) != nil || json.Compact(&cb, *b) != nil {
+		return bytes.Equal(*a, *b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// equalTags — теги сравниваются как множество
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string(nil), a...)
+	sb := append([]string(nil), b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	return reflect.DeepEqual(sa, sb)
+}
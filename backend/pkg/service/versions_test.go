@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"archive"
+)
+
+func TestDiffVersions(t *testing.T) {
+	str := func(s string) *string { return &s }
+	id := func(v int64) *int64 { return &v }
+	date := func(s string) *time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &d
+	}
+	raw := func(s string) *json.RawMessage { r := json.RawMessage(s); return &r }
+
+	base := archive.DocumentVersion{
+		Version:      1,
+		Title:        "Plan",
+		Privacy:      "public",
+		DocumentDate: date("2024-05-01"),
+		Author:       str("Ivanov"),
+		TypeID:       id(2),
+		FileMeta:     &archive.FileMeta{Key: "a", Sha256: "aa"},
+		GeoJSON:      raw(`{"type":"Point","coordinates":[1,2]}`),
+		Tags:         []string{"map", "city"},
+		Files:        []archive.VersionFile{{FileID: 1, Position: 1, Role: "preview", FileMeta: archive.FileMeta{Key: "p"}}},
+		CreatedAt:    time.Unix(100, 0),
+		CreatedBy:    id(1),
+	}
+
+	tests := []struct {
+		name   string
+		change func(v *archive.DocumentVersion)
+		fields []string
+	}{
+		{name: "no changes", change: func(v *archive.DocumentVersion) {}},
+		{
+			name: "service fields are ignored",
+			change: func(v *archive.DocumentVersion) {
+				v.Version, v.CreatedAt, v.CreatedBy, v.ChangeKind, v.IsCurrent = 2, time.Unix(200, 0), id(5), "update", true
+			},
+		},
+		{name: "title", change: func(v *archive.DocumentVersion) { v.Title = "Plan 2" }, fields: []string{"title"}},
+		{name: "privacy", change: func(v *archive.DocumentVersion) { v.Privacy = "private" }, fields: []string{"privacy"}},
+		{name: "date cleared", change: func(v *archive.DocumentVersion) { v.DocumentDate = nil }, fields: []string{"document_date"}},
+		{name: "same date, other pointer", change: func(v *archive.DocumentVersion) { v.DocumentDate = date("2024-05-01") }},
+		{name: "author", change: func(v *archive.DocumentVersion) { v.Author = str("Petrov") }, fields: []string{"author"}},
+		{name: "type", change: func(v *archive.DocumentVersion) { v.TypeID = nil }, fields: []string{"type_id"}},
+		{name: "file", change: func(v *archive.DocumentVersion) { v.FileMeta = &archive.FileMeta{Key: "b", Sha256: "bb"} }, fields: []string{"file_meta"}},
+		{name: "geojson formatting only", change: func(v *archive.DocumentVersion) { v.GeoJSON = raw(`{ "type": "Point", "coordinates": [1, 2] }`) }},
+		{name: "geojson", change: func(v *archive.DocumentVersion) { v.GeoJSON = raw(`{"type":"Point","coordinates":[3,4]}`) }, fields: []string{"geojson"}},
+		{name: "tags reordered", change: func(v *archive.DocumentVersion) { v.Tags = []string{"city", "map"} }},
+		{name: "tags", change: func(v *archive.DocumentVersion) { v.Tags = []string{"map"} }, fields: []string{"tags"}},
+		{
+			name: "attachment re-added under another id",
+			change: func(v *archive.DocumentVersion) {
+				v.Files = []archive.VersionFile{{FileID: 9, Position: 1, Role: "preview", FileMeta: archive.FileMeta{Key: "p"}}}
+			},
+		},
+		{
+			name: "attachment role",
+			change: func(v *archive.DocumentVersion) {
+				v.Files = []archive.VersionFile{{FileID: 1, Position: 1, Role: "original", FileMeta: archive.FileMeta{Key: "p"}}}
+			},
+			fields: []string{"files"},
+		},
+		{name: "attachment removed", change: func(v *archive.DocumentVersion) { v.Files = nil }, fields: []string{"files"}},
+		{
+			name: "several fields in fixed order",
+			change: func(v *archive.DocumentVersion) {
+				v.Tags, v.Title, v.Privacy = nil, "Other", "private"
+			},
+			fields: []string{"title", "privacy", "tags"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base
+			tt.change(&other)
+			changes := diffVersions(base, other)
+			got := make([]string, 0, len(changes))
+			for _, c := range changes {
+				got = append(got, c.Field)
+			}
+			want := tt.fields
+			if want == nil {
+				want = []string{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("changed fields = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDiffVersionsFromTo(t *testing.T) {
+	a := archive.DocumentVersion{Title: "old"}
+	b := archive.DocumentVersion{Title: "new"}
+	changes := diffVersions(a, b)
+	if len(changes) != 1 || changes[0].From != "old" || changes[0].To != "new" {
+		t.Fatalf("changes = %+v", changes)
+	}
+}
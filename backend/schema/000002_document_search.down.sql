@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS documents_updated_at_idx;
+DROP FUNCTION IF EXISTS fn_search_documents(INT, TEXT, TEXT, TEXT, DATE, DATE, TEXT, BOOLEAN, INT, INT);
+DROP FUNCTION IF EXISTS _like_escape(TEXT);
+DROP FUNCTION IF EXISTS _visible_documents(INT, BOOLEAN);
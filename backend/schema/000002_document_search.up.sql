@@ -0,0 +1,122 @@
+-- === Поиск документов: фильтры, сортировка и пагинация на стороне БД ===
+
+-- Документы, видимые пользователю. SQL-функция (не plpgsql), чтобы планировщик
+-- мог встроить её в вызывающий запрос и использовать индексы documents.
+-- p_is_admin вычисляется вызывающей функцией один раз, а не для каждой строки.
+CREATE OR REPLACE FUNCTION _visible_documents(p_requester_id INT, p_is_admin BOOLEAN)
+RETURNS SETOF documents
+LANGUAGE sql STABLE AS $$
+  SELECT d.*
+  FROM documents d
+  WHERE p_is_admin
+     OR d.privacy = 'public'::privacy_type
+     OR (p_requester_id IS NOT NULL AND d.created_by = p_requester_id)
+     OR (p_requester_id IS NOT NULL AND EXISTS (
+           SELECT 1 FROM document_permissions dp
+           WHERE dp.document_id = d.id AND dp.user_id = p_requester_id AND (dp.can_view OR dp.can_edit)))
+$$;
+
+CREATE OR REPLACE FUNCTION _like_escape(p_value TEXT) RETURNS TEXT
+LANGUAGE sql IMMUTABLE AS $$
+  SELECT replace(replace(replace(p_value, '\', '\\'), '%', '\%'), '_', '\_')
+$$;
+
+-- Все фильтры объединяются через AND; NULL означает «фильтр не задан».
+-- total_count — общее число подходящих документов без учёта limit/offset.
+CREATE OR REPLACE FUNCTION fn_search_documents(
+  p_requester_id INT,
+  p_tag TEXT,
+  p_author TEXT,
+  p_type TEXT,
+  p_date_from DATE,
+  p_date_to DATE,
+  p_sort TEXT,
+  p_desc BOOLEAN,
+  p_limit INT,
+  p_offset INT
+)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  type_name citext,
+  tags TEXT[],
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN,
+  total_count BIGINT
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_is_admin BOOLEAN := is_user_admin(p_requester_id);
+  v_sort TEXT := lower(coalesce(nullif(btrim(p_sort), ''), 'created_at'));
+  v_desc BOOLEAN := coalesce(p_desc, TRUE);
+  v_type_id INT;
+BEGIN
+  IF v_sort NOT IN ('created_at', 'updated_at', 'document_date', 'title') THEN
+    RAISE EXCEPTION 'unsupported sort field %', p_sort;
+  END IF;
+  IF p_limit IS NULL OR p_limit <= 0 THEN RAISE EXCEPTION 'p_limit must be positive'; END IF;
+
+  -- тип можно передать как id или как имя
+  IF p_type ~ '^\d+$' THEN
+    v_type_id := p_type::INT;
+  ELSIF p_type IS NOT NULL THEN
+    SELECT t.id INTO v_type_id FROM document_types t WHERE t.name = p_type::citext;
+    IF v_type_id IS NULL THEN RETURN; END IF;
+  END IF;
+
+  RETURN QUERY
+  SELECT
+    d.id,
+    d.title,
+    d.privacy,
+    d.created_at,
+    d.created_by,
+    d.updated_at,
+    d.updated_by,
+    d.document_date,
+    d.author,
+    d.type_id,
+    dt.name,
+    ARRAY(SELECT tg.name::TEXT FROM document_tags x JOIN tags tg ON tg.id = x.tag_id WHERE x.document_id = d.id ORDER BY tg.name),
+    d.geojson,
+    (v_is_admin
+      OR (v_uid IS NOT NULL AND d.created_by = v_uid)
+      OR (v_uid IS NOT NULL AND EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = d.id AND dp.user_id = v_uid AND dp.can_edit))),
+    (d.created_by IS NOT NULL AND v_uid IS NOT NULL AND d.created_by = v_uid),
+    count(*) OVER ()
+  FROM _visible_documents(v_uid, v_is_admin) d
+  LEFT JOIN document_types dt ON dt.id = d.type_id
+  WHERE (p_tag IS NULL OR EXISTS (
+          SELECT 1 FROM document_tags x JOIN tags tg ON tg.id = x.tag_id
+          WHERE x.document_id = d.id AND tg.name = p_tag::citext))
+    AND (p_author IS NULL OR d.author ILIKE '%' || _like_escape(p_author) || '%')
+    AND (v_type_id IS NULL OR d.type_id = v_type_id)
+    AND (p_date_from IS NULL OR d.document_date >= p_date_from)
+    AND (p_date_to IS NULL OR d.document_date <= p_date_to)
+  ORDER BY
+    CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(d.title) END ASC,
+    CASE WHEN v_sort = 'title' AND v_desc THEN lower(d.title) END DESC,
+    CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN d.created_at END ASC,
+    CASE WHEN v_sort = 'created_at' AND v_desc THEN d.created_at END DESC,
+    CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(d.updated_at, d.created_at) END ASC,
+    CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(d.updated_at, d.created_at) END DESC,
+    CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN d.document_date END ASC NULLS LAST,
+    CASE WHEN v_sort = 'document_date' AND v_desc THEN d.document_date END DESC NULLS LAST,
+    d.id DESC
+  LIMIT p_limit OFFSET GREATEST(coalesce(p_offset, 0), 0);
+END;
+$$;
+
+CREATE INDEX IF NOT EXISTS documents_updated_at_idx ON documents (COALESCE(updated_at, created_at));
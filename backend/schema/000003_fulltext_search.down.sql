@@ -0,0 +1,12 @@
+DROP FUNCTION IF EXISTS fn_search_documents(INT, TEXT, TEXT, TEXT, TEXT, DATE, DATE, TEXT, BOOLEAN, INT, INT);
+DROP FUNCTION IF EXISTS fn_set_document_file_text(INT, INT, TEXT);
+DROP TRIGGER IF EXISTS trg_tags_refresh_search ON tags;
+DROP TRIGGER IF EXISTS trg_document_tags_refresh_search ON document_tags;
+DROP TRIGGER IF EXISTS trg_documents_refresh_search ON documents;
+DROP FUNCTION IF EXISTS trg_tags_refresh_search();
+DROP FUNCTION IF EXISTS trg_document_tags_refresh_search();
+DROP FUNCTION IF EXISTS trg_documents_refresh_search();
+DROP FUNCTION IF EXISTS _refresh_document_search(INT);
+DROP FUNCTION IF EXISTS _document_tsquery(TEXT);
+DROP FUNCTION IF EXISTS _document_tsv(TEXT, TEXT, TEXT, TEXT);
+DROP TABLE IF EXISTS document_search;
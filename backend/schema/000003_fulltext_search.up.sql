@@ -0,0 +1,239 @@
+-- === Полнотекстовый поиск: title > author > tags > извлечённый текст файла ===
+
+-- Поисковый индекс хранится отдельно от documents: tsvector и извлечённый текст
+-- бывают большими, и им не место в to_jsonb(NEW) триггера fn_log_changes.
+CREATE TABLE IF NOT EXISTS document_search (
+  document_id INTEGER PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+  file_text TEXT,
+  tsv tsvector NOT NULL DEFAULT ''::tsvector,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS document_search_tsv_idx ON document_search USING gin (tsv);
+
+-- Каждое поле индексируется русским и английским словарями; вес задаёт приоритет при ранжировании.
+CREATE OR REPLACE FUNCTION _document_tsv(p_title TEXT, p_author TEXT, p_tags TEXT, p_file_text TEXT) RETURNS tsvector
+LANGUAGE sql IMMUTABLE AS $$
+  SELECT
+    setweight(to_tsvector('russian', coalesce(p_title, '')) || to_tsvector('english', coalesce(p_title, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(p_author, '')) || to_tsvector('english', coalesce(p_author, '')), 'B') ||
+    setweight(to_tsvector('russian', coalesce(p_tags, '')) || to_tsvector('english', coalesce(p_tags, '')), 'C') ||
+    setweight(to_tsvector('russian', coalesce(p_file_text, '')) || to_tsvector('english', coalesce(p_file_text, '')), 'D')
+$$;
+
+CREATE OR REPLACE FUNCTION _document_tsquery(p_query TEXT) RETURNS tsquery
+LANGUAGE sql IMMUTABLE AS $$
+  SELECT websearch_to_tsquery('russian', p_query) || websearch_to_tsquery('english', p_query)
+$$;
+
+CREATE OR REPLACE FUNCTION _refresh_document_search(p_document_id INT) RETURNS VOID LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO document_search AS s (document_id, file_text, tsv, updated_at)
+  SELECT d.id, ex.file_text, _document_tsv(d.title, d.author::TEXT, tg.names, ex.file_text), now()
+  FROM documents d
+  LEFT JOIN document_search ex ON ex.document_id = d.id
+  CROSS JOIN LATERAL (
+    SELECT string_agg(t.name::TEXT, ' ') AS names
+    FROM document_tags x JOIN tags t ON t.id = x.tag_id
+    WHERE x.document_id = d.id
+  ) tg
+  WHERE d.id = p_document_id
+  ON CONFLICT (document_id) DO UPDATE SET tsv = EXCLUDED.tsv, updated_at = now();
+END; $$;
+
+CREATE OR REPLACE FUNCTION trg_documents_refresh_search() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _refresh_document_search(NEW.id);
+  RETURN NEW;
+END; $$;
+
+DROP TRIGGER IF EXISTS trg_documents_refresh_search ON documents;
+CREATE TRIGGER trg_documents_refresh_search AFTER INSERT OR UPDATE OF title, author ON documents
+  FOR EACH ROW EXECUTE FUNCTION trg_documents_refresh_search();
+
+CREATE OR REPLACE FUNCTION trg_document_tags_refresh_search() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    PERFORM _refresh_document_search(OLD.document_id);
+    RETURN OLD;
+  END IF;
+  PERFORM _refresh_document_search(NEW.document_id);
+  RETURN NEW;
+END; $$;
+
+DROP TRIGGER IF EXISTS trg_document_tags_refresh_search ON document_tags;
+CREATE TRIGGER trg_document_tags_refresh_search AFTER INSERT OR DELETE ON document_tags
+  FOR EACH ROW EXECUTE FUNCTION trg_document_tags_refresh_search();
+
+CREATE OR REPLACE FUNCTION trg_tags_refresh_search() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+DECLARE v_doc INT;
+BEGIN
+  FOR v_doc IN SELECT x.document_id FROM document_tags x WHERE x.tag_id = NEW.id LOOP
+    PERFORM _refresh_document_search(v_doc);
+  END LOOP;
+  RETURN NEW;
+END; $$;
+
+DROP TRIGGER IF EXISTS trg_tags_refresh_search ON tags;
+CREATE TRIGGER trg_tags_refresh_search AFTER UPDATE OF name ON tags
+  FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name) EXECUTE FUNCTION trg_tags_refresh_search();
+
+-- Текст, извлечённый из файла (OCR, pdftotext и т.п.). NULL очищает текст.
+CREATE OR REPLACE FUNCTION fn_set_document_file_text(p_document_id INT, p_user_id INT, p_text TEXT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT EXISTS (SELECT 1 FROM documents WHERE id = p_document_id) THEN
+    RAISE EXCEPTION 'Document % does not exist', p_document_id;
+  END IF;
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN RAISE EXCEPTION 'No permission'; END IF;
+
+  INSERT INTO document_search (document_id, file_text) VALUES (p_document_id, p_text)
+  ON CONFLICT (document_id) DO UPDATE SET file_text = EXCLUDED.file_text;
+  PERFORM _refresh_document_search(p_document_id);
+END; $$;
+
+-- заполняем индекс для уже существующих документов
+SELECT _refresh_document_search(d.id) FROM documents d;
+
+-- === fn_search_documents: добавлен полнотекстовый запрос p_query ===
+DROP FUNCTION IF EXISTS fn_search_documents(INT, TEXT, TEXT, TEXT, DATE, DATE, TEXT, BOOLEAN, INT, INT);
+
+-- rank/headline заполняются только при непустом p_query; sort = 'relevance' сортирует по rank.
+CREATE OR REPLACE FUNCTION fn_search_documents(
+  p_requester_id INT,
+  p_query TEXT,
+  p_tag TEXT,
+  p_author TEXT,
+  p_type TEXT,
+  p_date_from DATE,
+  p_date_to DATE,
+  p_sort TEXT,
+  p_desc BOOLEAN,
+  p_limit INT,
+  p_offset INT
+)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  type_name citext,
+  tags TEXT[],
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN,
+  rank REAL,
+  headline TEXT,
+  total_count BIGINT
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_is_admin BOOLEAN := is_user_admin(p_requester_id);
+  v_sort TEXT := lower(coalesce(nullif(btrim(p_sort), ''), 'created_at'));
+  v_desc BOOLEAN := coalesce(p_desc, TRUE);
+  v_type_id INT;
+  v_query tsquery;
+BEGIN
+  IF v_sort NOT IN ('created_at', 'updated_at', 'document_date', 'title', 'relevance') THEN
+    RAISE EXCEPTION 'unsupported sort field %', p_sort;
+  END IF;
+  IF p_limit IS NULL OR p_limit <= 0 THEN RAISE EXCEPTION 'p_limit must be positive'; END IF;
+
+  IF p_query IS NOT NULL AND btrim(p_query) <> '' THEN
+    v_query := _document_tsquery(p_query);
+    -- запрос только из стоп-слов: совпадений быть не может
+    IF numnode(v_query) = 0 THEN RETURN; END IF;
+  ELSIF v_sort = 'relevance' THEN
+    RAISE EXCEPTION 'sort by relevance requires a query';
+  END IF;
+
+  -- тип можно передать как id или как имя
+  IF p_type ~ '^\d+$' THEN
+    v_type_id := p_type::INT;
+  ELSIF p_type IS NOT NULL THEN
+    SELECT t.id INTO v_type_id FROM document_types t WHERE t.name = p_type::citext;
+    IF v_type_id IS NULL THEN RETURN; END IF;
+  END IF;
+
+  RETURN QUERY
+  WITH page AS (
+    SELECT
+      d.*,
+      CASE WHEN v_query IS NOT NULL THEN ts_rank(s.tsv, v_query) END AS rnk,
+      s.file_text AS ftext,
+      count(*) OVER () AS total
+    FROM _visible_documents(v_uid, v_is_admin) d
+    LEFT JOIN document_search s ON s.document_id = d.id
+    WHERE (v_query IS NULL OR s.tsv @@ v_query)
+      AND (p_tag IS NULL OR EXISTS (
+            SELECT 1 FROM document_tags x JOIN tags tg ON tg.id = x.tag_id
+            WHERE x.document_id = d.id AND tg.name = p_tag::citext))
+      AND (p_author IS NULL OR d.author ILIKE '%' || _like_escape(p_author) || '%')
+      AND (v_type_id IS NULL OR d.type_id = v_type_id)
+      AND (p_date_from IS NULL OR d.document_date >= p_date_from)
+      AND (p_date_to IS NULL OR d.document_date <= p_date_to)
+    ORDER BY
+      CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN ts_rank(s.tsv, v_query) END ASC,
+      CASE WHEN v_sort = 'relevance' AND v_desc THEN ts_rank(s.tsv, v_query) END DESC,
+      CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(d.title) END ASC,
+      CASE WHEN v_sort = 'title' AND v_desc THEN lower(d.title) END DESC,
+      CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN d.created_at END ASC,
+      CASE WHEN v_sort = 'created_at' AND v_desc THEN d.created_at END DESC,
+      CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(d.updated_at, d.created_at) END ASC,
+      CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(d.updated_at, d.created_at) END DESC,
+      CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN d.document_date END ASC NULLS LAST,
+      CASE WHEN v_sort = 'document_date' AND v_desc THEN d.document_date END DESC NULLS LAST,
+      d.id DESC
+    LIMIT p_limit OFFSET GREATEST(coalesce(p_offset, 0), 0)
+  )
+  -- ts_headline дорогой, поэтому считается только для строк текущей страницы
+  SELECT
+    p.id,
+    p.title,
+    p.privacy,
+    p.created_at,
+    p.created_by,
+    p.updated_at,
+    p.updated_by,
+    p.document_date,
+    p.author,
+    p.type_id,
+    dt.name,
+    ARRAY(SELECT tg.name::TEXT FROM document_tags x JOIN tags tg ON tg.id = x.tag_id WHERE x.document_id = p.id ORDER BY tg.name),
+    p.geojson,
+    (v_is_admin
+      OR (v_uid IS NOT NULL AND p.created_by = v_uid)
+      OR (v_uid IS NOT NULL AND EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = p.id AND dp.user_id = v_uid AND dp.can_edit))),
+    (p.created_by IS NOT NULL AND v_uid IS NOT NULL AND p.created_by = v_uid),
+    p.rnk,
+    CASE WHEN v_query IS NOT NULL THEN
+      ts_headline('russian', concat_ws(' … ', p.title, p.author::TEXT, p.ftext), v_query,
+                  'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=25, MinWords=8')
+    END,
+    p.total
+  FROM page p
+  LEFT JOIN document_types dt ON dt.id = p.type_id
+  ORDER BY
+    CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN p.rnk END ASC,
+    CASE WHEN v_sort = 'relevance' AND v_desc THEN p.rnk END DESC,
+    CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(p.title) END ASC,
+    CASE WHEN v_sort = 'title' AND v_desc THEN lower(p.title) END DESC,
+    CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN p.created_at END ASC,
+    CASE WHEN v_sort = 'created_at' AND v_desc THEN p.created_at END DESC,
+    CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(p.updated_at, p.created_at) END ASC,
+    CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(p.updated_at, p.created_at) END DESC,
+    CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN p.document_date END ASC NULLS LAST,
+    CASE WHEN v_sort = 'document_date' AND v_desc THEN p.document_date END DESC NULLS LAST,
+    p.id DESC;
+END;
+$$;
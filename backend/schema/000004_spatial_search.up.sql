@@ -0,0 +1,207 @@
+-- === Пространственный поиск по documents.geom ===
+
+-- ST_DWithin/ST_Distance по geography (метры) используют этот индекс
+CREATE INDEX IF NOT EXISTS documents_geog_gist ON documents USING GIST ((geom::geography));
+
+-- Область поиска из GeoJSON (Polygon/MultiPolygon) с SRID 4326
+CREATE OR REPLACE FUNCTION _search_area_from_geojson(p_geojson JSONB) RETURNS geometry
+LANGUAGE plpgsql IMMUTABLE AS $$
+DECLARE g geometry;
+BEGIN
+  IF p_geojson IS NULL THEN RETURN NULL; END IF;
+  BEGIN
+    g := ST_SetSRID(ST_GeomFromGeoJSON(p_geojson::TEXT), 4326);
+  EXCEPTION WHEN OTHERS THEN
+    RAISE EXCEPTION 'invalid search geometry: %', SQLERRM;
+  END;
+  IF GeometryType(g) NOT IN ('POLYGON', 'MULTIPOLYGON') THEN
+    RAISE EXCEPTION 'search geometry must be Polygon or MultiPolygon, got %', GeometryType(g);
+  END IF;
+  IF NOT ST_IsValid(g) THEN g := ST_MakeValid(g); END IF;
+  RETURN g;
+END; $$;
+
+-- === fn_search_documents: добавлены bbox, область (intersects/within) и точка с радиусом ===
+DROP FUNCTION IF EXISTS fn_search_documents(INT, TEXT, TEXT, TEXT, TEXT, DATE, DATE, TEXT, BOOLEAN, INT, INT);
+
+-- p_bbox = {min_lon, min_lat, max_lon, max_lat}; p_area — GeoJSON полигон, p_relation = intersects|within;
+-- p_near_lon/p_near_lat — точка: distance_m заполняется расстоянием до неё, p_radius_m ограничивает выборку.
+-- rank/headline заполняются только при непустом p_query; sort = 'relevance' сортирует по rank, 'distance' — по distance_m.
+CREATE OR REPLACE FUNCTION fn_search_documents(
+  p_requester_id INT,
+  p_query TEXT,
+  p_tag TEXT,
+  p_author TEXT,
+  p_type TEXT,
+  p_date_from DATE,
+  p_date_to DATE,
+  p_bbox DOUBLE PRECISION[],
+  p_area JSONB,
+  p_relation TEXT,
+  p_near_lon DOUBLE PRECISION,
+  p_near_lat DOUBLE PRECISION,
+  p_radius_m DOUBLE PRECISION,
+  p_sort TEXT,
+  p_desc BOOLEAN,
+  p_limit INT,
+  p_offset INT
+)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  type_name citext,
+  tags TEXT[],
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN,
+  rank REAL,
+  headline TEXT,
+  distance_m DOUBLE PRECISION,
+  total_count BIGINT
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_is_admin BOOLEAN := is_user_admin(p_requester_id);
+  v_sort TEXT := lower(coalesce(nullif(btrim(p_sort), ''), 'created_at'));
+  v_desc BOOLEAN := coalesce(p_desc, TRUE);
+  v_type_id INT;
+  v_query tsquery;
+  v_bbox geometry;
+  v_area geometry;
+  v_relation TEXT := lower(coalesce(nullif(btrim(p_relation), ''), 'intersects'));
+  v_point geography;
+BEGIN
+  IF v_sort NOT IN ('created_at', 'updated_at', 'document_date', 'title', 'relevance', 'distance') THEN
+    RAISE EXCEPTION 'unsupported sort field %', p_sort;
+  END IF;
+  IF p_limit IS NULL OR p_limit <= 0 THEN RAISE EXCEPTION 'p_limit must be positive'; END IF;
+
+  IF p_query IS NOT NULL AND btrim(p_query) <> '' THEN
+    v_query := _document_tsquery(p_query);
+    -- запрос только из стоп-слов: совпадений быть не может
+    IF numnode(v_query) = 0 THEN RETURN; END IF;
+  ELSIF v_sort = 'relevance' THEN
+    RAISE EXCEPTION 'sort by relevance requires a query';
+  END IF;
+
+  IF p_bbox IS NOT NULL THEN
+    IF array_length(p_bbox, 1) IS DISTINCT FROM 4 THEN RAISE EXCEPTION 'p_bbox must have 4 elements'; END IF;
+    v_bbox := ST_MakeEnvelope(p_bbox[1], p_bbox[2], p_bbox[3], p_bbox[4], 4326);
+  END IF;
+
+  IF p_area IS NOT NULL THEN
+    IF v_relation NOT IN ('intersects', 'within') THEN RAISE EXCEPTION 'unsupported relation %', p_relation; END IF;
+    v_area := _search_area_from_geojson(p_area);
+  END IF;
+
+  IF p_near_lon IS NOT NULL AND p_near_lat IS NOT NULL THEN
+    v_point := ST_SetSRID(ST_MakePoint(p_near_lon, p_near_lat), 4326)::geography;
+  ELSIF p_radius_m IS NOT NULL THEN
+    RAISE EXCEPTION 'p_radius_m requires a point';
+  END IF;
+  IF v_sort = 'distance' AND v_point IS NULL THEN
+    RAISE EXCEPTION 'sort by distance requires a point';
+  END IF;
+
+  -- тип можно передать как id или как имя
+  IF p_type ~ '^\d+$' THEN
+    v_type_id := p_type::INT;
+  ELSIF p_type IS NOT NULL THEN
+    SELECT t.id INTO v_type_id FROM document_types t WHERE t.name = p_type::citext;
+    IF v_type_id IS NULL THEN RETURN; END IF;
+  END IF;
+
+  RETURN QUERY
+  WITH page AS (
+    SELECT
+      d.*,
+      CASE WHEN v_query IS NOT NULL THEN ts_rank(s.tsv, v_query) END AS rnk,
+      s.file_text AS ftext,
+      CASE WHEN v_point IS NOT NULL THEN ST_Distance(d.geom::geography, v_point) END AS dist,
+      count(*) OVER () AS total
+    FROM _visible_documents(v_uid, v_is_admin) d
+    LEFT JOIN document_search s ON s.document_id = d.id
+    WHERE (v_query IS NULL OR s.tsv @@ v_query)
+      AND (p_tag IS NULL OR EXISTS (
+            SELECT 1 FROM document_tags x JOIN tags tg ON tg.id = x.tag_id
+            WHERE x.document_id = d.id AND tg.name = p_tag::citext))
+      AND (p_author IS NULL OR d.author ILIKE '%' || _like_escape(p_author) || '%')
+      AND (v_type_id IS NULL OR d.type_id = v_type_id)
+      AND (p_date_from IS NULL OR d.document_date >= p_date_from)
+      AND (p_date_to IS NULL OR d.document_date <= p_date_to)
+      AND (v_bbox IS NULL OR (d.geom && v_bbox AND ST_Intersects(d.geom, v_bbox)))
+      AND (v_area IS NULL OR (v_relation = 'intersects' AND ST_Intersects(d.geom, v_area))
+                          OR (v_relation = 'within' AND ST_Within(d.geom, v_area)))
+      AND (v_point IS NULL OR d.geom IS NOT NULL)
+      AND (p_radius_m IS NULL OR ST_DWithin(d.geom::geography, v_point, p_radius_m))
+    ORDER BY
+      CASE WHEN v_sort = 'distance' AND NOT v_desc THEN d.geom::geography <-> v_point END ASC,
+      CASE WHEN v_sort = 'distance' AND v_desc THEN d.geom::geography <-> v_point END DESC,
+      CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN ts_rank(s.tsv, v_query) END ASC,
+      CASE WHEN v_sort = 'relevance' AND v_desc THEN ts_rank(s.tsv, v_query) END DESC,
+      CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(d.title) END ASC,
+      CASE WHEN v_sort = 'title' AND v_desc THEN lower(d.title) END DESC,
+      CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN d.created_at END ASC,
+      CASE WHEN v_sort = 'created_at' AND v_desc THEN d.created_at END DESC,
+      CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(d.updated_at, d.created_at) END ASC,
+      CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(d.updated_at, d.created_at) END DESC,
+      CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN d.document_date END ASC NULLS LAST,
+      CASE WHEN v_sort = 'document_date' AND v_desc THEN d.document_date END DESC NULLS LAST,
+      d.id DESC
+    LIMIT p_limit OFFSET GREATEST(coalesce(p_offset, 0), 0)
+  )
+  -- ts_headline дорогой, поэтому считается только для строк текущей страницы
+  SELECT
+    p.id,
+    p.title,
+    p.privacy,
+    p.created_at,
+    p.created_by,
+    p.updated_at,
+    p.updated_by,
+    p.document_date,
+    p.author,
+    p.type_id,
+    dt.name,
+    ARRAY(SELECT tg.name::TEXT FROM document_tags x JOIN tags tg ON tg.id = x.tag_id WHERE x.document_id = p.id ORDER BY tg.name),
+    p.geojson,
+    (v_is_admin
+      OR (v_uid IS NOT NULL AND p.created_by = v_uid)
+      OR (v_uid IS NOT NULL AND EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = p.id AND dp.user_id = v_uid AND dp.can_edit))),
+    (p.created_by IS NOT NULL AND v_uid IS NOT NULL AND p.created_by = v_uid),
+    p.rnk,
+    CASE WHEN v_query IS NOT NULL THEN
+      ts_headline('russian', concat_ws(' … ', p.title, p.author::TEXT, p.ftext), v_query,
+                  'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=25, MinWords=8')
+    END,
+    p.dist,
+    p.total
+  FROM page p
+  LEFT JOIN document_types dt ON dt.id = p.type_id
+  ORDER BY
+    CASE WHEN v_sort = 'distance' AND NOT v_desc THEN p.dist END ASC,
+    CASE WHEN v_sort = 'distance' AND v_desc THEN p.dist END DESC,
+    CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN p.rnk END ASC,
+    CASE WHEN v_sort = 'relevance' AND v_desc THEN p.rnk END DESC,
+    CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(p.title) END ASC,
+    CASE WHEN v_sort = 'title' AND v_desc THEN lower(p.title) END DESC,
+    CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN p.created_at END ASC,
+    CASE WHEN v_sort = 'created_at' AND v_desc THEN p.created_at END DESC,
+    CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(p.updated_at, p.created_at) END ASC,
+    CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(p.updated_at, p.created_at) END DESC,
+    CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN p.document_date END ASC NULLS LAST,
+    CASE WHEN v_sort = 'document_date' AND v_desc THEN p.document_date END DESC NULLS LAST,
+    p.id DESC;
+END;
+$$;
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS fn_get_documents_tile(INT, INT, INT, INT, BOOLEAN);
+DROP INDEX IF EXISTS documents_geom_3857_gist;
@@ -0,0 +1,73 @@
+-- === Векторные тайлы (MVT) слоя документов ===
+
+-- ST_AsMVTGeom работает в EPSG:3857; индекс по трансформированной геометрии
+-- позволяет отбирать документы тайла без пересчёта проекции для каждой строки.
+CREATE INDEX IF NOT EXISTS documents_geom_3857_gist ON documents USING GIST (ST_Transform(geom, 3857));
+
+-- Тайл z/x/y слоя "documents". Видимость — как в _can_user_view_document (через _visible_documents).
+-- p_cluster: документы группируются по сетке 64x64 ячейки на тайл; у кластера cluster = true
+-- и point_count, у одиночного документа — id, title, type_id, privacy.
+CREATE OR REPLACE FUNCTION fn_get_documents_tile(p_requester_id INT, p_z INT, p_x INT, p_y INT, p_cluster BOOLEAN)
+RETURNS BYTEA
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  v_is_admin BOOLEAN := is_user_admin(p_requester_id);
+  v_bounds geometry;
+  v_cell DOUBLE PRECISION;
+  v_tile BYTEA;
+BEGIN
+  IF p_z < 0 OR p_z > 24 THEN RAISE EXCEPTION 'invalid zoom %', p_z; END IF;
+  IF p_x < 0 OR p_y < 0 OR p_x >= (1 << p_z) OR p_y >= (1 << p_z) THEN
+    RAISE EXCEPTION 'tile %/%/% out of range', p_z, p_x, p_y;
+  END IF;
+
+  v_bounds := ST_TileEnvelope(p_z, p_x, p_y);
+
+  IF NOT coalesce(p_cluster, FALSE) THEN
+    SELECT ST_AsMVT(t, 'documents', 4096, 'geom') INTO v_tile
+    FROM (
+      SELECT
+        d.id,
+        d.title,
+        d.type_id,
+        d.privacy::TEXT AS privacy,
+        ST_AsMVTGeom(ST_Transform(d.geom, 3857), v_bounds, 4096, 64, TRUE) AS geom
+      FROM _visible_documents(p_requester_id, v_is_admin) d
+      WHERE d.geom IS NOT NULL
+        AND ST_Transform(d.geom, 3857) && ST_Expand(v_bounds, (ST_XMax(v_bounds) - ST_XMin(v_bounds)) * 64 / 4096)
+    ) t
+    WHERE t.geom IS NOT NULL;
+    RETURN v_tile;
+  END IF;
+
+  v_cell := (ST_XMax(v_bounds) - ST_XMin(v_bounds)) / 64;
+
+  SELECT ST_AsMVT(t, 'documents', 4096, 'geom') INTO v_tile
+  FROM (
+    SELECT
+      (count(*) > 1) AS cluster,
+      count(*)::INT AS point_count,
+      CASE WHEN count(*) = 1 THEN min(c.id) END AS id,
+      CASE WHEN count(*) = 1 THEN min(c.title) END AS title,
+      CASE WHEN count(*) = 1 THEN min(c.type_id) END AS type_id,
+      CASE WHEN count(*) = 1 THEN min(c.privacy) END AS privacy,
+      ST_AsMVTGeom(ST_Centroid(ST_Collect(c.pt)), v_bounds, 4096, 64, TRUE) AS geom
+    FROM (
+      SELECT
+        d.id,
+        d.title,
+        d.type_id,
+        d.privacy::TEXT AS privacy,
+        ST_Transform(ST_PointOnSurface(d.geom), 3857) AS pt
+      FROM _visible_documents(p_requester_id, v_is_admin) d
+      WHERE d.geom IS NOT NULL
+        AND ST_Transform(d.geom, 3857) && v_bounds
+    ) c
+    GROUP BY ST_SnapToGrid(c.pt, v_cell)
+  ) t
+  WHERE t.geom IS NOT NULL;
+  RETURN v_tile;
+END;
+$$;
@@ -0,0 +1,69 @@
+DROP FUNCTION IF EXISTS fn_change_user_password(INT, INT, TEXT);
+DROP FUNCTION IF EXISTS fn_rehash_user_password(INT, TEXT, TEXT);
+DROP FUNCTION IF EXISTS fn_get_user_password_hash(INT);
+DROP FUNCTION IF EXISTS fn_authorize_user(TEXT);
+
+-- восстановление определений из 000001; хеши Argon2id, записанные после 000006,
+-- прежней функцией не проверяются — таким пользователям пароль нужно задать заново
+CREATE OR REPLACE FUNCTION fn_authorize_user(p_login TEXT, p_password TEXT)
+RETURNS TABLE (id INT, login citext, full_name TEXT, role_name TEXT) SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.id, u.login, u.full_name, r.name
+  FROM users u JOIN roles r ON r.id = u.role_id
+  WHERE u.login = p_login::citext AND u.password_hash = p_password;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_change_user_password(
+  p_requester_id INT,
+  p_target_user_id INT,
+  p_old_password TEXT,
+  p_new_password TEXT
+)
+RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_is_admin BOOLEAN := FALSE;
+  v_current TEXT;
+BEGIN
+  IF p_requester_id IS NULL THEN
+    RAISE EXCEPTION 'p_requester_id is required';
+  END IF;
+  IF p_target_user_id IS NULL THEN
+    RAISE EXCEPTION 'p_target_user_id is required';
+  END IF;
+  IF p_new_password IS NULL OR btrim(p_new_password) = '' THEN
+    RAISE EXCEPTION 'p_new_password is required and must not be blank';
+  END IF;
+
+  v_is_admin := is_user_admin(p_requester_id);
+
+  -- admin changing other's password: allowed without old password
+  IF v_is_admin AND p_requester_id <> p_target_user_id THEN
+    UPDATE users SET password_hash = p_new_password WHERE id = p_target_user_id;
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'user % not found', p_target_user_id;
+    END IF;
+    RETURN;
+  END IF;
+
+  -- otherwise (self-change or admin changing own password) require old password match
+  SELECT password_hash INTO v_current FROM users WHERE id = p_target_user_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'user % not found', p_target_user_id;
+  END IF;
+
+  IF v_current IS NULL THEN
+    RAISE EXCEPTION 'current password missing for user %', p_target_user_id;
+  END IF;
+
+  -- verify old password: must match stored string (same logic as existing fn_authorize_user)
+  IF v_current <> COALESCE(p_old_password,'') THEN
+    RAISE EXCEPTION 'old password does not match';
+  END IF;
+
+  UPDATE users SET password_hash = p_new_password WHERE id = p_target_user_id;
+END;
+$$;
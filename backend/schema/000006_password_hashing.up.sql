@@ -0,0 +1,68 @@
+-- === Проверка пароля перенесена в приложение (Argon2id, PHC-формат в password_hash) ===
+
+-- fn_authorize_user больше не сравнивает пароли: возвращает хеш, проверку делает сервис.
+DROP FUNCTION IF EXISTS fn_authorize_user(TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION fn_authorize_user(p_login TEXT)
+RETURNS TABLE (id INT, login citext, full_name TEXT, role_name TEXT, password_hash TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.id, u.login, u.full_name, r.name, u.password_hash
+  FROM users u JOIN roles r ON r.id = u.role_id
+  WHERE u.login = p_login::citext;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_user_password_hash(p_user_id INT) RETURNS TEXT
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_hash TEXT;
+BEGIN
+  SELECT u.password_hash INTO v_hash FROM users u WHERE u.id = p_user_id;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_user_id; END IF;
+  RETURN v_hash;
+END; $$;
+
+-- Перехеширование при входе (устаревший формат или параметры). p_old_hash защищает
+-- от гонки с одновременной сменой пароля: запись обновляется, только если хеш не менялся.
+CREATE OR REPLACE FUNCTION fn_rehash_user_password(p_user_id INT, p_old_hash TEXT, p_new_hash TEXT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_new_hash IS NULL OR btrim(p_new_hash) = '' THEN RAISE EXCEPTION 'p_new_hash is required'; END IF;
+  UPDATE users SET password_hash = p_new_hash WHERE id = p_user_id AND password_hash = p_old_hash;
+  RETURN FOUND;
+END; $$;
+
+-- Смена пароля: старый пароль проверяет сервис (при смене собственного пароля),
+-- здесь остаётся только проверка прав — сам пользователь или администратор.
+DROP FUNCTION IF EXISTS fn_change_user_password(INT, INT, TEXT, TEXT);
+
+CREATE OR REPLACE FUNCTION fn_change_user_password(
+  p_requester_id INT,
+  p_target_user_id INT,
+  p_new_password_hash TEXT
+)
+RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_requester_id IS NULL THEN
+    RAISE EXCEPTION 'p_requester_id is required';
+  END IF;
+  IF p_target_user_id IS NULL THEN
+    RAISE EXCEPTION 'p_target_user_id is required';
+  END IF;
+  IF p_new_password_hash IS NULL OR btrim(p_new_password_hash) = '' THEN
+    RAISE EXCEPTION 'p_new_password_hash is required and must not be blank';
+  END IF;
+
+  IF p_requester_id <> p_target_user_id AND NOT is_user_admin(p_requester_id) THEN
+    RAISE EXCEPTION 'only administrator or the user themself may change password';
+  END IF;
+
+  UPDATE users SET password_hash = p_new_password_hash WHERE id = p_target_user_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'user % not found', p_target_user_id;
+  END IF;
+END;
+$$;
@@ -0,0 +1,7 @@
+DROP FUNCTION IF EXISTS fn_get_user_tokens_revoked_at(INT);
+DROP FUNCTION IF EXISTS fn_revoke_user_tokens(INT);
+DROP FUNCTION IF EXISTS fn_revoke_refresh_token(TEXT);
+DROP FUNCTION IF EXISTS fn_rotate_refresh_token(TEXT, TEXT, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS fn_create_refresh_token(INT, TEXT, TEXT, TIMESTAMPTZ);
+DROP TABLE IF EXISTS refresh_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_revoked_at;
@@ -0,0 +1,126 @@
+-- === Refresh-токены: хранение хешей, одноразовая ротация, отзыв ===
+
+-- Access-токены (JWT) с iat не позже этой отметки считаются отозванными («выйти везде»).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMPTZ;
+
+-- Хранится только sha256 от токена. Все токены, полученные ротацией из одного входа,
+-- образуют семейство (family_id); повторное использование уже обменянного токена
+-- означает утечку — отзывается всё семейство.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  family_id TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  replaced_by BIGINT REFERENCES refresh_tokens(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens (user_id);
+
+CREATE OR REPLACE FUNCTION fn_create_refresh_token(
+  p_user_id INT,
+  p_family_id TEXT,
+  p_token_hash TEXT,
+  p_expires_at TIMESTAMPTZ
+) RETURNS BIGINT
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_id BIGINT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_family_id IS NULL OR p_token_hash IS NULL THEN RAISE EXCEPTION 'p_family_id and p_token_hash are required'; END IF;
+  IF p_expires_at IS NULL OR p_expires_at <= now() THEN RAISE EXCEPTION 'p_expires_at must be in the future'; END IF;
+
+  INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+  VALUES (p_user_id, p_family_id, p_token_hash, p_expires_at)
+  RETURNING id INTO v_id;
+  RETURN v_id;
+END; $$;
+
+-- Обмен refresh-токена на новый того же семейства. Ошибки не выбрасываются, а
+-- возвращаются статусом: исключение откатило бы отзыв семейства при повторном использовании.
+--   ok       — старый токен помечен использованным, новый сохранён
+--   invalid  — токен не найден
+--   expired  — срок действия истёк
+--   revoked  — токен или все сессии пользователя отозваны
+--   reused   — токен уже был обменян; семейство отозвано
+CREATE OR REPLACE FUNCTION fn_rotate_refresh_token(
+  p_token_hash TEXT,
+  p_new_token_hash TEXT,
+  p_expires_at TIMESTAMPTZ
+) RETURNS TABLE (user_id INT, status TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_tok refresh_tokens%ROWTYPE;
+  v_revoked_at TIMESTAMPTZ;
+  v_new_id BIGINT;
+BEGIN
+  SELECT * INTO v_tok FROM refresh_tokens rt WHERE rt.token_hash = p_token_hash FOR UPDATE;
+  IF NOT FOUND THEN
+    RETURN QUERY SELECT NULL::INT, 'invalid'::TEXT;
+    RETURN;
+  END IF;
+
+  IF v_tok.used_at IS NOT NULL THEN
+    UPDATE refresh_tokens SET revoked_at = now()
+    WHERE family_id = v_tok.family_id AND revoked_at IS NULL;
+    RETURN QUERY SELECT v_tok.user_id, 'reused'::TEXT;
+    RETURN;
+  END IF;
+
+  SELECT u.tokens_revoked_at INTO v_revoked_at FROM users u WHERE u.id = v_tok.user_id;
+  IF v_tok.revoked_at IS NOT NULL OR (v_revoked_at IS NOT NULL AND v_tok.created_at <= v_revoked_at) THEN
+    RETURN QUERY SELECT v_tok.user_id, 'revoked'::TEXT;
+    RETURN;
+  END IF;
+
+  IF v_tok.expires_at <= now() THEN
+    RETURN QUERY SELECT v_tok.user_id, 'expired'::TEXT;
+    RETURN;
+  END IF;
+
+  INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+  VALUES (v_tok.user_id, v_tok.family_id, p_new_token_hash, p_expires_at)
+  RETURNING id INTO v_new_id;
+
+  UPDATE refresh_tokens SET used_at = now(), replaced_by = v_new_id WHERE id = v_tok.id;
+
+  RETURN QUERY SELECT v_tok.user_id, 'ok'::TEXT;
+END; $$;
+
+-- Выход из одной сессии: отзывается семейство, к которому принадлежит токен.
+-- Возвращает FALSE, если токен не найден.
+CREATE OR REPLACE FUNCTION fn_revoke_refresh_token(p_token_hash TEXT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_family TEXT;
+BEGIN
+  SELECT rt.family_id INTO v_family FROM refresh_tokens rt WHERE rt.token_hash = p_token_hash;
+  IF NOT FOUND THEN RETURN FALSE; END IF;
+
+  UPDATE refresh_tokens SET revoked_at = now()
+  WHERE family_id = v_family AND revoked_at IS NULL;
+  RETURN TRUE;
+END; $$;
+
+-- Выход из всех сессий: отзываются все refresh-токены и access-токены, выданные до этого момента.
+CREATE OR REPLACE FUNCTION fn_revoke_user_tokens(p_user_id INT) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE users SET tokens_revoked_at = now() WHERE id = p_user_id;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_user_id; END IF;
+
+  UPDATE refresh_tokens SET revoked_at = now()
+  WHERE user_id = p_user_id AND revoked_at IS NULL;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_user_tokens_revoked_at(p_user_id INT) RETURNS TIMESTAMPTZ
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_ts TIMESTAMPTZ;
+BEGIN
+  SELECT u.tokens_revoked_at INTO v_ts FROM users u WHERE u.id = p_user_id;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_user_id; END IF;
+  RETURN v_ts;
+END; $$;
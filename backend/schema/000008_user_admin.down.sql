@@ -0,0 +1,64 @@
+CREATE OR REPLACE FUNCTION fn_change_user_password(
+  p_requester_id INT,
+  p_target_user_id INT,
+  p_new_password_hash TEXT
+)
+RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_requester_id IS NULL THEN
+    RAISE EXCEPTION 'p_requester_id is required';
+  END IF;
+  IF p_target_user_id IS NULL THEN
+    RAISE EXCEPTION 'p_target_user_id is required';
+  END IF;
+  IF p_new_password_hash IS NULL OR btrim(p_new_password_hash) = '' THEN
+    RAISE EXCEPTION 'p_new_password_hash is required and must not be blank';
+  END IF;
+
+  IF p_requester_id <> p_target_user_id AND NOT is_user_admin(p_requester_id) THEN
+    RAISE EXCEPTION 'only administrator or the user themself may change password';
+  END IF;
+
+  UPDATE users SET password_hash = p_new_password_hash WHERE id = p_target_user_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'user % not found', p_target_user_id;
+  END IF;
+END;
+$$;
+
+DROP FUNCTION IF EXISTS fn_admin_reset_user_password(INT, INT, TEXT);
+DROP FUNCTION IF EXISTS fn_admin_set_user_disabled(INT, INT, BOOLEAN);
+DROP FUNCTION IF EXISTS fn_admin_set_user_role(INT, INT, SMALLINT);
+DROP FUNCTION IF EXISTS fn_admin_create_user(INT, TEXT, TEXT, TEXT, SMALLINT);
+DROP FUNCTION IF EXISTS fn_admin_list_users(INT, TEXT, SMALLINT, BOOLEAN, INT, INT);
+
+DROP FUNCTION IF EXISTS fn_get_user_auth_state(INT);
+CREATE OR REPLACE FUNCTION fn_get_user_tokens_revoked_at(p_user_id INT) RETURNS TIMESTAMPTZ
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_ts TIMESTAMPTZ;
+BEGIN
+  SELECT u.tokens_revoked_at INTO v_ts FROM users u WHERE u.id = p_user_id;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_user_id; END IF;
+  RETURN v_ts;
+END; $$;
+
+DROP FUNCTION IF EXISTS fn_authorize_user(TEXT);
+CREATE OR REPLACE FUNCTION fn_authorize_user(p_login TEXT)
+RETURNS TABLE (id INT, login citext, full_name TEXT, role_name TEXT, password_hash TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.id, u.login, u.full_name, r.name, u.password_hash
+  FROM users u JOIN roles r ON r.id = u.role_id
+  WHERE u.login = p_login::citext;
+END; $$;
+
+DROP FUNCTION IF EXISTS _revoke_user_sessions(INT);
+DROP FUNCTION IF EXISTS _require_admin(INT);
+DROP FUNCTION IF EXISTS _log_admin_action(INT, action_type, INT, TEXT, JSONB);
+DROP INDEX IF EXISTS users_role_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS must_change_password;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,239 @@
+-- === Администрирование пользователей: роли, блокировка, принудительная смена пароля ===
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS users_role_idx ON users (role_id);
+
+-- Запись действия администратора в общий журнал logs (table_name = 'users').
+-- В tg_op пишется имя операции, чтобы отличать такие записи от триггерных.
+CREATE OR REPLACE FUNCTION _log_admin_action(
+  p_admin_id INT,
+  p_action action_type,
+  p_target_user_id INT,
+  p_operation TEXT,
+  p_changes JSONB
+) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+  SELECT p_action, 'users', p_target_user_id, p_admin_id, u.login, p_operation,
+         current_setting('app.session_of_user', true), now(), p_changes
+  FROM users u WHERE u.id = p_admin_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION _require_admin(p_admin_id INT) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT is_user_admin(p_admin_id) THEN
+    RAISE EXCEPTION 'only administrator may manage users' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+END; $$;
+
+-- Отзыв всех сессий без проверки прав (вызывается из функций, которые уже проверили права)
+CREATE OR REPLACE FUNCTION _revoke_user_sessions(p_user_id INT) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE users SET tokens_revoked_at = now() WHERE id = p_user_id;
+  UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = p_user_id AND revoked_at IS NULL;
+END; $$;
+
+-- Вход: сервис отказывает заблокированным пользователям после проверки пароля
+DROP FUNCTION IF EXISTS fn_authorize_user(TEXT);
+
+CREATE OR REPLACE FUNCTION fn_authorize_user(p_login TEXT)
+RETURNS TABLE (id INT, login citext, full_name TEXT, role_name TEXT, password_hash TEXT, disabled BOOLEAN, must_change_password BOOLEAN)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.id, u.login, u.full_name, r.name, u.password_hash, u.disabled_at IS NOT NULL, u.must_change_password
+  FROM users u JOIN roles r ON r.id = u.role_id
+  WHERE u.login = p_login::citext;
+END; $$;
+
+-- Состояние пользователя для проверки access-токена на каждом запросе
+DROP FUNCTION IF EXISTS fn_get_user_tokens_revoked_at(INT);
+
+CREATE OR REPLACE FUNCTION fn_get_user_auth_state(p_user_id INT)
+RETURNS TABLE (tokens_revoked_at TIMESTAMPTZ, disabled BOOLEAN, must_change_password BOOLEAN)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.tokens_revoked_at, u.disabled_at IS NOT NULL, u.must_change_password
+  FROM users u WHERE u.id = p_user_id;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_user_id; END IF;
+END; $$;
+
+-- Список пользователей: поиск по логину/имени, фильтры по роли и блокировке
+CREATE OR REPLACE FUNCTION fn_admin_list_users(
+  p_admin_id INT,
+  p_query TEXT,
+  p_role_id SMALLINT,
+  p_disabled BOOLEAN,
+  p_limit INT,
+  p_offset INT
+)
+RETURNS TABLE (
+  id INT,
+  login citext,
+  full_name TEXT,
+  role_id SMALLINT,
+  role_name TEXT,
+  created_at TIMESTAMPTZ,
+  disabled BOOLEAN,
+  must_change_password BOOLEAN,
+  total_count BIGINT
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_admin(p_admin_id);
+  IF p_limit IS NULL OR p_limit <= 0 THEN RAISE EXCEPTION 'p_limit must be positive' USING ERRCODE = 'invalid_parameter_value'; END IF;
+
+  RETURN QUERY
+  SELECT u.id, u.login, u.full_name, u.role_id, r.name, u.created_at,
+         u.disabled_at IS NOT NULL, u.must_change_password,
+         count(*) OVER ()
+  FROM users u JOIN roles r ON r.id = u.role_id
+  WHERE (p_query IS NULL
+         OR u.login::TEXT ILIKE '%' || _like_escape(p_query) || '%'
+         OR u.full_name ILIKE '%' || _like_escape(p_query) || '%')
+    AND (p_role_id IS NULL OR u.role_id = p_role_id)
+    AND (p_disabled IS NULL OR (u.disabled_at IS NOT NULL) = p_disabled)
+  ORDER BY u.login
+  LIMIT p_limit OFFSET GREATEST(coalesce(p_offset, 0), 0);
+END; $$;
+
+-- Создание пользователя администратором (с произвольной ролью)
+CREATE OR REPLACE FUNCTION fn_admin_create_user(
+  p_admin_id INT,
+  p_login TEXT,
+  p_password_hash TEXT,
+  p_full_name TEXT,
+  p_role_id SMALLINT
+) RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_id INT;
+  v_login citext;
+BEGIN
+  PERFORM _require_admin(p_admin_id);
+  IF p_login IS NULL OR btrim(p_login) = '' THEN RAISE EXCEPTION 'p_login is required and must not be blank' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  IF p_password_hash IS NULL OR btrim(p_password_hash) = '' THEN RAISE EXCEPTION 'p_password_hash is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  IF NOT EXISTS (SELECT 1 FROM roles r WHERE r.id = p_role_id) THEN RAISE EXCEPTION 'role % not found', p_role_id USING ERRCODE = 'no_data_found'; END IF;
+
+  v_login := btrim(p_login)::citext;
+  INSERT INTO users (login, password_hash, full_name, role_id, created_at, must_change_password)
+  VALUES (v_login, p_password_hash, nullif(btrim(p_full_name), ''), p_role_id, now(), TRUE)
+  RETURNING users.id INTO v_id;
+
+  PERFORM _log_admin_action(p_admin_id, 'create', v_id, 'admin_create_user',
+    jsonb_build_object('new', jsonb_build_object('login', v_login, 'role_id', p_role_id)));
+  RETURN v_id;
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'User with login % already exists', v_login USING ERRCODE = 'unique_violation';
+END; $$;
+
+-- Смена роли. Нельзя понизить последнего активного администратора.
+CREATE OR REPLACE FUNCTION fn_admin_set_user_role(p_admin_id INT, p_target_user_id INT, p_role_id SMALLINT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_old SMALLINT;
+BEGIN
+  PERFORM _require_admin(p_admin_id);
+  IF NOT EXISTS (SELECT 1 FROM roles r WHERE r.id = p_role_id) THEN RAISE EXCEPTION 'role % not found', p_role_id USING ERRCODE = 'no_data_found'; END IF;
+
+  SELECT u.role_id INTO v_old FROM users u WHERE u.id = p_target_user_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_target_user_id USING ERRCODE = 'no_data_found'; END IF;
+  IF v_old = p_role_id THEN RETURN; END IF;
+
+  IF is_user_admin(p_target_user_id) AND NOT EXISTS (
+       SELECT 1 FROM users u JOIN roles r ON r.id = u.role_id
+       WHERE r.name = 'administrator' AND u.disabled_at IS NULL AND u.id <> p_target_user_id) THEN
+    RAISE EXCEPTION 'cannot change role of the last administrator' USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+
+  UPDATE users SET role_id = p_role_id WHERE id = p_target_user_id;
+  PERFORM _log_admin_action(p_admin_id, 'update', p_target_user_id, 'admin_set_role',
+    jsonb_build_object('old', jsonb_build_object('role_id', v_old), 'new', jsonb_build_object('role_id', p_role_id)));
+END; $$;
+
+-- Блокировка/разблокировка. Блокировка сразу отзывает все сессии пользователя.
+CREATE OR REPLACE FUNCTION fn_admin_set_user_disabled(p_admin_id INT, p_target_user_id INT, p_disabled BOOLEAN)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_was BOOLEAN;
+BEGIN
+  PERFORM _require_admin(p_admin_id);
+  IF p_disabled IS NULL THEN RAISE EXCEPTION 'p_disabled is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  IF p_disabled AND p_admin_id = p_target_user_id THEN RAISE EXCEPTION 'administrator cannot disable themself' USING ERRCODE = 'object_not_in_prerequisite_state'; END IF;
+
+  SELECT u.disabled_at IS NOT NULL INTO v_was FROM users u WHERE u.id = p_target_user_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_target_user_id USING ERRCODE = 'no_data_found'; END IF;
+  IF v_was = p_disabled THEN RETURN; END IF;
+
+  UPDATE users SET disabled_at = CASE WHEN p_disabled THEN now() END WHERE id = p_target_user_id;
+  IF p_disabled THEN
+    PERFORM _revoke_user_sessions(p_target_user_id);
+  END IF;
+
+  PERFORM _log_admin_action(p_admin_id, 'update', p_target_user_id,
+    CASE WHEN p_disabled THEN 'admin_disable_user' ELSE 'admin_enable_user' END,
+    jsonb_build_object('old', jsonb_build_object('disabled', v_was), 'new', jsonb_build_object('disabled', p_disabled)));
+END; $$;
+
+-- Принудительный сброс пароля: временный пароль, обязательная смена при входе, отзыв сессий
+CREATE OR REPLACE FUNCTION fn_admin_reset_user_password(p_admin_id INT, p_target_user_id INT, p_new_password_hash TEXT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_admin(p_admin_id);
+  IF p_new_password_hash IS NULL OR btrim(p_new_password_hash) = '' THEN RAISE EXCEPTION 'p_new_password_hash is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+
+  UPDATE users SET password_hash = p_new_password_hash, must_change_password = TRUE WHERE id = p_target_user_id;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_target_user_id USING ERRCODE = 'no_data_found'; END IF;
+  PERFORM _revoke_user_sessions(p_target_user_id);
+
+  PERFORM _log_admin_action(p_admin_id, 'update', p_target_user_id, 'admin_reset_password',
+    jsonb_build_object('new', jsonb_build_object('must_change_password', TRUE)));
+END; $$;
+
+-- Смена пароля самим пользователем снимает флаг обязательной смены;
+-- смена чужого пароля администратором попадает в журнал.
+CREATE OR REPLACE FUNCTION fn_change_user_password(
+  p_requester_id INT,
+  p_target_user_id INT,
+  p_new_password_hash TEXT
+)
+RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_requester_id IS NULL THEN
+    RAISE EXCEPTION 'p_requester_id is required';
+  END IF;
+  IF p_target_user_id IS NULL THEN
+    RAISE EXCEPTION 'p_target_user_id is required';
+  END IF;
+  IF p_new_password_hash IS NULL OR btrim(p_new_password_hash) = '' THEN
+    RAISE EXCEPTION 'p_new_password_hash is required and must not be blank';
+  END IF;
+
+  IF p_requester_id <> p_target_user_id AND NOT is_user_admin(p_requester_id) THEN
+    RAISE EXCEPTION 'only administrator or the user themself may change password';
+  END IF;
+
+  UPDATE users
+  SET password_hash = p_new_password_hash,
+      must_change_password = (p_requester_id <> p_target_user_id)
+  WHERE id = p_target_user_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'user % not found', p_target_user_id;
+  END IF;
+
+  IF p_requester_id <> p_target_user_id THEN
+    PERFORM _log_admin_action(p_requester_id, 'update', p_target_user_id, 'admin_change_password', NULL);
+  END IF;
+END;
+$$;
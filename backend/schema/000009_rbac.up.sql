@@ -0,0 +1,779 @@
+-- === RBAC: роли состоят из именованных прав вместо проверки имени роли 'administrator' ===
+
+CREATE TABLE IF NOT EXISTS permissions (
+  code TEXT PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+INSERT INTO permissions (code, description) VALUES
+  ('documents.read_all',   'Просмотр всех документов, включая приватные'),
+  ('documents.edit_any',   'Редактирование любого документа'),
+  ('documents.delete_any', 'Удаление любого документа'),
+  ('permissions.manage',   'Выдача и отзыв доступа к документам'),
+  ('logs.read',            'Просмотр журнала изменений'),
+  ('dictionaries.write',   'Изменение справочников: типы документов, теги'),
+  ('users.manage',         'Управление пользователями: создание, роли, блокировка, сброс пароля'),
+  ('roles.manage',         'Создание и изменение ролей')
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS description TEXT;
+-- системные роли (administrator, user) нельзя переименовать или удалить
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS is_system BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE roles SET is_system = TRUE WHERE name IN ('administrator', 'user');
+
+CREATE SEQUENCE IF NOT EXISTS roles_id_seq AS SMALLINT OWNED BY roles.id;
+SELECT setval('roles_id_seq', GREATEST((SELECT max(id) FROM roles), 1));
+ALTER TABLE roles ALTER COLUMN id SET DEFAULT nextval('roles_id_seq');
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role_id SMALLINT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+  permission TEXT NOT NULL REFERENCES permissions(code) ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission)
+);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.code FROM roles r CROSS JOIN permissions p WHERE r.name = 'administrator'
+ON CONFLICT DO NOTHING;
+
+-- Единственная точка проверки прав (её же вызывает Gin-middleware через репозиторий).
+-- У заблокированного пользователя прав нет.
+CREATE OR REPLACE FUNCTION has_permission(p_user_id INT, p_permission TEXT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE sql STABLE AS $$
+  SELECT p_user_id IS NOT NULL AND EXISTS (
+    SELECT 1 FROM users u JOIN role_permissions rp ON rp.role_id = u.role_id
+    WHERE u.id = p_user_id AND u.disabled_at IS NULL AND rp.permission = p_permission)
+$$;
+
+CREATE OR REPLACE FUNCTION _require_permission(p_user_id INT, p_permission TEXT) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT has_permission(p_user_id, p_permission) THEN
+    RAISE EXCEPTION 'permission % required', p_permission USING ERRCODE = 'insufficient_privilege';
+  END IF;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_user_permissions(p_user_id INT) RETURNS TEXT[]
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE sql STABLE AS $$
+  SELECT coalesce(array_agg(rp.permission ORDER BY rp.permission), '{}')
+  FROM users u JOIN role_permissions rp ON rp.role_id = u.role_id
+  WHERE u.id = p_user_id AND u.disabled_at IS NULL
+$$;
+
+-- Права раздаются через роли, поэтому должен оставаться хотя бы один активный
+-- пользователь с roles.manage. Вызывается в конце функций, меняющих роли/блокировку.
+CREATE OR REPLACE FUNCTION _assert_roles_manager_remains() RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM users u JOIN role_permissions rp ON rp.role_id = u.role_id
+    WHERE rp.permission = 'roles.manage' AND u.disabled_at IS NULL) THEN
+    RAISE EXCEPTION 'at least one active user must keep roles.manage permission' USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+END; $$;
+
+-- Журнал действий над произвольной таблицей; _log_admin_action — частный случай для users
+CREATE OR REPLACE FUNCTION _log_action(
+  p_user_id INT,
+  p_action action_type,
+  p_table_name TEXT,
+  p_record_id INT,
+  p_operation TEXT,
+  p_changes JSONB
+) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+  SELECT p_action, p_table_name, p_record_id, p_user_id, u.login, p_operation,
+         current_setting('app.session_of_user', true), now(), p_changes
+  FROM users u WHERE u.id = p_user_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION _log_admin_action(
+  p_admin_id INT,
+  p_action action_type,
+  p_target_user_id INT,
+  p_operation TEXT,
+  p_changes JSONB
+) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _log_action(p_admin_id, p_action, 'users', p_target_user_id, p_operation, p_changes);
+END; $$;
+
+-- Функции управления пользователями (000008) проверяют право users.manage
+CREATE OR REPLACE FUNCTION _require_admin(p_admin_id INT) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_admin_id, 'users.manage');
+END; $$;
+
+-- === Документы ===
+
+-- p_read_all — право documents.read_all, вычисленное вызывающей функцией один раз
+DROP FUNCTION IF EXISTS _visible_documents(INT, BOOLEAN);
+
+CREATE OR REPLACE FUNCTION _visible_documents(p_requester_id INT, p_read_all BOOLEAN)
+RETURNS SETOF documents
+LANGUAGE sql STABLE AS $$
+  SELECT d.*
+  FROM documents d
+  WHERE p_read_all
+     OR d.privacy = 'public'::privacy_type
+     OR (p_requester_id IS NOT NULL AND d.created_by = p_requester_id)
+     OR (p_requester_id IS NOT NULL AND EXISTS (
+           SELECT 1 FROM document_permissions dp
+           WHERE dp.document_id = d.id AND dp.user_id = p_requester_id AND (dp.can_view OR dp.can_edit)))
+$$;
+
+CREATE OR REPLACE FUNCTION _can_user_edit_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_creator INT;
+BEGIN
+  IF p_user_id IS NULL THEN RETURN FALSE; END IF;
+  IF has_permission(p_user_id, 'documents.edit_any') THEN RETURN TRUE; END IF;
+  SELECT d.created_by INTO v_creator FROM documents d WHERE d.id = p_document_id;
+  IF v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN EXISTS (SELECT 1 FROM document_permissions WHERE document_id = p_document_id AND user_id = p_user_id AND can_edit);
+END; $$;
+
+CREATE OR REPLACE FUNCTION _can_user_view_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_privacy privacy_type; v_creator INT;
+BEGIN
+  IF has_permission(p_user_id, 'documents.read_all') THEN RETURN TRUE; END IF;
+  SELECT d.privacy, d.created_by INTO v_privacy, v_creator FROM documents d WHERE d.id = p_document_id;
+  IF v_privacy = 'public'::privacy_type OR v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN EXISTS (SELECT 1 FROM document_permissions WHERE document_id = p_document_id AND user_id = p_user_id AND (can_view OR can_edit));
+END; $$;
+
+-- Удаление: автор и редакторы документа, как раньше, либо право documents.delete_any
+-- (documents.edit_any само по себе удалять не позволяет)
+CREATE OR REPLACE FUNCTION fn_delete_document(p_document_id INT, p_user_id INT) RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT (has_permission(p_user_id, 'documents.delete_any')
+          OR EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.created_by = p_user_id)
+          OR EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = p_document_id AND dp.user_id = p_user_id AND dp.can_edit)) THEN
+    RAISE EXCEPTION 'No permission';
+  END IF;
+  DELETE FROM documents WHERE id = p_document_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_set_document_permission(p_document_id INT, p_user_id INT, p_target_user_id INT, p_can_view BOOLEAN, p_can_edit BOOLEAN)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  INSERT INTO document_permissions (document_id, user_id, can_view, can_edit)
+    VALUES (p_document_id, p_target_user_id, p_can_view, p_can_edit)
+    ON CONFLICT (document_id,user_id) DO UPDATE SET can_view = EXCLUDED.can_view, can_edit = EXCLUDED.can_edit;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_remove_document_permission(p_document_id INT, p_user_id INT, p_target_user_id INT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  DELETE FROM document_permissions WHERE document_id = p_document_id AND user_id = p_target_user_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_documents_for_user(p_requester_id INT)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  updated_at TIMESTAMPTZ,
+  document_date DATE,
+  type_id INT,
+  author citext,
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_read_all BOOLEAN := has_permission(p_requester_id, 'documents.read_all');
+  v_edit_any BOOLEAN := has_permission(p_requester_id, 'documents.edit_any');
+BEGIN
+  RETURN QUERY
+  SELECT
+    d.id,
+    d.title,
+    d.privacy,
+    d.updated_at,
+    d.document_date,
+    d.type_id,
+    d.author,
+    d.geojson,
+    (v_edit_any
+      OR (v_uid IS NOT NULL AND d.created_by = v_uid)
+      OR (v_uid IS NOT NULL AND EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = d.id AND dp.user_id = v_uid AND dp.can_edit))) AS can_edit,
+    (d.created_by IS NOT NULL AND v_uid IS NOT NULL AND d.created_by = v_uid) AS is_author
+  FROM _visible_documents(v_uid, v_read_all) d
+  ORDER BY d.created_at DESC;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_get_document_by_id(p_document_id INT, p_requester_id INT DEFAULT NULL)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  geom geometry(Geometry,4326),
+  can_edit BOOLEAN
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id;
+  END IF;
+
+  RETURN QUERY
+    SELECT d.id, d.title, d.privacy, d.created_at, d.created_by, d.updated_at, d.updated_by,
+           d.document_date, d.author, d.type_id, d.file_meta, d.geojson, d.geom,
+           _can_user_edit_document(p_requester_id, d.id) AS can_edit
+    FROM documents d
+    WHERE d.id = p_document_id;
+END;
+$$;
+
+-- === Поиск и тайлы: видимость по documents.read_all, can_edit по documents.edit_any ===
+
+CREATE OR REPLACE FUNCTION fn_search_documents(
+  p_requester_id INT,
+  p_query TEXT,
+  p_tag TEXT,
+  p_author TEXT,
+  p_type TEXT,
+  p_date_from DATE,
+  p_date_to DATE,
+  p_bbox DOUBLE PRECISION[],
+  p_area JSONB,
+  p_relation TEXT,
+  p_near_lon DOUBLE PRECISION,
+  p_near_lat DOUBLE PRECISION,
+  p_radius_m DOUBLE PRECISION,
+  p_sort TEXT,
+  p_desc BOOLEAN,
+  p_limit INT,
+  p_offset INT
+)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  type_name citext,
+  tags TEXT[],
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN,
+  rank REAL,
+  headline TEXT,
+  distance_m DOUBLE PRECISION,
+  total_count BIGINT
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_read_all BOOLEAN := has_permission(p_requester_id, 'documents.read_all');
+  v_edit_any BOOLEAN := has_permission(p_requester_id, 'documents.edit_any');
+  v_sort TEXT := lower(coalesce(nullif(btrim(p_sort), ''), 'created_at'));
+  v_desc BOOLEAN := coalesce(p_desc, TRUE);
+  v_type_id INT;
+  v_query tsquery;
+  v_bbox geometry;
+  v_area geometry;
+  v_relation TEXT := lower(coalesce(nullif(btrim(p_relation), ''), 'intersects'));
+  v_point geography;
+BEGIN
+  IF v_sort NOT IN ('created_at', 'updated_at', 'document_date', 'title', 'relevance', 'distance') THEN
+    RAISE EXCEPTION 'unsupported sort field %', p_sort;
+  END IF;
+  IF p_limit IS NULL OR p_limit <= 0 THEN RAISE EXCEPTION 'p_limit must be positive'; END IF;
+
+  IF p_query IS NOT NULL AND btrim(p_query) <> '' THEN
+    v_query := _document_tsquery(p_query);
+    -- запрос только из стоп-слов: совпадений быть не может
+    IF numnode(v_query) = 0 THEN RETURN; END IF;
+  ELSIF v_sort = 'relevance' THEN
+    RAISE EXCEPTION 'sort by relevance requires a query';
+  END IF;
+
+  IF p_bbox IS NOT NULL THEN
+    IF array_length(p_bbox, 1) IS DISTINCT FROM 4 THEN RAISE EXCEPTION 'p_bbox must have 4 elements'; END IF;
+    v_bbox := ST_MakeEnvelope(p_bbox[1], p_bbox[2], p_bbox[3], p_bbox[4], 4326);
+  END IF;
+
+  IF p_area IS NOT NULL THEN
+    IF v_relation NOT IN ('intersects', 'within') THEN RAISE EXCEPTION 'unsupported relation %', p_relation; END IF;
+    v_area := _search_area_from_geojson(p_area);
+  END IF;
+
+  IF p_near_lon IS NOT NULL AND p_near_lat IS NOT NULL THEN
+    v_point := ST_SetSRID(ST_MakePoint(p_near_lon, p_near_lat), 4326)::geography;
+  ELSIF p_radius_m IS NOT NULL THEN
+    RAISE EXCEPTION 'p_radius_m requires a point';
+  END IF;
+  IF v_sort = 'distance' AND v_point IS NULL THEN
+    RAISE EXCEPTION 'sort by distance requires a point';
+  END IF;
+
+  -- тип можно передать как id или как имя
+  IF p_type ~ '^\d+$' THEN
+    v_type_id := p_type::INT;
+  ELSIF p_type IS NOT NULL THEN
+    SELECT t.id INTO v_type_id FROM document_types t WHERE t.name = p_type::citext;
+    IF v_type_id IS NULL THEN RETURN; END IF;
+  END IF;
+
+  RETURN QUERY
+  WITH page AS (
+    SELECT
+      d.*,
+      CASE WHEN v_query IS NOT NULL THEN ts_rank(s.tsv, v_query) END AS rnk,
+      s.file_text AS ftext,
+      CASE WHEN v_point IS NOT NULL THEN ST_Distance(d.geom::geography, v_point) END AS dist,
+      count(*) OVER () AS total
+    FROM _visible_documents(v_uid, v_read_all) d
+    LEFT JOIN document_search s ON s.document_id = d.id
+    WHERE (v_query IS NULL OR s.tsv @@ v_query)
+      AND (p_tag IS NULL OR EXISTS (
+            SELECT 1 FROM document_tags x JOIN tags tg ON tg.id = x.tag_id
+            WHERE x.document_id = d.id AND tg.name = p_tag::citext))
+      AND (p_author IS NULL OR d.author ILIKE '%' || _like_escape(p_author) || '%')
+      AND (v_type_id IS NULL OR d.type_id = v_type_id)
+      AND (p_date_from IS NULL OR d.document_date >= p_date_from)
+      AND (p_date_to IS NULL OR d.document_date <= p_date_to)
+      AND (v_bbox IS NULL OR (d.geom && v_bbox AND ST_Intersects(d.geom, v_bbox)))
+      AND (v_area IS NULL OR (v_relation = 'intersects' AND ST_Intersects(d.geom, v_area))
+                          OR (v_relation = 'within' AND ST_Within(d.geom, v_area)))
+      AND (v_point IS NULL OR d.geom IS NOT NULL)
+      AND (p_radius_m IS NULL OR ST_DWithin(d.geom::geography, v_point, p_radius_m))
+    ORDER BY
+      CASE WHEN v_sort = 'distance' AND NOT v_desc THEN d.geom::geography <-> v_point END ASC,
+      CASE WHEN v_sort = 'distance' AND v_desc THEN d.geom::geography <-> v_point END DESC,
+      CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN ts_rank(s.tsv, v_query) END ASC,
+      CASE WHEN v_sort = 'relevance' AND v_desc THEN ts_rank(s.tsv, v_query) END DESC,
+      CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(d.title) END ASC,
+      CASE WHEN v_sort = 'title' AND v_desc THEN lower(d.title) END DESC,
+      CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN d.created_at END ASC,
+      CASE WHEN v_sort = 'created_at' AND v_desc THEN d.created_at END DESC,
+      CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(d.updated_at, d.created_at) END ASC,
+      CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(d.updated_at, d.created_at) END DESC,
+      CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN d.document_date END ASC NULLS LAST,
+      CASE WHEN v_sort = 'document_date' AND v_desc THEN d.document_date END DESC NULLS LAST,
+      d.id DESC
+    LIMIT p_limit OFFSET GREATEST(coalesce(p_offset, 0), 0)
+  )
+  -- ts_headline дорогой, поэтому считается только для строк текущей страницы
+  SELECT
+    p.id,
+    p.title,
+    p.privacy,
+    p.created_at,
+    p.created_by,
+    p.updated_at,
+    p.updated_by,
+    p.document_date,
+    p.author,
+    p.type_id,
+    dt.name,
+    ARRAY(SELECT tg.name::TEXT FROM document_tags x JOIN tags tg ON tg.id = x.tag_id WHERE x.document_id = p.id ORDER BY tg.name),
+    p.geojson,
+    (v_edit_any
+      OR (v_uid IS NOT NULL AND p.created_by = v_uid)
+      OR (v_uid IS NOT NULL AND EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = p.id AND dp.user_id = v_uid AND dp.can_edit))),
+    (p.created_by IS NOT NULL AND v_uid IS NOT NULL AND p.created_by = v_uid),
+    p.rnk,
+    CASE WHEN v_query IS NOT NULL THEN
+      ts_headline('russian', concat_ws(' … ', p.title, p.author::TEXT, p.ftext), v_query,
+                  'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=25, MinWords=8')
+    END,
+    p.dist,
+    p.total
+  FROM page p
+  LEFT JOIN document_types dt ON dt.id = p.type_id
+  ORDER BY
+    CASE WHEN v_sort = 'distance' AND NOT v_desc THEN p.dist END ASC,
+    CASE WHEN v_sort = 'distance' AND v_desc THEN p.dist END DESC,
+    CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN p.rnk END ASC,
+    CASE WHEN v_sort = 'relevance' AND v_desc THEN p.rnk END DESC,
+    CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(p.title) END ASC,
+    CASE WHEN v_sort = 'title' AND v_desc THEN lower(p.title) END DESC,
+    CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN p.created_at END ASC,
+    CASE WHEN v_sort = 'created_at' AND v_desc THEN p.created_at END DESC,
+    CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(p.updated_at, p.created_at) END ASC,
+    CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(p.updated_at, p.created_at) END DESC,
+    CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN p.document_date END ASC NULLS LAST,
+    CASE WHEN v_sort = 'document_date' AND v_desc THEN p.document_date END DESC NULLS LAST,
+    p.id DESC;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_get_documents_tile(p_requester_id INT, p_z INT, p_x INT, p_y INT, p_cluster BOOLEAN)
+RETURNS BYTEA
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql STABLE AS $$
+DECLARE
+  v_read_all BOOLEAN := has_permission(p_requester_id, 'documents.read_all');
+  v_bounds geometry;
+  v_cell DOUBLE PRECISION;
+  v_tile BYTEA;
+BEGIN
+  IF p_z < 0 OR p_z > 24 THEN RAISE EXCEPTION 'invalid zoom %', p_z; END IF;
+  IF p_x < 0 OR p_y < 0 OR p_x >= (1 << p_z) OR p_y >= (1 << p_z) THEN
+    RAISE EXCEPTION 'tile %/%/% out of range', p_z, p_x, p_y;
+  END IF;
+
+  v_bounds := ST_TileEnvelope(p_z, p_x, p_y);
+
+  IF NOT coalesce(p_cluster, FALSE) THEN
+    SELECT ST_AsMVT(t, 'documents', 4096, 'geom') INTO v_tile
+    FROM (
+      SELECT
+        d.id,
+        d.title,
+        d.type_id,
+        d.privacy::TEXT AS privacy,
+        ST_AsMVTGeom(ST_Transform(d.geom, 3857), v_bounds, 4096, 64, TRUE) AS geom
+      FROM _visible_documents(p_requester_id, v_read_all) d
+      WHERE d.geom IS NOT NULL
+        AND ST_Transform(d.geom, 3857) && ST_Expand(v_bounds, (ST_XMax(v_bounds) - ST_XMin(v_bounds)) * 64 / 4096)
+    ) t
+    WHERE t.geom IS NOT NULL;
+    RETURN v_tile;
+  END IF;
+
+  v_cell := (ST_XMax(v_bounds) - ST_XMin(v_bounds)) / 64;
+
+  SELECT ST_AsMVT(t, 'documents', 4096, 'geom') INTO v_tile
+  FROM (
+    SELECT
+      (count(*) > 1) AS cluster,
+      count(*)::INT AS point_count,
+      CASE WHEN count(*) = 1 THEN min(c.id) END AS id,
+      CASE WHEN count(*) = 1 THEN min(c.title) END AS title,
+      CASE WHEN count(*) = 1 THEN min(c.type_id) END AS type_id,
+      CASE WHEN count(*) = 1 THEN min(c.privacy) END AS privacy,
+      ST_AsMVTGeom(ST_Centroid(ST_Collect(c.pt)), v_bounds, 4096, 64, TRUE) AS geom
+    FROM (
+      SELECT
+        d.id,
+        d.title,
+        d.type_id,
+        d.privacy::TEXT AS privacy,
+        ST_Transform(ST_PointOnSurface(d.geom), 3857) AS pt
+      FROM _visible_documents(p_requester_id, v_read_all) d
+      WHERE d.geom IS NOT NULL
+        AND ST_Transform(d.geom, 3857) && v_bounds
+    ) c
+    GROUP BY ST_SnapToGrid(c.pt, v_cell)
+  ) t
+  WHERE t.geom IS NOT NULL;
+  RETURN v_tile;
+END;
+$$;
+
+-- === Пользователи ===
+
+CREATE OR REPLACE FUNCTION fn_update_user_full_name(
+  p_requester_id INT,
+  p_target_user_id INT,
+  p_full_name TEXT
+)
+RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_trimmed TEXT;
+BEGIN
+  IF p_requester_id IS NULL THEN
+    RAISE EXCEPTION 'p_requester_id is required';
+  END IF;
+  IF p_target_user_id IS NULL THEN
+    RAISE EXCEPTION 'p_target_user_id is required';
+  END IF;
+
+  -- trim and validate full name (allow NULL to clear name)
+  IF p_full_name IS NOT NULL THEN
+    v_trimmed := btrim(p_full_name);
+    IF v_trimmed = '' THEN
+      RAISE EXCEPTION 'p_full_name must not be blank when provided';
+    END IF;
+  ELSE
+    v_trimmed := NULL;
+  END IF;
+
+  IF p_requester_id <> p_target_user_id AND NOT has_permission(p_requester_id, 'users.manage') THEN
+    RAISE EXCEPTION 'only the user themself or a user with users.manage may change full_name';
+  END IF;
+
+  UPDATE users
+  SET full_name = v_trimmed
+  WHERE id = p_target_user_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'user % not found', p_target_user_id;
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_change_user_password(
+  p_requester_id INT,
+  p_target_user_id INT,
+  p_new_password_hash TEXT
+)
+RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_requester_id IS NULL THEN
+    RAISE EXCEPTION 'p_requester_id is required';
+  END IF;
+  IF p_target_user_id IS NULL THEN
+    RAISE EXCEPTION 'p_target_user_id is required';
+  END IF;
+  IF p_new_password_hash IS NULL OR btrim(p_new_password_hash) = '' THEN
+    RAISE EXCEPTION 'p_new_password_hash is required and must not be blank';
+  END IF;
+
+  IF p_requester_id <> p_target_user_id AND NOT has_permission(p_requester_id, 'users.manage') THEN
+    RAISE EXCEPTION 'only the user themself or a user with users.manage may change password';
+  END IF;
+
+  UPDATE users
+  SET password_hash = p_new_password_hash,
+      must_change_password = (p_requester_id <> p_target_user_id)
+  WHERE id = p_target_user_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'user % not found', p_target_user_id;
+  END IF;
+
+  IF p_requester_id <> p_target_user_id THEN
+    PERFORM _log_admin_action(p_requester_id, 'update', p_target_user_id, 'admin_change_password', NULL);
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_admin_set_user_role(p_admin_id INT, p_target_user_id INT, p_role_id SMALLINT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_old SMALLINT;
+BEGIN
+  PERFORM _require_admin(p_admin_id);
+  IF NOT EXISTS (SELECT 1 FROM roles r WHERE r.id = p_role_id) THEN RAISE EXCEPTION 'role % not found', p_role_id USING ERRCODE = 'no_data_found'; END IF;
+
+  SELECT u.role_id INTO v_old FROM users u WHERE u.id = p_target_user_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_target_user_id USING ERRCODE = 'no_data_found'; END IF;
+  IF v_old = p_role_id THEN RETURN; END IF;
+
+  UPDATE users SET role_id = p_role_id WHERE id = p_target_user_id;
+  PERFORM _assert_roles_manager_remains();
+
+  PERFORM _log_admin_action(p_admin_id, 'update', p_target_user_id, 'admin_set_role',
+    jsonb_build_object('old', jsonb_build_object('role_id', v_old), 'new', jsonb_build_object('role_id', p_role_id)));
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_admin_set_user_disabled(p_admin_id INT, p_target_user_id INT, p_disabled BOOLEAN)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_was BOOLEAN;
+BEGIN
+  PERFORM _require_admin(p_admin_id);
+  IF p_disabled IS NULL THEN RAISE EXCEPTION 'p_disabled is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  IF p_disabled AND p_admin_id = p_target_user_id THEN RAISE EXCEPTION 'administrator cannot disable themself' USING ERRCODE = 'object_not_in_prerequisite_state'; END IF;
+
+  SELECT u.disabled_at IS NOT NULL INTO v_was FROM users u WHERE u.id = p_target_user_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % not found', p_target_user_id USING ERRCODE = 'no_data_found'; END IF;
+  IF v_was = p_disabled THEN RETURN; END IF;
+
+  UPDATE users SET disabled_at = CASE WHEN p_disabled THEN now() END WHERE id = p_target_user_id;
+  IF p_disabled THEN
+    PERFORM _revoke_user_sessions(p_target_user_id);
+    PERFORM _assert_roles_manager_remains();
+  END IF;
+
+  PERFORM _log_admin_action(p_admin_id, 'update', p_target_user_id,
+    CASE WHEN p_disabled THEN 'admin_disable_user' ELSE 'admin_enable_user' END,
+    jsonb_build_object('old', jsonb_build_object('disabled', v_was), 'new', jsonb_build_object('disabled', p_disabled)));
+END; $$;
+
+-- is_user_admin больше нигде не используется: права проверяет has_permission
+DROP FUNCTION IF EXISTS is_user_admin(INT);
+
+-- === Журнал (право logs.read); границы периода включительно, NULL — без ограничения ===
+
+CREATE OR REPLACE FUNCTION fn_get_logs_by_user(p_requester_id INT, p_target_user_id INT, p_start TIMESTAMPTZ, p_end TIMESTAMPTZ)
+RETURNS TABLE (id INT, action TEXT, table_name TEXT, record_id INT, user_id INT, user_login TEXT, action_time TIMESTAMPTZ, changes JSONB)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'logs.read');
+  RETURN QUERY
+  SELECT l.id, l.action::TEXT, l.table_name, l.record_id, l.user_id, l.user_login, l.action_time, l.changes
+  FROM logs l
+  WHERE l.user_id = p_target_user_id
+    AND (p_start IS NULL OR l.action_time >= p_start)
+    AND (p_end IS NULL OR l.action_time <= p_end)
+  ORDER BY l.action_time DESC, l.id DESC;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_logs_by_table(p_requester_id INT, p_table_name TEXT, p_start TIMESTAMPTZ, p_end TIMESTAMPTZ)
+RETURNS TABLE (id INT, action TEXT, table_name TEXT, record_id INT, user_id INT, user_login TEXT, action_time TIMESTAMPTZ, changes JSONB)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'logs.read');
+  RETURN QUERY
+  SELECT l.id, l.action::TEXT, l.table_name, l.record_id, l.user_id, l.user_login, l.action_time, l.changes
+  FROM logs l
+  WHERE l.table_name = p_table_name
+    AND (p_start IS NULL OR l.action_time >= p_start)
+    AND (p_end IS NULL OR l.action_time <= p_end)
+  ORDER BY l.action_time DESC, l.id DESC;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_logs_by_date(p_requester_id INT, p_start TIMESTAMPTZ, p_end TIMESTAMPTZ)
+RETURNS TABLE (id INT, action TEXT, table_name TEXT, record_id INT, user_id INT, user_login TEXT, action_time TIMESTAMPTZ, changes JSONB)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'logs.read');
+  IF p_start IS NULL OR p_end IS NULL THEN RAISE EXCEPTION 'p_start and p_end are required'; END IF;
+  RETURN QUERY
+  SELECT l.id, l.action::TEXT, l.table_name, l.record_id, l.user_id, l.user_login, l.action_time, l.changes
+  FROM logs l
+  WHERE l.action_time BETWEEN p_start AND p_end
+  ORDER BY l.action_time DESC, l.id DESC;
+END; $$;
+
+-- === Роли (право roles.manage; список ролей доступен и users.manage — для назначения) ===
+
+CREATE OR REPLACE FUNCTION fn_list_permissions()
+RETURNS TABLE (code TEXT, description TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE sql STABLE AS $$
+  SELECT p.code, p.description FROM permissions p ORDER BY p.code
+$$;
+
+CREATE OR REPLACE FUNCTION fn_list_roles(p_requester_id INT)
+RETURNS TABLE (id SMALLINT, name TEXT, description TEXT, is_system BOOLEAN, permissions TEXT[], user_count BIGINT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT (has_permission(p_requester_id, 'roles.manage') OR has_permission(p_requester_id, 'users.manage')) THEN
+    RAISE EXCEPTION 'permission roles.manage required';
+  END IF;
+  RETURN QUERY
+  SELECT r.id, r.name, r.description, r.is_system,
+         ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role_id = r.id ORDER BY rp.permission),
+         (SELECT count(*) FROM users u WHERE u.role_id = r.id)
+  FROM roles r
+  ORDER BY r.id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION _set_role_permissions(p_role_id SMALLINT, p_permissions TEXT[]) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_unknown TEXT;
+BEGIN
+  SELECT x INTO v_unknown FROM unnest(p_permissions) x
+  WHERE NOT EXISTS (SELECT 1 FROM permissions p WHERE p.code = x) LIMIT 1;
+  IF v_unknown IS NOT NULL THEN RAISE EXCEPTION 'unknown permission %', v_unknown; END IF;
+
+  DELETE FROM role_permissions WHERE role_id = p_role_id;
+  INSERT INTO role_permissions (role_id, permission)
+  SELECT DISTINCT p_role_id, x FROM unnest(p_permissions) x;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_create_role(p_requester_id INT, p_name TEXT, p_description TEXT, p_permissions TEXT[])
+RETURNS SMALLINT
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_id SMALLINT;
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'roles.manage');
+  IF p_name IS NULL OR btrim(p_name) = '' THEN RAISE EXCEPTION 'p_name is required and must not be blank'; END IF;
+
+  INSERT INTO roles (name, description) VALUES (btrim(p_name), nullif(btrim(p_description), ''))
+  RETURNING roles.id INTO v_id;
+  PERFORM _set_role_permissions(v_id, coalesce(p_permissions, '{}'));
+
+  PERFORM _log_action(p_requester_id, 'create', 'roles', v_id, 'create_role',
+    jsonb_build_object('new', jsonb_build_object('name', btrim(p_name), 'permissions', coalesce(p_permissions, '{}'))));
+  RETURN v_id;
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Role % already exists', btrim(p_name);
+END; $$;
+
+-- NULL в p_name/p_description/p_permissions — поле не меняется; массив прав заменяет текущий набор
+CREATE OR REPLACE FUNCTION fn_update_role(p_requester_id INT, p_role_id SMALLINT, p_name TEXT, p_description TEXT, p_permissions TEXT[])
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_role roles%ROWTYPE;
+  v_old_perms TEXT[];
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'roles.manage');
+  SELECT * INTO v_role FROM roles r WHERE r.id = p_role_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'role % not found', p_role_id; END IF;
+  IF p_name IS NOT NULL AND btrim(p_name) = '' THEN RAISE EXCEPTION 'p_name must not be blank'; END IF;
+  IF v_role.is_system AND p_name IS NOT NULL AND btrim(p_name) <> v_role.name THEN
+    RAISE EXCEPTION 'system role % cannot be renamed', v_role.name;
+  END IF;
+
+  v_old_perms := ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role_id = p_role_id ORDER BY rp.permission);
+
+  UPDATE roles SET
+    name = coalesce(btrim(p_name), name),
+    description = CASE WHEN p_description IS NULL THEN description ELSE nullif(btrim(p_description), '') END
+  WHERE id = p_role_id;
+  IF p_permissions IS NOT NULL THEN
+    PERFORM _set_role_permissions(p_role_id, p_permissions);
+    PERFORM _assert_roles_manager_remains();
+  END IF;
+
+  PERFORM _log_action(p_requester_id, 'update', 'roles', p_role_id, 'update_role',
+    jsonb_build_object(
+      'old', jsonb_build_object('name', v_role.name, 'description', v_role.description, 'permissions', v_old_perms),
+      'new', jsonb_build_object('name', coalesce(btrim(p_name), v_role.name), 'description', p_description, 'permissions', p_permissions)));
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Role % already exists', btrim(p_name);
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_delete_role(p_requester_id INT, p_role_id SMALLINT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_role roles%ROWTYPE;
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'roles.manage');
+  SELECT * INTO v_role FROM roles r WHERE r.id = p_role_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'role % not found', p_role_id; END IF;
+  IF v_role.is_system THEN RAISE EXCEPTION 'system role % cannot be deleted', v_role.name; END IF;
+  IF EXISTS (SELECT 1 FROM users u WHERE u.role_id = p_role_id) THEN
+    RAISE EXCEPTION 'role % is assigned to users', v_role.name;
+  END IF;
+
+  DELETE FROM roles WHERE id = p_role_id;
+  PERFORM _log_action(p_requester_id, 'delete', 'roles', p_role_id, 'delete_role',
+    jsonb_build_object('old', jsonb_build_object('name', v_role.name)));
+END; $$;
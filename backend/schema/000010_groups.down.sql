@@ -0,0 +1,283 @@
+DROP FUNCTION IF EXISTS fn_remove_document_group_permission(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_set_document_group_permission(INT, INT, INT, BOOLEAN, BOOLEAN);
+DROP FUNCTION IF EXISTS fn_remove_group_member(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_add_group_members(INT, INT, INT[]);
+DROP FUNCTION IF EXISTS fn_list_group_members(INT, INT);
+DROP FUNCTION IF EXISTS fn_delete_group(INT, INT);
+DROP FUNCTION IF EXISTS fn_update_group(INT, INT, TEXT, TEXT);
+DROP FUNCTION IF EXISTS fn_create_group(INT, TEXT, TEXT);
+DROP FUNCTION IF EXISTS fn_list_groups(INT);
+
+-- восстановление определений из 000009
+CREATE OR REPLACE FUNCTION _visible_documents(p_requester_id INT, p_read_all BOOLEAN)
+RETURNS SETOF documents
+LANGUAGE sql STABLE AS $$
+  SELECT d.*
+  FROM documents d
+  WHERE p_read_all
+     OR d.privacy = 'public'::privacy_type
+     OR (p_requester_id IS NOT NULL AND d.created_by = p_requester_id)
+     OR (p_requester_id IS NOT NULL AND EXISTS (
+           SELECT 1 FROM document_permissions dp
+           WHERE dp.document_id = d.id AND dp.user_id = p_requester_id AND (dp.can_view OR dp.can_edit)))
+$$;
+
+CREATE OR REPLACE FUNCTION _can_user_edit_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_creator INT;
+BEGIN
+  IF p_user_id IS NULL THEN RETURN FALSE; END IF;
+  IF has_permission(p_user_id, 'documents.edit_any') THEN RETURN TRUE; END IF;
+  SELECT d.created_by INTO v_creator FROM documents d WHERE d.id = p_document_id;
+  IF v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN EXISTS (SELECT 1 FROM document_permissions WHERE document_id = p_document_id AND user_id = p_user_id AND can_edit);
+END; $$;
+
+CREATE OR REPLACE FUNCTION _can_user_view_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_privacy privacy_type; v_creator INT;
+BEGIN
+  IF has_permission(p_user_id, 'documents.read_all') THEN RETURN TRUE; END IF;
+  SELECT d.privacy, d.created_by INTO v_privacy, v_creator FROM documents d WHERE d.id = p_document_id;
+  IF v_privacy = 'public'::privacy_type OR v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN EXISTS (SELECT 1 FROM document_permissions WHERE document_id = p_document_id AND user_id = p_user_id AND (can_view OR can_edit));
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_delete_document(p_document_id INT, p_user_id INT) RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT (has_permission(p_user_id, 'documents.delete_any')
+          OR EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.created_by = p_user_id)
+          OR EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = p_document_id AND dp.user_id = p_user_id AND dp.can_edit)) THEN
+    RAISE EXCEPTION 'No permission';
+  END IF;
+  DELETE FROM documents WHERE id = p_document_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_documents_for_user(p_requester_id INT)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  updated_at TIMESTAMPTZ,
+  document_date DATE,
+  type_id INT,
+  author citext,
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_read_all BOOLEAN := has_permission(p_requester_id, 'documents.read_all');
+  v_edit_any BOOLEAN := has_permission(p_requester_id, 'documents.edit_any');
+BEGIN
+  RETURN QUERY
+  SELECT
+    d.id,
+    d.title,
+    d.privacy,
+    d.updated_at,
+    d.document_date,
+    d.type_id,
+    d.author,
+    d.geojson,
+    (v_edit_any
+      OR (v_uid IS NOT NULL AND d.created_by = v_uid)
+      OR (v_uid IS NOT NULL AND EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = d.id AND dp.user_id = v_uid AND dp.can_edit))) AS can_edit,
+    (d.created_by IS NOT NULL AND v_uid IS NOT NULL AND d.created_by = v_uid) AS is_author
+  FROM _visible_documents(v_uid, v_read_all) d
+  ORDER BY d.created_at DESC;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_search_documents(
+  p_requester_id INT,
+  p_query TEXT,
+  p_tag TEXT,
+  p_author TEXT,
+  p_type TEXT,
+  p_date_from DATE,
+  p_date_to DATE,
+  p_bbox DOUBLE PRECISION[],
+  p_area JSONB,
+  p_relation TEXT,
+  p_near_lon DOUBLE PRECISION,
+  p_near_lat DOUBLE PRECISION,
+  p_radius_m DOUBLE PRECISION,
+  p_sort TEXT,
+  p_desc BOOLEAN,
+  p_limit INT,
+  p_offset INT
+)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  type_name citext,
+  tags TEXT[],
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN,
+  rank REAL,
+  headline TEXT,
+  distance_m DOUBLE PRECISION,
+  total_count BIGINT
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_read_all BOOLEAN := has_permission(p_requester_id, 'documents.read_all');
+  v_edit_any BOOLEAN := has_permission(p_requester_id, 'documents.edit_any');
+  v_sort TEXT := lower(coalesce(nullif(btrim(p_sort), ''), 'created_at'));
+  v_desc BOOLEAN := coalesce(p_desc, TRUE);
+  v_type_id INT;
+  v_query tsquery;
+  v_bbox geometry;
+  v_area geometry;
+  v_relation TEXT := lower(coalesce(nullif(btrim(p_relation), ''), 'intersects'));
+  v_point geography;
+BEGIN
+  IF v_sort NOT IN ('created_at', 'updated_at', 'document_date', 'title', 'relevance', 'distance') THEN
+    RAISE EXCEPTION 'unsupported sort field %', p_sort;
+  END IF;
+  IF p_limit IS NULL OR p_limit <= 0 THEN RAISE EXCEPTION 'p_limit must be positive'; END IF;
+
+  IF p_query IS NOT NULL AND btrim(p_query) <> '' THEN
+    v_query := _document_tsquery(p_query);
+    -- запрос только из стоп-слов: совпадений быть не может
+    IF numnode(v_query) = 0 THEN RETURN; END IF;
+  ELSIF v_sort = 'relevance' THEN
+    RAISE EXCEPTION 'sort by relevance requires a query';
+  END IF;
+
+  IF p_bbox IS NOT NULL THEN
+    IF array_length(p_bbox, 1) IS DISTINCT FROM 4 THEN RAISE EXCEPTION 'p_bbox must have 4 elements'; END IF;
+    v_bbox := ST_MakeEnvelope(p_bbox[1], p_bbox[2], p_bbox[3], p_bbox[4], 4326);
+  END IF;
+
+  IF p_area IS NOT NULL THEN
+    IF v_relation NOT IN ('intersects', 'within') THEN RAISE EXCEPTION 'unsupported relation %', p_relation; END IF;
+    v_area := _search_area_from_geojson(p_area);
+  END IF;
+
+  IF p_near_lon IS NOT NULL AND p_near_lat IS NOT NULL THEN
+    v_point := ST_SetSRID(ST_MakePoint(p_near_lon, p_near_lat), 4326)::geography;
+  ELSIF p_radius_m IS NOT NULL THEN
+    RAISE EXCEPTION 'p_radius_m requires a point';
+  END IF;
+  IF v_sort = 'distance' AND v_point IS NULL THEN
+    RAISE EXCEPTION 'sort by distance requires a point';
+  END IF;
+
+  -- тип можно передать как id или как имя
+  IF p_type ~ '^\d+$' THEN
+    v_type_id := p_type::INT;
+  ELSIF p_type IS NOT NULL THEN
+    SELECT t.id INTO v_type_id FROM document_types t WHERE t.name = p_type::citext;
+    IF v_type_id IS NULL THEN RETURN; END IF;
+  END IF;
+
+  RETURN QUERY
+  WITH page AS (
+    SELECT
+      d.*,
+      CASE WHEN v_query IS NOT NULL THEN ts_rank(s.tsv, v_query) END AS rnk,
+      s.file_text AS ftext,
+      CASE WHEN v_point IS NOT NULL THEN ST_Distance(d.geom::geography, v_point) END AS dist,
+      count(*) OVER () AS total
+    FROM _visible_documents(v_uid, v_read_all) d
+    LEFT JOIN document_search s ON s.document_id = d.id
+    WHERE (v_query IS NULL OR s.tsv @@ v_query)
+      AND (p_tag IS NULL OR EXISTS (
+            SELECT 1 FROM document_tags x JOIN tags tg ON tg.id = x.tag_id
+            WHERE x.document_id = d.id AND tg.name = p_tag::citext))
+      AND (p_author IS NULL OR d.author ILIKE '%' || _like_escape(p_author) || '%')
+      AND (v_type_id IS NULL OR d.type_id = v_type_id)
+      AND (p_date_from IS NULL OR d.document_date >= p_date_from)
+      AND (p_date_to IS NULL OR d.document_date <= p_date_to)
+      AND (v_bbox IS NULL OR (d.geom && v_bbox AND ST_Intersects(d.geom, v_bbox)))
+      AND (v_area IS NULL OR (v_relation = 'intersects' AND ST_Intersects(d.geom, v_area))
+                          OR (v_relation = 'within' AND ST_Within(d.geom, v_area)))
+      AND (v_point IS NULL OR d.geom IS NOT NULL)
+      AND (p_radius_m IS NULL OR ST_DWithin(d.geom::geography, v_point, p_radius_m))
+    ORDER BY
+      CASE WHEN v_sort = 'distance' AND NOT v_desc THEN d.geom::geography <-> v_point END ASC,
+      CASE WHEN v_sort = 'distance' AND v_desc THEN d.geom::geography <-> v_point END DESC,
+      CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN ts_rank(s.tsv, v_query) END ASC,
+      CASE WHEN v_sort = 'relevance' AND v_desc THEN ts_rank(s.tsv, v_query) END DESC,
+      CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(d.title) END ASC,
+      CASE WHEN v_sort = 'title' AND v_desc THEN lower(d.title) END DESC,
+      CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN d.created_at END ASC,
+      CASE WHEN v_sort = 'created_at' AND v_desc THEN d.created_at END DESC,
+      CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(d.updated_at, d.created_at) END ASC,
+      CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(d.updated_at, d.created_at) END DESC,
+      CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN d.document_date END ASC NULLS LAST,
+      CASE WHEN v_sort = 'document_date' AND v_desc THEN d.document_date END DESC NULLS LAST,
+      d.id DESC
+    LIMIT p_limit OFFSET GREATEST(coalesce(p_offset, 0), 0)
+  )
+  -- ts_headline дорогой, поэтому считается только для строк текущей страницы
+  SELECT
+    p.id,
+    p.title,
+    p.privacy,
+    p.created_at,
+    p.created_by,
+    p.updated_at,
+    p.updated_by,
+    p.document_date,
+    p.author,
+    p.type_id,
+    dt.name,
+    ARRAY(SELECT tg.name::TEXT FROM document_tags x JOIN tags tg ON tg.id = x.tag_id WHERE x.document_id = p.id ORDER BY tg.name),
+    p.geojson,
+    (v_edit_any
+      OR (v_uid IS NOT NULL AND p.created_by = v_uid)
+      OR (v_uid IS NOT NULL AND EXISTS (SELECT 1 FROM document_permissions dp WHERE dp.document_id = p.id AND dp.user_id = v_uid AND dp.can_edit))),
+    (p.created_by IS NOT NULL AND v_uid IS NOT NULL AND p.created_by = v_uid),
+    p.rnk,
+    CASE WHEN v_query IS NOT NULL THEN
+      ts_headline('russian', concat_ws(' … ', p.title, p.author::TEXT, p.ftext), v_query,
+                  'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=25, MinWords=8')
+    END,
+    p.dist,
+    p.total
+  FROM page p
+  LEFT JOIN document_types dt ON dt.id = p.type_id
+  ORDER BY
+    CASE WHEN v_sort = 'distance' AND NOT v_desc THEN p.dist END ASC,
+    CASE WHEN v_sort = 'distance' AND v_desc THEN p.dist END DESC,
+    CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN p.rnk END ASC,
+    CASE WHEN v_sort = 'relevance' AND v_desc THEN p.rnk END DESC,
+    CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(p.title) END ASC,
+    CASE WHEN v_sort = 'title' AND v_desc THEN lower(p.title) END DESC,
+    CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN p.created_at END ASC,
+    CASE WHEN v_sort = 'created_at' AND v_desc THEN p.created_at END DESC,
+    CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(p.updated_at, p.created_at) END ASC,
+    CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(p.updated_at, p.created_at) END DESC,
+    CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN p.document_date END ASC NULLS LAST,
+    CASE WHEN v_sort = 'document_date' AND v_desc THEN p.document_date END DESC NULLS LAST,
+    p.id DESC;
+END;
+$$;
+
+DROP FUNCTION IF EXISTS _has_document_grant(INT, INT, BOOLEAN);
+
+DELETE FROM role_permissions WHERE permission = 'groups.manage';
+DELETE FROM permissions WHERE code = 'groups.manage';
+DROP TABLE IF EXISTS document_group_permissions;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
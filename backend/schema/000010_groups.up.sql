@@ -0,0 +1,480 @@
+-- === Группы пользователей и выдача доступа к документам группе ===
+
+CREATE TABLE IF NOT EXISTS groups (
+  id SERIAL PRIMARY KEY,
+  name citext NOT NULL UNIQUE,
+  description TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  CONSTRAINT groups_name_not_blank CHECK (btrim(name::text) <> '')
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+  group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  added_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS group_members_user_idx ON group_members (user_id);
+
+-- Права группы на документ; сосед document_permissions с теми же флагами
+CREATE TABLE IF NOT EXISTS document_group_permissions (
+  document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+  group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+  can_view BOOLEAN NOT NULL DEFAULT FALSE,
+  can_edit BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (document_id, group_id)
+);
+CREATE INDEX IF NOT EXISTS document_group_permissions_group_idx ON document_group_permissions (group_id);
+
+INSERT INTO permissions (code, description) VALUES
+  ('groups.manage', 'Создание групп и управление их составом')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, 'groups.manage' FROM roles r WHERE r.name = 'administrator'
+ON CONFLICT DO NOTHING;
+
+-- Явный доступ к документу: личный или через любую из групп пользователя.
+-- p_edit = TRUE — нужен can_edit, иначе достаточно can_view или can_edit.
+-- Единственное место, где читаются document_permissions/document_group_permissions;
+-- SQL-функция без SECURITY DEFINER, чтобы планировщик мог встроить её в запрос.
+CREATE OR REPLACE FUNCTION _has_document_grant(p_document_id INT, p_user_id INT, p_edit BOOLEAN)
+RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+  SELECT p_user_id IS NOT NULL AND (
+    EXISTS (
+      SELECT 1 FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND dp.user_id = p_user_id
+        AND (dp.can_edit OR (NOT p_edit AND dp.can_view)))
+    OR EXISTS (
+      SELECT 1 FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND gm.user_id = p_user_id
+        AND (gp.can_edit OR (NOT p_edit AND gp.can_view))))
+$$;
+
+CREATE OR REPLACE FUNCTION _visible_documents(p_requester_id INT, p_read_all BOOLEAN)
+RETURNS SETOF documents
+LANGUAGE sql STABLE AS $$
+  SELECT d.*
+  FROM documents d
+  WHERE p_read_all
+     OR d.privacy = 'public'::privacy_type
+     OR (p_requester_id IS NOT NULL AND d.created_by = p_requester_id)
+     OR _has_document_grant(d.id, p_requester_id, FALSE)
+$$;
+
+CREATE OR REPLACE FUNCTION _can_user_edit_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_creator INT;
+BEGIN
+  IF p_user_id IS NULL THEN RETURN FALSE; END IF;
+  IF has_permission(p_user_id, 'documents.edit_any') THEN RETURN TRUE; END IF;
+  SELECT d.created_by INTO v_creator FROM documents d WHERE d.id = p_document_id;
+  IF v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN _has_document_grant(p_document_id, p_user_id, TRUE);
+END; $$;
+
+CREATE OR REPLACE FUNCTION _can_user_view_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_privacy privacy_type; v_creator INT;
+BEGIN
+  IF has_permission(p_user_id, 'documents.read_all') THEN RETURN TRUE; END IF;
+  SELECT d.privacy, d.created_by INTO v_privacy, v_creator FROM documents d WHERE d.id = p_document_id;
+  IF v_privacy = 'public'::privacy_type OR v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN _has_document_grant(p_document_id, p_user_id, FALSE);
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_delete_document(p_document_id INT, p_user_id INT) RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT (has_permission(p_user_id, 'documents.delete_any')
+          OR EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.created_by = p_user_id)
+          OR _has_document_grant(p_document_id, p_user_id, TRUE)) THEN
+    RAISE EXCEPTION 'No permission';
+  END IF;
+  DELETE FROM documents WHERE id = p_document_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_documents_for_user(p_requester_id INT)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  updated_at TIMESTAMPTZ,
+  document_date DATE,
+  type_id INT,
+  author citext,
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_read_all BOOLEAN := has_permission(p_requester_id, 'documents.read_all');
+  v_edit_any BOOLEAN := has_permission(p_requester_id, 'documents.edit_any');
+BEGIN
+  RETURN QUERY
+  SELECT
+    d.id,
+    d.title,
+    d.privacy,
+    d.updated_at,
+    d.document_date,
+    d.type_id,
+    d.author,
+    d.geojson,
+    (v_edit_any
+      OR (v_uid IS NOT NULL AND d.created_by = v_uid)
+      OR _has_document_grant(d.id, v_uid, TRUE)) AS can_edit,
+    (d.created_by IS NOT NULL AND v_uid IS NOT NULL AND d.created_by = v_uid) AS is_author
+  FROM _visible_documents(v_uid, v_read_all) d
+  ORDER BY d.created_at DESC;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_search_documents(
+  p_requester_id INT,
+  p_query TEXT,
+  p_tag TEXT,
+  p_author TEXT,
+  p_type TEXT,
+  p_date_from DATE,
+  p_date_to DATE,
+  p_bbox DOUBLE PRECISION[],
+  p_area JSONB,
+  p_relation TEXT,
+  p_near_lon DOUBLE PRECISION,
+  p_near_lat DOUBLE PRECISION,
+  p_radius_m DOUBLE PRECISION,
+  p_sort TEXT,
+  p_desc BOOLEAN,
+  p_limit INT,
+  p_offset INT
+)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  type_name citext,
+  tags TEXT[],
+  geojson JSONB,
+  can_edit BOOLEAN,
+  is_author BOOLEAN,
+  rank REAL,
+  headline TEXT,
+  distance_m DOUBLE PRECISION,
+  total_count BIGINT
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_uid INT := p_requester_id;
+  v_read_all BOOLEAN := has_permission(p_requester_id, 'documents.read_all');
+  v_edit_any BOOLEAN := has_permission(p_requester_id, 'documents.edit_any');
+  v_sort TEXT := lower(coalesce(nullif(btrim(p_sort), ''), 'created_at'));
+  v_desc BOOLEAN := coalesce(p_desc, TRUE);
+  v_type_id INT;
+  v_query tsquery;
+  v_bbox geometry;
+  v_area geometry;
+  v_relation TEXT := lower(coalesce(nullif(btrim(p_relation), ''), 'intersects'));
+  v_point geography;
+BEGIN
+  IF v_sort NOT IN ('created_at', 'updated_at', 'document_date', 'title', 'relevance', 'distance') THEN
+    RAISE EXCEPTION 'unsupported sort field %', p_sort;
+  END IF;
+  IF p_limit IS NULL OR p_limit <= 0 THEN RAISE EXCEPTION 'p_limit must be positive'; END IF;
+
+  IF p_query IS NOT NULL AND btrim(p_query) <> '' THEN
+    v_query := _document_tsquery(p_query);
+    -- запрос только из стоп-слов: совпадений быть не может
+    IF numnode(v_query) = 0 THEN RETURN; END IF;
+  ELSIF v_sort = 'relevance' THEN
+    RAISE EXCEPTION 'sort by relevance requires a query';
+  END IF;
+
+  IF p_bbox IS NOT NULL THEN
+    IF array_length(p_bbox, 1) IS DISTINCT FROM 4 THEN RAISE EXCEPTION 'p_bbox must have 4 elements'; END IF;
+    v_bbox := ST_MakeEnvelope(p_bbox[1], p_bbox[2], p_bbox[3], p_bbox[4], 4326);
+  END IF;
+
+  IF p_area IS NOT NULL THEN
+    IF v_relation NOT IN ('intersects', 'within') THEN RAISE EXCEPTION 'unsupported relation %', p_relation; END IF;
+    v_area := _search_area_from_geojson(p_area);
+  END IF;
+
+  IF p_near_lon IS NOT NULL AND p_near_lat IS NOT NULL THEN
+    v_point := ST_SetSRID(ST_MakePoint(p_near_lon, p_near_lat), 4326)::geography;
+  ELSIF p_radius_m IS NOT NULL THEN
+    RAISE EXCEPTION 'p_radius_m requires a point';
+  END IF;
+  IF v_sort = 'distance' AND v_point IS NULL THEN
+    RAISE EXCEPTION 'sort by distance requires a point';
+  END IF;
+
+  -- тип можно передать как id или как имя
+  IF p_type ~ '^\d+$' THEN
+    v_type_id := p_type::INT;
+  ELSIF p_type IS NOT NULL THEN
+    SELECT t.id INTO v_type_id FROM document_types t WHERE t.name = p_type::citext;
+    IF v_type_id IS NULL THEN RETURN; END IF;
+  END IF;
+
+  RETURN QUERY
+  WITH page AS (
+    SELECT
+      d.*,
+      CASE WHEN v_query IS NOT NULL THEN ts_rank(s.tsv, v_query) END AS rnk,
+      s.file_text AS ftext,
+      CASE WHEN v_point IS NOT NULL THEN ST_Distance(d.geom::geography, v_point) END AS dist,
+      count(*) OVER () AS total
+    FROM _visible_documents(v_uid, v_read_all) d
+    LEFT JOIN document_search s ON s.document_id = d.id
+    WHERE (v_query IS NULL OR s.tsv @@ v_query)
+      AND (p_tag IS NULL OR EXISTS (
+            SELECT 1 FROM document_tags x JOIN tags tg ON tg.id = x.tag_id
+            WHERE x.document_id = d.id AND tg.name = p_tag::citext))
+      AND (p_author IS NULL OR d.author ILIKE '%' || _like_escape(p_author) || '%')
+      AND (v_type_id IS NULL OR d.type_id = v_type_id)
+      AND (p_date_from IS NULL OR d.document_date >= p_date_from)
+      AND (p_date_to IS NULL OR d.document_date <= p_date_to)
+      AND (v_bbox IS NULL OR (d.geom && v_bbox AND ST_Intersects(d.geom, v_bbox)))
+      AND (v_area IS NULL OR (v_relation = 'intersects' AND ST_Intersects(d.geom, v_area))
+                          OR (v_relation = 'within' AND ST_Within(d.geom, v_area)))
+      AND (v_point IS NULL OR d.geom IS NOT NULL)
+      AND (p_radius_m IS NULL OR ST_DWithin(d.geom::geography, v_point, p_radius_m))
+    ORDER BY
+      CASE WHEN v_sort = 'distance' AND NOT v_desc THEN d.geom::geography <-> v_point END ASC,
+      CASE WHEN v_sort = 'distance' AND v_desc THEN d.geom::geography <-> v_point END DESC,
+      CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN ts_rank(s.tsv, v_query) END ASC,
+      CASE WHEN v_sort = 'relevance' AND v_desc THEN ts_rank(s.tsv, v_query) END DESC,
+      CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(d.title) END ASC,
+      CASE WHEN v_sort = 'title' AND v_desc THEN lower(d.title) END DESC,
+      CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN d.created_at END ASC,
+      CASE WHEN v_sort = 'created_at' AND v_desc THEN d.created_at END DESC,
+      CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(d.updated_at, d.created_at) END ASC,
+      CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(d.updated_at, d.created_at) END DESC,
+      CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN d.document_date END ASC NULLS LAST,
+      CASE WHEN v_sort = 'document_date' AND v_desc THEN d.document_date END DESC NULLS LAST,
+      d.id DESC
+    LIMIT p_limit OFFSET GREATEST(coalesce(p_offset, 0), 0)
+  )
+  -- ts_headline дорогой, поэтому считается только для строк текущей страницы
+  SELECT
+    p.id,
+    p.title,
+    p.privacy,
+    p.created_at,
+    p.created_by,
+    p.updated_at,
+    p.updated_by,
+    p.document_date,
+    p.author,
+    p.type_id,
+    dt.name,
+    ARRAY(SELECT tg.name::TEXT FROM document_tags x JOIN tags tg ON tg.id = x.tag_id WHERE x.document_id = p.id ORDER BY tg.name),
+    p.geojson,
+    (v_edit_any
+      OR (v_uid IS NOT NULL AND p.created_by = v_uid)
+      OR _has_document_grant(p.id, v_uid, TRUE)),
+    (p.created_by IS NOT NULL AND v_uid IS NOT NULL AND p.created_by = v_uid),
+    p.rnk,
+    CASE WHEN v_query IS NOT NULL THEN
+      ts_headline('russian', concat_ws(' … ', p.title, p.author::TEXT, p.ftext), v_query,
+                  'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=25, MinWords=8')
+    END,
+    p.dist,
+    p.total
+  FROM page p
+  LEFT JOIN document_types dt ON dt.id = p.type_id
+  ORDER BY
+    CASE WHEN v_sort = 'distance' AND NOT v_desc THEN p.dist END ASC,
+    CASE WHEN v_sort = 'distance' AND v_desc THEN p.dist END DESC,
+    CASE WHEN v_sort = 'relevance' AND NOT v_desc THEN p.rnk END ASC,
+    CASE WHEN v_sort = 'relevance' AND v_desc THEN p.rnk END DESC,
+    CASE WHEN v_sort = 'title' AND NOT v_desc THEN lower(p.title) END ASC,
+    CASE WHEN v_sort = 'title' AND v_desc THEN lower(p.title) END DESC,
+    CASE WHEN v_sort = 'created_at' AND NOT v_desc THEN p.created_at END ASC,
+    CASE WHEN v_sort = 'created_at' AND v_desc THEN p.created_at END DESC,
+    CASE WHEN v_sort = 'updated_at' AND NOT v_desc THEN COALESCE(p.updated_at, p.created_at) END ASC,
+    CASE WHEN v_sort = 'updated_at' AND v_desc THEN COALESCE(p.updated_at, p.created_at) END DESC,
+    CASE WHEN v_sort = 'document_date' AND NOT v_desc THEN p.document_date END ASC NULLS LAST,
+    CASE WHEN v_sort = 'document_date' AND v_desc THEN p.document_date END DESC NULLS LAST,
+    p.id DESC;
+END;
+$$;
+
+-- === Группы (изменение — право groups.manage; просмотр — любой пользователь) ===
+
+CREATE OR REPLACE FUNCTION fn_list_groups(p_requester_id INT)
+RETURNS TABLE (id INT, name citext, description TEXT, created_at TIMESTAMPTZ, member_count BIGINT, is_member BOOLEAN)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_requester_id IS NULL THEN RAISE EXCEPTION 'p_requester_id is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  RETURN QUERY
+  SELECT g.id, g.name, g.description, g.created_at,
+         (SELECT count(*) FROM group_members gm WHERE gm.group_id = g.id),
+         EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = g.id AND gm.user_id = p_requester_id)
+  FROM groups g
+  ORDER BY g.name;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_create_group(p_requester_id INT, p_name TEXT, p_description TEXT)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_id INT;
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'groups.manage');
+  IF p_name IS NULL OR btrim(p_name) = '' THEN RAISE EXCEPTION 'p_name is required and must not be blank' USING ERRCODE = 'invalid_parameter_value'; END IF;
+
+  INSERT INTO groups (name, description, created_by)
+  VALUES (btrim(p_name)::citext, nullif(btrim(p_description), ''), p_requester_id)
+  RETURNING groups.id INTO v_id;
+
+  PERFORM _log_action(p_requester_id, 'create', 'groups', v_id, 'create_group',
+    jsonb_build_object('new', jsonb_build_object('name', btrim(p_name))));
+  RETURN v_id;
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Group % already exists', btrim(p_name) USING ERRCODE = 'unique_violation';
+END; $$;
+
+-- NULL — поле не меняется
+CREATE OR REPLACE FUNCTION fn_update_group(p_requester_id INT, p_group_id INT, p_name TEXT, p_description TEXT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_old groups%ROWTYPE;
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'groups.manage');
+  IF p_name IS NOT NULL AND btrim(p_name) = '' THEN RAISE EXCEPTION 'p_name must not be blank' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  SELECT * INTO v_old FROM groups g WHERE g.id = p_group_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'group % not found', p_group_id USING ERRCODE = 'no_data_found'; END IF;
+
+  UPDATE groups SET
+    name = coalesce(btrim(p_name)::citext, name),
+    description = CASE WHEN p_description IS NULL THEN description ELSE nullif(btrim(p_description), '') END
+  WHERE id = p_group_id;
+
+  PERFORM _log_action(p_requester_id, 'update', 'groups', p_group_id, 'update_group',
+    jsonb_build_object('old', jsonb_build_object('name', v_old.name, 'description', v_old.description),
+                       'new', jsonb_build_object('name', p_name, 'description', p_description)));
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Group % already exists', btrim(p_name) USING ERRCODE = 'unique_violation';
+END; $$;
+
+-- Удаление группы снимает и её доступы к документам (ON DELETE CASCADE)
+CREATE OR REPLACE FUNCTION fn_delete_group(p_requester_id INT, p_group_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_name citext;
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'groups.manage');
+  DELETE FROM groups g WHERE g.id = p_group_id RETURNING g.name INTO v_name;
+  IF NOT FOUND THEN RAISE EXCEPTION 'group % not found', p_group_id USING ERRCODE = 'no_data_found'; END IF;
+
+  PERFORM _log_action(p_requester_id, 'delete', 'groups', p_group_id, 'delete_group',
+    jsonb_build_object('old', jsonb_build_object('name', v_name)));
+END; $$;
+
+-- Состав группы видят её участники и пользователи с groups.manage
+CREATE OR REPLACE FUNCTION fn_list_group_members(p_requester_id INT, p_group_id INT)
+RETURNS TABLE (user_id INT, login citext, full_name TEXT, added_at TIMESTAMPTZ)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM groups g WHERE g.id = p_group_id) THEN RAISE EXCEPTION 'group % not found', p_group_id USING ERRCODE = 'no_data_found'; END IF;
+  IF NOT (has_permission(p_requester_id, 'groups.manage')
+          OR EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = p_group_id AND gm.user_id = p_requester_id)) THEN
+    RAISE EXCEPTION 'permission groups.manage required' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  SELECT u.id, u.login, u.full_name, gm.added_at
+  FROM group_members gm JOIN users u ON u.id = gm.user_id
+  WHERE gm.group_id = p_group_id
+  ORDER BY u.login;
+END; $$;
+
+-- Добавление пачкой; уже состоящие в группе пропускаются. Возвращает число добавленных.
+CREATE OR REPLACE FUNCTION fn_add_group_members(p_requester_id INT, p_group_id INT, p_user_ids INT[])
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_missing INT;
+  v_added INT[];
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'groups.manage');
+  IF NOT EXISTS (SELECT 1 FROM groups g WHERE g.id = p_group_id) THEN RAISE EXCEPTION 'group % not found', p_group_id USING ERRCODE = 'no_data_found'; END IF;
+  IF p_user_ids IS NULL OR cardinality(p_user_ids) = 0 THEN RAISE EXCEPTION 'p_user_ids must not be empty' USING ERRCODE = 'invalid_parameter_value'; END IF;
+
+  SELECT x INTO v_missing FROM unnest(p_user_ids) x
+  WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = x) LIMIT 1;
+  IF v_missing IS NOT NULL THEN RAISE EXCEPTION 'user % not found', v_missing USING ERRCODE = 'no_data_found'; END IF;
+
+  WITH ins AS (
+    INSERT INTO group_members (group_id, user_id, added_by)
+    SELECT DISTINCT p_group_id, x, p_requester_id FROM unnest(p_user_ids) x
+    ON CONFLICT DO NOTHING
+    RETURNING group_members.user_id
+  )
+  SELECT coalesce(array_agg(ins.user_id ORDER BY ins.user_id), '{}') INTO v_added FROM ins;
+
+  IF cardinality(v_added) > 0 THEN
+    PERFORM _log_action(p_requester_id, 'update', 'groups', p_group_id, 'add_group_members',
+      jsonb_build_object('new', jsonb_build_object('user_ids', v_added)));
+  END IF;
+  RETURN cardinality(v_added);
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_remove_group_member(p_requester_id INT, p_group_id INT, p_user_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_requester_id, 'groups.manage');
+  DELETE FROM group_members WHERE group_id = p_group_id AND user_id = p_user_id;
+  IF NOT FOUND THEN RAISE EXCEPTION 'user % is not a member of group %', p_user_id, p_group_id USING ERRCODE = 'no_data_found'; END IF;
+
+  PERFORM _log_action(p_requester_id, 'update', 'groups', p_group_id, 'remove_group_member',
+    jsonb_build_object('old', jsonb_build_object('user_id', p_user_id)));
+END; $$;
+
+-- === Доступ группы к документу (право permissions.manage, как и для пользователей) ===
+
+CREATE OR REPLACE FUNCTION fn_set_document_group_permission(p_document_id INT, p_user_id INT, p_group_id INT, p_can_view BOOLEAN, p_can_edit BOOLEAN)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id) THEN RAISE EXCEPTION 'Document % does not exist', p_document_id USING ERRCODE = 'no_data_found'; END IF;
+  IF NOT EXISTS (SELECT 1 FROM groups g WHERE g.id = p_group_id) THEN RAISE EXCEPTION 'group % not found', p_group_id USING ERRCODE = 'no_data_found'; END IF;
+
+  INSERT INTO document_group_permissions (document_id, group_id, can_view, can_edit)
+    VALUES (p_document_id, p_group_id, coalesce(p_can_view, FALSE), coalesce(p_can_edit, FALSE))
+    ON CONFLICT (document_id, group_id) DO UPDATE SET can_view = EXCLUDED.can_view, can_edit = EXCLUDED.can_edit;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'set_group_permission',
+    jsonb_build_object('new', jsonb_build_object('group_id', p_group_id, 'can_view', p_can_view, 'can_edit', p_can_edit)));
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_remove_document_group_permission(p_document_id INT, p_user_id INT, p_group_id INT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  DELETE FROM document_group_permissions WHERE document_id = p_document_id AND group_id = p_group_id;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'remove_group_permission',
+    jsonb_build_object('old', jsonb_build_object('group_id', p_group_id)));
+END; $$;
@@ -0,0 +1,70 @@
+DROP FUNCTION IF EXISTS fn_purge_expired_document_permissions();
+DROP FUNCTION IF EXISTS fn_set_document_permission(INT, INT, INT, BOOLEAN, BOOLEAN, BOOLEAN, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS fn_set_document_group_permission(INT, INT, INT, BOOLEAN, BOOLEAN, BOOLEAN, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS _check_document_share(INT, INT, INT, BOOLEAN, BOOLEAN, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS _can_user_share_document(INT, INT);
+DROP FUNCTION IF EXISTS _is_document_delegate(INT, INT);
+DROP FUNCTION IF EXISTS _document_share_expires_at(INT, INT);
+DROP FUNCTION IF EXISTS _has_document_grant(INT, INT, BOOLEAN, BOOLEAN);
+
+-- восстановление определений из 000009/000010
+CREATE OR REPLACE FUNCTION _has_document_grant(p_document_id INT, p_user_id INT, p_edit BOOLEAN)
+RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+  SELECT p_user_id IS NOT NULL AND (
+    EXISTS (
+      SELECT 1 FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND dp.user_id = p_user_id
+        AND (dp.can_edit OR (NOT p_edit AND dp.can_view)))
+    OR EXISTS (
+      SELECT 1 FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND gm.user_id = p_user_id
+        AND (gp.can_edit OR (NOT p_edit AND gp.can_view))))
+$$;
+
+CREATE OR REPLACE FUNCTION fn_set_document_permission(p_document_id INT, p_user_id INT, p_target_user_id INT, p_can_view BOOLEAN, p_can_edit BOOLEAN)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  INSERT INTO document_permissions (document_id, user_id, can_view, can_edit)
+    VALUES (p_document_id, p_target_user_id, p_can_view, p_can_edit)
+    ON CONFLICT (document_id,user_id) DO UPDATE SET can_view = EXCLUDED.can_view, can_edit = EXCLUDED.can_edit;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_remove_document_permission(p_document_id INT, p_user_id INT, p_target_user_id INT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  DELETE FROM document_permissions WHERE document_id = p_document_id AND user_id = p_target_user_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_set_document_group_permission(p_document_id INT, p_user_id INT, p_group_id INT, p_can_view BOOLEAN, p_can_edit BOOLEAN)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id) THEN RAISE EXCEPTION 'Document % does not exist', p_document_id; END IF;
+  IF NOT EXISTS (SELECT 1 FROM groups g WHERE g.id = p_group_id) THEN RAISE EXCEPTION 'group % not found', p_group_id; END IF;
+
+  INSERT INTO document_group_permissions (document_id, group_id, can_view, can_edit)
+    VALUES (p_document_id, p_group_id, coalesce(p_can_view, FALSE), coalesce(p_can_edit, FALSE))
+    ON CONFLICT (document_id, group_id) DO UPDATE SET can_view = EXCLUDED.can_view, can_edit = EXCLUDED.can_edit;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'set_group_permission',
+    jsonb_build_object('new', jsonb_build_object('group_id', p_group_id, 'can_view', p_can_view, 'can_edit', p_can_edit)));
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_remove_document_group_permission(p_document_id INT, p_user_id INT, p_group_id INT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_user_id, 'permissions.manage');
+  DELETE FROM document_group_permissions WHERE document_id = p_document_id AND group_id = p_group_id;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'remove_group_permission',
+    jsonb_build_object('old', jsonb_build_object('group_id', p_group_id)));
+END; $$;
+
+DROP INDEX IF EXISTS document_group_permissions_expires_idx;
+DROP INDEX IF EXISTS document_permissions_expires_idx;
+ALTER TABLE document_group_permissions DROP COLUMN IF EXISTS granted_by, DROP COLUMN IF EXISTS expires_at, DROP COLUMN IF EXISTS can_share;
+ALTER TABLE document_permissions DROP COLUMN IF EXISTS granted_by, DROP COLUMN IF EXISTS expires_at, DROP COLUMN IF EXISTS can_share;
@@ -0,0 +1,218 @@
+-- === Срочные и делегируемые права на документы ===
+-- expires_at: NULL — бессрочно; истёкшие записи не учитываются ни одной проверкой
+-- и периодически удаляются fn_purge_expired_document_permissions.
+-- can_share: право делиться документом дальше (выдавать/снимать доступ) без permissions.manage.
+
+ALTER TABLE document_permissions
+  ADD COLUMN IF NOT EXISTS can_share BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+ALTER TABLE document_group_permissions
+  ADD COLUMN IF NOT EXISTS can_share BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS document_permissions_expires_idx
+  ON document_permissions (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS document_group_permissions_expires_idx
+  ON document_group_permissions (expires_at) WHERE expires_at IS NOT NULL;
+
+-- кто выдал доступ: делегат может менять и снимать только свои выдачи
+ALTER TABLE document_permissions
+  ADD COLUMN IF NOT EXISTS granted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE document_group_permissions
+  ADD COLUMN IF NOT EXISTS granted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- p_share — нужен действующий can_share (p_edit тогда не учитывается)
+DROP FUNCTION IF EXISTS _has_document_grant(INT, INT, BOOLEAN);
+CREATE OR REPLACE FUNCTION _has_document_grant(p_document_id INT, p_user_id INT, p_edit BOOLEAN, p_share BOOLEAN DEFAULT FALSE)
+RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+  SELECT p_user_id IS NOT NULL AND (
+    EXISTS (
+      SELECT 1 FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND dp.user_id = p_user_id
+        AND (dp.expires_at IS NULL OR dp.expires_at > now())
+        AND CASE WHEN p_share THEN dp.can_share ELSE dp.can_edit OR (NOT p_edit AND dp.can_view) END)
+    OR EXISTS (
+      SELECT 1 FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND gm.user_id = p_user_id
+        AND (gp.expires_at IS NULL OR gp.expires_at > now())
+        AND CASE WHEN p_share THEN gp.can_share ELSE gp.can_edit OR (NOT p_edit AND gp.can_view) END))
+$$;
+
+-- Срок действующего can_share пользователя: самый поздний из личных и групповых; NULL — бессрочно
+CREATE OR REPLACE FUNCTION _document_share_expires_at(p_document_id INT, p_user_id INT)
+RETURNS TIMESTAMPTZ
+LANGUAGE sql STABLE AS $$
+  SELECT CASE WHEN bool_or(s.expires_at IS NULL) THEN NULL ELSE max(s.expires_at) END
+  FROM (
+    SELECT dp.expires_at FROM document_permissions dp
+    WHERE dp.document_id = p_document_id AND dp.user_id = p_user_id AND dp.can_share
+      AND (dp.expires_at IS NULL OR dp.expires_at > now())
+    UNION ALL
+    SELECT gp.expires_at FROM document_group_permissions gp
+    JOIN group_members gm ON gm.group_id = gp.group_id
+    WHERE gp.document_id = p_document_id AND gm.user_id = p_user_id AND gp.can_share
+      AND (gp.expires_at IS NULL OR gp.expires_at > now())) s
+$$;
+
+-- Делегат делится документом только через can_share: он не автор и без permissions.manage
+CREATE OR REPLACE FUNCTION _is_document_delegate(p_user_id INT, p_document_id INT)
+RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+  SELECT NOT has_permission(p_user_id, 'permissions.manage')
+     AND NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.created_by = p_user_id)
+$$;
+
+-- Кто может выдавать и снимать доступ к документу: permissions.manage,
+-- автор документа и обладатели действующего can_share (лично или через группу)
+CREATE OR REPLACE FUNCTION _can_user_share_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RETURN FALSE; END IF;
+  IF has_permission(p_user_id, 'permissions.manage') THEN RETURN TRUE; END IF;
+  IF EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.created_by = p_user_id) THEN RETURN TRUE; END IF;
+  RETURN _has_document_grant(p_document_id, p_user_id, FALSE, TRUE);
+END; $$;
+
+-- Проверки перед выдачей доступа; возвращает срок, с которым доступ будет выдан.
+-- can_share выдаёт только permissions.manage. Делегат не может выдать больше, чем имеет сам:
+-- can_edit — только если сам редактирует, срок — не дольше собственного can_share;
+-- и не может менять собственный доступ (например, продлевать его).
+CREATE OR REPLACE FUNCTION _check_document_share(
+  p_document_id INT, p_user_id INT, p_target_user_id INT,
+  p_can_edit BOOLEAN, p_can_share BOOLEAN, p_expires_at TIMESTAMPTZ)
+RETURNS TIMESTAMPTZ
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_limit TIMESTAMPTZ;
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id) THEN
+    RAISE EXCEPTION 'Document % does not exist', p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+  IF NOT _can_user_share_document(p_user_id, p_document_id) THEN RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege'; END IF;
+  IF p_expires_at IS NOT NULL AND p_expires_at <= now() THEN
+    RAISE EXCEPTION 'expires_at must be in the future' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  IF coalesce(p_can_share, FALSE) AND NOT has_permission(p_user_id, 'permissions.manage') THEN
+    RAISE EXCEPTION 'permission permissions.manage required to grant can_share' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  IF NOT _is_document_delegate(p_user_id, p_document_id) THEN RETURN p_expires_at; END IF;
+  IF p_target_user_id IS NOT NULL AND p_target_user_id = p_user_id THEN
+    RAISE EXCEPTION 'cannot change own permissions' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  IF coalesce(p_can_edit, FALSE) AND NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'cannot grant edit access without edit access' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  v_limit := _document_share_expires_at(p_document_id, p_user_id);
+  IF v_limit IS NOT NULL AND (p_expires_at IS NULL OR p_expires_at > v_limit) THEN
+    RETURN v_limit;
+  END IF;
+  RETURN p_expires_at;
+END; $$;
+
+DROP FUNCTION IF EXISTS fn_set_document_permission(INT, INT, INT, BOOLEAN, BOOLEAN);
+CREATE OR REPLACE FUNCTION fn_set_document_permission(
+  p_document_id INT, p_user_id INT, p_target_user_id INT,
+  p_can_view BOOLEAN, p_can_edit BOOLEAN, p_can_share BOOLEAN, p_expires_at TIMESTAMPTZ)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_expires TIMESTAMPTZ;
+BEGIN
+  v_expires := _check_document_share(p_document_id, p_user_id, p_target_user_id, p_can_edit, p_can_share, p_expires_at);
+  IF NOT EXISTS (SELECT 1 FROM users u WHERE u.id = p_target_user_id) THEN
+    RAISE EXCEPTION 'user % not found', p_target_user_id USING ERRCODE = 'no_data_found';
+  END IF;
+  IF _is_document_delegate(p_user_id, p_document_id) AND EXISTS (
+       SELECT 1 FROM document_permissions dp
+       WHERE dp.document_id = p_document_id AND dp.user_id = p_target_user_id
+         AND dp.granted_by IS DISTINCT FROM p_user_id) THEN
+    RAISE EXCEPTION 'permission was granted by another user' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  INSERT INTO document_permissions (document_id, user_id, can_view, can_edit, can_share, expires_at, granted_by)
+    VALUES (p_document_id, p_target_user_id, coalesce(p_can_view, FALSE), coalesce(p_can_edit, FALSE), coalesce(p_can_share, FALSE), v_expires, p_user_id)
+    ON CONFLICT (document_id, user_id) DO UPDATE
+      SET can_view = EXCLUDED.can_view, can_edit = EXCLUDED.can_edit,
+          can_share = EXCLUDED.can_share, expires_at = EXCLUDED.expires_at, granted_by = EXCLUDED.granted_by;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'set_permission',
+    jsonb_build_object('new', jsonb_build_object('user_id', p_target_user_id, 'can_view', p_can_view,
+      'can_edit', p_can_edit, 'can_share', p_can_share, 'expires_at', v_expires)));
+END; $$;
+
+-- делегат снимает только выданный им доступ
+CREATE OR REPLACE FUNCTION fn_remove_document_permission(p_document_id INT, p_user_id INT, p_target_user_id INT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT _can_user_share_document(p_user_id, p_document_id) THEN RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege'; END IF;
+  IF _is_document_delegate(p_user_id, p_document_id) AND EXISTS (
+       SELECT 1 FROM document_permissions dp
+       WHERE dp.document_id = p_document_id AND dp.user_id = p_target_user_id
+         AND dp.granted_by IS DISTINCT FROM p_user_id) THEN
+    RAISE EXCEPTION 'permission was granted by another user' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  DELETE FROM document_permissions WHERE document_id = p_document_id AND user_id = p_target_user_id;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'remove_permission',
+    jsonb_build_object('old', jsonb_build_object('user_id', p_target_user_id)));
+END; $$;
+
+DROP FUNCTION IF EXISTS fn_set_document_group_permission(INT, INT, INT, BOOLEAN, BOOLEAN);
+CREATE OR REPLACE FUNCTION fn_set_document_group_permission(
+  p_document_id INT, p_user_id INT, p_group_id INT,
+  p_can_view BOOLEAN, p_can_edit BOOLEAN, p_can_share BOOLEAN, p_expires_at TIMESTAMPTZ)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_expires TIMESTAMPTZ;
+BEGIN
+  v_expires := _check_document_share(p_document_id, p_user_id, NULL, p_can_edit, p_can_share, p_expires_at);
+  IF NOT EXISTS (SELECT 1 FROM groups g WHERE g.id = p_group_id) THEN
+    RAISE EXCEPTION 'group % not found', p_group_id USING ERRCODE = 'no_data_found';
+  END IF;
+  IF _is_document_delegate(p_user_id, p_document_id) AND EXISTS (
+       SELECT 1 FROM document_group_permissions gp
+       WHERE gp.document_id = p_document_id AND gp.group_id = p_group_id
+         AND gp.granted_by IS DISTINCT FROM p_user_id) THEN
+    RAISE EXCEPTION 'permission was granted by another user' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  INSERT INTO document_group_permissions (document_id, group_id, can_view, can_edit, can_share, expires_at, granted_by)
+    VALUES (p_document_id, p_group_id, coalesce(p_can_view, FALSE), coalesce(p_can_edit, FALSE), coalesce(p_can_share, FALSE), v_expires, p_user_id)
+    ON CONFLICT (document_id, group_id) DO UPDATE
+      SET can_view = EXCLUDED.can_view, can_edit = EXCLUDED.can_edit,
+          can_share = EXCLUDED.can_share, expires_at = EXCLUDED.expires_at, granted_by = EXCLUDED.granted_by;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'set_group_permission',
+    jsonb_build_object('new', jsonb_build_object('group_id', p_group_id, 'can_view', p_can_view,
+      'can_edit', p_can_edit, 'can_share', p_can_share, 'expires_at', v_expires)));
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_remove_document_group_permission(p_document_id INT, p_user_id INT, p_group_id INT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT _can_user_share_document(p_user_id, p_document_id) THEN RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege'; END IF;
+  IF _is_document_delegate(p_user_id, p_document_id) AND EXISTS (
+       SELECT 1 FROM document_group_permissions gp
+       WHERE gp.document_id = p_document_id AND gp.group_id = p_group_id
+         AND gp.granted_by IS DISTINCT FROM p_user_id) THEN
+    RAISE EXCEPTION 'permission was granted by another user' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  DELETE FROM document_group_permissions WHERE document_id = p_document_id AND group_id = p_group_id;
+
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'remove_group_permission',
+    jsonb_build_object('old', jsonb_build_object('group_id', p_group_id)));
+END; $$;
+
+-- Фоновая очистка истёкших прав; возвращает число удалённых записей
+CREATE OR REPLACE FUNCTION fn_purge_expired_document_permissions()
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_users INT; v_groups INT;
+BEGIN
+  DELETE FROM document_permissions WHERE expires_at IS NOT NULL AND expires_at <= now();
+  GET DIAGNOSTICS v_users = ROW_COUNT;
+  DELETE FROM document_group_permissions WHERE expires_at IS NOT NULL AND expires_at <= now();
+  GET DIAGNOSTICS v_groups = ROW_COUNT;
+  RETURN v_users + v_groups;
+END; $$;
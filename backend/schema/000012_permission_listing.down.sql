@@ -0,0 +1,38 @@
+DROP FUNCTION IF EXISTS fn_get_documents_shared_with_me(INT);
+DROP FUNCTION IF EXISTS fn_get_document_permissions(INT, INT);
+
+-- восстановление определения из 000009
+DROP FUNCTION IF EXISTS fn_get_document_by_id(INT, INT);
+CREATE OR REPLACE FUNCTION fn_get_document_by_id(p_document_id INT, p_requester_id INT DEFAULT NULL)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  geom geometry(Geometry,4326),
+  can_edit BOOLEAN
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id;
+  END IF;
+
+  RETURN QUERY
+    SELECT d.id, d.title, d.privacy, d.created_at, d.created_by, d.updated_at, d.updated_by,
+           d.document_date, d.author, d.type_id, d.file_meta, d.geojson, d.geom,
+           _can_user_edit_document(p_requester_id, d.id) AS can_edit
+    FROM documents d
+    WHERE d.id = p_document_id;
+END;
+$$;
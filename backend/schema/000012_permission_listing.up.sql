@@ -0,0 +1,147 @@
+-- === Просмотр выданных доступов и «доступные мне» ===
+
+-- Действующие (не истёкшие) доступы к документу: личные и групповые.
+-- Видны тем, кто может ими управлять (_can_user_share_document).
+CREATE OR REPLACE FUNCTION fn_get_document_permissions(p_document_id INT, p_requester_id INT)
+RETURNS TABLE (
+  grantee_type TEXT,
+  user_id INT,
+  login citext,
+  full_name TEXT,
+  group_id INT,
+  group_name citext,
+  can_view BOOLEAN,
+  can_edit BOOLEAN,
+  can_share BOOLEAN,
+  expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id) THEN RAISE EXCEPTION 'Document % does not exist', p_document_id USING ERRCODE = 'no_data_found'; END IF;
+  IF NOT _can_user_share_document(p_requester_id, p_document_id) THEN RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege'; END IF;
+
+  RETURN QUERY
+  SELECT 'user'::TEXT, u.id, u.login, u.full_name, NULL::INT, NULL::citext,
+         dp.can_view, dp.can_edit, dp.can_share, dp.expires_at
+  FROM document_permissions dp JOIN users u ON u.id = dp.user_id
+  WHERE dp.document_id = p_document_id AND (dp.expires_at IS NULL OR dp.expires_at > now())
+  UNION ALL
+  SELECT 'group'::TEXT, NULL::INT, NULL::citext, NULL::TEXT, g.id, g.name,
+         gp.can_view, gp.can_edit, gp.can_share, gp.expires_at
+  FROM document_group_permissions gp JOIN groups g ON g.id = gp.group_id
+  WHERE gp.document_id = p_document_id AND (gp.expires_at IS NULL OR gp.expires_at > now())
+  ORDER BY 1 DESC, 3, 6;
+END; $$;
+
+-- Документы, которые пользователь видит только благодаря явному доступу:
+-- не свои и не публичные; documents.read_all здесь не учитывается.
+-- Личные и групповые доступы сводятся в один уровень (максимальный),
+-- expires_at — самый поздний срок (NULL, если есть бессрочный доступ).
+CREATE OR REPLACE FUNCTION fn_get_documents_shared_with_me(p_requester_id INT)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  updated_at TIMESTAMPTZ,
+  document_date DATE,
+  type_id INT,
+  author citext,
+  created_by INT,
+  created_by_login citext,
+  can_edit BOOLEAN,
+  can_share BOOLEAN,
+  expires_at TIMESTAMPTZ,
+  via_groups TEXT[]
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_requester_id IS NULL THEN RAISE EXCEPTION 'p_requester_id is required'; END IF;
+
+  RETURN QUERY
+  WITH grants AS (
+    SELECT dp.document_id, dp.can_edit, dp.can_share, dp.expires_at, NULL::TEXT AS group_name
+    FROM document_permissions dp
+    WHERE dp.user_id = p_requester_id AND (dp.can_view OR dp.can_edit)
+      AND (dp.expires_at IS NULL OR dp.expires_at > now())
+    UNION ALL
+    SELECT gp.document_id, gp.can_edit, gp.can_share, gp.expires_at, g.name::TEXT
+    FROM document_group_permissions gp
+    JOIN group_members gm ON gm.group_id = gp.group_id AND gm.user_id = p_requester_id
+    JOIN groups g ON g.id = gp.group_id
+    WHERE (gp.can_view OR gp.can_edit)
+      AND (gp.expires_at IS NULL OR gp.expires_at > now())
+  )
+  SELECT d.id, d.title, d.privacy, d.updated_at, d.document_date, d.type_id, d.author,
+         d.created_by, u.login,
+         bool_or(gr.can_edit),
+         bool_or(gr.can_share),
+         CASE WHEN bool_or(gr.expires_at IS NULL) THEN NULL ELSE max(gr.expires_at) END,
+         coalesce(array_agg(DISTINCT gr.group_name) FILTER (WHERE gr.group_name IS NOT NULL), '{}')
+  FROM grants gr
+  JOIN documents d ON d.id = gr.document_id
+  LEFT JOIN users u ON u.id = d.created_by
+  WHERE d.privacy <> 'public'::privacy_type
+    AND d.created_by IS DISTINCT FROM p_requester_id
+  GROUP BY d.id, u.login
+  ORDER BY d.updated_at DESC NULLS LAST, d.id DESC;
+END; $$;
+
+-- Карточка документа: viewers/editors — пользователи с действующим явным доступом
+-- (лично или через группу); заполняются только для тех, кто управляет доступом.
+DROP FUNCTION IF EXISTS fn_get_document_by_id(INT, INT);
+CREATE OR REPLACE FUNCTION fn_get_document_by_id(p_document_id INT, p_requester_id INT DEFAULT NULL)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  geom geometry(Geometry,4326),
+  can_edit BOOLEAN,
+  viewers INT[],
+  editors INT[]
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_viewers INT[];
+  v_editors INT[];
+BEGIN
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id;
+  END IF;
+
+  IF _can_user_share_document(p_requester_id, p_document_id) THEN
+    WITH grantees AS (
+      SELECT dp.user_id, dp.can_edit FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND (dp.can_view OR dp.can_edit)
+        AND (dp.expires_at IS NULL OR dp.expires_at > now())
+      UNION ALL
+      SELECT gm.user_id, gp.can_edit FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND (gp.can_view OR gp.can_edit)
+        AND (gp.expires_at IS NULL OR gp.expires_at > now())
+    )
+    SELECT coalesce(array_agg(DISTINCT g.user_id), '{}'),
+           coalesce(array_agg(DISTINCT g.user_id) FILTER (WHERE g.can_edit), '{}')
+    INTO v_viewers, v_editors
+    FROM grantees g;
+  END IF;
+
+  RETURN QUERY
+    SELECT d.id, d.title, d.privacy, d.created_at, d.created_by, d.updated_at, d.updated_by,
+           d.document_date, d.author, d.type_id, d.file_meta, d.geojson, d.geom,
+           _can_user_edit_document(p_requester_id, d.id) AS can_edit,
+           v_viewers, v_editors
+    FROM documents d
+    WHERE d.id = p_document_id;
+END;
+$$;
@@ -0,0 +1,65 @@
+DROP FUNCTION IF EXISTS fn_cancel_access_request(INT, INT);
+DROP FUNCTION IF EXISTS fn_decide_access_request(INT, INT, BOOLEAN, TEXT, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS fn_list_incoming_access_requests(INT, TEXT);
+DROP FUNCTION IF EXISTS fn_list_my_access_requests(INT);
+DROP FUNCTION IF EXISTS fn_request_document_access(INT, INT, TEXT, TEXT);
+
+-- восстановление определения из 000012
+CREATE OR REPLACE FUNCTION fn_get_document_by_id(p_document_id INT, p_requester_id INT DEFAULT NULL)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  geom geometry(Geometry,4326),
+  can_edit BOOLEAN,
+  viewers INT[],
+  editors INT[]
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_viewers INT[];
+  v_editors INT[];
+BEGIN
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id;
+  END IF;
+
+  IF _can_user_share_document(p_requester_id, p_document_id) THEN
+    WITH grantees AS (
+      SELECT dp.user_id, dp.can_edit FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND (dp.can_view OR dp.can_edit)
+        AND (dp.expires_at IS NULL OR dp.expires_at > now())
+      UNION ALL
+      SELECT gm.user_id, gp.can_edit FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND (gp.can_view OR gp.can_edit)
+        AND (gp.expires_at IS NULL OR gp.expires_at > now())
+    )
+    SELECT coalesce(array_agg(DISTINCT g.user_id), '{}'),
+           coalesce(array_agg(DISTINCT g.user_id) FILTER (WHERE g.can_edit), '{}')
+    INTO v_viewers, v_editors
+    FROM grantees g;
+  END IF;
+
+  RETURN QUERY
+    SELECT d.id, d.title, d.privacy, d.created_at, d.created_by, d.updated_at, d.updated_by,
+           d.document_date, d.author, d.type_id, d.file_meta, d.geojson, d.geom,
+           _can_user_edit_document(p_requester_id, d.id) AS can_edit,
+           v_viewers, v_editors
+    FROM documents d
+    WHERE d.id = p_document_id;
+END;
+$$;
+
+DROP TABLE IF EXISTS document_access_requests;
@@ -0,0 +1,245 @@
+-- === Запросы доступа к закрытым документам ===
+-- Пользователь без доступа просит view/edit с обоснованием; решение принимает тот,
+-- кто может выдавать доступ к документу (_can_user_share_document). Одобрение
+-- создаёт/обновляет строку document_permissions.
+--
+-- Ошибки, которые должен различать API, поднимаются с явным SQLSTATE:
+--   insufficient_privilege (42501) -> 403, no_data_found (P0002) -> 404,
+--   unique_violation (23505) / object_not_in_prerequisite_state (55000) -> 409.
+
+CREATE TABLE IF NOT EXISTS document_access_requests (
+  id SERIAL PRIMARY KEY,
+  document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  level TEXT NOT NULL CHECK (level IN ('view', 'edit')),
+  reason TEXT,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  decided_at TIMESTAMPTZ,
+  decided_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  decision_comment TEXT,
+  grant_expires_at TIMESTAMPTZ
+);
+-- не больше одного открытого запроса пользователя на документ
+CREATE UNIQUE INDEX IF NOT EXISTS document_access_requests_pending_uidx
+  ON document_access_requests (document_id, user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS document_access_requests_user_idx ON document_access_requests (user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS document_access_requests_doc_idx ON document_access_requests (document_id) WHERE status = 'pending';
+
+CREATE OR REPLACE FUNCTION fn_get_document_by_id(p_document_id INT, p_requester_id INT DEFAULT NULL)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  geom geometry(Geometry,4326),
+  can_edit BOOLEAN,
+  viewers INT[],
+  editors INT[]
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_viewers INT[];
+  v_editors INT[];
+BEGIN
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege', HINT = 'request access: POST /api/documents/:id/access-requests';
+  END IF;
+
+  IF _can_user_share_document(p_requester_id, p_document_id) THEN
+    WITH grantees AS (
+      SELECT dp.user_id, dp.can_edit FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND (dp.can_view OR dp.can_edit)
+        AND (dp.expires_at IS NULL OR dp.expires_at > now())
+      UNION ALL
+      SELECT gm.user_id, gp.can_edit FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND (gp.can_view OR gp.can_edit)
+        AND (gp.expires_at IS NULL OR gp.expires_at > now())
+    )
+    SELECT coalesce(array_agg(DISTINCT g.user_id), '{}'),
+           coalesce(array_agg(DISTINCT g.user_id) FILTER (WHERE g.can_edit), '{}')
+    INTO v_viewers, v_editors
+    FROM grantees g;
+  END IF;
+
+  RETURN QUERY
+    SELECT d.id, d.title, d.privacy, d.created_at, d.created_by, d.updated_at, d.updated_by,
+           d.document_date, d.author, d.type_id, d.file_meta, d.geojson, d.geom,
+           _can_user_edit_document(p_requester_id, d.id) AS can_edit,
+           v_viewers, v_editors
+    FROM documents d
+    WHERE d.id = p_document_id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_request_document_access(p_user_id INT, p_document_id INT, p_level TEXT, p_reason TEXT)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_id INT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  IF p_level IS NULL OR p_level NOT IN ('view', 'edit') THEN RAISE EXCEPTION 'level must be view or edit' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id) THEN
+    RAISE EXCEPTION 'Document % does not exist', p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  IF (p_level = 'view' AND _can_user_view_document(p_user_id, p_document_id))
+     OR (p_level = 'edit' AND _can_user_edit_document(p_user_id, p_document_id)) THEN
+    RAISE EXCEPTION 'User % already has % access to document %', p_user_id, p_level, p_document_id
+      USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+
+  INSERT INTO document_access_requests (document_id, user_id, level, reason)
+  VALUES (p_document_id, p_user_id, p_level, nullif(btrim(p_reason), ''))
+  RETURNING id INTO v_id;
+
+  PERFORM _log_action(p_user_id, 'create', 'document_access_requests', v_id, 'request_access',
+    jsonb_build_object('new', jsonb_build_object('document_id', p_document_id, 'level', p_level)));
+  RETURN v_id;
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Access request for document % is already pending', p_document_id USING ERRCODE = 'unique_violation';
+END; $$;
+
+-- Запросы, отправленные пользователем (все статусы)
+CREATE OR REPLACE FUNCTION fn_list_my_access_requests(p_user_id INT)
+RETURNS TABLE (
+  id INT,
+  document_id INT,
+  document_title TEXT,
+  user_id INT,
+  user_login citext,
+  user_full_name TEXT,
+  level TEXT,
+  reason TEXT,
+  status TEXT,
+  created_at TIMESTAMPTZ,
+  decided_at TIMESTAMPTZ,
+  decided_by INT,
+  decided_by_login citext,
+  decision_comment TEXT,
+  grant_expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT r.id, r.document_id, d.title, r.user_id, u.login, u.full_name, r.level, r.reason, r.status,
+         r.created_at, r.decided_at, r.decided_by, dec.login, r.decision_comment, r.grant_expires_at
+  FROM document_access_requests r
+  JOIN documents d ON d.id = r.document_id
+  JOIN users u ON u.id = r.user_id
+  LEFT JOIN users dec ON dec.id = r.decided_by
+  WHERE r.user_id = p_user_id
+  ORDER BY r.created_at DESC;
+END; $$;
+
+-- Очередь на рассмотрение: запросы к документам, доступом к которым пользователь управляет.
+-- p_status NULL — все статусы.
+CREATE OR REPLACE FUNCTION fn_list_incoming_access_requests(p_user_id INT, p_status TEXT)
+RETURNS TABLE (
+  id INT,
+  document_id INT,
+  document_title TEXT,
+  user_id INT,
+  user_login citext,
+  user_full_name TEXT,
+  level TEXT,
+  reason TEXT,
+  status TEXT,
+  created_at TIMESTAMPTZ,
+  decided_at TIMESTAMPTZ,
+  decided_by INT,
+  decided_by_login citext,
+  decision_comment TEXT,
+  grant_expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_manage BOOLEAN := has_permission(p_user_id, 'permissions.manage');
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  RETURN QUERY
+  SELECT r.id, r.document_id, d.title, r.user_id, u.login, u.full_name, r.level, r.reason, r.status,
+         r.created_at, r.decided_at, r.decided_by, dec.login, r.decision_comment, r.grant_expires_at
+  FROM document_access_requests r
+  JOIN documents d ON d.id = r.document_id
+  JOIN users u ON u.id = r.user_id
+  LEFT JOIN users dec ON dec.id = r.decided_by
+  WHERE (p_status IS NULL OR r.status = p_status)
+    AND r.user_id <> p_user_id
+    AND (v_manage OR d.created_by = p_user_id OR _can_user_share_document(p_user_id, d.id))
+  ORDER BY r.created_at;
+END; $$;
+
+-- Одобрение/отклонение. При одобрении доступ не понижается: существующий can_edit
+-- и can_share сохраняются; p_expires_at — срок выдаваемого доступа (NULL — бессрочно;
+-- у делегата срок ограничен его собственным can_share).
+CREATE OR REPLACE FUNCTION fn_decide_access_request(p_user_id INT, p_request_id INT, p_approve BOOLEAN, p_comment TEXT, p_expires_at TIMESTAMPTZ)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_req document_access_requests%ROWTYPE;
+  v_expires TIMESTAMPTZ;
+BEGIN
+  SELECT * INTO v_req FROM document_access_requests r WHERE r.id = p_request_id FOR UPDATE;
+  IF NOT FOUND THEN RAISE EXCEPTION 'access request % not found', p_request_id USING ERRCODE = 'no_data_found'; END IF;
+  IF NOT _can_user_share_document(p_user_id, v_req.document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  IF v_req.status <> 'pending' THEN
+    RAISE EXCEPTION 'access request % is already %', p_request_id, v_req.status USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+
+  IF coalesce(p_approve, FALSE) THEN
+    v_expires := _check_document_share(v_req.document_id, p_user_id, v_req.user_id, v_req.level = 'edit', FALSE, p_expires_at);
+
+    INSERT INTO document_permissions (document_id, user_id, can_view, can_edit, can_share, expires_at, granted_by)
+    VALUES (v_req.document_id, v_req.user_id, TRUE, v_req.level = 'edit', FALSE, v_expires, p_user_id)
+    ON CONFLICT (document_id, user_id) DO UPDATE
+      SET can_view = TRUE,
+          can_edit = document_permissions.can_edit OR EXCLUDED.can_edit,
+          expires_at = EXCLUDED.expires_at;
+  END IF;
+
+  UPDATE document_access_requests SET
+    status = CASE WHEN coalesce(p_approve, FALSE) THEN 'approved' ELSE 'rejected' END,
+    decided_at = now(),
+    decided_by = p_user_id,
+    decision_comment = nullif(btrim(p_comment), ''),
+    grant_expires_at = v_expires
+  WHERE id = p_request_id;
+
+  PERFORM _log_action(p_user_id, 'update', 'document_access_requests', p_request_id,
+    CASE WHEN coalesce(p_approve, FALSE) THEN 'approve_access' ELSE 'reject_access' END,
+    jsonb_build_object('new', jsonb_build_object('document_id', v_req.document_id, 'user_id', v_req.user_id,
+      'level', v_req.level, 'expires_at', v_expires)));
+END; $$;
+
+-- Отзыв собственного открытого запроса
+CREATE OR REPLACE FUNCTION fn_cancel_access_request(p_user_id INT, p_request_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_req document_access_requests%ROWTYPE;
+BEGIN
+  SELECT * INTO v_req FROM document_access_requests r WHERE r.id = p_request_id FOR UPDATE;
+  IF NOT FOUND OR v_req.user_id IS DISTINCT FROM p_user_id THEN
+    RAISE EXCEPTION 'access request % not found', p_request_id USING ERRCODE = 'no_data_found';
+  END IF;
+  IF v_req.status <> 'pending' THEN
+    RAISE EXCEPTION 'access request % is already %', p_request_id, v_req.status USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+
+  UPDATE document_access_requests SET status = 'cancelled', decided_at = now(), decided_by = p_user_id
+  WHERE id = p_request_id;
+END; $$;
@@ -0,0 +1,160 @@
+DROP FUNCTION IF EXISTS fn_restore_document_version(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_get_document_version(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_list_document_versions(INT, INT);
+
+-- восстановление определений из 000001
+CREATE OR REPLACE FUNCTION fn_update_document(
+  p_document_id INT,
+  p_user_id INT,
+  p_title TEXT,
+  p_document_date DATE,
+  p_author TEXT,       
+  p_type_id INT,
+  p_file_meta JSONB,
+  p_geojson JSONB,
+  p_tags TEXT[],
+  p_privacy TEXT
+) RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  a_name citext := NULL;
+  t TEXT;
+  v_exists BOOLEAN;
+  v_privacy_lower TEXT;
+BEGIN
+  -- Обязательные проверки
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_document_id IS NULL THEN RAISE EXCEPTION 'p_document_id is required'; END IF;
+  IF p_title IS NULL OR btrim(p_title) = '' THEN RAISE EXCEPTION 'p_title is required'; END IF;
+  IF p_privacy IS NULL THEN RAISE EXCEPTION 'p_privacy must be provided'; END IF;
+
+  v_privacy_lower := lower(btrim(p_privacy));
+  IF v_privacy_lower NOT IN ('public','private') THEN
+    RAISE EXCEPTION 'p_privacy must be one of public/private';
+  END IF;
+
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission';
+  END IF;
+
+  -- проверим существование
+  SELECT EXISTS (SELECT 1 FROM documents WHERE id = p_document_id) INTO v_exists;
+  IF NOT v_exists THEN RAISE EXCEPTION 'Document % does not exist', p_document_id; END IF;
+
+  IF p_author IS NOT NULL AND btrim(p_author) <> '' THEN
+    a_name := p_author::citext;
+  END IF;
+
+  -- Обновляем запись
+  UPDATE documents SET
+    title = p_title,
+    document_date = p_document_date,
+    author = a_name,
+    type_id = p_type_id,
+    file_meta = p_file_meta,
+    geojson = p_geojson,
+    privacy = v_privacy_lower::privacy_type,
+    updated_at = now(),
+    updated_by = p_user_id
+  WHERE id = p_document_id;
+
+  -- Теги: если передан NULL — не трогаем; если передан массив (включая пустой) — заменяем
+  IF p_tags IS NOT NULL THEN
+    DELETE FROM document_tags WHERE document_id = p_document_id;
+    FOR t IN SELECT DISTINCT btrim(tag) FROM unnest(p_tags) tag WHERE btrim(tag) <> '' LOOP
+      PERFORM _internal_attach_tag_to_document(p_document_id, t);
+    END LOOP;
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_add_document(
+  p_user_id INT,
+  p_title TEXT,
+  p_document_date DATE,
+  p_author TEXT,     
+  p_type_id INT,
+  p_file_meta JSONB,
+  p_geojson JSONB,
+  p_tags TEXT[],
+  p_privacy TEXT
+) RETURNS INT
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  new_id INT;
+  a_name citext := NULL;
+  t TEXT;
+  v_privacy_lower TEXT;
+BEGIN
+  -- Обязательные проверки
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_title IS NULL OR btrim(p_title) = '' THEN RAISE EXCEPTION 'p_title is required'; END IF;
+  IF p_privacy IS NULL THEN RAISE EXCEPTION 'p_privacy must be provided'; END IF;
+
+  v_privacy_lower := lower(btrim(p_privacy));
+  IF v_privacy_lower NOT IN ('public','private') THEN
+    RAISE EXCEPTION 'p_privacy must be one of public/private';
+  END IF;
+
+  IF p_author IS NOT NULL AND btrim(p_author) <> '' THEN
+    a_name := p_author::citext;
+  END IF;
+
+  -- Вставка документа (atomic в рамках функции)
+  INSERT INTO documents (title, privacy, created_at, created_by, document_date, author, type_id, file_meta, geojson)
+  VALUES (p_title, v_privacy_lower::privacy_type, now(), p_user_id, p_document_date, a_name, p_type_id, p_file_meta, p_geojson)
+  RETURNING id INTO new_id;
+
+  -- Теги: убираем дубликаты, создаём и привязываем
+  IF p_tags IS NOT NULL THEN
+    FOR t IN SELECT DISTINCT btrim(tag) FROM unnest(p_tags) tag WHERE btrim(tag) <> '' LOOP
+      PERFORM _internal_attach_tag_to_document(new_id, t);
+    END LOOP;
+  END IF;
+
+  RETURN new_id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_log_changes() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+DECLARE
+  v_user_id INTEGER;
+  v_user_login TEXT;
+  v_new JSONB;
+  v_old JSONB;
+  v_tg_op TEXT := TG_OP;
+  v_session_of_user TEXT := current_setting('app.session_of_user', true);
+BEGIN
+  -- попытка определить пользователя из created_by/updated_by, иначе current_user
+  IF TG_OP = 'INSERT' THEN v_user_id := COALESCE(NEW.updated_by, NEW.created_by);
+  ELSIF TG_OP = 'UPDATE' THEN v_user_id := COALESCE(NEW.updated_by, NEW.created_by);
+  ELSE v_user_id := COALESCE(OLD.updated_by, OLD.created_by); END IF;
+
+  IF v_user_id IS NOT NULL THEN SELECT login INTO v_user_login FROM users WHERE id = v_user_id; ELSE v_user_login := current_user; END IF;
+
+  IF TG_OP = 'INSERT' THEN
+    v_new := to_jsonb(NEW) - 'password_hash' - 'file_meta';
+    INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+    VALUES ('create'::action_type, TG_TABLE_NAME, NEW.id, v_user_id, v_user_login, v_tg_op, v_session_of_user, now(), jsonb_build_object('new', v_new));
+    RETURN NEW;
+  ELSIF TG_OP = 'UPDATE' THEN
+    v_old := to_jsonb(OLD) - 'password_hash' - 'file_meta';
+    v_new := to_jsonb(NEW) - 'password_hash' - 'file_meta';
+    INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+    VALUES ('update'::action_type, TG_TABLE_NAME, NEW.id, v_user_id, v_user_login, v_tg_op, v_session_of_user, now(), jsonb_build_object('old', v_old, 'new', v_new));
+    RETURN NEW;
+  ELSE
+    v_old := to_jsonb(OLD) - 'password_hash' - 'file_meta';
+    INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+    VALUES ('delete'::action_type, TG_TABLE_NAME, OLD.id, v_user_id, v_user_login, v_tg_op, v_session_of_user, now(), jsonb_build_object('old', v_old));
+    RETURN OLD;
+  END IF;
+END; $$;
+
+DROP FUNCTION IF EXISTS _snapshot_document_version(INT, INT, TEXT, INT);
+DROP TABLE IF EXISTS document_versions;
+ALTER TABLE documents DROP COLUMN IF EXISTS version;
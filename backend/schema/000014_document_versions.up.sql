@@ -0,0 +1,338 @@
+-- === История версий документов ===
+-- Каждая запись document_versions — состояние документа после изменения
+-- (создание, правка, восстановление): метаданные, теги и ссылка на файл.
+-- documents.version — номер текущей версии; старые файлы остаются доступны
+-- по file_meta своей версии.
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS document_versions (
+  id BIGSERIAL PRIMARY KEY,
+  document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+  version INTEGER NOT NULL,
+  title TEXT NOT NULL,
+  privacy privacy_type NOT NULL,
+  document_date DATE,
+  author citext,
+  type_id INTEGER REFERENCES document_types(id) ON DELETE SET NULL,
+  file_meta JSONB,
+  geojson JSONB,
+  tags TEXT[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  change_kind TEXT NOT NULL CHECK (change_kind IN ('create', 'update', 'restore')),
+  restored_from INTEGER,
+  UNIQUE (document_id, version)
+);
+
+-- Снимок текущего состояния документа под его текущим номером версии
+CREATE OR REPLACE FUNCTION _snapshot_document_version(p_document_id INT, p_user_id INT, p_kind TEXT, p_restored_from INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO document_versions (document_id, version, title, privacy, document_date, author, type_id,
+                                 file_meta, geojson, tags, created_at, created_by, change_kind, restored_from)
+  SELECT d.id, d.version, d.title, d.privacy, d.document_date, d.author, d.type_id,
+         d.file_meta, d.geojson,
+         coalesce((SELECT array_agg(t.name::TEXT ORDER BY t.name)
+                   FROM document_tags x JOIN tags t ON t.id = x.tag_id
+                   WHERE x.document_id = d.id), '{}'),
+         now(), p_user_id, p_kind, p_restored_from
+  FROM documents d
+  WHERE d.id = p_document_id;
+END; $$;
+
+-- исходная версия для уже существующих документов
+INSERT INTO document_versions (document_id, version, title, privacy, document_date, author, type_id,
+                               file_meta, geojson, tags, created_at, created_by, change_kind)
+SELECT d.id, d.version, d.title, d.privacy, d.document_date, d.author, d.type_id, d.file_meta, d.geojson,
+       coalesce((SELECT array_agg(t.name::TEXT ORDER BY t.name)
+                 FROM document_tags x JOIN tags t ON t.id = x.tag_id
+                 WHERE x.document_id = d.id), '{}'),
+       coalesce(d.updated_at, d.created_at), coalesce(d.updated_by, d.created_by), 'create'
+FROM documents d
+ON CONFLICT (document_id, version) DO NOTHING;
+
+-- file_meta больше не вырезается из логов: без него не восстановить, какой файл был у документа
+CREATE OR REPLACE FUNCTION fn_log_changes() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+DECLARE
+  v_user_id INTEGER;
+  v_user_login TEXT;
+  v_new JSONB;
+  v_old JSONB;
+  v_tg_op TEXT := TG_OP;
+  v_session_of_user TEXT := current_setting('app.session_of_user', true);
+BEGIN
+  -- попытка определить пользователя из created_by/updated_by, иначе current_user
+  IF TG_OP = 'INSERT' THEN v_user_id := COALESCE(NEW.updated_by, NEW.created_by);
+  ELSIF TG_OP = 'UPDATE' THEN v_user_id := COALESCE(NEW.updated_by, NEW.created_by);
+  ELSE v_user_id := COALESCE(OLD.updated_by, OLD.created_by); END IF;
+
+  IF v_user_id IS NOT NULL THEN SELECT login INTO v_user_login FROM users WHERE id = v_user_id; ELSE v_user_login := current_user; END IF;
+
+  IF TG_OP = 'INSERT' THEN
+    v_new := to_jsonb(NEW) - 'password_hash';
+    INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+    VALUES ('create'::action_type, TG_TABLE_NAME, NEW.id, v_user_id, v_user_login, v_tg_op, v_session_of_user, now(), jsonb_build_object('new', v_new));
+    RETURN NEW;
+  ELSIF TG_OP = 'UPDATE' THEN
+    v_old := to_jsonb(OLD) - 'password_hash';
+    v_new := to_jsonb(NEW) - 'password_hash';
+    INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+    VALUES ('update'::action_type, TG_TABLE_NAME, NEW.id, v_user_id, v_user_login, v_tg_op, v_session_of_user, now(), jsonb_build_object('old', v_old, 'new', v_new));
+    RETURN NEW;
+  ELSE
+    v_old := to_jsonb(OLD) - 'password_hash';
+    INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+    VALUES ('delete'::action_type, TG_TABLE_NAME, OLD.id, v_user_id, v_user_login, v_tg_op, v_session_of_user, now(), jsonb_build_object('old', v_old));
+    RETURN OLD;
+  END IF;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_add_document(
+  p_user_id INT,
+  p_title TEXT,
+  p_document_date DATE,
+  p_author TEXT,     
+  p_type_id INT,
+  p_file_meta JSONB,
+  p_geojson JSONB,
+  p_tags TEXT[],
+  p_privacy TEXT
+) RETURNS INT
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  new_id INT;
+  a_name citext := NULL;
+  t TEXT;
+  v_privacy_lower TEXT;
+BEGIN
+  -- Обязательные проверки
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_title IS NULL OR btrim(p_title) = '' THEN RAISE EXCEPTION 'p_title is required'; END IF;
+  IF p_privacy IS NULL THEN RAISE EXCEPTION 'p_privacy must be provided'; END IF;
+
+  v_privacy_lower := lower(btrim(p_privacy));
+  IF v_privacy_lower NOT IN ('public','private') THEN
+    RAISE EXCEPTION 'p_privacy must be one of public/private';
+  END IF;
+
+  IF p_author IS NOT NULL AND btrim(p_author) <> '' THEN
+    a_name := p_author::citext;
+  END IF;
+
+  -- Вставка документа (atomic в рамках функции)
+  INSERT INTO documents (title, privacy, created_at, created_by, document_date, author, type_id, file_meta, geojson)
+  VALUES (p_title, v_privacy_lower::privacy_type, now(), p_user_id, p_document_date, a_name, p_type_id, p_file_meta, p_geojson)
+  RETURNING id INTO new_id;
+
+  -- Теги: убираем дубликаты, создаём и привязываем
+  IF p_tags IS NOT NULL THEN
+    FOR t IN SELECT DISTINCT btrim(tag) FROM unnest(p_tags) tag WHERE btrim(tag) <> '' LOOP
+      PERFORM _internal_attach_tag_to_document(new_id, t);
+    END LOOP;
+  END IF;
+
+  PERFORM _snapshot_document_version(new_id, p_user_id, 'create', NULL);
+
+  RETURN new_id;
+END;
+$$;
+
+-- p_file_meta NULL — файл не меняется (раньше ссылка на файл затиралась)
+CREATE OR REPLACE FUNCTION fn_update_document(
+  p_document_id INT,
+  p_user_id INT,
+  p_title TEXT,
+  p_document_date DATE,
+  p_author TEXT,       
+  p_type_id INT,
+  p_file_meta JSONB,
+  p_geojson JSONB,
+  p_tags TEXT[],
+  p_privacy TEXT
+) RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  a_name citext := NULL;
+  t TEXT;
+  v_exists BOOLEAN;
+  v_privacy_lower TEXT;
+BEGIN
+  -- Обязательные проверки
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_document_id IS NULL THEN RAISE EXCEPTION 'p_document_id is required'; END IF;
+  IF p_title IS NULL OR btrim(p_title) = '' THEN RAISE EXCEPTION 'p_title is required'; END IF;
+  IF p_privacy IS NULL THEN RAISE EXCEPTION 'p_privacy must be provided'; END IF;
+
+  v_privacy_lower := lower(btrim(p_privacy));
+  IF v_privacy_lower NOT IN ('public','private') THEN
+    RAISE EXCEPTION 'p_privacy must be one of public/private';
+  END IF;
+
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission';
+  END IF;
+
+  -- проверим существование
+  SELECT EXISTS (SELECT 1 FROM documents WHERE id = p_document_id) INTO v_exists;
+  IF NOT v_exists THEN RAISE EXCEPTION 'Document % does not exist', p_document_id; END IF;
+
+  IF p_author IS NOT NULL AND btrim(p_author) <> '' THEN
+    a_name := p_author::citext;
+  END IF;
+
+  -- Обновляем запись
+  UPDATE documents SET
+    title = p_title,
+    document_date = p_document_date,
+    author = a_name,
+    type_id = p_type_id,
+    file_meta = coalesce(p_file_meta, file_meta),
+    geojson = p_geojson,
+    privacy = v_privacy_lower::privacy_type,
+    updated_at = now(),
+    updated_by = p_user_id,
+    version = version + 1
+  WHERE id = p_document_id;
+
+  -- Теги: если передан NULL — не трогаем; если передан массив (включая пустой) — заменяем
+  IF p_tags IS NOT NULL THEN
+    DELETE FROM document_tags WHERE document_id = p_document_id;
+    FOR t IN SELECT DISTINCT btrim(tag) FROM unnest(p_tags) tag WHERE btrim(tag) <> '' LOOP
+      PERFORM _internal_attach_tag_to_document(p_document_id, t);
+    END LOOP;
+  END IF;
+
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'update', NULL);
+END;
+$$;
+
+-- Список версий (без geojson), новые сверху. Право просмотра документа.
+CREATE OR REPLACE FUNCTION fn_list_document_versions(p_document_id INT, p_requester_id INT)
+RETURNS TABLE (
+  version INT,
+  title TEXT,
+  privacy privacy_type,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  tags TEXT[],
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  created_by_login citext,
+  change_kind TEXT,
+  restored_from INT,
+  is_current BOOLEAN
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  SELECT v.version, v.title, v.privacy, v.document_date, v.author, v.type_id, v.file_meta, v.tags,
+         v.created_at, v.created_by, u.login, v.change_kind, v.restored_from, v.version = d.version
+  FROM document_versions v
+  JOIN documents d ON d.id = v.document_id
+  LEFT JOIN users u ON u.id = v.created_by
+  WHERE v.document_id = p_document_id
+  ORDER BY v.version DESC;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_document_version(p_document_id INT, p_requester_id INT, p_version INT)
+RETURNS TABLE (
+  version INT,
+  title TEXT,
+  privacy privacy_type,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  tags TEXT[],
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  created_by_login citext,
+  change_kind TEXT,
+  restored_from INT,
+  is_current BOOLEAN
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  SELECT v.version, v.title, v.privacy, v.document_date, v.author, v.type_id, v.file_meta, v.geojson, v.tags,
+         v.created_at, v.created_by, u.login, v.change_kind, v.restored_from, v.version = d.version
+  FROM document_versions v
+  JOIN documents d ON d.id = v.document_id
+  LEFT JOIN users u ON u.id = v.created_by
+  WHERE v.document_id = p_document_id AND v.version = p_version;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'version % of document % not found', p_version, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+END; $$;
+
+-- Восстановление: содержимое старой версии становится новой версией (история не переписывается).
+-- Если файл меняется, извлечённый текст прежнего файла в поисковом индексе сбрасывается.
+-- Возвращает номер новой версии.
+CREATE OR REPLACE FUNCTION fn_restore_document_version(p_document_id INT, p_user_id INT, p_version INT)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ver document_versions%ROWTYPE;
+  v_old_file JSONB;
+  v_new_version INT;
+  t TEXT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  SELECT * INTO v_ver FROM document_versions v WHERE v.document_id = p_document_id AND v.version = p_version;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'version % of document % not found', p_version, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  SELECT d.file_meta INTO v_old_file FROM documents d WHERE d.id = p_document_id FOR UPDATE;
+
+  UPDATE documents SET
+    title = v_ver.title,
+    privacy = v_ver.privacy,
+    document_date = v_ver.document_date,
+    author = v_ver.author,
+    type_id = v_ver.type_id,
+    file_meta = v_ver.file_meta,
+    geojson = v_ver.geojson,
+    updated_at = now(),
+    updated_by = p_user_id,
+    version = version + 1
+  WHERE id = p_document_id
+  RETURNING documents.version INTO v_new_version;
+
+  DELETE FROM document_tags WHERE document_id = p_document_id;
+  FOREACH t IN ARRAY v_ver.tags LOOP
+    PERFORM _internal_attach_tag_to_document(p_document_id, t);
+  END LOOP;
+
+  IF v_old_file IS DISTINCT FROM v_ver.file_meta THEN
+    UPDATE document_search SET file_text = NULL WHERE document_id = p_document_id;
+    PERFORM _refresh_document_search(p_document_id);
+  END IF;
+
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'restore', p_version);
+  RETURN v_new_version;
+END; $$;
@@ -0,0 +1,490 @@
+-- === Корзина документов ===
+-- DELETE /api/documents/:id больше не удаляет строку: документ помечается deleted_at/deleted_by
+-- и пропадает из всех функций чтения. Из корзины его можно восстановить; окончательно
+-- документы удаляет фоновая задача fn_purge_deleted_documents по истечении срока хранения.
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_documents_deleted_at ON documents (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Документ существует и не в корзине; иначе no_data_found (404)
+CREATE OR REPLACE FUNCTION _require_live_document(p_document_id INT)
+RETURNS VOID LANGUAGE plpgsql STABLE AS $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.deleted_at IS NULL) THEN
+    RAISE EXCEPTION 'Document % does not exist', p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+END; $$;
+
+-- Удалить в корзину и восстановить может автор, редактор (личный или групповой доступ) или documents.delete_any
+CREATE OR REPLACE FUNCTION _can_user_delete_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RETURN FALSE; END IF;
+  RETURN has_permission(p_user_id, 'documents.delete_any')
+      OR EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.created_by = p_user_id)
+      OR _has_document_grant(p_document_id, p_user_id, TRUE);
+END; $$;
+
+-- документы из корзины не видны ни в списках, ни в поиске, ни на карте
+CREATE OR REPLACE FUNCTION _visible_documents(p_requester_id INT, p_read_all BOOLEAN)
+RETURNS SETOF documents
+LANGUAGE sql STABLE AS $$
+  SELECT d.*
+  FROM documents d
+  WHERE d.deleted_at IS NULL
+    AND (p_read_all
+      OR d.privacy = 'public'::privacy_type
+      OR (p_requester_id IS NOT NULL AND d.created_by = p_requester_id)
+      OR _has_document_grant(d.id, p_requester_id, FALSE))
+$$;
+
+CREATE OR REPLACE FUNCTION _can_user_view_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_privacy privacy_type; v_creator INT;
+BEGIN
+  SELECT d.privacy, d.created_by INTO v_privacy, v_creator FROM documents d WHERE d.id = p_document_id AND d.deleted_at IS NULL;
+  IF NOT FOUND THEN RETURN FALSE; END IF;
+  IF has_permission(p_user_id, 'documents.read_all') THEN RETURN TRUE; END IF;
+  IF v_privacy = 'public'::privacy_type OR v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN _has_document_grant(p_document_id, p_user_id, FALSE);
+END; $$;
+
+CREATE OR REPLACE FUNCTION _can_user_edit_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_creator INT;
+BEGIN
+  IF p_user_id IS NULL THEN RETURN FALSE; END IF;
+  SELECT d.created_by INTO v_creator FROM documents d WHERE d.id = p_document_id AND d.deleted_at IS NULL;
+  IF NOT FOUND THEN RETURN FALSE; END IF;
+  IF has_permission(p_user_id, 'documents.edit_any') THEN RETURN TRUE; END IF;
+  IF v_creator = p_user_id THEN RETURN TRUE; END IF;
+  RETURN _has_document_grant(p_document_id, p_user_id, TRUE);
+END; $$;
+
+CREATE OR REPLACE FUNCTION _can_user_share_document(p_user_id INT, p_document_id INT) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RETURN FALSE; END IF;
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.deleted_at IS NULL) THEN RETURN FALSE; END IF;
+  IF has_permission(p_user_id, 'permissions.manage') THEN RETURN TRUE; END IF;
+  IF EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id AND d.created_by = p_user_id) THEN RETURN TRUE; END IF;
+  RETURN _has_document_grant(p_document_id, p_user_id, FALSE, TRUE);
+END; $$;
+
+CREATE OR REPLACE FUNCTION _check_document_share(
+  p_document_id INT, p_user_id INT, p_target_user_id INT,
+  p_can_edit BOOLEAN, p_can_share BOOLEAN, p_expires_at TIMESTAMPTZ)
+RETURNS TIMESTAMPTZ
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_limit TIMESTAMPTZ;
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_share_document(p_user_id, p_document_id) THEN RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege'; END IF;
+  IF p_expires_at IS NOT NULL AND p_expires_at <= now() THEN
+    RAISE EXCEPTION 'expires_at must be in the future' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  IF coalesce(p_can_share, FALSE) AND NOT has_permission(p_user_id, 'permissions.manage') THEN
+    RAISE EXCEPTION 'permission permissions.manage required to grant can_share' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  IF NOT _is_document_delegate(p_user_id, p_document_id) THEN RETURN p_expires_at; END IF;
+  IF p_target_user_id IS NOT NULL AND p_target_user_id = p_user_id THEN
+    RAISE EXCEPTION 'cannot change own permissions' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  IF coalesce(p_can_edit, FALSE) AND NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'cannot grant edit access without edit access' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  v_limit := _document_share_expires_at(p_document_id, p_user_id);
+  IF v_limit IS NOT NULL AND (p_expires_at IS NULL OR p_expires_at > v_limit) THEN
+    RETURN v_limit;
+  END IF;
+  RETURN p_expires_at;
+END; $$;
+
+-- документ в корзине — 404, а не 403
+CREATE OR REPLACE FUNCTION fn_get_document_by_id(p_document_id INT, p_requester_id INT DEFAULT NULL)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  geom geometry(Geometry,4326),
+  can_edit BOOLEAN,
+  viewers INT[],
+  editors INT[]
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_viewers INT[];
+  v_editors INT[];
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege', HINT = 'request access: POST /api/documents/:id/access-requests';
+  END IF;
+
+  IF _can_user_share_document(p_requester_id, p_document_id) THEN
+    WITH grantees AS (
+      SELECT dp.user_id, dp.can_edit FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND (dp.can_view OR dp.can_edit)
+        AND (dp.expires_at IS NULL OR dp.expires_at > now())
+      UNION ALL
+      SELECT gm.user_id, gp.can_edit FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND (gp.can_view OR gp.can_edit)
+        AND (gp.expires_at IS NULL OR gp.expires_at > now())
+    )
+    SELECT coalesce(array_agg(DISTINCT g.user_id), '{}'),
+           coalesce(array_agg(DISTINCT g.user_id) FILTER (WHERE g.can_edit), '{}')
+    INTO v_viewers, v_editors
+    FROM grantees g;
+  END IF;
+
+  RETURN QUERY
+    SELECT d.id, d.title, d.privacy, d.created_at, d.created_by, d.updated_at, d.updated_by,
+           d.document_date, d.author, d.type_id, d.file_meta, d.geojson, d.geom,
+           _can_user_edit_document(p_requester_id, d.id) AS can_edit,
+           v_viewers, v_editors
+    FROM documents d
+    WHERE d.id = p_document_id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_list_document_versions(p_document_id INT, p_requester_id INT)
+RETURNS TABLE (
+  version INT,
+  title TEXT,
+  privacy privacy_type,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  tags TEXT[],
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  created_by_login citext,
+  change_kind TEXT,
+  restored_from INT,
+  is_current BOOLEAN
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  SELECT v.version, v.title, v.privacy, v.document_date, v.author, v.type_id, v.file_meta, v.tags,
+         v.created_at, v.created_by, u.login, v.change_kind, v.restored_from, v.version = d.version
+  FROM document_versions v
+  JOIN documents d ON d.id = v.document_id
+  LEFT JOIN users u ON u.id = v.created_by
+  WHERE v.document_id = p_document_id
+  ORDER BY v.version DESC;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_document_version(p_document_id INT, p_requester_id INT, p_version INT)
+RETURNS TABLE (
+  version INT,
+  title TEXT,
+  privacy privacy_type,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  tags TEXT[],
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  created_by_login citext,
+  change_kind TEXT,
+  restored_from INT,
+  is_current BOOLEAN
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  SELECT v.version, v.title, v.privacy, v.document_date, v.author, v.type_id, v.file_meta, v.geojson, v.tags,
+         v.created_at, v.created_by, u.login, v.change_kind, v.restored_from, v.version = d.version
+  FROM document_versions v
+  JOIN documents d ON d.id = v.document_id
+  LEFT JOIN users u ON u.id = v.created_by
+  WHERE v.document_id = p_document_id AND v.version = p_version;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'version % of document % not found', p_version, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_documents_shared_with_me(p_requester_id INT)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  updated_at TIMESTAMPTZ,
+  document_date DATE,
+  type_id INT,
+  author citext,
+  created_by INT,
+  created_by_login citext,
+  can_edit BOOLEAN,
+  can_share BOOLEAN,
+  expires_at TIMESTAMPTZ,
+  via_groups TEXT[]
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_requester_id IS NULL THEN RAISE EXCEPTION 'p_requester_id is required'; END IF;
+
+  RETURN QUERY
+  WITH grants AS (
+    SELECT dp.document_id, dp.can_edit, dp.can_share, dp.expires_at, NULL::TEXT AS group_name
+    FROM document_permissions dp
+    WHERE dp.user_id = p_requester_id AND (dp.can_view OR dp.can_edit)
+      AND (dp.expires_at IS NULL OR dp.expires_at > now())
+    UNION ALL
+    SELECT gp.document_id, gp.can_edit, gp.can_share, gp.expires_at, g.name::TEXT
+    FROM document_group_permissions gp
+    JOIN group_members gm ON gm.group_id = gp.group_id AND gm.user_id = p_requester_id
+    JOIN groups g ON g.id = gp.group_id
+    WHERE (gp.can_view OR gp.can_edit)
+      AND (gp.expires_at IS NULL OR gp.expires_at > now())
+  )
+  SELECT d.id, d.title, d.privacy, d.updated_at, d.document_date, d.type_id, d.author,
+         d.created_by, u.login,
+         bool_or(gr.can_edit),
+         bool_or(gr.can_share),
+         CASE WHEN bool_or(gr.expires_at IS NULL) THEN NULL ELSE max(gr.expires_at) END,
+         coalesce(array_agg(DISTINCT gr.group_name) FILTER (WHERE gr.group_name IS NOT NULL), '{}')
+  FROM grants gr
+  JOIN documents d ON d.id = gr.document_id
+  LEFT JOIN users u ON u.id = d.created_by
+  WHERE d.deleted_at IS NULL
+    AND d.privacy <> 'public'::privacy_type
+    AND d.created_by IS DISTINCT FROM p_requester_id
+  GROUP BY d.id, u.login
+  ORDER BY d.updated_at DESC NULLS LAST, d.id DESC;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_request_document_access(p_user_id INT, p_document_id INT, p_level TEXT, p_reason TEXT)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_id INT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  IF p_level IS NULL OR p_level NOT IN ('view', 'edit') THEN RAISE EXCEPTION 'level must be view or edit' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  PERFORM _require_live_document(p_document_id);
+
+  IF (p_level = 'view' AND _can_user_view_document(p_user_id, p_document_id))
+     OR (p_level = 'edit' AND _can_user_edit_document(p_user_id, p_document_id)) THEN
+    RAISE EXCEPTION 'User % already has % access to document %', p_user_id, p_level, p_document_id
+      USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+
+  INSERT INTO document_access_requests (document_id, user_id, level, reason)
+  VALUES (p_document_id, p_user_id, p_level, nullif(btrim(p_reason), ''))
+  RETURNING id INTO v_id;
+
+  PERFORM _log_action(p_user_id, 'create', 'document_access_requests', v_id, 'request_access',
+    jsonb_build_object('new', jsonb_build_object('document_id', p_document_id, 'level', p_level)));
+  RETURN v_id;
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Access request for document % is already pending', p_document_id USING ERRCODE = 'unique_violation';
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_list_my_access_requests(p_user_id INT)
+RETURNS TABLE (
+  id INT,
+  document_id INT,
+  document_title TEXT,
+  user_id INT,
+  user_login citext,
+  user_full_name TEXT,
+  level TEXT,
+  reason TEXT,
+  status TEXT,
+  created_at TIMESTAMPTZ,
+  decided_at TIMESTAMPTZ,
+  decided_by INT,
+  decided_by_login citext,
+  decision_comment TEXT,
+  grant_expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT r.id, r.document_id, d.title, r.user_id, u.login, u.full_name, r.level, r.reason, r.status,
+         r.created_at, r.decided_at, r.decided_by, dec.login, r.decision_comment, r.grant_expires_at
+  FROM document_access_requests r
+  JOIN documents d ON d.id = r.document_id AND d.deleted_at IS NULL
+  JOIN users u ON u.id = r.user_id
+  LEFT JOIN users dec ON dec.id = r.decided_by
+  WHERE r.user_id = p_user_id
+  ORDER BY r.created_at DESC;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_list_incoming_access_requests(p_user_id INT, p_status TEXT)
+RETURNS TABLE (
+  id INT,
+  document_id INT,
+  document_title TEXT,
+  user_id INT,
+  user_login citext,
+  user_full_name TEXT,
+  level TEXT,
+  reason TEXT,
+  status TEXT,
+  created_at TIMESTAMPTZ,
+  decided_at TIMESTAMPTZ,
+  decided_by INT,
+  decided_by_login citext,
+  decision_comment TEXT,
+  grant_expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_manage BOOLEAN := has_permission(p_user_id, 'permissions.manage');
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required' USING ERRCODE = 'invalid_parameter_value'; END IF;
+  RETURN QUERY
+  SELECT r.id, r.document_id, d.title, r.user_id, u.login, u.full_name, r.level, r.reason, r.status,
+         r.created_at, r.decided_at, r.decided_by, dec.login, r.decision_comment, r.grant_expires_at
+  FROM document_access_requests r
+  JOIN documents d ON d.id = r.document_id AND d.deleted_at IS NULL
+  JOIN users u ON u.id = r.user_id
+  LEFT JOIN users dec ON dec.id = r.decided_by
+  WHERE (p_status IS NULL OR r.status = p_status)
+    AND r.user_id <> p_user_id
+    AND (v_manage OR d.created_by = p_user_id OR _can_user_share_document(p_user_id, d.id))
+  ORDER BY r.created_at;
+END; $$;
+
+-- удаление в корзину; строка, права и теги остаются до восстановления или очистки
+CREATE OR REPLACE FUNCTION fn_delete_document(p_document_id INT, p_user_id INT) RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_delete_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  UPDATE documents
+     SET deleted_at = now(), deleted_by = p_user_id, updated_at = now(), updated_by = p_user_id
+   WHERE id = p_document_id;
+END; $$;
+
+-- Корзина: документы, которые пользователь может восстановить
+CREATE OR REPLACE FUNCTION fn_list_trash(p_requester_id INT)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  document_date DATE,
+  type_id INT,
+  author citext,
+  created_by INT,
+  created_by_login citext,
+  deleted_at TIMESTAMPTZ,
+  deleted_by INT,
+  deleted_by_login citext
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_delete_any BOOLEAN := has_permission(p_requester_id, 'documents.delete_any');
+BEGIN
+  IF p_requester_id IS NULL THEN RAISE EXCEPTION 'p_requester_id is required'; END IF;
+  RETURN QUERY
+  SELECT d.id, d.title, d.privacy, d.document_date, d.type_id, d.author,
+         d.created_by, cu.login, d.deleted_at, d.deleted_by, du.login
+  FROM documents d
+  LEFT JOIN users cu ON cu.id = d.created_by
+  LEFT JOIN users du ON du.id = d.deleted_by
+  WHERE d.deleted_at IS NOT NULL
+    AND (v_delete_any
+      OR d.created_by = p_requester_id
+      OR d.deleted_by = p_requester_id
+      OR _has_document_grant(d.id, p_requester_id, TRUE))
+  ORDER BY d.deleted_at DESC, d.id DESC;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_restore_document(p_document_id INT, p_user_id INT)
+RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_deleted_at TIMESTAMPTZ; v_deleted_by INT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  SELECT d.deleted_at, d.deleted_by INTO v_deleted_at, v_deleted_by FROM documents d WHERE d.id = p_document_id FOR UPDATE;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Document % does not exist', p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+  IF NOT (_can_user_delete_document(p_user_id, p_document_id) OR v_deleted_by = p_user_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  IF v_deleted_at IS NULL THEN
+    RAISE EXCEPTION 'Document % is not in trash', p_document_id USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+
+  UPDATE documents
+     SET deleted_at = NULL, deleted_by = NULL, updated_at = now(), updated_by = p_user_id
+   WHERE id = p_document_id;
+END; $$;
+
+-- Окончательное удаление документов, пролежавших в корзине дольше p_older_than (не больше p_limit за вызов).
+-- Возвращает файлы (текущий и из версий), на которые больше не ссылается ни один документ,
+-- — их удаляет из хранилища вызывающая сторона.
+CREATE OR REPLACE FUNCTION fn_purge_deleted_documents(p_older_than INTERVAL, p_limit INT)
+RETURNS TABLE (provider TEXT, bucket TEXT, key TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ids INT[];
+  v_files JSONB[];
+BEGIN
+  IF p_older_than IS NULL OR p_older_than < interval '0' THEN RAISE EXCEPTION 'p_older_than must not be negative'; END IF;
+
+  SELECT array_agg(d.id) INTO v_ids
+  FROM (
+    SELECT d.id FROM documents d
+    WHERE d.deleted_at IS NOT NULL AND d.deleted_at <= now() - p_older_than
+    ORDER BY d.deleted_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  ) d;
+  IF v_ids IS NULL THEN RETURN; END IF;
+
+  SELECT array_agg(DISTINCT f.fm) INTO v_files
+  FROM (
+    SELECT d.file_meta AS fm FROM documents d WHERE d.id = ANY(v_ids) AND d.file_meta ? 'key'
+    UNION
+    SELECT v.file_meta FROM document_versions v WHERE v.document_id = ANY(v_ids) AND v.file_meta ? 'key'
+  ) f;
+
+  DELETE FROM documents d WHERE d.id = ANY(v_ids);
+
+  RETURN QUERY
+  SELECT DISTINCT f->>'provider', f->>'bucket', f->>'key'
+  FROM unnest(coalesce(v_files, '{}')) f
+  WHERE NOT EXISTS (
+          SELECT 1 FROM documents d
+          WHERE d.file_meta->>'key' = f->>'key' AND d.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_versions v
+          WHERE v.file_meta->>'key' = f->>'key' AND v.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket');
+END; $$;
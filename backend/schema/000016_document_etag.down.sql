@@ -0,0 +1,197 @@
+DROP FUNCTION IF EXISTS fn_get_document_by_id(INT, INT);
+DROP FUNCTION IF EXISTS fn_update_document(INT, INT, TEXT, DATE, TEXT, INT, JSONB, JSONB, TEXT[], TEXT, INT);
+DROP FUNCTION IF EXISTS fn_delete_document(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_restore_document_version(INT, INT, INT, INT);
+DROP FUNCTION IF EXISTS _check_document_version(INT, INT);
+
+-- восстановление прежних определений
+
+CREATE OR REPLACE FUNCTION fn_get_document_by_id(p_document_id INT, p_requester_id INT DEFAULT NULL)
+RETURNS TABLE (
+  id INT,
+  title TEXT,
+  privacy privacy_type,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT,
+  document_date DATE,
+  author citext,
+  type_id INT,
+  file_meta JSONB,
+  geojson JSONB,
+  geom geometry(Geometry,4326),
+  can_edit BOOLEAN,
+  viewers INT[],
+  editors INT[]
+)
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  v_viewers INT[];
+  v_editors INT[];
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege', HINT = 'request access: POST /api/documents/:id/access-requests';
+  END IF;
+
+  IF _can_user_share_document(p_requester_id, p_document_id) THEN
+    WITH grantees AS (
+      SELECT dp.user_id, dp.can_edit FROM document_permissions dp
+      WHERE dp.document_id = p_document_id AND (dp.can_view OR dp.can_edit)
+        AND (dp.expires_at IS NULL OR dp.expires_at > now())
+      UNION ALL
+      SELECT gm.user_id, gp.can_edit FROM document_group_permissions gp
+      JOIN group_members gm ON gm.group_id = gp.group_id
+      WHERE gp.document_id = p_document_id AND (gp.can_view OR gp.can_edit)
+        AND (gp.expires_at IS NULL OR gp.expires_at > now())
+    )
+    SELECT coalesce(array_agg(DISTINCT g.user_id), '{}'),
+           coalesce(array_agg(DISTINCT g.user_id) FILTER (WHERE g.can_edit), '{}')
+    INTO v_viewers, v_editors
+    FROM grantees g;
+  END IF;
+
+  RETURN QUERY
+    SELECT d.id, d.title, d.privacy, d.created_at, d.created_by, d.updated_at, d.updated_by,
+           d.document_date, d.author, d.type_id, d.file_meta, d.geojson, d.geom,
+           _can_user_edit_document(p_requester_id, d.id) AS can_edit,
+           v_viewers, v_editors
+    FROM documents d
+    WHERE d.id = p_document_id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_update_document(
+  p_document_id INT,
+  p_user_id INT,
+  p_title TEXT,
+  p_document_date DATE,
+  p_author TEXT,       
+  p_type_id INT,
+  p_file_meta JSONB,
+  p_geojson JSONB,
+  p_tags TEXT[],
+  p_privacy TEXT
+) RETURNS VOID
+SECURITY DEFINER
+SET search_path = public, pg_temp
+LANGUAGE plpgsql AS $$
+DECLARE
+  a_name citext := NULL;
+  t TEXT;
+  v_exists BOOLEAN;
+  v_privacy_lower TEXT;
+BEGIN
+  -- Обязательные проверки
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_document_id IS NULL THEN RAISE EXCEPTION 'p_document_id is required'; END IF;
+  IF p_title IS NULL OR btrim(p_title) = '' THEN RAISE EXCEPTION 'p_title is required'; END IF;
+  IF p_privacy IS NULL THEN RAISE EXCEPTION 'p_privacy must be provided'; END IF;
+
+  v_privacy_lower := lower(btrim(p_privacy));
+  IF v_privacy_lower NOT IN ('public','private') THEN
+    RAISE EXCEPTION 'p_privacy must be one of public/private';
+  END IF;
+
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission';
+  END IF;
+
+  -- проверим существование
+  SELECT EXISTS (SELECT 1 FROM documents WHERE id = p_document_id) INTO v_exists;
+  IF NOT v_exists THEN RAISE EXCEPTION 'Document % does not exist', p_document_id; END IF;
+
+  IF p_author IS NOT NULL AND btrim(p_author) <> '' THEN
+    a_name := p_author::citext;
+  END IF;
+
+  -- Обновляем запись
+  UPDATE documents SET
+    title = p_title,
+    document_date = p_document_date,
+    author = a_name,
+    type_id = p_type_id,
+    file_meta = coalesce(p_file_meta, file_meta),
+    geojson = p_geojson,
+    privacy = v_privacy_lower::privacy_type,
+    updated_at = now(),
+    updated_by = p_user_id,
+    version = version + 1
+  WHERE id = p_document_id;
+
+  -- Теги: если передан NULL — не трогаем; если передан массив (включая пустой) — заменяем
+  IF p_tags IS NOT NULL THEN
+    DELETE FROM document_tags WHERE document_id = p_document_id;
+    FOR t IN SELECT DISTINCT btrim(tag) FROM unnest(p_tags) tag WHERE btrim(tag) <> '' LOOP
+      PERFORM _internal_attach_tag_to_document(p_document_id, t);
+    END LOOP;
+  END IF;
+
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'update', NULL);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION fn_delete_document(p_document_id INT, p_user_id INT) RETURNS VOID SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_delete_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  UPDATE documents
+     SET deleted_at = now(), deleted_by = p_user_id, updated_at = now(), updated_by = p_user_id
+   WHERE id = p_document_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_restore_document_version(p_document_id INT, p_user_id INT, p_version INT)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ver document_versions%ROWTYPE;
+  v_old_file JSONB;
+  v_new_version INT;
+  t TEXT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  SELECT * INTO v_ver FROM document_versions v WHERE v.document_id = p_document_id AND v.version = p_version;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'version % of document % not found', p_version, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  SELECT d.file_meta INTO v_old_file FROM documents d WHERE d.id = p_document_id FOR UPDATE;
+
+  UPDATE documents SET
+    title = v_ver.title,
+    privacy = v_ver.privacy,
+    document_date = v_ver.document_date,
+    author = v_ver.author,
+    type_id = v_ver.type_id,
+    file_meta = v_ver.file_meta,
+    geojson = v_ver.geojson,
+    updated_at = now(),
+    updated_by = p_user_id,
+    version = version + 1
+  WHERE id = p_document_id
+  RETURNING documents.version INTO v_new_version;
+
+  DELETE FROM document_tags WHERE document_id = p_document_id;
+  FOREACH t IN ARRAY v_ver.tags LOOP
+    PERFORM _internal_attach_tag_to_document(p_document_id, t);
+  END LOOP;
+
+  IF v_old_file IS DISTINCT FROM v_ver.file_meta THEN
+    UPDATE document_search SET file_text = NULL WHERE document_id = p_document_id;
+    PERFORM _refresh_document_search(p_document_id);
+  END IF;
+
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'restore', p_version);
+  RETURN v_new_version;
+END; $$;
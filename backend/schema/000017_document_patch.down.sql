@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS fn_require_document_edit(INT, INT);
+DROP FUNCTION IF EXISTS fn_patch_document(INT, INT, JSONB, INT);
@@ -0,0 +1,96 @@
+-- === Частичное изменение документа (PATCH) ===
+-- p_patch — JSON-объект только с изменяемыми полями; JSON null очищает поле
+-- (title и privacy очистить нельзя). Файл (file_meta) заменяется или удаляется целиком,
+-- извлечённый текст старого файла при этом сбрасывается. Ошибки входных данных — SQLSTATE класса 22.
+
+CREATE OR REPLACE FUNCTION fn_patch_document(p_document_id INT, p_user_id INT, p_patch JSONB, p_expected_version INT DEFAULT NULL)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_unknown TEXT[];
+  v_privacy TEXT;
+  v_type_id INT;
+  v_version INT;
+  v_old_file JSONB;
+  t TEXT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_patch IS NULL OR jsonb_typeof(p_patch) <> 'object' OR p_patch = '{}'::jsonb THEN
+    RAISE EXCEPTION 'patch must be a non-empty object' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  SELECT array_agg(k ORDER BY k) INTO v_unknown
+  FROM jsonb_object_keys(p_patch) k
+  WHERE k NOT IN ('title', 'privacy', 'document_date', 'author', 'type_id', 'geojson', 'tags', 'file_meta');
+  IF v_unknown IS NOT NULL THEN RAISE EXCEPTION 'unknown fields: %', array_to_string(v_unknown, ', ') USING ERRCODE = 'invalid_parameter_value'; END IF;
+
+  -- проверка значений до блокировки
+  IF p_patch ? 'title' AND nullif(btrim(p_patch->>'title'), '') IS NULL THEN
+    RAISE EXCEPTION 'title must not be empty' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  IF p_patch ? 'privacy' THEN
+    v_privacy := lower(btrim(p_patch->>'privacy'));
+    IF v_privacy IS NULL OR v_privacy NOT IN ('public', 'private') THEN
+      RAISE EXCEPTION 'privacy must be one of public/private' USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+  END IF;
+  IF p_patch ? 'type_id' THEN
+    v_type_id := (p_patch->>'type_id')::INT;
+    IF v_type_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM document_types dt WHERE dt.id = v_type_id) THEN
+      RAISE EXCEPTION 'document type % not found', v_type_id USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+  END IF;
+  IF p_patch ? 'tags' AND jsonb_typeof(p_patch->'tags') NOT IN ('array', 'null') THEN
+    RAISE EXCEPTION 'tags must be an array' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  PERFORM _check_document_version(p_document_id, p_expected_version);
+  SELECT d.file_meta INTO v_old_file FROM documents d WHERE d.id = p_document_id;
+
+  UPDATE documents d SET
+    title         = CASE WHEN p_patch ? 'title' THEN btrim(p_patch->>'title') ELSE d.title END,
+    privacy       = CASE WHEN p_patch ? 'privacy' THEN v_privacy::privacy_type ELSE d.privacy END,
+    document_date = CASE WHEN p_patch ? 'document_date' THEN (p_patch->>'document_date')::DATE ELSE d.document_date END,
+    author        = CASE WHEN p_patch ? 'author' THEN nullif(btrim(p_patch->>'author'), '')::citext ELSE d.author END,
+    type_id       = CASE WHEN p_patch ? 'type_id' THEN v_type_id ELSE d.type_id END,
+    geojson       = CASE WHEN p_patch ? 'geojson' THEN nullif(p_patch->'geojson', 'null'::jsonb) ELSE d.geojson END,
+    file_meta     = CASE WHEN p_patch ? 'file_meta' THEN nullif(p_patch->'file_meta', 'null'::jsonb) ELSE d.file_meta END,
+    updated_at = now(),
+    updated_by = p_user_id,
+    version = d.version + 1
+  WHERE d.id = p_document_id
+  RETURNING d.version INTO v_version;
+
+  -- теги: null или [] — снять все, массив — заменить
+  IF p_patch ? 'tags' THEN
+    DELETE FROM document_tags WHERE document_id = p_document_id;
+    IF jsonb_typeof(p_patch->'tags') = 'array' THEN
+      FOR t IN SELECT DISTINCT btrim(tag) FROM jsonb_array_elements_text(p_patch->'tags') tag WHERE btrim(tag) <> '' LOOP
+        PERFORM _internal_attach_tag_to_document(p_document_id, t);
+      END LOOP;
+    END IF;
+  END IF;
+
+  IF p_patch ? 'file_meta' AND v_old_file IS DISTINCT FROM nullif(p_patch->'file_meta', 'null'::jsonb) THEN
+    UPDATE document_search SET file_text = NULL WHERE document_id = p_document_id;
+    PERFORM _refresh_document_search(p_document_id);
+  END IF;
+
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'update', NULL);
+  RETURN v_version;
+END; $$;
+
+-- Проверка права на правку до загрузки нового файла в хранилище:
+-- чужой запрос не должен оставлять объекты. 404 — документа нет или он в корзине
+CREATE OR REPLACE FUNCTION fn_require_document_edit(p_document_id INT, p_user_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+END; $$;
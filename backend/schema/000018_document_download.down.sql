@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS fn_log_document_download(INT, INT, INT, TEXT);
+DROP FUNCTION IF EXISTS fn_open_document_file(INT, INT, INT);
+
+-- значение 'read' остаётся в action_type: PostgreSQL не удаляет значения enum,
+-- а записи журнала о скачиваниях сохраняются
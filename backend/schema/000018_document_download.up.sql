@@ -0,0 +1,42 @@
+-- === Скачивание файла документа через API ===
+-- GET /api/documents/:id/file[?version=N] проверяет право просмотра и пишет каждое скачивание
+-- в logs (action = 'read', tg_op = 'download').
+
+ALTER TYPE action_type ADD VALUE IF NOT EXISTS 'read';
+
+-- Проверка доступа; возвращает file_meta текущего файла документа или файла версии p_version.
+-- В журнал скачивание пишет fn_log_document_download, когда объект уже открыт в хранилище
+CREATE OR REPLACE FUNCTION fn_open_document_file(p_document_id INT, p_user_id INT, p_version INT)
+RETURNS JSONB
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_file JSONB;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_user_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege', HINT = 'request access: POST /api/documents/:id/access-requests';
+  END IF;
+
+  IF p_version IS NULL THEN
+    SELECT d.file_meta INTO v_file FROM documents d WHERE d.id = p_document_id;
+  ELSE
+    SELECT v.file_meta INTO v_file FROM document_versions v WHERE v.document_id = p_document_id AND v.version = p_version;
+  END IF;
+  IF v_file IS NULL OR NOT v_file ? 'key' THEN
+    RAISE EXCEPTION 'Document % has no file', p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+  RETURN v_file;
+END; $$;
+
+-- Запись скачивания в журнал: право просмотра проверяется ещё раз, file_meta берётся из БД
+CREATE OR REPLACE FUNCTION fn_log_document_download(p_document_id INT, p_user_id INT, p_version INT, p_range TEXT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_file JSONB;
+BEGIN
+  v_file := fn_open_document_file(p_document_id, p_user_id, p_version);
+  PERFORM _log_action(p_user_id, 'read', 'documents', p_document_id, 'download',
+    jsonb_build_object('file', jsonb_build_object('bucket', v_file->>'bucket', 'key', v_file->>'key', 'sha256', v_file->>'sha256'),
+                       'version', p_version, 'range', p_range));
+END; $$;
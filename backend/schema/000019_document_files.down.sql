@@ -0,0 +1,127 @@
+-- восстановление прежнего определения из 000015
+CREATE OR REPLACE FUNCTION fn_purge_deleted_documents(p_older_than INTERVAL, p_limit INT)
+RETURNS TABLE (provider TEXT, bucket TEXT, key TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ids INT[];
+  v_files JSONB[];
+BEGIN
+  IF p_older_than IS NULL OR p_older_than < interval '0' THEN RAISE EXCEPTION 'p_older_than must not be negative'; END IF;
+
+  SELECT array_agg(d.id) INTO v_ids
+  FROM (
+    SELECT d.id FROM documents d
+    WHERE d.deleted_at IS NOT NULL AND d.deleted_at <= now() - p_older_than
+    ORDER BY d.deleted_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  ) d;
+  IF v_ids IS NULL THEN RETURN; END IF;
+
+  SELECT array_agg(DISTINCT f.fm) INTO v_files
+  FROM (
+    SELECT d.file_meta AS fm FROM documents d WHERE d.id = ANY(v_ids) AND d.file_meta ? 'key'
+    UNION
+    SELECT v.file_meta FROM document_versions v WHERE v.document_id = ANY(v_ids) AND v.file_meta ? 'key'
+  ) f;
+
+  DELETE FROM documents d WHERE d.id = ANY(v_ids);
+
+  RETURN QUERY
+  SELECT DISTINCT f->>'provider', f->>'bucket', f->>'key'
+  FROM unnest(coalesce(v_files, '{}')) f
+  WHERE NOT EXISTS (
+          SELECT 1 FROM documents d
+          WHERE d.file_meta->>'key' = f->>'key' AND d.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_versions v
+          WHERE v.file_meta->>'key' = f->>'key' AND v.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket');
+END; $$;
+
+DROP FUNCTION IF EXISTS fn_log_attachment_download(INT, INT, INT, TEXT);
+DROP FUNCTION IF EXISTS fn_open_document_attachment(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_list_document_version_files(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_reorder_document_files(INT, INT, INT[]);
+DROP FUNCTION IF EXISTS fn_remove_document_file(INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_replace_document_file(INT, INT, INT, TEXT, JSONB);
+DROP FUNCTION IF EXISTS fn_add_document_file(INT, INT, TEXT, JSONB, INT);
+DROP FUNCTION IF EXISTS fn_list_document_files(INT, INT);
+DROP FUNCTION IF EXISTS _check_document_files_edit(INT, INT);
+DROP FUNCTION IF EXISTS _touch_document_files(INT, INT);
+
+-- восстановление определений из 000014 и 000016
+CREATE OR REPLACE FUNCTION _snapshot_document_version(p_document_id INT, p_user_id INT, p_kind TEXT, p_restored_from INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO document_versions (document_id, version, title, privacy, document_date, author, type_id,
+                                 file_meta, geojson, tags, created_at, created_by, change_kind, restored_from)
+  SELECT d.id, d.version, d.title, d.privacy, d.document_date, d.author, d.type_id,
+         d.file_meta, d.geojson,
+         coalesce((SELECT array_agg(t.name::TEXT ORDER BY t.name)
+                   FROM document_tags x JOIN tags t ON t.id = x.tag_id
+                   WHERE x.document_id = d.id), '{}'),
+         now(), p_user_id, p_kind, p_restored_from
+  FROM documents d
+  WHERE d.id = p_document_id;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_restore_document_version(p_document_id INT, p_user_id INT, p_version INT, p_expected_version INT DEFAULT NULL)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ver document_versions%ROWTYPE;
+  v_old_file JSONB;
+  v_new_version INT;
+  t TEXT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  SELECT * INTO v_ver FROM document_versions v WHERE v.document_id = p_document_id AND v.version = p_version;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'version % of document % not found', p_version, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  PERFORM _check_document_version(p_document_id, p_expected_version);
+  SELECT d.file_meta INTO v_old_file FROM documents d WHERE d.id = p_document_id;
+
+  UPDATE documents SET
+    title = v_ver.title,
+    privacy = v_ver.privacy,
+    document_date = v_ver.document_date,
+    author = v_ver.author,
+    type_id = v_ver.type_id,
+    file_meta = v_ver.file_meta,
+    geojson = v_ver.geojson,
+    updated_at = now(),
+    updated_by = p_user_id,
+    version = version + 1
+  WHERE id = p_document_id
+  RETURNING documents.version INTO v_new_version;
+
+  DELETE FROM document_tags WHERE document_id = p_document_id;
+  FOREACH t IN ARRAY v_ver.tags LOOP
+    PERFORM _internal_attach_tag_to_document(p_document_id, t);
+  END LOOP;
+
+  IF v_old_file IS DISTINCT FROM v_ver.file_meta THEN
+    UPDATE document_search SET file_text = NULL WHERE document_id = p_document_id;
+    PERFORM _refresh_document_search(p_document_id);
+  END IF;
+
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'restore', p_version);
+  RETURN v_new_version;
+END; $$;
+
+DROP TABLE IF EXISTS document_version_files;
+
+-- версии из-за вложений остаются в истории как обычные правки
+UPDATE document_versions SET change_kind = 'update' WHERE change_kind = 'files';
+ALTER TABLE document_versions DROP CONSTRAINT IF EXISTS document_versions_change_kind_check;
+ALTER TABLE document_versions ADD CONSTRAINT document_versions_change_kind_check
+  CHECK (change_kind IN ('create', 'update', 'restore'));
+
+DROP TABLE IF EXISTS document_files;
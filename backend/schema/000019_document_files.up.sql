@@ -0,0 +1,383 @@
+-- === Вложения документа ===
+-- Кроме основного файла (documents.file_meta) у документа может быть упорядоченный список
+-- вложений с ролью: original, transcript, preview или attachment. Любое изменение списка
+-- поднимает documents.version (ETag) и пишет в историю версию с change_kind = 'files'.
+-- Каждая версия хранит список вложений (document_version_files), восстановление версии его возвращает.
+
+CREATE TABLE IF NOT EXISTS document_files (
+  id SERIAL PRIMARY KEY,
+  document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL CHECK (position > 0),
+  role TEXT NOT NULL DEFAULT 'attachment' CHECK (role IN ('original', 'transcript', 'preview', 'attachment')),
+  file_meta JSONB NOT NULL CHECK (file_meta ? 'key'),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  updated_at TIMESTAMPTZ,
+  updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  -- отложенная проверка: перестановка меняет позиции нескольких строк одним UPDATE
+  CONSTRAINT document_files_position_key UNIQUE (document_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+CREATE INDEX IF NOT EXISTS idx_document_files_key ON document_files ((file_meta->>'key'));
+
+ALTER TABLE document_versions DROP CONSTRAINT IF EXISTS document_versions_change_kind_check;
+ALTER TABLE document_versions ADD CONSTRAINT document_versions_change_kind_check
+  CHECK (change_kind IN ('create', 'update', 'restore', 'files'));
+
+-- Состав вложений каждой версии: по нему сравниваются версии и восстанавливаются вложения.
+-- file_id — id строки document_files на момент снимка
+CREATE TABLE IF NOT EXISTS document_version_files (
+  document_id INTEGER NOT NULL,
+  version INTEGER NOT NULL,
+  position INTEGER NOT NULL,
+  file_id INTEGER NOT NULL,
+  role TEXT NOT NULL,
+  file_meta JSONB NOT NULL,
+  PRIMARY KEY (document_id, version, position),
+  FOREIGN KEY (document_id, version) REFERENCES document_versions (document_id, version) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_document_version_files_key ON document_version_files ((file_meta->>'key'));
+
+-- Снимок версии вместе со списком вложений
+CREATE OR REPLACE FUNCTION _snapshot_document_version(p_document_id INT, p_user_id INT, p_kind TEXT, p_restored_from INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO document_versions (document_id, version, title, privacy, document_date, author, type_id,
+                                 file_meta, geojson, tags, created_at, created_by, change_kind, restored_from)
+  SELECT d.id, d.version, d.title, d.privacy, d.document_date, d.author, d.type_id,
+         d.file_meta, d.geojson,
+         coalesce((SELECT array_agg(t.name::TEXT ORDER BY t.name)
+                   FROM document_tags x JOIN tags t ON t.id = x.tag_id
+                   WHERE x.document_id = d.id), '{}'),
+         now(), p_user_id, p_kind, p_restored_from
+  FROM documents d
+  WHERE d.id = p_document_id;
+
+  INSERT INTO document_version_files (document_id, version, position, file_id, role, file_meta)
+  SELECT f.document_id, d.version, f.position, f.id, f.role, f.file_meta
+  FROM document_files f JOIN documents d ON d.id = f.document_id
+  WHERE f.document_id = p_document_id;
+END; $$;
+
+-- Восстановление версии возвращает и список вложений этой версии
+CREATE OR REPLACE FUNCTION fn_restore_document_version(p_document_id INT, p_user_id INT, p_version INT, p_expected_version INT DEFAULT NULL)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ver document_versions%ROWTYPE;
+  v_old_file JSONB;
+  v_new_version INT;
+  t TEXT;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  SELECT * INTO v_ver FROM document_versions v WHERE v.document_id = p_document_id AND v.version = p_version;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'version % of document % not found', p_version, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  PERFORM _check_document_version(p_document_id, p_expected_version);
+  SELECT d.file_meta INTO v_old_file FROM documents d WHERE d.id = p_document_id;
+
+  UPDATE documents SET
+    title = v_ver.title,
+    privacy = v_ver.privacy,
+    document_date = v_ver.document_date,
+    author = v_ver.author,
+    type_id = v_ver.type_id,
+    file_meta = v_ver.file_meta,
+    geojson = v_ver.geojson,
+    updated_at = now(),
+    updated_by = p_user_id,
+    version = version + 1
+  WHERE id = p_document_id
+  RETURNING documents.version INTO v_new_version;
+
+  -- вложения версии возвращаются под прежними id: ссылки на них остаются рабочими
+  DELETE FROM document_files f WHERE f.document_id = p_document_id;
+  INSERT INTO document_files (id, document_id, position, role, file_meta, created_by)
+  SELECT vf.file_id, p_document_id, vf.position, vf.role, vf.file_meta, p_user_id
+  FROM document_version_files vf
+  WHERE vf.document_id = p_document_id AND vf.version = p_version;
+
+  DELETE FROM document_tags WHERE document_id = p_document_id;
+  FOREACH t IN ARRAY v_ver.tags LOOP
+    PERFORM _internal_attach_tag_to_document(p_document_id, t);
+  END LOOP;
+
+  IF v_old_file IS DISTINCT FROM v_ver.file_meta THEN
+    UPDATE document_search SET file_text = NULL WHERE document_id = p_document_id;
+    PERFORM _refresh_document_search(p_document_id);
+  END IF;
+
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'restore', p_version);
+  RETURN v_new_version;
+END; $$;
+
+-- Новая версия документа после изменения списка вложений
+CREATE OR REPLACE FUNCTION _touch_document_files(p_document_id INT, p_user_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE documents SET updated_at = now(), updated_by = p_user_id, version = version + 1
+  WHERE id = p_document_id;
+  PERFORM _snapshot_document_version(p_document_id, p_user_id, 'files', NULL);
+END; $$;
+
+-- Право на изменение вложений — то же, что на правку документа
+CREATE OR REPLACE FUNCTION _check_document_files_edit(p_document_id INT, p_user_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_edit_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'No permission' USING ERRCODE = 'insufficient_privilege';
+  END IF;
+  -- сериализует изменения списка вложений одного документа
+  PERFORM 1 FROM documents d WHERE d.id = p_document_id FOR UPDATE;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_list_document_files(p_document_id INT, p_requester_id INT)
+RETURNS TABLE (
+  id INT,
+  position INT,
+  role TEXT,
+  file_meta JSONB,
+  created_at TIMESTAMPTZ,
+  created_by INT,
+  updated_at TIMESTAMPTZ,
+  updated_by INT
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  SELECT f.id, f.position, f.role, f.file_meta, f.created_at, f.created_by, f.updated_at, f.updated_by
+  FROM document_files f
+  WHERE f.document_id = p_document_id
+  ORDER BY f.position;
+END; $$;
+
+-- p_position NULL — в конец списка; иначе вложение вставляется на эту позицию со сдвигом остальных
+CREATE OR REPLACE FUNCTION fn_add_document_file(p_document_id INT, p_user_id INT, p_role TEXT, p_file_meta JSONB, p_position INT)
+RETURNS INTEGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_count INT;
+  v_position INT;
+  v_id INT;
+BEGIN
+  IF p_file_meta IS NULL OR NOT p_file_meta ? 'key' THEN
+    RAISE EXCEPTION 'file_meta with key is required' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  IF p_role IS NOT NULL AND p_role NOT IN ('original', 'transcript', 'preview', 'attachment') THEN
+    RAISE EXCEPTION 'role must be one of original/transcript/preview/attachment' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  PERFORM _check_document_files_edit(p_document_id, p_user_id);
+
+  SELECT count(*) INTO v_count FROM document_files f WHERE f.document_id = p_document_id;
+  v_position := least(greatest(coalesce(p_position, v_count + 1), 1), v_count + 1);
+
+  UPDATE document_files f SET position = f.position + 1
+  WHERE f.document_id = p_document_id AND f.position >= v_position;
+
+  INSERT INTO document_files (document_id, position, role, file_meta, created_by)
+  VALUES (p_document_id, v_position, coalesce(p_role, 'attachment'), p_file_meta, p_user_id)
+  RETURNING id INTO v_id;
+
+  PERFORM _touch_document_files(p_document_id, p_user_id);
+  PERFORM _log_action(p_user_id, 'create', 'document_files', v_id, 'add_file',
+    jsonb_build_object('new', jsonb_build_object('document_id', p_document_id, 'position', v_position,
+      'role', coalesce(p_role, 'attachment'), 'file_meta', p_file_meta)));
+  RETURN v_id;
+END; $$;
+
+-- Замена файла и/или роли вложения (NULL — оставить как есть)
+CREATE OR REPLACE FUNCTION fn_replace_document_file(p_document_id INT, p_user_id INT, p_file_id INT, p_role TEXT, p_file_meta JSONB)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_old document_files%ROWTYPE;
+BEGIN
+  IF p_role IS NULL AND p_file_meta IS NULL THEN
+    RAISE EXCEPTION 'nothing to update' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  IF p_file_meta IS NOT NULL AND NOT p_file_meta ? 'key' THEN
+    RAISE EXCEPTION 'file_meta with key is required' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  IF p_role IS NOT NULL AND p_role NOT IN ('original', 'transcript', 'preview', 'attachment') THEN
+    RAISE EXCEPTION 'role must be one of original/transcript/preview/attachment' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  PERFORM _check_document_files_edit(p_document_id, p_user_id);
+
+  SELECT * INTO v_old FROM document_files f WHERE f.id = p_file_id AND f.document_id = p_document_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'file % of document % not found', p_file_id, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  UPDATE document_files f SET
+    role = coalesce(p_role, f.role),
+    file_meta = coalesce(p_file_meta, f.file_meta),
+    updated_at = now(),
+    updated_by = p_user_id
+  WHERE f.id = p_file_id;
+
+  PERFORM _touch_document_files(p_document_id, p_user_id);
+  PERFORM _log_action(p_user_id, 'update', 'document_files', p_file_id, 'replace_file',
+    jsonb_build_object('old', jsonb_build_object('role', v_old.role, 'file_meta', v_old.file_meta),
+                       'new', jsonb_build_object('role', p_role, 'file_meta', p_file_meta)));
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_remove_document_file(p_document_id INT, p_user_id INT, p_file_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_old document_files%ROWTYPE;
+BEGIN
+  PERFORM _check_document_files_edit(p_document_id, p_user_id);
+
+  DELETE FROM document_files f WHERE f.id = p_file_id AND f.document_id = p_document_id
+  RETURNING * INTO v_old;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'file % of document % not found', p_file_id, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+
+  UPDATE document_files f SET position = f.position - 1
+  WHERE f.document_id = p_document_id AND f.position > v_old.position;
+
+  PERFORM _touch_document_files(p_document_id, p_user_id);
+  PERFORM _log_action(p_user_id, 'delete', 'document_files', p_file_id, 'remove_file',
+    jsonb_build_object('old', jsonb_build_object('document_id', p_document_id, 'position', v_old.position,
+      'role', v_old.role, 'file_meta', v_old.file_meta)));
+END; $$;
+
+-- p_file_ids — все вложения документа в новом порядке
+CREATE OR REPLACE FUNCTION fn_reorder_document_files(p_document_id INT, p_user_id INT, p_file_ids INT[])
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _check_document_files_edit(p_document_id, p_user_id);
+
+  IF p_file_ids IS NULL
+     OR cardinality(p_file_ids) <> (SELECT count(DISTINCT x) FROM unnest(p_file_ids) x)
+     OR (SELECT array_agg(x ORDER BY x) FROM unnest(p_file_ids) x)
+        IS DISTINCT FROM (SELECT array_agg(f.id ORDER BY f.id) FROM document_files f WHERE f.document_id = p_document_id) THEN
+    RAISE EXCEPTION 'file_ids must list every file of document % exactly once', p_document_id
+      USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  UPDATE document_files f SET position = o.ord
+  FROM unnest(p_file_ids) WITH ORDINALITY AS o(id, ord)
+  WHERE f.id = o.id AND f.position <> o.ord;
+
+  PERFORM _touch_document_files(p_document_id, p_user_id);
+  PERFORM _log_action(p_user_id, 'update', 'documents', p_document_id, 'reorder_files',
+    jsonb_build_object('new', jsonb_build_object('file_ids', to_jsonb(p_file_ids))));
+END; $$;
+
+-- Скачивание вложения: как fn_open_document_file, в журнал пишет fn_log_attachment_download
+CREATE OR REPLACE FUNCTION fn_open_document_attachment(p_document_id INT, p_user_id INT, p_file_id INT)
+RETURNS JSONB
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_file JSONB;
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_user_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_user_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege', HINT = 'request access: POST /api/documents/:id/access-requests';
+  END IF;
+
+  SELECT f.file_meta INTO v_file FROM document_files f WHERE f.id = p_file_id AND f.document_id = p_document_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'file % of document % not found', p_file_id, p_document_id USING ERRCODE = 'no_data_found';
+  END IF;
+  RETURN v_file;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_log_attachment_download(p_document_id INT, p_user_id INT, p_file_id INT, p_range TEXT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE v_file JSONB;
+BEGIN
+  v_file := fn_open_document_attachment(p_document_id, p_user_id, p_file_id);
+  PERFORM _log_action(p_user_id, 'read', 'documents', p_document_id, 'download',
+    jsonb_build_object('file', jsonb_build_object('id', p_file_id, 'bucket', v_file->>'bucket', 'key', v_file->>'key',
+                                                  'sha256', v_file->>'sha256'),
+                       'range', p_range));
+END; $$;
+
+-- Вложения версии документа по порядку
+CREATE OR REPLACE FUNCTION fn_list_document_version_files(p_document_id INT, p_requester_id INT, p_version INT)
+RETURNS TABLE (file_id INT, position INT, role TEXT, file_meta JSONB)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  SELECT vf.file_id, vf.position, vf.role, vf.file_meta
+  FROM document_version_files vf
+  WHERE vf.document_id = p_document_id AND vf.version = p_version
+  ORDER BY vf.position;
+END; $$;
+
+-- очистка корзины удаляет и файлы вложений
+CREATE OR REPLACE FUNCTION fn_purge_deleted_documents(p_older_than INTERVAL, p_limit INT)
+RETURNS TABLE (provider TEXT, bucket TEXT, key TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ids INT[];
+  v_files JSONB[];
+BEGIN
+  IF p_older_than IS NULL OR p_older_than < interval '0' THEN RAISE EXCEPTION 'p_older_than must not be negative'; END IF;
+
+  SELECT array_agg(d.id) INTO v_ids
+  FROM (
+    SELECT d.id FROM documents d
+    WHERE d.deleted_at IS NOT NULL AND d.deleted_at <= now() - p_older_than
+    ORDER BY d.deleted_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  ) d;
+  IF v_ids IS NULL THEN RETURN; END IF;
+
+  SELECT array_agg(DISTINCT f.fm) INTO v_files
+  FROM (
+    SELECT d.file_meta AS fm FROM documents d WHERE d.id = ANY(v_ids) AND d.file_meta ? 'key'
+    UNION
+    SELECT v.file_meta FROM document_versions v WHERE v.document_id = ANY(v_ids) AND v.file_meta ? 'key'
+    UNION
+    SELECT a.file_meta FROM document_files a WHERE a.document_id = ANY(v_ids)
+    UNION
+    SELECT vf.file_meta FROM document_version_files vf WHERE vf.document_id = ANY(v_ids)
+  ) f;
+
+  DELETE FROM documents d WHERE d.id = ANY(v_ids);
+
+  RETURN QUERY
+  SELECT DISTINCT f->>'provider', f->>'bucket', f->>'key'
+  FROM unnest(coalesce(v_files, '{}')) f
+  WHERE NOT EXISTS (
+          SELECT 1 FROM documents d
+          WHERE d.file_meta->>'key' = f->>'key' AND d.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_versions v
+          WHERE v.file_meta->>'key' = f->>'key' AND v.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_files a
+          WHERE a.file_meta->>'key' = f->>'key' AND a.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_version_files vf
+          WHERE vf.file_meta->>'key' = f->>'key' AND vf.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket');
+END; $$;
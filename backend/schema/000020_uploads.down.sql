@@ -0,0 +1,8 @@
+DROP FUNCTION IF EXISTS fn_purge_expired_uploads(INT);
+DROP FUNCTION IF EXISTS fn_delete_upload(TEXT, INT);
+DROP FUNCTION IF EXISTS fn_complete_upload(TEXT, INT, JSONB);
+DROP FUNCTION IF EXISTS fn_save_upload_progress(TEXT, INT, BIGINT, BIGINT, JSONB, BYTEA);
+DROP FUNCTION IF EXISTS fn_get_upload(TEXT, INT);
+DROP FUNCTION IF EXISTS fn_create_upload(TEXT, INT, BIGINT, TEXT, TEXT, JSONB, TEXT, TEXT, TEXT, TIMESTAMPTZ);
+
+DROP TABLE IF EXISTS uploads;
@@ -0,0 +1,134 @@
+-- === Возобновляемые загрузки (tus) ===
+-- Строка uploads — состояние загрузки: сколько байт принято (upload_offset), какие части
+-- уже лежат в хранилище (parts) и состояние SHA-256 после upload_offset байт (hash_state).
+-- Завершённую загрузку (status = 'completed', file_meta) владелец прикрепляет к документу
+-- по id; просроченные строки удаляет фоновая задача.
+
+CREATE TABLE IF NOT EXISTS uploads (
+  id TEXT PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  upload_length BIGINT NOT NULL CHECK (upload_length > 0),
+  upload_offset BIGINT NOT NULL DEFAULT 0,
+  filename TEXT,
+  content_type TEXT,
+  metadata JSONB NOT NULL DEFAULT '{}',
+  bucket TEXT NOT NULL,
+  key TEXT NOT NULL,
+  storage_upload_id TEXT NOT NULL,
+  parts JSONB NOT NULL DEFAULT '[]',
+  hash_state BYTEA,
+  status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed')),
+  file_meta JSONB,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  CHECK (upload_offset BETWEEN 0 AND upload_length)
+);
+CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads (expires_at);
+CREATE INDEX IF NOT EXISTS idx_uploads_user ON uploads (user_id);
+
+CREATE OR REPLACE FUNCTION fn_create_upload(
+  p_id TEXT, p_user_id INT, p_length BIGINT, p_filename TEXT, p_content_type TEXT, p_metadata JSONB,
+  p_bucket TEXT, p_key TEXT, p_storage_upload_id TEXT, p_expires_at TIMESTAMPTZ)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_length IS NULL OR p_length <= 0 THEN
+    RAISE EXCEPTION 'upload length must be positive' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  INSERT INTO uploads (id, user_id, upload_length, filename, content_type, metadata, bucket, key, storage_upload_id, expires_at)
+  VALUES (p_id, p_user_id, p_length, nullif(btrim(p_filename), ''), nullif(btrim(p_content_type), ''),
+          coalesce(p_metadata, '{}'), p_bucket, p_key, p_storage_upload_id, p_expires_at);
+END; $$;
+
+-- Загрузка видна только владельцу; чужая или просроченная — no_data_found (404)
+CREATE OR REPLACE FUNCTION fn_get_upload(p_id TEXT, p_user_id INT)
+RETURNS TABLE (
+  id TEXT,
+  user_id INT,
+  upload_length BIGINT,
+  upload_offset BIGINT,
+  filename TEXT,
+  content_type TEXT,
+  metadata JSONB,
+  bucket TEXT,
+  key TEXT,
+  storage_upload_id TEXT,
+  parts JSONB,
+  hash_state BYTEA,
+  status TEXT,
+  file_meta JSONB,
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.id, u.user_id, u.upload_length, u.upload_offset, u.filename, u.content_type, u.metadata,
+         u.bucket, u.key, u.storage_upload_id, u.parts, u.hash_state, u.status, u.file_meta,
+         u.created_at, u.updated_at, u.expires_at
+  FROM uploads u
+  WHERE u.id = p_id AND u.user_id = p_user_id AND u.expires_at > now();
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'upload % not found', p_id USING ERRCODE = 'no_data_found';
+  END IF;
+END; $$;
+
+-- Сохранение прогресса; p_old_offset защищает от параллельной записи в ту же загрузку (409)
+CREATE OR REPLACE FUNCTION fn_save_upload_progress(
+  p_id TEXT, p_user_id INT, p_old_offset BIGINT, p_new_offset BIGINT, p_parts JSONB, p_hash_state BYTEA)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE uploads u
+     SET upload_offset = p_new_offset, parts = p_parts, hash_state = p_hash_state, updated_at = now()
+   WHERE u.id = p_id AND u.user_id = p_user_id AND u.status = 'active' AND u.upload_offset = p_old_offset;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'upload % changed concurrently or is not active', p_id USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_complete_upload(p_id TEXT, p_user_id INT, p_file_meta JSONB)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE uploads u
+     SET status = 'completed', upload_offset = u.upload_length, file_meta = p_file_meta,
+         hash_state = NULL, updated_at = now()
+   WHERE u.id = p_id AND u.user_id = p_user_id AND u.status = 'active';
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'upload % is not active', p_id USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+  PERFORM _log_action(p_user_id, 'create', 'uploads', NULL, 'complete_upload',
+    jsonb_build_object('new', jsonb_build_object('id', p_id, 'file_meta', p_file_meta)));
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_delete_upload(p_id TEXT, p_user_id INT)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  DELETE FROM uploads u WHERE u.id = p_id AND u.user_id = p_user_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'upload % not found', p_id USING ERRCODE = 'no_data_found';
+  END IF;
+END; $$;
+
+-- Удаляет просроченные загрузки (не больше p_limit); незавершённые вызывающая сторона
+-- прерывает в хранилище. Файлы завершённых, но не прикреплённых загрузок остаются в хранилище.
+CREATE OR REPLACE FUNCTION fn_purge_expired_uploads(p_limit INT)
+RETURNS TABLE (id TEXT, status TEXT, bucket TEXT, key TEXT, storage_upload_id TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  DELETE FROM uploads u
+  WHERE u.id IN (
+    SELECT x.id FROM uploads x
+    WHERE x.expires_at <= now()
+    ORDER BY x.expires_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  )
+  RETURNING u.id, u.status, u.bucket, u.key, u.storage_upload_id;
+END; $$;
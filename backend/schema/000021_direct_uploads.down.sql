@@ -0,0 +1,72 @@
+DROP FUNCTION IF EXISTS fn_purge_expired_uploads(INT);
+DROP FUNCTION IF EXISTS fn_get_upload(TEXT, INT);
+DROP FUNCTION IF EXISTS fn_create_upload(TEXT, INT, BIGINT, TEXT, TEXT, JSONB, TEXT, TEXT, TEXT, TIMESTAMPTZ, TEXT, TEXT);
+
+-- прямые загрузки в старой схеме не представимы
+DELETE FROM uploads WHERE kind = 'direct';
+ALTER TABLE uploads ALTER COLUMN storage_upload_id SET NOT NULL;
+ALTER TABLE uploads DROP COLUMN IF EXISTS sha256, DROP COLUMN IF EXISTS kind;
+
+CREATE OR REPLACE FUNCTION fn_create_upload(
+  p_id TEXT, p_user_id INT, p_length BIGINT, p_filename TEXT, p_content_type TEXT, p_metadata JSONB,
+  p_bucket TEXT, p_key TEXT, p_storage_upload_id TEXT, p_expires_at TIMESTAMPTZ)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_length IS NULL OR p_length <= 0 THEN
+    RAISE EXCEPTION 'upload length must be positive' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  INSERT INTO uploads (id, user_id, upload_length, filename, content_type, metadata, bucket, key, storage_upload_id, expires_at)
+  VALUES (p_id, p_user_id, p_length, nullif(btrim(p_filename), ''), nullif(btrim(p_content_type), ''),
+          coalesce(p_metadata, '{}'), p_bucket, p_key, p_storage_upload_id, p_expires_at);
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_get_upload(p_id TEXT, p_user_id INT)
+RETURNS TABLE (
+  id TEXT,
+  user_id INT,
+  upload_length BIGINT,
+  upload_offset BIGINT,
+  filename TEXT,
+  content_type TEXT,
+  metadata JSONB,
+  bucket TEXT,
+  key TEXT,
+  storage_upload_id TEXT,
+  parts JSONB,
+  hash_state BYTEA,
+  status TEXT,
+  file_meta JSONB,
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.id, u.user_id, u.upload_length, u.upload_offset, u.filename, u.content_type, u.metadata,
+         u.bucket, u.key, u.storage_upload_id, u.parts, u.hash_state, u.status, u.file_meta,
+         u.created_at, u.updated_at, u.expires_at
+  FROM uploads u
+  WHERE u.id = p_id AND u.user_id = p_user_id AND u.expires_at > now();
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'upload % not found', p_id USING ERRCODE = 'no_data_found';
+  END IF;
+END; $$;
+
+CREATE OR REPLACE FUNCTION fn_purge_expired_uploads(p_limit INT)
+RETURNS TABLE (id TEXT, status TEXT, bucket TEXT, key TEXT, storage_upload_id TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  DELETE FROM uploads u
+  WHERE u.id IN (
+    SELECT x.id FROM uploads x
+    WHERE x.expires_at <= now()
+    ORDER BY x.expires_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  )
+  RETURNING u.id, u.status, u.bucket, u.key, u.storage_upload_id;
+END; $$;
@@ -0,0 +1,85 @@
+-- === Прямые загрузки в хранилище (presigned PUT) ===
+-- kind = 'direct': клиент кладёт файл по подписанной ссылке во временный ключ bucket/key,
+-- затем finalize проверяет размер, тип и SHA-256 и переносит объект в постоянный ключ.
+-- sha256 — ожидаемая клиентом контрольная сумма (необязательна).
+
+ALTER TABLE uploads
+  ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'tus' CHECK (kind IN ('tus', 'direct')),
+  ADD COLUMN IF NOT EXISTS sha256 TEXT CHECK (sha256 ~ '^[0-9a-f]{64}$');
+ALTER TABLE uploads ALTER COLUMN storage_upload_id DROP NOT NULL;
+
+DROP FUNCTION IF EXISTS fn_create_upload(TEXT, INT, BIGINT, TEXT, TEXT, JSONB, TEXT, TEXT, TEXT, TIMESTAMPTZ);
+CREATE OR REPLACE FUNCTION fn_create_upload(
+  p_id TEXT, p_user_id INT, p_length BIGINT, p_filename TEXT, p_content_type TEXT, p_metadata JSONB,
+  p_bucket TEXT, p_key TEXT, p_storage_upload_id TEXT, p_expires_at TIMESTAMPTZ,
+  p_kind TEXT DEFAULT 'tus', p_sha256 TEXT DEFAULT NULL)
+RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_user_id IS NULL THEN RAISE EXCEPTION 'p_user_id is required'; END IF;
+  IF p_length IS NULL OR p_length <= 0 THEN
+    RAISE EXCEPTION 'upload length must be positive' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  IF p_sha256 IS NOT NULL AND lower(p_sha256) !~ '^[0-9a-f]{64}$' THEN
+    RAISE EXCEPTION 'sha256 must be 64 hex characters' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  INSERT INTO uploads (id, user_id, upload_length, filename, content_type, metadata, bucket, key, storage_upload_id,
+                       expires_at, kind, sha256)
+  VALUES (p_id, p_user_id, p_length, nullif(btrim(p_filename), ''), nullif(btrim(p_content_type), ''),
+          coalesce(p_metadata, '{}'), p_bucket, p_key, p_storage_upload_id, p_expires_at,
+          coalesce(p_kind, 'tus'), lower(p_sha256));
+END; $$;
+
+DROP FUNCTION IF EXISTS fn_get_upload(TEXT, INT);
+CREATE OR REPLACE FUNCTION fn_get_upload(p_id TEXT, p_user_id INT)
+RETURNS TABLE (
+  id TEXT,
+  user_id INT,
+  kind TEXT,
+  upload_length BIGINT,
+  upload_offset BIGINT,
+  filename TEXT,
+  content_type TEXT,
+  metadata JSONB,
+  sha256 TEXT,
+  bucket TEXT,
+  key TEXT,
+  storage_upload_id TEXT,
+  parts JSONB,
+  hash_state BYTEA,
+  status TEXT,
+  file_meta JSONB,
+  created_at TIMESTAMPTZ,
+  updated_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT u.id, u.user_id, u.kind, u.upload_length, u.upload_offset, u.filename, u.content_type, u.metadata,
+         u.sha256, u.bucket, u.key, u.storage_upload_id, u.parts, u.hash_state, u.status, u.file_meta,
+         u.created_at, u.updated_at, u.expires_at
+  FROM uploads u
+  WHERE u.id = p_id AND u.user_id = p_user_id AND u.expires_at > now();
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'upload % not found', p_id USING ERRCODE = 'no_data_found';
+  END IF;
+END; $$;
+
+-- незавершённую прямую загрузку вызывающая сторона удаляет из временного ключа
+DROP FUNCTION IF EXISTS fn_purge_expired_uploads(INT);
+CREATE OR REPLACE FUNCTION fn_purge_expired_uploads(p_limit INT)
+RETURNS TABLE (id TEXT, kind TEXT, status TEXT, bucket TEXT, key TEXT, storage_upload_id TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  DELETE FROM uploads u
+  WHERE u.id IN (
+    SELECT x.id FROM uploads x
+    WHERE x.expires_at <= now()
+    ORDER BY x.expires_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  )
+  RETURNING u.id, u.kind, u.status, u.bucket, u.key, u.storage_upload_id;
+END; $$;
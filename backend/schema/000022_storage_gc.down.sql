@@ -0,0 +1,57 @@
+CREATE OR REPLACE FUNCTION fn_purge_deleted_documents(p_older_than INTERVAL, p_limit INT)
+RETURNS TABLE (provider TEXT, bucket TEXT, key TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ids INT[];
+  v_files JSONB[];
+BEGIN
+  IF p_older_than IS NULL OR p_older_than < interval '0' THEN RAISE EXCEPTION 'p_older_than must not be negative'; END IF;
+
+  SELECT array_agg(d.id) INTO v_ids
+  FROM (
+    SELECT d.id FROM documents d
+    WHERE d.deleted_at IS NOT NULL AND d.deleted_at <= now() - p_older_than
+    ORDER BY d.deleted_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  ) d;
+  IF v_ids IS NULL THEN RETURN; END IF;
+
+  SELECT array_agg(DISTINCT f.fm) INTO v_files
+  FROM (
+    SELECT d.file_meta AS fm FROM documents d WHERE d.id = ANY(v_ids) AND d.file_meta ? 'key'
+    UNION
+    SELECT v.file_meta FROM document_versions v WHERE v.document_id = ANY(v_ids) AND v.file_meta ? 'key'
+    UNION
+    SELECT a.file_meta FROM document_files a WHERE a.document_id = ANY(v_ids)
+    UNION
+    SELECT vf.file_meta FROM document_version_files vf WHERE vf.document_id = ANY(v_ids)
+  ) f;
+
+  DELETE FROM documents d WHERE d.id = ANY(v_ids);
+
+  RETURN QUERY
+  SELECT DISTINCT f->>'provider', f->>'bucket', f->>'key'
+  FROM unnest(coalesce(v_files, '{}')) f
+  WHERE NOT EXISTS (
+          SELECT 1 FROM documents d
+          WHERE d.file_meta->>'key' = f->>'key' AND d.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_versions v
+          WHERE v.file_meta->>'key' = f->>'key' AND v.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_files a
+          WHERE a.file_meta->>'key' = f->>'key' AND a.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket')
+    AND NOT EXISTS (
+          SELECT 1 FROM document_version_files vf
+          WHERE vf.file_meta->>'key' = f->>'key' AND vf.file_meta->>'bucket' IS NOT DISTINCT FROM f->>'bucket');
+END; $$;
+
+DROP FUNCTION IF EXISTS fn_unreferenced_objects(TEXT, TEXT[]);
+DROP FUNCTION IF EXISTS _is_object_referenced(TEXT, TEXT);
+
+DROP INDEX IF EXISTS idx_uploads_key;
+DROP INDEX IF EXISTS idx_uploads_file_key;
+DROP INDEX IF EXISTS idx_document_files_file_key;
+DROP INDEX IF EXISTS idx_document_versions_file_key;
+DROP INDEX IF EXISTS idx_documents_file_key;
@@ -0,0 +1,83 @@
+-- === Сборка мусора в хранилище ===
+-- Объект хранилища нужен, пока на его ключ ссылается file_meta документа (в том числе
+-- в корзине), версии, вложения или загрузки, либо пока в него идёт прямая загрузка.
+-- Фоновая задача сверяет содержимое бакета с этими ссылками пачками ключей.
+
+CREATE INDEX IF NOT EXISTS idx_documents_file_key ON documents ((file_meta->>'key'));
+CREATE INDEX IF NOT EXISTS idx_document_versions_file_key ON document_versions ((file_meta->>'key'));
+CREATE INDEX IF NOT EXISTS idx_document_files_file_key ON document_files ((file_meta->>'key'));
+CREATE INDEX IF NOT EXISTS idx_uploads_file_key ON uploads ((file_meta->>'key'));
+CREATE INDEX IF NOT EXISTS idx_uploads_key ON uploads (key);
+
+-- file_meta без bucket (старые записи) считается ссылкой на ключ в любом бакете
+CREATE OR REPLACE FUNCTION _is_object_referenced(p_bucket TEXT, p_key TEXT)
+RETURNS BOOLEAN
+STABLE SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE sql AS $$
+  SELECT EXISTS (
+           SELECT 1 FROM documents d
+           WHERE d.file_meta->>'key' = p_key AND coalesce(d.file_meta->>'bucket', p_bucket) IS NOT DISTINCT FROM p_bucket)
+      OR EXISTS (
+           SELECT 1 FROM document_versions v
+           WHERE v.file_meta->>'key' = p_key AND coalesce(v.file_meta->>'bucket', p_bucket) IS NOT DISTINCT FROM p_bucket)
+      OR EXISTS (
+           SELECT 1 FROM document_files a
+           WHERE a.file_meta->>'key' = p_key AND coalesce(a.file_meta->>'bucket', p_bucket) IS NOT DISTINCT FROM p_bucket)
+      OR EXISTS (
+           SELECT 1 FROM document_version_files vf
+           WHERE vf.file_meta->>'key' = p_key AND coalesce(vf.file_meta->>'bucket', p_bucket) IS NOT DISTINCT FROM p_bucket)
+      OR EXISTS (
+           SELECT 1 FROM uploads u
+           WHERE u.file_meta->>'key' = p_key AND coalesce(u.file_meta->>'bucket', p_bucket) IS NOT DISTINCT FROM p_bucket)
+      OR EXISTS (
+           SELECT 1 FROM uploads u
+           WHERE u.key = p_key AND u.bucket IS NOT DISTINCT FROM p_bucket AND u.status = 'active');
+$$;
+
+-- Ключи из p_keys, на которые ничего не ссылается
+CREATE OR REPLACE FUNCTION fn_unreferenced_objects(p_bucket TEXT, p_keys TEXT[])
+RETURNS TABLE (key TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  RETURN QUERY
+  SELECT DISTINCT k FROM unnest(coalesce(p_keys, '{}')) k
+  WHERE NOT _is_object_referenced(p_bucket, k);
+END; $$;
+
+-- Очистка корзины проверяет ссылки тем же помощником (в том числе из загрузок)
+CREATE OR REPLACE FUNCTION fn_purge_deleted_documents(p_older_than INTERVAL, p_limit INT)
+RETURNS TABLE (provider TEXT, bucket TEXT, key TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ids INT[];
+  v_files JSONB[];
+BEGIN
+  IF p_older_than IS NULL OR p_older_than < interval '0' THEN RAISE EXCEPTION 'p_older_than must not be negative'; END IF;
+
+  SELECT array_agg(d.id) INTO v_ids
+  FROM (
+    SELECT d.id FROM documents d
+    WHERE d.deleted_at IS NOT NULL AND d.deleted_at <= now() - p_older_than
+    ORDER BY d.deleted_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  ) d;
+  IF v_ids IS NULL THEN RETURN; END IF;
+
+  SELECT array_agg(DISTINCT f.fm) INTO v_files
+  FROM (
+    SELECT d.file_meta AS fm FROM documents d WHERE d.id = ANY(v_ids) AND d.file_meta ? 'key'
+    UNION
+    SELECT v.file_meta FROM document_versions v WHERE v.document_id = ANY(v_ids) AND v.file_meta ? 'key'
+    UNION
+    SELECT a.file_meta FROM document_files a WHERE a.document_id = ANY(v_ids)
+    UNION
+    SELECT vf.file_meta FROM document_version_files vf WHERE vf.document_id = ANY(v_ids)
+  ) f;
+
+  DELETE FROM documents d WHERE d.id = ANY(v_ids);
+
+  RETURN QUERY
+  SELECT DISTINCT f->>'provider', f->>'bucket', f->>'key'
+  FROM unnest(coalesce(v_files, '{}')) f
+  WHERE NOT _is_object_referenced(f->>'bucket', f->>'key');
+END; $$;
@@ -0,0 +1,10 @@
+DROP FUNCTION IF EXISTS fn_fixity_report(INT, BOOLEAN, INT, INT, INT);
+DROP FUNCTION IF EXISTS fn_fixity_document_files(INT, INT);
+DROP FUNCTION IF EXISTS fn_record_fixity_result(TEXT, TEXT, TEXT, TEXT, BIGINT, TEXT, TEXT);
+DROP FUNCTION IF EXISTS fn_fixity_next_batch(INT, INTERVAL);
+DROP FUNCTION IF EXISTS _document_file_refs();
+
+DROP TABLE IF EXISTS file_fixity;
+
+DELETE FROM role_permissions WHERE permission = 'storage.audit';
+DELETE FROM permissions WHERE code = 'storage.audit';
@@ -0,0 +1,173 @@
+-- === Проверка целостности хранимых файлов (fixity) ===
+-- FileMeta.sha256 считается при загрузке; фоновая задача перечитывает объекты из хранилища,
+-- пересчитывает SHA-256 и записывает итог по каждому объекту. Один объект может быть
+-- файлом нескольких документов, версий и вложений — проверяется он один раз, а отчёт
+-- раскрывается по документам. Порядок выборки (сначала непроверенные, затем давно
+-- проверенные) делает проход возобновляемым: после перезапуска работа продолжается
+-- с того места, где остановилась.
+
+INSERT INTO permissions (code, description) VALUES
+  ('storage.audit', 'Проверка целостности файлов в хранилище')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, 'storage.audit' FROM roles r WHERE r.name = 'administrator'
+ON CONFLICT DO NOTHING;
+
+-- bucket '' — file_meta без bucket (старые записи)
+CREATE TABLE IF NOT EXISTS file_fixity (
+  bucket TEXT NOT NULL DEFAULT '',
+  key TEXT NOT NULL,
+  expected_sha256 TEXT,
+  actual_sha256 TEXT,
+  size BIGINT,
+  status TEXT NOT NULL CHECK (status IN ('ok', 'mismatch', 'missing', 'error')),
+  error TEXT,
+  checked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  failed_since TIMESTAMPTZ,
+  checks INT NOT NULL DEFAULT 1,
+  PRIMARY KEY (bucket, key)
+);
+CREATE INDEX IF NOT EXISTS file_fixity_checked_at_idx ON file_fixity (checked_at);
+CREATE INDEX IF NOT EXISTS file_fixity_failed_idx ON file_fixity (status) WHERE status <> 'ok';
+
+-- Все файлы документов: основной файл (в том числе в корзине), версии, вложения и вложения версий
+CREATE OR REPLACE FUNCTION _document_file_refs()
+RETURNS TABLE (document_id INT, file_id INT, version INT, bucket TEXT, key TEXT, sha256 TEXT, size BIGINT)
+STABLE SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE sql AS $$
+  SELECT d.id, NULL::INT, NULL::INT, coalesce(d.file_meta->>'bucket', ''), d.file_meta->>'key',
+         d.file_meta->>'sha256', (d.file_meta->>'size')::BIGINT
+  FROM documents d WHERE d.file_meta ? 'key'
+  UNION ALL
+  SELECT v.document_id, NULL, v.version, coalesce(v.file_meta->>'bucket', ''), v.file_meta->>'key',
+         v.file_meta->>'sha256', (v.file_meta->>'size')::BIGINT
+  FROM document_versions v WHERE v.file_meta ? 'key'
+  UNION ALL
+  SELECT a.document_id, a.id, NULL, coalesce(a.file_meta->>'bucket', ''), a.file_meta->>'key',
+         a.file_meta->>'sha256', (a.file_meta->>'size')::BIGINT
+  FROM document_files a WHERE a.file_meta ? 'key'
+  UNION ALL
+  SELECT vf.document_id, vf.file_id, vf.version, coalesce(vf.file_meta->>'bucket', ''), vf.file_meta->>'key',
+         vf.file_meta->>'sha256', (vf.file_meta->>'size')::BIGINT
+  FROM document_version_files vf WHERE vf.file_meta ? 'key';
+$$;
+
+-- Следующая пачка объектов на проверку: ещё не проверявшиеся, затем проверенные раньше
+-- now() - p_recheck_after, самые давние первыми
+CREATE OR REPLACE FUNCTION fn_fixity_next_batch(p_limit INT, p_recheck_after INTERVAL)
+RETURNS TABLE (bucket TEXT, key TEXT, sha256 TEXT, size BIGINT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF p_recheck_after IS NULL OR p_recheck_after < interval '0' THEN RAISE EXCEPTION 'p_recheck_after must not be negative'; END IF;
+  RETURN QUERY
+  SELECT x.bucket, x.key, x.sha256, x.size
+  FROM (
+    SELECT DISTINCT ON (r.bucket, r.key) r.bucket, r.key, r.sha256, r.size, f.checked_at
+    FROM _document_file_refs() r
+    LEFT JOIN file_fixity f ON f.bucket = r.bucket AND f.key = r.key
+    WHERE f.key IS NULL OR f.checked_at <= now() - p_recheck_after
+    ORDER BY r.bucket, r.key, (r.sha256 IS NULL)
+  ) x
+  ORDER BY x.checked_at NULLS FIRST, x.bucket, x.key
+  LIMIT coalesce(p_limit, 100);
+END; $$;
+
+-- Результат проверки объекта. При переходе в mismatch/missing поднимается тревога:
+-- запись в logs (table_name = 'file_fixity', по одной на затронутый документ)
+-- и pg_notify('fixity_alert'); повторные проверки того же сбоя тревогу не дублируют.
+-- Возвращает TRUE, если тревога поднята.
+CREATE OR REPLACE FUNCTION fn_record_fixity_result(
+  p_bucket TEXT,
+  p_key TEXT,
+  p_expected_sha256 TEXT,
+  p_actual_sha256 TEXT,
+  p_size BIGINT,
+  p_status TEXT,
+  p_error TEXT
+) RETURNS BOOLEAN
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_bucket TEXT := coalesce(p_bucket, '');
+  v_prev TEXT;
+  v_alert BOOLEAN;
+  v_docs INT[];
+  v_changes JSONB;
+BEGIN
+  IF p_key IS NULL OR p_key = '' THEN RAISE EXCEPTION 'p_key is required' USING ERRCODE = '22023'; END IF;
+  IF p_status NOT IN ('ok', 'mismatch', 'missing', 'error') THEN
+    RAISE EXCEPTION 'invalid fixity status %', p_status USING ERRCODE = '22023';
+  END IF;
+
+  SELECT f.status INTO v_prev FROM file_fixity f WHERE f.bucket = v_bucket AND f.key = p_key FOR UPDATE;
+
+  INSERT INTO file_fixity AS f (bucket, key, expected_sha256, actual_sha256, size, status, error, checked_at, failed_since, checks)
+  VALUES (v_bucket, p_key, p_expected_sha256, p_actual_sha256, p_size, p_status, p_error, now(),
+          CASE WHEN p_status = 'ok' THEN NULL ELSE now() END, 1)
+  ON CONFLICT (bucket, key) DO UPDATE
+  SET expected_sha256 = EXCLUDED.expected_sha256,
+      actual_sha256 = EXCLUDED.actual_sha256,
+      size = EXCLUDED.size,
+      status = EXCLUDED.status,
+      error = EXCLUDED.error,
+      checked_at = EXCLUDED.checked_at,
+      failed_since = CASE WHEN EXCLUDED.status = 'ok' THEN NULL ELSE coalesce(f.failed_since, EXCLUDED.checked_at) END,
+      checks = f.checks + 1;
+
+  v_alert := p_status IN ('mismatch', 'missing') AND v_prev IS DISTINCT FROM p_status;
+  IF NOT v_alert THEN RETURN FALSE; END IF;
+
+  SELECT array_agg(DISTINCT r.document_id ORDER BY r.document_id) INTO v_docs
+  FROM _document_file_refs() r WHERE r.bucket = v_bucket AND r.key = p_key;
+
+  v_changes := jsonb_build_object(
+    'bucket', v_bucket, 'key', p_key, 'status', p_status,
+    'expected_sha256', p_expected_sha256, 'actual_sha256', p_actual_sha256,
+    'error', p_error, 'documents', to_jsonb(coalesce(v_docs, '{}')));
+
+  INSERT INTO logs(action, table_name, record_id, user_id, user_login, tg_op, session_of_user, action_time, changes)
+  SELECT 'update'::action_type, 'file_fixity', d, NULL, NULL, 'fixity_' || p_status,
+         current_setting('app.session_of_user', true), now(), v_changes
+  FROM unnest(coalesce(v_docs, ARRAY[NULL::INT])) d;
+
+  PERFORM pg_notify('fixity_alert', v_changes::TEXT);
+  RETURN TRUE;
+END; $$;
+
+-- Файлы документа на проверку по запросу администратора
+CREATE OR REPLACE FUNCTION fn_fixity_document_files(p_admin_id INT, p_document_id INT)
+RETURNS TABLE (bucket TEXT, key TEXT, sha256 TEXT, size BIGINT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_admin_id, 'storage.audit');
+  IF NOT EXISTS (SELECT 1 FROM documents d WHERE d.id = p_document_id) THEN
+    RAISE EXCEPTION 'document % not found', p_document_id USING ERRCODE = 'P0002';
+  END IF;
+  RETURN QUERY
+  SELECT DISTINCT ON (r.bucket, r.key) r.bucket, r.key, r.sha256, r.size
+  FROM _document_file_refs() r
+  WHERE r.document_id = p_document_id
+  ORDER BY r.bucket, r.key, (r.sha256 IS NULL);
+END; $$;
+
+-- Отчёт по документам: p_failed_only — только mismatch/missing/error; p_document_id — один документ
+CREATE OR REPLACE FUNCTION fn_fixity_report(p_admin_id INT, p_failed_only BOOLEAN, p_document_id INT, p_limit INT, p_offset INT)
+RETURNS TABLE (
+  document_id INT, title TEXT, deleted BOOLEAN, file_id INT, version INT,
+  bucket TEXT, key TEXT, status TEXT, expected_sha256 TEXT, actual_sha256 TEXT,
+  size BIGINT, error TEXT, checked_at TIMESTAMPTZ, failed_since TIMESTAMPTZ, checks INT
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_permission(p_admin_id, 'storage.audit');
+  RETURN QUERY
+  SELECT r.document_id, d.title::TEXT, d.deleted_at IS NOT NULL, r.file_id, r.version,
+         f.bucket, f.key, f.status, f.expected_sha256, f.actual_sha256,
+         f.size, f.error, f.checked_at, f.failed_since, f.checks
+  FROM file_fixity f
+  JOIN _document_file_refs() r ON r.bucket = f.bucket AND r.key = f.key
+  JOIN documents d ON d.id = r.document_id
+  WHERE (NOT coalesce(p_failed_only, TRUE) OR f.status <> 'ok')
+    AND (p_document_id IS NULL OR r.document_id = p_document_id)
+  ORDER BY (f.status = 'ok'), f.checked_at DESC, r.document_id, r.file_id NULLS FIRST, r.version NULLS FIRST
+  LIMIT coalesce(p_limit, 100) OFFSET coalesce(p_offset, 0);
+END; $$;
@@ -0,0 +1,196 @@
+-- === Дедупликация файлов по содержимому ===
+-- Объекты хранилища адресуются по SHA-256 (<prefix>/sha256/ab/cd/<hex>): одинаковый файл,
+-- загруженный к разным документам, хранится один раз. stored_objects считает ссылки на
+-- объект из file_meta документов, версий и вложений; счётчик ведут триггеры.
+-- bucket '' — file_meta без bucket (старые записи), как в file_fixity.
+
+CREATE TABLE IF NOT EXISTS stored_objects (
+  bucket TEXT NOT NULL DEFAULT '',
+  key TEXT NOT NULL,
+  sha256 TEXT,
+  size BIGINT,
+  ref_count INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (bucket, key)
+);
+CREATE INDEX IF NOT EXISTS stored_objects_sha256_idx ON stored_objects (sha256);
+
+CREATE OR REPLACE FUNCTION _adjust_object_refs(p_file_meta JSONB, p_delta INT) RETURNS VOID
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_bucket TEXT := coalesce(p_file_meta->>'bucket', '');
+  v_key TEXT := p_file_meta->>'key';
+BEGIN
+  IF v_key IS NULL THEN RETURN; END IF;
+  INSERT INTO stored_objects AS s (bucket, key, sha256, size, ref_count)
+  VALUES (v_bucket, v_key, p_file_meta->>'sha256', (p_file_meta->>'size')::BIGINT, p_delta)
+  ON CONFLICT (bucket, key) DO UPDATE
+  SET ref_count = s.ref_count + p_delta,
+      sha256 = coalesce(s.sha256, EXCLUDED.sha256),
+      size = coalesce(s.size, EXCLUDED.size),
+      updated_at = now();
+  IF p_delta < 0 THEN
+    DELETE FROM stored_objects s WHERE s.bucket = v_bucket AND s.key = v_key AND s.ref_count <= 0;
+  END IF;
+END; $$;
+
+CREATE OR REPLACE FUNCTION _track_object_refs() RETURNS TRIGGER
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  IF TG_OP = 'UPDATE'
+     AND OLD.file_meta->>'key' IS NOT DISTINCT FROM NEW.file_meta->>'key'
+     AND OLD.file_meta->>'bucket' IS NOT DISTINCT FROM NEW.file_meta->>'bucket' THEN
+    RETURN NULL;
+  END IF;
+  IF TG_OP IN ('UPDATE', 'DELETE') THEN
+    PERFORM _adjust_object_refs(OLD.file_meta, -1);
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') THEN
+    PERFORM _adjust_object_refs(NEW.file_meta, 1);
+  END IF;
+  RETURN NULL;
+END; $$;
+
+DROP TRIGGER IF EXISTS trg_documents_object_refs ON documents;
+CREATE TRIGGER trg_documents_object_refs
+AFTER INSERT OR DELETE OR UPDATE OF file_meta ON documents
+FOR EACH ROW EXECUTE FUNCTION _track_object_refs();
+
+DROP TRIGGER IF EXISTS trg_document_versions_object_refs ON document_versions;
+CREATE TRIGGER trg_document_versions_object_refs
+AFTER INSERT OR DELETE OR UPDATE OF file_meta ON document_versions
+FOR EACH ROW EXECUTE FUNCTION _track_object_refs();
+
+DROP TRIGGER IF EXISTS trg_document_files_object_refs ON document_files;
+CREATE TRIGGER trg_document_files_object_refs
+AFTER INSERT OR DELETE OR UPDATE OF file_meta ON document_files
+FOR EACH ROW EXECUTE FUNCTION _track_object_refs();
+
+DROP TRIGGER IF EXISTS trg_document_version_files_object_refs ON document_version_files;
+CREATE TRIGGER trg_document_version_files_object_refs
+AFTER INSERT OR DELETE OR UPDATE OF file_meta ON document_version_files
+FOR EACH ROW EXECUTE FUNCTION _track_object_refs();
+
+-- Счётчики для уже загруженных файлов
+INSERT INTO stored_objects (bucket, key, sha256, size, ref_count)
+SELECT r.bucket, r.key, max(r.sha256), max(r.size), count(*)
+FROM _document_file_refs() r
+GROUP BY r.bucket, r.key
+ON CONFLICT (bucket, key) DO UPDATE SET ref_count = EXCLUDED.ref_count, updated_at = now();
+
+-- Ссылки документов берутся из счётчика; загрузки проверяются как раньше
+CREATE OR REPLACE FUNCTION _is_object_referenced(p_bucket TEXT, p_key TEXT)
+RETURNS BOOLEAN
+STABLE SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE sql AS $$
+  SELECT EXISTS (
+           SELECT 1 FROM stored_objects s
+           WHERE s.key = p_key AND s.bucket IN (coalesce(p_bucket, ''), '') AND s.ref_count > 0)
+      OR EXISTS (
+           SELECT 1 FROM uploads u
+           WHERE u.file_meta->>'key' = p_key AND coalesce(u.file_meta->>'bucket', p_bucket) IS NOT DISTINCT FROM p_bucket)
+      OR EXISTS (
+           SELECT 1 FROM uploads u
+           WHERE u.key = p_key AND u.bucket IS NOT DISTINCT FROM p_bucket AND u.status = 'active');
+$$;
+
+-- Другие документы с тем же файлом: для основного файла (file_id NULL) и каждого вложения
+-- документа — документы, где тот же объект является основным файлом или вложением.
+-- Видны только документы, доступные запрашивающему; ref_count считает все ссылки
+-- (в том числе версии и недоступные документы). Файл без совпадений — одна строка
+-- с document_id NULL.
+CREATE OR REPLACE FUNCTION fn_document_shared_files(p_document_id INT, p_requester_id INT)
+RETURNS TABLE (
+  source_file_id INT,
+  bucket TEXT,
+  key TEXT,
+  sha256 TEXT,
+  ref_count INT,
+  document_id INT,
+  title TEXT,
+  file_id INT
+)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM _require_live_document(p_document_id);
+  IF NOT _can_user_view_document(p_requester_id, p_document_id) THEN
+    RAISE EXCEPTION 'User % has no permission to view document %', p_requester_id, p_document_id
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+
+  RETURN QUERY
+  WITH src AS (
+    SELECT NULL::INT AS file_id, coalesce(d.file_meta->>'bucket', '') AS bucket, d.file_meta->>'key' AS key,
+           d.file_meta->>'sha256' AS sha256, 0 AS pos
+    FROM documents d WHERE d.id = p_document_id AND d.file_meta ? 'key'
+    UNION ALL
+    SELECT a.id, coalesce(a.file_meta->>'bucket', ''), a.file_meta->>'key', a.file_meta->>'sha256', a.position
+    FROM document_files a WHERE a.document_id = p_document_id
+  )
+  SELECT s.file_id, s.bucket, s.key, coalesce(so.sha256, s.sha256), coalesce(so.ref_count, 0),
+         o.document_id, o.title, o.file_id
+  FROM src s
+  LEFT JOIN stored_objects so ON so.bucket = s.bucket AND so.key = s.key
+  LEFT JOIN LATERAL (
+    SELECT x.document_id, d.title, x.file_id
+    FROM (
+      SELECT d2.id AS document_id, NULL::INT AS file_id
+      FROM documents d2
+      WHERE d2.file_meta->>'key' = s.key AND coalesce(d2.file_meta->>'bucket', '') = s.bucket
+      UNION
+      SELECT a2.document_id, a2.id
+      FROM document_files a2
+      WHERE a2.file_meta->>'key' = s.key AND coalesce(a2.file_meta->>'bucket', '') = s.bucket
+    ) x
+    JOIN documents d ON d.id = x.document_id AND d.deleted_at IS NULL
+    WHERE x.document_id <> p_document_id
+      AND _can_user_view_document(p_requester_id, x.document_id)
+  ) o ON TRUE
+  ORDER BY s.pos, o.document_id, o.file_id NULLS FIRST;
+END; $$;
+
+-- Очистка корзины: удаляет документы и возвращает объекты, на которые после этого не
+-- осталось ссылок (по stored_objects и загрузкам). Вызывающий удаляет их из хранилища,
+-- перепроверив ссылки и время изменения непосредственно перед удалением: загрузка того же
+-- содержимого попадает на тот же ключ раньше, чем запишется ссылка на него
+DROP FUNCTION IF EXISTS fn_purge_deleted_documents(INTERVAL, INT);
+CREATE OR REPLACE FUNCTION fn_purge_deleted_documents(p_older_than INTERVAL, p_limit INT)
+RETURNS TABLE (provider TEXT, bucket TEXT, key TEXT)
+SECURITY DEFINER SET search_path = public, pg_temp LANGUAGE plpgsql AS $$
+DECLARE
+  v_ids INT[];
+  v_files JSONB[];
+BEGIN
+  IF p_older_than IS NULL OR p_older_than < interval '0' THEN
+    RAISE EXCEPTION 'p_older_than must not be negative' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  SELECT array_agg(d.id) INTO v_ids
+  FROM (
+    SELECT d.id FROM documents d
+    WHERE d.deleted_at IS NOT NULL AND d.deleted_at <= now() - p_older_than
+    ORDER BY d.deleted_at
+    LIMIT coalesce(p_limit, 100)
+    FOR UPDATE SKIP LOCKED
+  ) d;
+  IF v_ids IS NULL THEN RETURN; END IF;
+
+  SELECT array_agg(DISTINCT f.fm) INTO v_files
+  FROM (
+    SELECT d.file_meta AS fm FROM documents d WHERE d.id = ANY(v_ids) AND d.file_meta ? 'key'
+    UNION
+    SELECT v.file_meta FROM document_versions v WHERE v.document_id = ANY(v_ids) AND v.file_meta ? 'key'
+    UNION
+    SELECT a.file_meta FROM document_files a WHERE a.document_id = ANY(v_ids)
+    UNION
+    SELECT vf.file_meta FROM document_version_files vf WHERE vf.document_id = ANY(v_ids)
+  ) f;
+
+  -- триггеры *_object_refs уменьшают счётчики stored_objects
+  DELETE FROM documents d WHERE d.id = ANY(v_ids);
+
+  RETURN QUERY
+  SELECT DISTINCT f->>'provider', f->>'bucket', f->>'key'
+  FROM unnest(coalesce(v_files, '{}')) f
+  WHERE NOT _is_object_referenced(f->>'bucket', f->>'key');
+END; $$;
@@ -0,0 +1,525 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalURLPrefix is the route under which LocalStorage serves signed URLs.
+const LocalURLPrefix = "/storage/local"
+
+// localPutTimeout bounds a single presigned PUT served by LocalStorage.
+const localPutTimeout = 30 * time.Minute
+
+type LocalConfig struct {
+	Root       string // directory holding <bucket>/<key>; created if missing
+	Bucket     string // default bucket
+	Prefix     string // optional key prefix like "documents/"
+	BaseURL    string // public origin for signed URLs, e.g. "https://archive.example.org"; empty gives relative URLs
+	SigningKey []byte // HMAC key for signed URLs
+}
+
+// LocalStorage keeps objects on the local filesystem. Keys are content-addressed
+// (<prefix>/sha256/ab/cd/<hex>), files are written to a temp file and renamed into
+// place, so a reader never sees a partial object and equal uploads share one file.
+type LocalStorage struct {
+	cfg LocalConfig
+}
+
+func NewLocalStorage(cfg LocalConfig) (*LocalStorage, error) {
+	if cfg.Root == "" {
+		return nil, errors.New("local storage: root is required")
+	}
+	if len(cfg.SigningKey) < 32 {
+		return nil, errors.New("local storage: signing key must be at least 32 bytes")
+	}
+	if cfg.Bucket == "" {
+		cfg.Bucket = "local"
+	}
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Root = root
+	if err := os.MkdirAll(filepath.Join(root, ".tmp"), 0o750); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{cfg: cfg}, nil
+}
+
+// objectPath maps bucket/key to a file under root and rejects keys escaping it.
+func (l *LocalStorage) objectPath(bucket, key string) (string, error) {
+	if bucket == "" {
+		bucket = l.cfg.Bucket
+	}
+	if bucket == ".tmp" || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", errors.New("invalid bucket")
+	}
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || strings.Contains(key, `\`) || clean != "/"+strings.TrimPrefix(key, "/") {
+		return "", errors.New("invalid key")
+	}
+	return filepath.Join(l.cfg.Root, bucket, filepath.FromSlash(clean)), nil
+}
+
+func (l *LocalStorage) UploadStream(ctx context.Context, filename string, r io.Reader, size int64, contentType string) (FileUploadResult, error) {
+	tmp, err := os.CreateTemp(filepath.Join(l.cfg.Root, ".tmp"), "upload-*")
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	// after a successful rename the temp name no longer exists and Remove is a no-op
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), &ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	if size >= 0 && n != size {
+		return FileUploadResult{}, errors.New("local storage: size mismatch")
+	}
+	if err := tmp.Sync(); err != nil {
+		return FileUploadResult{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return FileUploadResult{}, err
+	}
+
+	sha := hex.EncodeToString(h.Sum(nil))
+	key := contentKey(l.cfg.Prefix, sha)
+	dst, err := l.objectPath(l.cfg.Bucket, key)
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return FileUploadResult{}, err
+	}
+	// same content is already stored: keep the existing file, but bump its modification
+	// time so the GC grace period covers the new reference as it does a new file
+	if _, err := os.Stat(dst); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(tmp.Name(), dst); err != nil {
+			return FileUploadResult{}, err
+		}
+	} else if err != nil {
+		return FileUploadResult{}, err
+	} else {
+		now := time.Now()
+		if err := os.Chtimes(dst, now, now); err != nil {
+			return FileUploadResult{}, err
+		}
+	}
+
+	return FileUploadResult{
+		Provider: "local",
+		Bucket:   l.cfg.Bucket,
+		Key:      key,
+		Mime:     contentType,
+		Size:     n,
+		Sha256:   sha,
+	}, nil
+}
+
+// SignedURL returns <BaseURL>/storage/local/<bucket>/<key>?expires=<unix>&signature=<hmac>.
+func (l *LocalStorage) SignedURL(ctx context.Context, bucket, key string, expirySeconds int) (string, error) {
+	if bucket == "" {
+		bucket = l.cfg.Bucket
+	}
+	if _, err := l.objectPath(bucket, key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(time.Duration(expirySeconds)*time.Second).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", l.sign(bucket, key, expires))
+	u := strings.TrimRight(l.cfg.BaseURL, "/") + LocalURLPrefix + "/" + url.PathEscape(bucket) + "/" + escapeKey(key)
+	return u + "?" + q.Encode(), nil
+}
+
+func (l *LocalStorage) sign(bucket, key, expires string) string {
+	mac := hmac.New(sha256.New, l.cfg.SigningKey)
+	mac.Write([]byte(bucket + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *LocalStorage) Open(ctx context.Context, bucket, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ObjectInfo{}, ErrObjectNotFound
+		}
+		return nil, ObjectInfo{}, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return f, ObjectInfo{Size: st.Size(), LastModified: st.ModTime()}, nil
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, bucket, key string) error {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks root/<bucket>; keys are slash-separated paths relative to the bucket directory.
+func (l *LocalStorage) List(ctx context.Context, prefix string, fn func(ObjectEntry) error) error {
+	base := filepath.Join(l.cfg.Root, l.cfg.Bucket)
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		return fn(ObjectEntry{Bucket: l.cfg.Bucket, Key: key, Size: info.Size(), LastModified: info.ModTime()})
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP serves GET/HEAD LocalURLPrefix/<bucket>/<key> for URLs issued by SignedURL
+// and PUT for URLs issued by PresignUpload.
+func (l *LocalStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, LocalURLPrefix+"/")
+	bucket, key, ok := strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	expires := q.Get("expires")
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+	want := l.sign(bucket, key, expires)
+	if r.Method == http.MethodPut {
+		want = l.signPut(bucket, key, expires, q.Get("size"), r.Header.Get("Content-Type"))
+	}
+	if subtle.ConstantTimeCompare([]byte(want), []byte(q.Get("signature"))) != 1 {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodPut {
+		l.servePut(w, r, bucket, key, q.Get("size"))
+		return
+	}
+
+	f, info, err := l.Open(r.Context(), bucket, key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "failed to open file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// No content type is stored next to the object, and the bytes are user-supplied:
+	// never let ServeContent sniff them, always download and sandbox.
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=0")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, path.Base(key), info.LastModified, f)
+}
+
+// multipartDir holds the parts of an unfinished upload: root/.tmp/multipart-<id>/<number>.
+func (l *LocalStorage) multipartDir(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", errors.New("invalid upload id")
+	}
+	return filepath.Join(l.cfg.Root, ".tmp", "multipart-"+uploadID), nil
+}
+
+func (l *LocalStorage) NewMultipartUpload(ctx context.Context, filename, contentType string) (MultipartUpload, error) {
+	id, err := randomID()
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+	dir, err := l.multipartDir(id)
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+	if err := os.Mkdir(dir, 0o750); err != nil {
+		return MultipartUpload{}, err
+	}
+	// окончательный ключ станет известен по содержимому в CompleteMultipartUpload
+	return MultipartUpload{Bucket: l.cfg.Bucket, Key: path.Base(filename), UploadID: id}, nil
+}
+
+func (l *LocalStorage) PutPart(ctx context.Context, u MultipartUpload, number int, r io.Reader, size int64) (UploadedPart, error) {
+	dir, err := l.multipartDir(u.UploadID)
+	if err != nil {
+		return UploadedPart{}, err
+	}
+	if number < 1 {
+		return UploadedPart{}, errors.New("invalid part number")
+	}
+	tmp, err := os.CreateTemp(dir, "part-*")
+	if err != nil {
+		return UploadedPart{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), &ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		return UploadedPart{}, err
+	}
+	if size >= 0 && n != size {
+		return UploadedPart{}, errors.New("local storage: size mismatch")
+	}
+	if err := tmp.Sync(); err != nil {
+		return UploadedPart{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return UploadedPart{}, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(number))); err != nil {
+		return UploadedPart{}, err
+	}
+	return UploadedPart{Number: number, ETag: hex.EncodeToString(h.Sum(nil)), Size: n}, nil
+}
+
+// CompleteMultipartUpload concatenates the parts through UploadStream, so the result is
+// content-addressed like any other local object.
+func (l *LocalStorage) CompleteMultipartUpload(ctx context.Context, u MultipartUpload, parts []UploadedPart, contentType string) (FileUploadResult, error) {
+	dir, err := l.multipartDir(u.UploadID)
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	var size int64
+	for _, p := range parts {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(p.Number)))
+		if err != nil {
+			return FileUploadResult{}, fmt.Errorf("local storage: part %d: %w", p.Number, err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+		size += p.Size
+	}
+	res, err := l.UploadStream(ctx, u.Key, io.MultiReader(readers...), size, contentType)
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return FileUploadResult{}, err
+	}
+	return res, nil
+}
+
+func (l *LocalStorage) AbortMultipartUpload(ctx context.Context, u MultipartUpload) error {
+	dir, err := l.multipartDir(u.UploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// MinPartSize: parts are plain files, any size will do.
+func (l *LocalStorage) MinPartSize() int64 {
+	return 1
+}
+
+// PresignUpload: the signature covers the key, size and Content-Type, so the PUT must
+// carry exactly the declared length and type.
+func (l *LocalStorage) PresignUpload(ctx context.Context, filename, contentType string, size int64, expiry time.Duration) (PresignedUpload, error) {
+	id, err := randomID()
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+	key := strings.TrimPrefix(strings.Trim(l.cfg.Prefix, "/")+"/tmp/"+id+"/"+path.Base(filename), "/")
+	if _, err := l.objectPath(l.cfg.Bucket, key); err != nil {
+		return PresignedUpload{}, err
+	}
+	expiresAt := time.Now().Add(expiry)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	sizeStr := strconv.FormatInt(size, 10)
+
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("size", sizeStr)
+	q.Set("signature", l.signPut(l.cfg.Bucket, key, expires, sizeStr, contentType))
+	u := strings.TrimRight(l.cfg.BaseURL, "/") + LocalURLPrefix + "/" + url.PathEscape(l.cfg.Bucket) + "/" + escapeKey(key)
+	return PresignedUpload{
+		Method:    http.MethodPut,
+		URL:       u + "?" + q.Encode(),
+		Headers:   map[string]string{"Content-Type": contentType},
+		Bucket:    l.cfg.Bucket,
+		Key:       key,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (l *LocalStorage) signPut(bucket, key, expires, size, contentType string) string {
+	return l.sign(bucket, key, "PUT\n"+expires+"\n"+size+"\n"+contentType)
+}
+
+// servePut stores the request body at bucket/key (temp file + rename).
+func (l *LocalStorage) servePut(w http.ResponseWriter, r *http.Request, bucket, key, size string) {
+	want, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || r.ContentLength != want {
+		http.Error(w, "content length does not match the signed size", http.StatusBadRequest)
+		return
+	}
+	dst, err := l.objectPath(bucket, key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// large bodies outlive the server's ReadTimeout; the link itself is already bounded
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(localPutTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(localPutTimeout))
+
+	tmp, err := os.CreateTemp(filepath.Join(l.cfg.Root, ".tmp"), "put-*")
+	if err != nil {
+		http.Error(w, "failed to store file", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	n, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, want))
+	if err != nil || n != want {
+		http.Error(w, "incomplete body", http.StatusBadRequest)
+		return
+	}
+	if err := tmp.Sync(); err != nil {
+		http.Error(w, "failed to store file", http.StatusInternalServerError)
+		return
+	}
+	tmp.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		http.Error(w, "failed to store file", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		http.Error(w, "failed to store file", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Stat: local objects keep no content type.
+func (l *LocalStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	p, err := l.objectPath(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	st, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: st.Size(), LastModified: st.ModTime()}, nil
+}
+
+// Promote re-stores the object through UploadStream; objects assembled by
+// CompleteMultipartUpload are content-addressed already and are returned as is.
+func (l *LocalStorage) Promote(ctx context.Context, bucket, key, sum, contentType string) (FileUploadResult, error) {
+	if bucket == "" {
+		bucket = l.cfg.Bucket
+	}
+	if !validSha256(sum) {
+		return FileUploadResult{}, errors.New("local storage: invalid sha256")
+	}
+	if bucket == l.cfg.Bucket && key == contentKey(l.cfg.Prefix, sum) {
+		info, err := l.Stat(ctx, bucket, key)
+		if err != nil {
+			return FileUploadResult{}, err
+		}
+		return FileUploadResult{Provider: "local", Bucket: bucket, Key: key, Mime: contentType, Size: info.Size, Sha256: sum}, nil
+	}
+
+	f, info, err := l.Open(ctx, bucket, key)
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	defer f.Close()
+	res, err := l.UploadStream(ctx, key, f, info.Size, contentType)
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	if res.Sha256 != sum {
+		return FileUploadResult{}, fmt.Errorf("local storage: %s/%s changed: sha256 %s, expected %s", bucket, key, res.Sha256, sum)
+	}
+	return res, nil
+}
+
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// ctxReader stops a long copy when the request is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocalStorage(t *testing.T) *LocalStorage {
+	t.Helper()
+	l, err := NewLocalStorage(LocalConfig{
+		Root:       t.TempDir(),
+		Bucket:     "archive",
+		Prefix:     "documents/",
+		SigningKey: []byte(strings.Repeat("k", 32)),
+	})
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return l
+}
+
+func TestNewLocalStorageValidation(t *testing.T) {
+	if _, err := NewLocalStorage(LocalConfig{SigningKey: make([]byte, 32)}); err == nil {
+		t.Fatal("empty root must be rejected")
+	}
+	if _, err := NewLocalStorage(LocalConfig{Root: t.TempDir(), SigningKey: make([]byte, 31)}); err == nil {
+		t.Fatal("short signing key must be rejected")
+	}
+}
+
+func TestLocalObjectPath(t *testing.T) {
+	l := newTestLocalStorage(t)
+	tests := []struct {
+		name   string
+		bucket string
+		key    string
+		want   string // relative to root; empty means the key is rejected
+	}{
+		{name: "content key", bucket: "archive", key: "documents/sha256/ab/cd/abcd", want: "archive/documents/sha256/ab/cd/abcd"},
+		{name: "default bucket", key: "documents/a.pdf", want: "archive/documents/a.pdf"},
+		{name: "leading slash", bucket: "archive", key: "/documents/a.pdf", want: "archive/documents/a.pdf"},
+		{name: "empty key", bucket: "archive", key: ""},
+		{name: "root key", bucket: "archive", key: "/"},
+		{name: "parent traversal", bucket: "archive", key: "../secret"},
+		{name: "nested traversal", bucket: "archive", key: "documents/../../secret"},
+		{name: "dot segment", bucket: "archive", key: "documents/./a.pdf"},
+		{name: "double slash", bucket: "archive", key: "documents//a.pdf"},
+		{name: "trailing slash", bucket: "archive", key: "documents/"},
+		{name: "backslash", bucket: "archive", key: `documents\..\secret`},
+		{name: "temp bucket", bucket: ".tmp", key: "put-1"},
+		{name: "parent bucket", bucket: "..", key: "secret"},
+		{name: "dot bucket", bucket: ".", key: "secret"},
+		{name: "bucket with slash", bucket: "archive/../x", key: "secret"},
+		{name: "bucket with backslash", bucket: `archive\x`, key: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.objectPath(tt.bucket, tt.key)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("objectPath(%q, %q) = %q, want an error", tt.bucket, tt.key, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("objectPath(%q, %q): %v", tt.bucket, tt.key, err)
+			}
+			if want := filepath.Join(l.cfg.Root, filepath.FromSlash(tt.want)); got != want {
+				t.Fatalf("objectPath(%q, %q) = %q, want %q", tt.bucket, tt.key, got, want)
+			}
+		})
+	}
+}
+
+func TestLocalSign(t *testing.T) {
+	l := newTestLocalStorage(t)
+	other, err := NewLocalStorage(LocalConfig{Root: t.TempDir(), SigningKey: []byte(strings.Repeat("o", 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := l.sign("archive", "documents/a.pdf", "100")
+	if base != l.sign("archive", "documents/a.pdf", "100") {
+		t.Fatal("sign must be deterministic")
+	}
+	tests := []struct {
+		name string
+		sig  string
+	}{
+		{name: "bucket", sig: l.sign("other", "documents/a.pdf", "100")},
+		{name: "key", sig: l.sign("archive", "documents/b.pdf", "100")},
+		{name: "expires", sig: l.sign("archive", "documents/a.pdf", "101")},
+		{name: "field boundary", sig: l.sign("archive\ndocuments", "a.pdf", "100")},
+		{name: "signing key", sig: other.sign("archive", "documents/a.pdf", "100")},
+		{name: "put", sig: l.signPut("archive", "documents/a.pdf", "100", "", "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sig == base {
+				t.Fatalf("changing %s must change the signature", tt.name)
+			}
+		})
+	}
+}
+
+func TestLocalSignPut(t *testing.T) {
+	l := newTestLocalStorage(t)
+	base := l.signPut("archive", "documents/tmp/1/a.pdf", "100", "5", "application/pdf")
+	if base != l.signPut("archive", "documents/tmp/1/a.pdf", "100", "5", "application/pdf") {
+		t.Fatal("signPut must be deterministic")
+	}
+	tests := []struct {
+		name string
+		sig  string
+	}{
+		{name: "bucket", sig: l.signPut("other", "documents/tmp/1/a.pdf", "100", "5", "application/pdf")},
+		{name: "key", sig: l.signPut("archive", "documents/tmp/1/b.pdf", "100", "5", "application/pdf")},
+		{name: "expires", sig: l.signPut("archive", "documents/tmp/1/a.pdf", "101", "5", "application/pdf")},
+		{name: "size", sig: l.signPut("archive", "documents/tmp/1/a.pdf", "100", "6", "application/pdf")},
+		{name: "content type", sig: l.signPut("archive", "documents/tmp/1/a.pdf", "100", "5", "text/html")},
+		{name: "get signature", sig: l.sign("archive", "documents/tmp/1/a.pdf", "100")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sig == base {
+				t.Fatalf("changing %s must change the signature", tt.name)
+			}
+		})
+	}
+}
+
+func TestLocalServeHTTPSignature(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocalStorage(t)
+	res, err := l.UploadStream(ctx, "a.pdf", strings.NewReader("hello"), 5, "application/pdf")
+	if err != nil {
+		t.Fatalf("UploadStream: %v", err)
+	}
+	signed, err := l.SignedURL(ctx, res.Bucket, res.Key, 60)
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(name, value string) string {
+		q := u.Query()
+		q.Set(name, value)
+		return u.Path + "?" + q.Encode()
+	}
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{name: "valid link", target: u.RequestURI(), status: http.StatusOK},
+		{name: "tampered signature", target: with("signature", strings.Repeat("0", 64)), status: http.StatusForbidden},
+		{name: "extended expiry", target: with("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)), status: http.StatusForbidden},
+		{name: "expired", target: with("expires", expired) + "&signature=" + l.sign(res.Bucket, res.Key, expired), status: http.StatusForbidden},
+		{name: "other key", target: strings.Replace(u.Path, res.Key, res.Key+"x", 1) + "?" + u.RawQuery, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			l.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if w.Body.String() != "hello" {
+				t.Fatalf("body = %q", w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/octet-stream" {
+				t.Fatalf("Content-Type = %q", ct)
+			}
+			if csp := w.Header().Get("Content-Security-Policy"); csp != "sandbox" {
+				t.Fatalf("Content-Security-Policy = %q", csp)
+			}
+		})
+	}
+}
+
+func TestLocalServeHTTPPut(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocalStorage(t)
+	body := []byte("hello")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		{name: "declared type and size", contentType: "application/pdf", body: body, status: http.StatusOK},
+		{name: "other content type", contentType: "text/html", body: body, status: http.StatusForbidden},
+		{name: "other size", contentType: "application/pdf", body: []byte("hello!"), status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := l.PresignUpload(ctx, "a.pdf", "application/pdf", int64(len(body)), time.Minute)
+			if err != nil {
+				t.Fatalf("PresignUpload: %v", err)
+			}
+			r := httptest.NewRequest(http.MethodPut, p.URL, bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			l.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			_, err = l.Stat(ctx, p.Bucket, p.Key)
+			if stored := err == nil; stored != (tt.status == http.StatusOK) {
+				t.Fatalf("object stored = %v, Stat err = %v", stored, err)
+			}
+		})
+	}
+}
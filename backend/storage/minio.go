@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
+	"net/http"
 	"net/url"
 	"path"
 	"strings"
@@ -41,31 +43,26 @@ func NewMinioStorage(cfg MinioConfig) (*MinioStorage, error) {
 	return &MinioStorage{client: mc, cfg: cfg}, nil
 }
 
+// UploadStream writes to a temporary key while hashing, then promotes the object to its
+// content-addressed key; an upload of content that is already stored only drops the temp object.
 func (m *MinioStorage) UploadStream(ctx context.Context, filename string, r io.Reader, size int64, contentType string) (FileUploadResult, error) {
-	name := path.Base(filename)
-	now := time.Now().UTC().Format("20060102-150405")
-	key := strings.Trim(m.cfg.Prefix, "/") + "/" + now + "-" + name
-	key = strings.TrimPrefix(key, "/")
+	tmp, err := m.tempKey(filename)
+	if err != nil {
+		return FileUploadResult{}, err
+	}
 
 	// hash while streaming
 	h := sha256.New()
 	tee := io.TeeReader(r, h)
 
 	opts := minio.PutObjectOptions{ContentType: contentType}
-	info, err := m.client.PutObject(ctx, m.cfg.Bucket, key, tee, size, opts)
-	if err != nil {
+	if _, err := m.client.PutObject(ctx, m.cfg.Bucket, tmp, tee, size, opts); err != nil {
 		return FileUploadResult{}, err
 	}
+	// a temp object left behind by a failed promote is removed by storage GC
+	defer m.client.RemoveObject(context.WithoutCancel(ctx), m.cfg.Bucket, tmp, minio.RemoveObjectOptions{})
 
-	sha := hex.EncodeToString(h.Sum(nil))
-	return FileUploadResult{
-		Provider: "minio",
-		Bucket:   m.cfg.Bucket,
-		Key:      key,
-		Mime:     contentType,
-		Size:     info.Size,
-		Sha256:   sha,
-	}, nil
+	return m.Promote(ctx, m.cfg.Bucket, tmp, hex.EncodeToString(h.Sum(nil)), contentType)
 }
 
 func (m *MinioStorage) SignedURL(ctx context.Context, bucket, key string, expirySeconds int) (string, error) {
@@ -81,3 +78,207 @@ func (m *MinioStorage) SignedURL(ctx context.Context, bucket, key string, expiry
 	}
 	return u.String(), nil
 }
+
+func (m *MinioStorage) Open(ctx context.Context, bucket, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	if bucket == "" {
+		bucket = m.cfg.Bucket
+	}
+	obj, err := m.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	// GetObject is lazy: Stat performs the request and reports a missing key
+	st, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ObjectInfo{}, ErrObjectNotFound
+		}
+		return nil, ObjectInfo{}, err
+	}
+	return obj, ObjectInfo{Size: st.Size, ContentType: st.ContentType, LastModified: st.LastModified}, nil
+}
+
+func (m *MinioStorage) Delete(ctx context.Context, bucket, key string) error {
+	if bucket == "" {
+		bucket = m.cfg.Bucket
+	}
+	// RemoveObject does not fail on a missing key
+	return m.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (m *MinioStorage) List(ctx context.Context, prefix string, fn func(ObjectEntry) error) error {
+	// cancelling the context stops the listing goroutine
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for obj := range m.client.ListObjects(ctx, m.cfg.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if err := fn(ObjectEntry{Bucket: m.cfg.Bucket, Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// minioMinPartSize: S3 requires every part but the last to be at least 5 MiB
+const minioMinPartSize = 5 << 20
+
+func (m *MinioStorage) core() minio.Core {
+	return minio.Core{Client: m.client}
+}
+
+// NewMultipartUpload assembles the object under a temporary key; it gets its permanent
+// key from Promote once the hash is known.
+func (m *MinioStorage) NewMultipartUpload(ctx context.Context, filename, contentType string) (MultipartUpload, error) {
+	key, err := m.tempKey(filename)
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+	id, err := m.core().NewMultipartUpload(ctx, m.cfg.Bucket, key, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+	return MultipartUpload{Bucket: m.cfg.Bucket, Key: key, UploadID: id}, nil
+}
+
+func (m *MinioStorage) PutPart(ctx context.Context, u MultipartUpload, number int, r io.Reader, size int64) (UploadedPart, error) {
+	p, err := m.core().PutObjectPart(ctx, u.Bucket, u.Key, u.UploadID, number, r, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return UploadedPart{}, err
+	}
+	return UploadedPart{Number: p.PartNumber, ETag: p.ETag, Size: p.Size}, nil
+}
+
+func (m *MinioStorage) CompleteMultipartUpload(ctx context.Context, u MultipartUpload, parts []UploadedPart, contentType string) (FileUploadResult, error) {
+	complete := make([]minio.CompletePart, 0, len(parts))
+	var size int64
+	for _, p := range parts {
+		complete = append(complete, minio.CompletePart{PartNumber: p.Number, ETag: p.ETag})
+		size += p.Size
+	}
+	if _, err := m.core().CompleteMultipartUpload(ctx, u.Bucket, u.Key, u.UploadID, complete, minio.PutObjectOptions{ContentType: contentType}); err != nil {
+		return FileUploadResult{}, err
+	}
+	return FileUploadResult{
+		Provider: "minio",
+		Bucket:   u.Bucket,
+		Key:      u.Key,
+		Mime:     contentType,
+		Size:     size,
+	}, nil
+}
+
+func (m *MinioStorage) AbortMultipartUpload(ctx context.Context, u MultipartUpload) error {
+	err := m.core().AbortMultipartUpload(ctx, u.Bucket, u.Key, u.UploadID)
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return nil
+	}
+	return err
+}
+
+func (m *MinioStorage) MinPartSize() int64 {
+	return minioMinPartSize
+}
+
+// tempKey is where an upload lands before it is promoted: <prefix>/tmp/<random>/<name>.
+func (m *MinioStorage) tempKey(filename string) (string, error) {
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	key := strings.Trim(m.cfg.Prefix, "/") + "/tmp/" + id + "/" + path.Base(filename)
+	return strings.TrimPrefix(key, "/"), nil
+}
+
+// PresignUpload signs Content-Type into the URL, so MinIO rejects a PUT with another type.
+func (m *MinioStorage) PresignUpload(ctx context.Context, filename, contentType string, size int64, expiry time.Duration) (PresignedUpload, error) {
+	key, err := m.tempKey(filename)
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	u, err := m.client.PresignHeader(ctx, http.MethodPut, m.cfg.Bucket, key, expiry, url.Values{}, headers)
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+	return PresignedUpload{
+		Method:    http.MethodPut,
+		URL:       u.String(),
+		Headers:   map[string]string{"Content-Type": contentType},
+		Bucket:    m.cfg.Bucket,
+		Key:       key,
+		ExpiresAt: time.Now().Add(expiry),
+	}, nil
+}
+
+func (m *MinioStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	if bucket == "" {
+		bucket = m.cfg.Bucket
+	}
+	st, err := m.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectInfo{}, ErrObjectNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Size: st.Size, ContentType: st.ContentType, LastModified: st.LastModified}, nil
+}
+
+// Promote is a server-side copy; ComposeObject switches to multipart copy for objects over
+// 5 GiB. If the content is already stored, the existing object is copied onto itself
+// instead: that refreshes its modification time, so the GC grace period covers the new
+// reference as it does a new object.
+func (m *MinioStorage) Promote(ctx context.Context, bucket, key, sum, contentType string) (FileUploadResult, error) {
+	if bucket == "" {
+		bucket = m.cfg.Bucket
+	}
+	if !validSha256(sum) {
+		return FileUploadResult{}, errors.New("minio storage: invalid sha256")
+	}
+	dst := contentKey(m.cfg.Prefix, sum)
+
+	src := minio.CopySrcOptions{Bucket: m.cfg.Bucket, Object: dst}
+	st, err := m.client.StatObject(ctx, m.cfg.Bucket, dst, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			return FileUploadResult{}, err
+		}
+		src = minio.CopySrcOptions{Bucket: bucket, Object: key}
+		if st, err = m.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{}); err != nil {
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				return FileUploadResult{}, ErrObjectNotFound
+			}
+			return FileUploadResult{}, err
+		}
+	}
+
+	// a copy onto itself is only allowed with replaced metadata; keep the stored type
+	storedType := st.ContentType
+	if storedType == "" {
+		storedType = contentType
+	}
+	_, err = m.client.ComposeObject(ctx,
+		minio.CopyDestOptions{
+			Bucket:          m.cfg.Bucket,
+			Object:          dst,
+			ReplaceMetadata: true,
+			UserMetadata:    map[string]string{"Content-Type": storedType},
+		},
+		src,
+	)
+	if err != nil {
+		return FileUploadResult{}, err
+	}
+	return FileUploadResult{
+		Provider: "minio",
+		Bucket:   m.cfg.Bucket,
+		Key:      dst,
+		Mime:     contentType,
+		Size:     st.Size,
+		Sha256:   sum,
+	}, nil
+}
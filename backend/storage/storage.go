@@ -2,9 +2,17 @@ package storage
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"io"
+	"strings"
+	"time"
 )
 
+// ErrObjectNotFound is returned by Open when the object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
 type FileUploadResult struct {
 	Provider string
 	Bucket   string
@@ -14,9 +22,104 @@ type FileUploadResult struct {
 	Sha256   string
 }
 
+// ObjectInfo describes a stored object opened for reading.
+type ObjectInfo struct {
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ObjectEntry is one object reported by List.
+type ObjectEntry struct {
+	Bucket       string
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// MultipartUpload identifies an object being assembled from parts.
+type MultipartUpload struct {
+	Bucket   string
+	Key      string
+	UploadID string
+}
+
+// UploadedPart is a part already accepted by the storage; parts are completed in Number order.
+type UploadedPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// PresignedUpload lets a client put an object straight into the storage: send Method to URL
+// with Headers before ExpiresAt. The object lands at Bucket/Key, a temporary key that the
+// server promotes with Copy after checking it.
+type PresignedUpload struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Bucket    string            `json:"-"`
+	Key       string            `json:"-"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
 type Storage interface {
 	// UploadStream: size can be -1 if unknown, but prefer passing accurate size when available.
 	UploadStream(ctx context.Context, filename string, r io.Reader, size int64, contentType string) (FileUploadResult, error)
 	// SignedURL returns presigned GET URL valid for expirySeconds.
 	SignedURL(ctx context.Context, bucket, key string, expirySeconds int) (string, error)
+	// Open returns a seekable reader over the object, suitable for http.ServeContent.
+	Open(ctx context.Context, bucket, key string) (io.ReadSeekCloser, ObjectInfo, error)
+	// Delete removes the object; a missing object is not an error.
+	Delete(ctx context.Context, bucket, key string) error
+	// List calls fn for every object of the default bucket whose key starts with prefix;
+	// an error from fn stops the listing and is returned.
+	List(ctx context.Context, prefix string, fn func(ObjectEntry) error) error
+
+	// NewMultipartUpload starts an object assembled from parts (resumable uploads).
+	NewMultipartUpload(ctx context.Context, filename, contentType string) (MultipartUpload, error)
+	// PutPart stores part number (1-based); re-sending a number replaces the part.
+	PutPart(ctx context.Context, u MultipartUpload, number int, r io.Reader, size int64) (UploadedPart, error)
+	// CompleteMultipartUpload joins parts into an object. The result key may differ from u.Key
+	// and may still be temporary; Sha256 is empty when the storage does not compute it.
+	CompleteMultipartUpload(ctx context.Context, u MultipartUpload, parts []UploadedPart, contentType string) (FileUploadResult, error)
+	// AbortMultipartUpload discards the parts; an unknown upload is not an error.
+	AbortMultipartUpload(ctx context.Context, u MultipartUpload) error
+	// MinPartSize is the smallest allowed size of every part but the last.
+	MinPartSize() int64
+
+	// PresignUpload issues a PUT URL for a new temporary object; size is informational
+	// (the client may still send anything), so the object must be checked before use.
+	PresignUpload(ctx context.Context, filename, contentType string, size int64, expiry time.Duration) (PresignedUpload, error)
+	// Stat reports the object size and content type; a missing object gives ErrObjectNotFound.
+	Stat(ctx context.Context, bucket, key string) (ObjectInfo, error)
+	// Promote stores bucket/key under its content-addressed key (see contentKey); sum must be
+	// the verified SHA-256 of the object. When that content is already stored the existing object
+	// is reused. The source is left in place: the caller deletes it once the new key is recorded,
+	// unless the result key equals the source key.
+	Promote(ctx context.Context, bucket, key, sum, contentType string) (FileUploadResult, error)
+}
+
+// contentKey is where an object with the given SHA-256 lives: <prefix>/sha256/ab/cd/<hex>.
+// Equal uploads map to one key, so a file attached to many documents is stored once.
+func contentKey(prefix, sha string) string {
+	return strings.TrimPrefix(strings.Trim(prefix, "/")+"/sha256/"+sha[0:2]+"/"+sha[2:4]+"/"+sha, "/")
+}
+
+// validSha256 reports whether s is a lowercase hex SHA-256.
+func validSha256(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// randomID returns 128 random bits in hex for temporary keys and upload ids.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -4,9 +4,40 @@ import (
 	"time"
 )
 
+// Коды прав (таблица permissions); роль — набор прав
+const (
+	PermDocumentsReadAll   = "documents.read_all"
+	PermDocumentsEditAny   = "documents.edit_any"
+	PermDocumentsDeleteAny = "documents.delete_any"
+	PermPermissionsManage  = "permissions.manage"
+	PermLogsRead           = "logs.read"
+	PermDictionariesWrite  = "dictionaries.write"
+	PermUsersManage        = "users.manage"
+	PermRolesManage        = "roles.manage"
+	PermGroupsManage       = "groups.manage"
+	PermStorageAudit       = "storage.audit"
+)
+
+type Permission struct {
+	Code        string `db:"code" json:"code"`
+	Description string `db:"description" json:"description"`
+}
+
 type Role struct {
-	ID   int64  `db:"id" json:"id"`
-	Name string `db:"name" json:"name"`
+	ID          int64    `db:"id" json:"id"`
+	Name        string   `db:"name" json:"name"`
+	Description *string  `db:"description" json:"description,omitempty"`
+	IsSystem    bool     `db:"is_system" json:"is_system"`
+	Permissions []string `db:"permissions" json:"permissions"`
+	UserCount   int64    `db:"user_count" json:"user_count"`
+}
+
+// RoleInput — создание/изменение роли; nil — поле не меняется,
+// Permissions (если задан) заменяет набор прав целиком
+type RoleInput struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
 }
 
 type User struct {
@@ -16,4 +47,62 @@ type User struct {
 	PasswordHash string    `db:"password_hash" json:"-"`
 	FullName     *string   `db:"full_name" json:"full_name,omitempty"`
 	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+
+	RoleName           string `db:"role_name" json:"role_name,omitempty"`
+	Disabled           bool   `db:"disabled" json:"disabled"`
+	MustChangePassword bool   `db:"must_change_password" json:"must_change_password"`
+}
+
+// UserAuthState — то, что проверяется по access-токену на каждом запросе
+type UserAuthState struct {
+	TokensRevokedAt    *time.Time `db:"tokens_revoked_at"`
+	Disabled           bool       `db:"disabled"`
+	MustChangePassword bool       `db:"must_change_password"`
+}
+
+// UserListFilter — параметры списка пользователей для администратора; nil — фильтр не задан
+type UserListFilter struct {
+	Query    string `json:"q,omitempty"` // подстрока логина или имени
+	RoleID   *int64 `json:"role_id,omitempty"`
+	Disabled *bool  `json:"disabled,omitempty"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+}
+
+type UserListResult struct {
+	Items  []User `json:"items"`
+	Total  int64  `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// Group — группа пользователей; доступ к документу можно выдать группе целиком
+type Group struct {
+	ID          int64     `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description *string   `db:"description" json:"description,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	MemberCount int64     `db:"member_count" json:"member_count"`
+	IsMember    bool      `db:"is_member" json:"is_member"`
+}
+
+// GroupInput — создание/изменение группы; nil — поле не меняется
+type GroupInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+type GroupMember struct {
+	UserID   int64     `db:"user_id" json:"user_id"`
+	Login    string    `db:"login" json:"login"`
+	FullName *string   `db:"full_name" json:"full_name,omitempty"`
+	AddedAt  time.Time `db:"added_at" json:"added_at"`
+}
+
+// AdminUserCreateInput — создание пользователя администратором
+type AdminUserCreateInput struct {
+	Login    string  `json:"login"`
+	Password string  `json:"password"`
+	FullName *string `json:"full_name,omitempty"`
+	RoleID   int64   `json:"role_id"`
 }
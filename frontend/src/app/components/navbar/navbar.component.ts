@@ -51,8 +51,7 @@ export class NavbarComponent {
   }
 
   signOut(): void {
-    this.auth.clearToken();
-    this.router.navigateByUrl(PathWithSlash(RoutesPath.SignIn));
+    this.auth.signOut().subscribe(() => this.router.navigateByUrl(PathWithSlash(RoutesPath.SignIn)));
   }
 
   menuToggleClick(): void {
@@ -17,6 +17,8 @@ export interface SignInInput {
 
 export interface TokenResponse {
   token?: string;
+  refresh_token?: string;
+  expires_in?: number;
 }
 
 export interface AuthResponse extends TokenResponse {
@@ -24,6 +26,7 @@ export interface AuthResponse extends TokenResponse {
 }
 
 const TOKEN_KEY = 'auth_token';
+const REFRESH_TOKEN_KEY = 'auth_refresh_token';
 
 @Injectable({ providedIn: 'root' })
 export class AuthService {
@@ -42,16 +45,17 @@ export class AuthService {
 
   updateToken(): Observable<TokenResponse> {
     const token = this.getToken();
-    if (token) {
+    const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+    if (token && refreshToken) {
       this.token.set(token);
-      return this.http.post<TokenResponse>(`/auth/refresh-token`, {}).pipe(catchError((err) => {
+      return this.http.post<TokenResponse>(`/auth/refresh-token`, { refresh_token: refreshToken }).pipe(catchError((err) => {
         this.informerSrv.error(err?.error?.message, 'Ошибка проверки токена');
         this.clearToken();
         return of(null);
       }),
         tap((newToken) => {
           if (newToken?.token) {
-            this.saveToken(newToken.token);
+            this.saveToken(newToken);
           }
         })
       );
@@ -61,9 +65,22 @@ export class AuthService {
     }
   }
 
-  saveToken(token: string): void {
-    localStorage.setItem(TOKEN_KEY, token);
-    this.token.set(token);
+  signOut(): Observable<unknown> {
+    const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+    this.clearToken();
+    if (!refreshToken) {
+      return of(null);
+    }
+    return this.http.post(`/auth/logout`, { refresh_token: refreshToken }).pipe(catchError(() => of(null)));
+  }
+
+  saveToken(res: TokenResponse): void {
+    if (!res.token) return;
+    localStorage.setItem(TOKEN_KEY, res.token);
+    if (res.refresh_token) {
+      localStorage.setItem(REFRESH_TOKEN_KEY, res.refresh_token);
+    }
+    this.token.set(res.token);
   }
 
   getToken(): string | null {
@@ -72,6 +89,7 @@ export class AuthService {
 
   clearToken(): void {
     localStorage.removeItem(TOKEN_KEY);
+    localStorage.removeItem(REFRESH_TOKEN_KEY);
     this.token.set(null);
   }
 
@@ -47,7 +47,7 @@ export class SignInComponent {
       takeUntilDestroyed(this.destroyRef)).subscribe({
         next: (res) => {
           if (res?.token) {
-            this.auth.saveToken(res.token);
+            this.auth.saveToken(res);
             this.router.navigateByUrl(PathWithSlash(RoutesPath.Dashboard));
           }
         },
@@ -58,7 +58,7 @@ export class SignUpComponent {
       takeUntilDestroyed(this.destroyRef)).subscribe({
         next: (res) => {
           if (res?.token) {
-            this.auth.saveToken(res.token);
+            this.auth.saveToken(res);
             this.router.navigateByUrl(PathWithSlash(RoutesPath.Dashboard));
           }
         },
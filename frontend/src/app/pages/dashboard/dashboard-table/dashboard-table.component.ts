@@ -20,6 +20,7 @@ import { MatIconModule } from '@angular/material/icon';
 export class DashboardTableComponent implements AfterViewInit {
   @ViewChild(MatSort) sort: MatSort;
   rowSelected = output<ArchiveDocument>();
+  scrolledBottom = output<void>();
   documents = input<ArchiveDocument[]>([]);
   filter = input<string>('');
   readonly selected = signal<ArchiveDocument | null>(null);
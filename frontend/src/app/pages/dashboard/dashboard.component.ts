@@ -1,6 +1,6 @@
 import { ChangeDetectionStrategy, Component, DestroyRef, inject, OnInit, signal, ViewContainerRef } from '@angular/core';
-import { ArchiveDocument, DashboardService } from './services/dashboard.service';
-import { catchError, filter, mergeMap, of, Subject } from 'rxjs';
+import { ArchiveDocument, DashboardService, DocumentSearchResult } from './services/dashboard.service';
+import { catchError, exhaustMap, filter, of, Subject, switchMap } from 'rxjs';
 import { MatButtonModule } from '@angular/material/button';
 import { MatIconModule } from '@angular/material/icon';
 import { LoadingBarService } from '@core/loading-bar/loading-bar.service';
@@ -35,21 +35,42 @@ export class DashboardComponent implements OnInit {
   readonly isLoading = toSignal(this.loadingBarSrv.show$);
 
   private readonly reload$ = new Subject<void>();
+  private readonly loadMore$ = new Subject<void>();
   readonly documents = signal<ArchiveDocument[]>([]);
+  // курсор следующей страницы; null — загружено всё
+  private readonly nextCursor = signal<string | null>(null);
+  private generation = 0;
   readonly filter = signal('');
   readonly selectedDoc = signal<ArchiveDocument | null>(null);
 
   constructor() {
     this.reload$.pipe(
-      mergeMap(() => this.documentService.getALLDocuments().pipe(this.loadingBarSrv.withLoading(), catchError((err) => {
+      switchMap(() => this.documentService.getDocuments().pipe(this.loadingBarSrv.withLoading(), catchError((err) => {
         this.informerSrv.error(err?.error?.message, 'Ошибка получения документов');
         return of(null);
       }))),
       takeUntilDestroyed(this.destroyRef)
-    ).subscribe((documents) => {
-      this.documents.set(documents || []);
-      console.log(documents);
-    })
+    ).subscribe((page) => {
+      this.documents.set(page?.items || []);
+      this.nextCursor.set(page?.next_cursor || null);
+    });
+
+    // следующая страница подгружается только после того, как пришла предыдущая;
+    // страница, запрошенная до refresh, отбрасывается
+    this.loadMore$.pipe(
+      filter(() => !!this.nextCursor()),
+      exhaustMap(() => {
+        const generation = this.generation;
+        return this.documentService.getDocuments(this.nextCursor() ?? undefined).pipe(this.loadingBarSrv.withLoading(), catchError((err) => {
+          this.informerSrv.error(err?.error?.message, 'Ошибка получения документов');
+          return of(null);
+        }), filter((page): page is DocumentSearchResult => !!page && generation === this.generation));
+      }),
+      takeUntilDestroyed(this.destroyRef)
+    ).subscribe((page) => {
+      this.documents.update(docs => docs.concat(page.items));
+      this.nextCursor.set(page.next_cursor || null);
+    });
   }
 
   ngOnInit(): void {
@@ -57,9 +78,14 @@ export class DashboardComponent implements OnInit {
   }
 
   refresh(): void {
+    this.generation++;
     this.reload$.next();
   }
 
+  loadMore(): void {
+    this.loadMore$.next();
+  }
+
   selectDocument(document: ArchiveDocument): void {
 
     if (!document) {
@@ -90,7 +116,6 @@ export class DashboardComponent implements OnInit {
     })
       .afterClosed()
       .pipe(filter(Boolean),
-        mergeMap(() => this.documentService.getALLDocuments().pipe(this.loadingBarSrv.withLoading())),
         takeUntilDestroyed(this.destroyRef)
       ).subscribe({
         next: () => {
@@ -110,7 +135,6 @@ export class DashboardComponent implements OnInit {
     })
       .afterClosed()
       .pipe(filter(Boolean),
-        mergeMap(() => this.documentService.getALLDocuments().pipe(this.loadingBarSrv.withLoading())),
         takeUntilDestroyed(this.destroyRef)
       ).subscribe({
         next: () => {
@@ -37,14 +37,29 @@ export interface ArchiveDocument {
   geom?: string | null;
 }
 
+export interface DocumentSearchResult {
+  items: ArchiveDocument[];
+  total: number;
+  limit: number;
+  offset: number;
+  sort: string;
+  order: 'asc' | 'desc';
+  next_cursor?: string;
+}
+
+export const DOCUMENTS_PAGE_SIZE = 100;
+
 @Injectable()
 export class DashboardService {
   private readonly http = inject(HttpClient);
   private readonly base = '/api/documents';
   private readonly cachedDocuments = new Map<number, ArchiveDocument>();
 
-  getALLDocuments(): Observable<ArchiveDocument[]> {
-    return this.http.get<ArchiveDocument[]>(this.base);
+  // одна страница поиска; следующая — по next_cursor, когда таблицу прокрутили до конца
+  getDocuments(cursor?: string): Observable<DocumentSearchResult> {
+    return this.http.get<DocumentSearchResult>(this.base, {
+      params: cursor ? { limit: DOCUMENTS_PAGE_SIZE, cursor } : { limit: DOCUMENTS_PAGE_SIZE },
+    });
   }
 
   getDocumentById(id: number, forceUpd?: boolean): Observable<ArchiveDocument> {